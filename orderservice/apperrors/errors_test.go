@@ -0,0 +1,67 @@
+package apperrors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKindOf(t *testing.T) {
+	cause := errors.New("duplicate key")
+	err := fmt.Errorf("saving: %w", Conflict("customer already exists", cause))
+
+	assert.Equal(t, KindConflict, KindOf(err))
+	assert.True(t, Is(err, KindConflict))
+	assert.ErrorIs(t, err, cause)
+	assert.Equal(t, KindInternal, KindOf(errors.New("boom")))
+	assert.False(t, Is(nil, KindInternal))
+}
+
+func TestProblemFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		detail string
+	}{
+		{"Not found", NotFound("order not found", nil), http.StatusNotFound, "order not found"},
+		{"Conflict", Conflict("customer already exists", nil), http.StatusConflict, "customer already exists"},
+		{"Validation", Validation("invalid order ID"), http.StatusBadRequest, "invalid order ID"},
+		{"Unauthenticated", Unauthenticated("invalid email or password", nil), http.StatusUnauthorized, "invalid email or password"},
+		{"Forbidden", Forbidden("email address has not been verified", nil), http.StatusForbidden, "email address has not been verified"},
+		{"Upstream", Upstream("database unavailable", errors.New("dial tcp")), http.StatusServiceUnavailable, "database unavailable"},
+		{"Untyped errors hide their cause", errors.New("pq: password authentication failed"), http.StatusInternalServerError, "An unexpected error occurred"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problem := ProblemFor(tt.err)
+			assert.Equal(t, tt.status, problem.Status)
+			assert.Equal(t, tt.detail, problem.Detail)
+			assert.Equal(t, http.StatusText(tt.status), problem.Title)
+		})
+	}
+}
+
+func TestRespond(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/customers", nil)
+
+	Respond(c, Validation("invalid customer", FieldError{Field: "email", Message: "must be a valid email"}))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+	assert.True(t, c.IsAborted())
+
+	var problem Problem
+	json.Unmarshal(w.Body.Bytes(), &problem)
+	assert.Equal(t, "/problems/validation", problem.Type)
+	assert.Equal(t, "/customers", problem.Instance)
+	assert.Equal(t, "email", problem.Errors[0].Field)
+}
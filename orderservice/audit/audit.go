@@ -0,0 +1,166 @@
+// Package audit attributes recorded actions to whoever made the request
+// and where it came from.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"orderservice/logging"
+	"orderservice/models"
+)
+
+// ActorHeader names the member of staff making a request. It is set by the
+// admin gateway in front of the service.
+const ActorHeader = "X-Actor"
+
+// Actors recorded when no one is named.
+const (
+	Anonymous = "anonymous" // a request without a trusted X-Actor header
+	System    = "system"    // background jobs, outside any request
+)
+
+const maxActorLength = 100
+
+type contextKey int
+
+const sourceKey contextKey = iota
+
+// Source is who made a request and from where.
+type Source struct {
+	Actor string
+	IP    string
+}
+
+// Middleware stores the request's Source in its context. ActorHeader is
+// only believed on requests trusted reports came through the admin gateway
+// or another of our services; anyone else is recorded as Anonymous.
+func Middleware(trusted func(*gin.Context) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor := c.GetHeader(ActorHeader)
+		if !trusted(c) || !validActor(actor) {
+			actor = Anonymous
+		}
+		ctx := WithSource(c.Request.Context(), Source{Actor: actor, IP: c.ClientIP()})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// WithSource returns a copy of ctx carrying source.
+func WithSource(ctx context.Context, source Source) context.Context {
+	return context.WithValue(ctx, sourceKey, source)
+}
+
+// FromContext returns the Source stored in ctx. Outside a request the
+// actor is System.
+func FromContext(ctx context.Context) Source {
+	if source, ok := ctx.Value(sourceKey).(Source); ok {
+		return source
+	}
+	return Source{Actor: System}
+}
+
+// Entry returns an audit entry for action on the entity, attributed to the
+// request in ctx.
+func Entry(ctx context.Context, action, entityType string, entityID uint) *models.AuditEntry {
+	source := FromContext(ctx)
+	return &models.AuditEntry{
+		Actor:      source.Actor,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		RequestID:  logging.RequestID(ctx),
+		SourceIP:   source.IP,
+	}
+}
+
+// recordFields are the gorm.Model fields, which say nothing about what an
+// action changed.
+var recordFields = []string{"ID", "CreatedAt", "UpdatedAt", "DeletedAt"}
+
+var null = json.RawMessage("null")
+
+// Diff returns the fields that differ between before and after, as they
+// are encoded in JSON. Either may be nil, as before a create. Personal
+// fields are shown as models.Redacted unless they are empty.
+func Diff(before, after interface{}, personal ...string) (models.Changes, error) {
+	old, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes models.Changes
+	add := func(name string) {
+		b, a := orNull(old[name]), orNull(updated[name])
+		if slices.Contains(recordFields, name) || bytes.Equal(b, a) {
+			return
+		}
+		if _, done := changes[name]; done {
+			return
+		}
+		if slices.Contains(personal, name) {
+			b, a = redact(b), redact(a)
+		}
+		if changes == nil {
+			changes = models.Changes{}
+		}
+		changes[name] = models.Change{Before: b, After: a}
+	}
+	for name := range old {
+		add(name)
+	}
+	for name := range updated {
+		add(name)
+	}
+	return changes, nil
+}
+
+// fields returns v's JSON object members. A nil v has none.
+func fields(v interface{}) (map[string]json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]json.RawMessage
+	err = json.Unmarshal(data, &m)
+	return m, err
+}
+
+func orNull(v json.RawMessage) json.RawMessage {
+	if v == nil {
+		return null
+	}
+	return v
+}
+
+func redact(v json.RawMessage) json.RawMessage {
+	if bytes.Equal(v, null) || bytes.Equal(v, json.RawMessage(`""`)) {
+		return v
+	}
+	return json.RawMessage(`"` + models.Redacted + `"`)
+}
+
+// validActor rejects names that are empty, oversized or contain anything
+// other than printable ASCII, so callers cannot inject into the log.
+func validActor(actor string) bool {
+	if actor == "" || len(actor) > maxActorLength {
+		return false
+	}
+	for _, r := range actor {
+		if r < ' ' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"orderservice/logging"
+	"orderservice/models"
+)
+
+func TestMiddleware(t *testing.T) {
+	var entry *models.AuditEntry
+	trusted := true
+	router := gin.New()
+	router.Use(logging.Middleware(zap.NewNop()), Middleware(func(*gin.Context) bool { return trusted }))
+	router.POST("/customers/:id/erasure", func(c *gin.Context) {
+		entry = Entry(c.Request.Context(), "customer.erased", "customer", 7)
+		c.Status(http.StatusOK)
+	})
+
+	send := func(actor string) {
+		req := httptest.NewRequest("POST", "/customers/7/erasure", nil)
+		req.RemoteAddr = "192.0.2.10:4000"
+		req.Header.Set(logging.RequestIDHeader, "abc-123")
+		if actor != "" {
+			req.Header.Set(ActorHeader, actor)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	t.Run("Named actor", func(t *testing.T) {
+		send("dpo@example.com")
+		assert.Equal(t, &models.AuditEntry{
+			Actor:      "dpo@example.com",
+			Action:     "customer.erased",
+			EntityType: "customer",
+			EntityID:   7,
+			RequestID:  "abc-123",
+			SourceIP:   "192.0.2.10",
+		}, entry)
+	})
+
+	t.Run("Missing actor", func(t *testing.T) {
+		send("")
+		assert.Equal(t, Anonymous, entry.Actor)
+	})
+
+	t.Run("Untrusted caller", func(t *testing.T) {
+		trusted = false
+		defer func() { trusted = true }()
+		send("dpo@example.com")
+		assert.Equal(t, Anonymous, entry.Actor, "only the gateway names actors")
+	})
+
+	t.Run("Unsafe actor", func(t *testing.T) {
+		send("admin\nforged line")
+		assert.Equal(t, Anonymous, entry.Actor)
+		send(strings.Repeat("x", maxActorLength+1))
+		assert.Equal(t, Anonymous, entry.Actor)
+	})
+}
+
+func TestFromContextOutsideRequest(t *testing.T) {
+	entry := Entry(context.Background(), "order.expired", "order", 3)
+	assert.Equal(t, System, entry.Actor)
+	assert.Empty(t, entry.RequestID)
+	assert.Empty(t, entry.SourceIP)
+}
+
+func TestDiff(t *testing.T) {
+	type record struct {
+		ID     uint
+		Name   string  `json:"name"`
+		Status string  `json:"status"`
+		Total  float64 `json:"total"`
+		Note   *string `json:"note,omitempty"`
+	}
+	note := "gift"
+
+	t.Run("Update", func(t *testing.T) {
+		changes, err := Diff(&record{ID: 1, Name: "Wanjiru", Status: "pending", Total: 10},
+			&record{ID: 1, Name: "Akinyi", Status: "paid", Total: 10, Note: &note}, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, models.Changes{
+			"name":   {Before: json.RawMessage(`"[redacted]"`), After: json.RawMessage(`"[redacted]"`)},
+			"status": {Before: json.RawMessage(`"pending"`), After: json.RawMessage(`"paid"`)},
+			"note":   {Before: json.RawMessage(`null`), After: json.RawMessage(`"gift"`)},
+		}, changes)
+	})
+
+	t.Run("Create", func(t *testing.T) {
+		changes, err := Diff(nil, &record{ID: 1, Status: "pending"})
+		assert.NoError(t, err)
+		assert.Equal(t, json.RawMessage(`"pending"`), changes["status"].After)
+		assert.Equal(t, json.RawMessage(`null`), changes["status"].Before)
+		assert.NotContains(t, changes, "ID")
+		assert.Equal(t, json.RawMessage(`0`), changes["total"].After, "creates record every field")
+	})
+
+	t.Run("No change", func(t *testing.T) {
+		changes, err := Diff(&record{ID: 1, Name: "x"}, &record{ID: 2, Name: "x"})
+		assert.NoError(t, err)
+		assert.Nil(t, changes)
+	})
+}
@@ -0,0 +1,92 @@
+// Package auth handles customer credentials: password hashing, the
+// one-time tokens emailed for verification and password resets, and the
+// signed access tokens customers present on later requests.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"orderservice/apperrors"
+)
+
+// Config holds how customers authenticate.
+type Config struct {
+	// Secret signs access tokens. Anyone holding it can sign in as any
+	// customer.
+	Secret    []byte
+	TokenTTL  time.Duration
+	VerifyTTL time.Duration
+	ResetTTL  time.Duration
+	// AppURL is the storefront the links in account emails point to.
+	AppURL string
+	// StaffToken is the shared secret the admin gateway sends in
+	// StaffHeader. Staff routes refuse every request when it is empty.
+	StaffToken string
+	// ServiceToken is the secret shared with the payment service, sent in
+	// ServiceHeader both ways.
+	ServiceToken string
+}
+
+// Tokens returns the access tokens signed with the configured secret.
+func (c Config) Tokens() *Tokens {
+	return NewTokens(c.Secret, c.TokenTTL)
+}
+
+// Link returns the storefront link at path carrying a one-time token.
+func (c Config) Link(path, token string) string {
+	return strings.TrimRight(c.AppURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// dummyHash is compared against when a login names no account, so a
+// failed login takes as long whether or not the email is registered.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+// HashPassword returns the bcrypt hash of password.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", apperrors.Validation("password is too long",
+			apperrors.FieldError{Field: "password", Message: "must be at most 72 bytes"})
+	}
+	if err != nil {
+		return "", apperrors.Internal("password could not be hashed", err)
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches hash. An empty hash never
+// matches but takes as long to check as one that exists.
+func CheckPassword(hash, password string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NewToken returns a random one-time token to send to a customer and the
+// hash to store for it.
+func NewToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", apperrors.Internal("token could not be generated", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the stored form of a one-time token. Tokens are long
+// and random, so an unsalted SHA-256 is enough to keep a leaked table from
+// being usable.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
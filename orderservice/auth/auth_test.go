@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"orderservice/apperrors"
+	"orderservice/audit"
+	"orderservice/models"
+	"orderservice/repository"
+)
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+func TestPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	require.NoError(t, err)
+	assert.NotContains(t, hash, "correct horse")
+	assert.True(t, CheckPassword(hash, "correct horse"))
+	assert.False(t, CheckPassword(hash, "Correct horse"))
+	assert.False(t, CheckPassword("", ""), "customers without a password cannot log in")
+
+	_, err = HashPassword(strings.Repeat("é", 40))
+	assert.True(t, apperrors.Is(err, apperrors.KindValidation), "over 72 bytes")
+}
+
+func TestToken(t *testing.T) {
+	token, hash, err := NewToken()
+	require.NoError(t, err)
+	assert.Len(t, token, 43)
+	assert.Equal(t, hash, HashToken(token))
+	assert.NotEqual(t, token, hash)
+
+	other, _, err := NewToken()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+
+	config := Config{AppURL: "https://shop.example.com/"}
+	assert.Equal(t, "https://shop.example.com/reset-password?token=a%2Bb", config.Link("/reset-password", "a+b"))
+}
+
+func TestTokens(t *testing.T) {
+	tokens := NewTokens(secret, time.Hour)
+	now := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	token, expires, err := tokens.Issue(42, 3, now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Hour), expires)
+	assert.Equal(t, 2, strings.Count(token, "."))
+
+	claims, err := tokens.Verify(token, now.Add(59*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, uint(42), claims.CustomerID)
+	assert.Equal(t, uint(3), claims.Version)
+	assert.True(t, now.Equal(claims.IssuedAt))
+
+	t.Run("Expired", func(t *testing.T) {
+		_, err := tokens.Verify(token, expires)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Signed with another secret", func(t *testing.T) {
+		_, err := NewTokens([]byte("another secret, just as long as it"), time.Hour).Verify(token, now)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		parts := strings.Split(token, ".")
+		forged, _, _ := tokens.Issue(7, 3, now)
+		parts[1] = strings.Split(forged, ".")[1]
+		_, err := tokens.Verify(strings.Join(parts, "."), now)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		for _, malformed := range []string{"", "a.b", "a.b.c", token + "."} {
+			_, err := tokens.Verify(malformed, now)
+			assert.ErrorIs(t, err, ErrInvalidToken, malformed)
+		}
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	customer := &models.Customer{Name: "Wanjiru", Email: "wanjiru@example.com"}
+	require.NoError(t, store.Customers().CreateCustomer(ctx, customer))
+	tokens := NewTokens(secret, time.Hour)
+
+	router := gin.New()
+	router.GET("/me", Middleware(tokens, store, zap.NewNop()), func(c *gin.Context) {
+		c.String(http.StatusOK, Customer(c).Email)
+	})
+	router.GET("/me/actor", audit.Middleware(Trusted), Middleware(tokens, store, zap.NewNop()), func(c *gin.Context) {
+		c.String(http.StatusOK, audit.FromContext(c.Request.Context()).Actor)
+	})
+	get := func(authorization string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/me", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	token, _, err := tokens.Issue(customer.ID, customer.TokenVersion, time.Now())
+	require.NoError(t, err)
+	w := get("Bearer " + token)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "wanjiru@example.com", w.Body.String())
+
+	t.Run("Audit actor", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/me/actor", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(audit.ActorHeader, "someone-else")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, Actor(customer.ID), w.Body.String(), "customers act as themselves")
+	})
+
+	w = get("")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer realm="orderservice"`, w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusUnauthorized, get("Basic "+token).Code)
+	assert.Equal(t, http.StatusUnauthorized, get("Bearer nonsense").Code)
+
+	t.Run("Unknown customer", func(t *testing.T) {
+		token, _, err := tokens.Issue(9999, 0, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, get("Bearer "+token).Code)
+	})
+
+	t.Run("Password changed since", func(t *testing.T) {
+		// Issued in the same second as the change, which iat cannot tell
+		// apart from a token issued just after it
+		now := time.Now()
+		old, _, err := tokens.Issue(customer.ID, customer.TokenVersion, now)
+		require.NoError(t, err)
+		require.NoError(t, store.Customers().SetPassword(ctx, customer.ID, "hash", now))
+		w := get("Bearer " + old)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+
+		changed, err := store.Customers().GetCustomer(ctx, customer.ID)
+		require.NoError(t, err)
+		fresh, _, err := tokens.Issue(customer.ID, changed.TokenVersion, now)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, get("Bearer "+fresh).Code)
+	})
+}
+
+func TestStaff(t *testing.T) {
+	staffToken := strings.Repeat("s", 32)
+	router := gin.New()
+	router.Use(Staff(staffToken))
+	router.GET("/admin", RequireStaff(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	get := func(token string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/admin", nil)
+		if token != "" {
+			req.Header.Set(StaffHeader, token)
+		}
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, get(staffToken))
+	assert.Equal(t, http.StatusUnauthorized, get(""))
+	assert.Equal(t, http.StatusUnauthorized, get("wrong"))
+
+	t.Run("No token configured", func(t *testing.T) {
+		router := gin.New()
+		router.Use(Staff(""))
+		router.GET("/admin", RequireStaff(), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/admin", nil)
+		req.Header.Set(StaffHeader, "")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "an empty token never matches")
+	})
+}
+
+func TestRequireTrusted(t *testing.T) {
+	staffToken, serviceToken := strings.Repeat("s", 32), strings.Repeat("p", 32)
+	router := gin.New()
+	router.Use(Staff(staffToken), Service(serviceToken))
+	router.PUT("/orders/1/status", RequireTrusted(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	put := func(header, token string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", "/orders/1/status", nil)
+		if header != "" {
+			req.Header.Set(header, token)
+		}
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, put(StaffHeader, staffToken))
+	assert.Equal(t, http.StatusOK, put(ServiceHeader, serviceToken))
+	assert.Equal(t, http.StatusUnauthorized, put("", ""))
+	assert.Equal(t, http.StatusUnauthorized, put(ServiceHeader, staffToken), "tokens are not interchangeable")
+}
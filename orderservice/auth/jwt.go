@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Issuer identifies access tokens issued by this service.
+const Issuer = "orderservice"
+
+// header is the fixed JOSE header of every access token.
+var header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// ErrInvalidToken is returned for access tokens that are malformed, signed
+// with another key, issued elsewhere or expired.
+var ErrInvalidToken = errors.New("invalid access token")
+
+// Claims are the fields of an access token. Version is the customer's
+// token version when it was issued.
+type Claims struct {
+	CustomerID uint
+	Version    uint
+	IssuedAt   time.Time
+	ExpiresAt  time.Time
+}
+
+type jwtClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Version   uint   `json:"ver"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Tokens issues and verifies access tokens: JWTs signed with HMAC-SHA256.
+type Tokens struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewTokens returns Tokens signing with secret whose tokens are valid for
+// ttl.
+func NewTokens(secret []byte, ttl time.Duration) *Tokens {
+	return &Tokens{secret: secret, ttl: ttl}
+}
+
+// Issue returns an access token for the customer, at their token version,
+// issued at now and when it expires.
+func (t *Tokens) Issue(customerID, version uint, now time.Time) (string, time.Time, error) {
+	expires := now.Add(t.ttl).Truncate(time.Second)
+	payload, err := json.Marshal(jwtClaims{
+		Issuer:    Issuer,
+		Subject:   strconv.FormatUint(uint64(customerID), 10),
+		Version:   version,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + t.sign(unsigned), expires, nil
+}
+
+// Verify checks token's signature, issuer and expiry at now and returns
+// its claims.
+func (t *Tokens) Verify(token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != header {
+		return Claims{}, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(t.sign(parts[0]+"."+parts[1]))) {
+		return Claims{}, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	var claims jwtClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Issuer != Issuer {
+		return Claims{}, ErrInvalidToken
+	}
+	id, err := strconv.ParseUint(claims.Subject, 10, 0)
+	if err != nil || id == 0 || now.Unix() >= claims.ExpiresAt {
+		return Claims{}, ErrInvalidToken
+	}
+	return Claims{
+		CustomerID: uint(id),
+		Version:    claims.Version,
+		IssuedAt:   time.Unix(claims.IssuedAt, 0),
+		ExpiresAt:  time.Unix(claims.ExpiresAt, 0),
+	}, nil
+}
+
+func (t *Tokens) sign(unsigned string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"orderservice/apperrors"
+	"orderservice/audit"
+	"orderservice/logging"
+	"orderservice/models"
+	"orderservice/repository"
+)
+
+const customerKey = "auth.customer"
+
+// Middleware requires a valid access token in the Authorization header and
+// makes the customer it was issued to available through Customer, and the
+// audit log actor. Tokens issued before the customer last changed their
+// password are refused.
+func Middleware(tokens *Tokens, store repository.Store, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="orderservice"`)
+			apperrors.Respond(c, apperrors.Unauthenticated("access token required", nil))
+			return
+		}
+
+		var customer *models.Customer
+		claims, err := tokens.Verify(token, time.Now())
+		if err == nil {
+			customer, err = store.Customers().GetCustomer(c.Request.Context(), claims.CustomerID)
+		}
+		// Changing the password or erasing the customer moves their token
+		// version on, which ends every session issued before.
+		if err == nil && claims.Version != customer.TokenVersion {
+			err = ErrInvalidToken
+		}
+		if errors.Is(err, ErrInvalidToken) || apperrors.Is(err, apperrors.KindNotFound) {
+			c.Header("WWW-Authenticate", `Bearer realm="orderservice", error="invalid_token"`)
+			apperrors.Respond(c, apperrors.Unauthenticated("access token is invalid or has expired", err))
+			return
+		}
+		if err != nil {
+			logging.FromContext(c.Request.Context(), logger).Error("Failed to load customer", zap.Error(err))
+			apperrors.Respond(c, err)
+			return
+		}
+
+		logging.With(c, logger, zap.Uint("customer_id", customer.ID))
+		source := audit.FromContext(c.Request.Context())
+		source.Actor = Actor(customer.ID)
+		c.Request = c.Request.WithContext(audit.WithSource(c.Request.Context(), source))
+		c.Set(customerKey, customer)
+		c.Next()
+	}
+}
+
+// Actor is how the customer with id is named in the audit log when they
+// act through their own account.
+func Actor(id uint) string {
+	return fmt.Sprintf("customer:%d", id)
+}
+
+// Customer returns the customer authenticated by Middleware.
+func Customer(c *gin.Context) *models.Customer {
+	customer, _ := c.MustGet(customerKey).(*models.Customer)
+	return customer
+}
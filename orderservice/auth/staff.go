@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+	"orderservice/apperrors"
+)
+
+// StaffHeader carries the shared secret the admin gateway adds to the
+// requests of signed-in staff.
+const StaffHeader = "X-Staff-Token"
+
+// ServiceHeader carries the shared secret the payment service adds to its
+// calls.
+const ServiceHeader = "X-Service-Token"
+
+const (
+	staffKey   = "auth.staff"
+	serviceKey = "auth.service"
+)
+
+// Staff marks requests that carry token in StaffHeader as made by staff.
+// It refuses nothing itself; see RequireStaff. With an empty token no
+// request is staff.
+func Staff(token string) gin.HandlerFunc {
+	return mark(staffKey, StaffHeader, token)
+}
+
+// Service marks requests that carry token in ServiceHeader as made by the
+// payment service. With an empty token no request is.
+func Service(token string) gin.HandlerFunc {
+	return mark(serviceKey, ServiceHeader, token)
+}
+
+func mark(key, header, token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sent := c.GetHeader(header)
+		c.Set(key, token != "" && subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1)
+		c.Next()
+	}
+}
+
+// IsStaff reports whether Staff marked the request as made by staff.
+func IsStaff(c *gin.Context) bool {
+	return c.GetBool(staffKey)
+}
+
+// Trusted reports whether the request came from staff through the admin
+// gateway or from the payment service, the callers whose audit.ActorHeader
+// is believed.
+func Trusted(c *gin.Context) bool {
+	return IsStaff(c) || c.GetBool(serviceKey)
+}
+
+// RequireStaff refuses requests Staff did not mark as made by staff.
+func RequireStaff() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsStaff(c) {
+			apperrors.Respond(c, apperrors.Unauthenticated("staff credentials required", nil))
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireTrusted refuses requests that neither Staff nor Service marked,
+// for routes both staff and the payment service use.
+func RequireTrusted() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !Trusted(c) {
+			apperrors.Respond(c, apperrors.Unauthenticated("staff or service credentials required", nil))
+			return
+		}
+		c.Next()
+	}
+}
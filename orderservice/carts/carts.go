@@ -0,0 +1,264 @@
+// Package carts prices shopping carts and turns them into orders.
+package carts
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"orderservice/apperrors"
+	"orderservice/catalog"
+	"orderservice/models"
+	"orderservice/money"
+	"orderservice/promotions"
+	"orderservice/repository"
+	"orderservice/shipping"
+	"orderservice/tax"
+)
+
+// Limits on cart contents. MaxItems matches the limit on orders.
+const (
+	MaxItems    = 100
+	MaxQuantity = 1000
+)
+
+// Open returns a conflict if cart can no longer be changed or checked out.
+func Open(cart *models.Cart, now time.Time) error {
+	switch {
+	case cart.Status != models.CartOpen:
+		return apperrors.Conflict("cart has already been checked out", nil)
+	case cart.Expired(now):
+		return apperrors.Conflict("cart has expired", nil)
+	}
+	return nil
+}
+
+// SetItem sets the quantity of a product or variant in cart and records
+// the current catalogue price as the price the customer has seen. It fails
+// with a validation error if the product cannot be ordered or has fewer
+// units in stock. field prefixes the field names in those errors, e.g.
+// "items[2].".
+func SetItem(ctx context.Context, store repository.Store, cart *models.Cart, req models.CartItemRequest, field string) error {
+	product, variant, err := catalog.Resolve(ctx, store, req.ProductID, req.VariantID,
+		field+"product_id", field+"variant_id")
+	if err != nil {
+		return err
+	}
+	price := catalog.Price(product, variant)
+
+	limit, message := MaxQuantity, fmt.Sprintf("must be at most %d", MaxQuantity)
+	if stock := catalog.Stock(product, variant); stock != nil && *stock < limit {
+		limit, message = *stock, fmt.Sprintf("must be at most %d, the quantity in stock", *stock)
+	}
+	if req.Quantity > limit {
+		return apperrors.Validation("quantity is not available",
+			apperrors.FieldError{Field: field + "quantity", Message: message})
+	}
+
+	if item := cart.Item(req.ProductID, req.VariantID); item != nil {
+		item.Quantity = req.Quantity
+		item.UnitPrice = price
+		return nil
+	}
+	if len(cart.Items) >= MaxItems {
+		return apperrors.Validation("cart is full", apperrors.FieldError{
+			Field:   "items",
+			Message: fmt.Sprintf("must contain at most %d items", MaxItems),
+		})
+	}
+	cart.Items = append(cart.Items, models.CartItem{
+		ProductID: req.ProductID,
+		VariantID: req.VariantID,
+		Quantity:  req.Quantity,
+		UnitPrice: price,
+	})
+	return nil
+}
+
+// Reprice brings each item's unit price up to date with the catalogue and
+// reports whether any price changed. Items that can no longer be ordered
+// are left for checkout to report.
+func Reprice(ctx context.Context, store repository.Store, cart *models.Cart) (bool, error) {
+	var changed bool
+	for i := range cart.Items {
+		item := &cart.Items[i]
+		product, variant, err := catalog.Resolve(ctx, store, item.ProductID, item.VariantID, "", "")
+		if apperrors.Is(err, apperrors.KindValidation) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if price := catalog.Price(product, variant); price != item.UnitPrice {
+			item.UnitPrice = price
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// Order builds the unsaved order cart would become at current catalogue
+// prices and exchange rates, in the cart's currency, with one line per item
+// and no discounts or tax yet.
+func Order(ctx context.Context, store repository.Store, cart *models.Cart, rates tax.Rates, exchange money.Rates) (*models.Order, error) {
+	order := &models.Order{
+		CustomerID:   cart.CustomerID,
+		Currency:     cart.Currency,
+		TaxInclusive: rates.Inclusive,
+	}
+	if order.Currency == "" {
+		order.Currency = exchange.Base
+	}
+	for i, item := range cart.Items {
+		product, variant, err := catalog.Resolve(ctx, store, item.ProductID, item.VariantID,
+			fmt.Sprintf("items[%d].product_id", i), fmt.Sprintf("items[%d].variant_id", i))
+		if err != nil {
+			return nil, err
+		}
+		line, err := catalog.Line(product, variant, item.Quantity, order.Currency, rates, exchange)
+		if err != nil {
+			return nil, err
+		}
+		order.Products = append(order.Products, *product)
+		order.Items = append(order.Items, line)
+	}
+	return order, nil
+}
+
+// Quote returns the unsaved order cart would become if checked out now,
+// with discounts and tax worked out. Coupons that no longer apply are left
+// out; checkout reports them.
+func Quote(ctx context.Context, store repository.Store, cart *models.Cart, rates tax.Rates, exchange money.Rates, now time.Time) (*models.Order, error) {
+	order, err := Order(ctx, store, cart, rates, exchange)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range cart.CouponCodes {
+		_, err := promotions.Preview(ctx, store, order, []string{code}, now)
+		if err != nil && !apperrors.Is(err, apperrors.KindValidation) && !apperrors.Is(err, apperrors.KindConflict) {
+			return nil, err
+		}
+	}
+	for _, discount := range order.Discounts {
+		order.Discount += discount.Amount
+	}
+	tax.Apply(order, rates)
+	order.CalculateTotals()
+	return order, nil
+}
+
+// Price sets cart.Totals to what the cart would cost if checked out now.
+func Price(ctx context.Context, store repository.Store, cart *models.Cart, rates tax.Rates, exchange money.Rates, now time.Time) error {
+	order, err := Quote(ctx, store, cart, rates, exchange, now)
+	if err != nil {
+		return err
+	}
+
+	cart.Totals = &models.CartTotals{
+		Lines:        order.Items,
+		Discounts:    order.Discounts,
+		Subtotal:     order.Subtotal,
+		Discount:     order.Discount,
+		TaxAmount:    order.TaxAmount,
+		TaxInclusive: order.TaxInclusive,
+		Total:        order.Total,
+	}
+	return nil
+}
+
+// Checkout turns cart into an order shipped as delivery: it re-checks every
+// price against the catalogue, redeems the cart's coupons, adds the
+// shipping fee, reserves stock and marks the cart checked out. Run it
+// inside a unit of work so a failure leaves nothing behind.
+func Checkout(ctx context.Context, store repository.Store, cart *models.Cart, delivery models.Delivery, rates tax.Rates, exchange money.Rates, now time.Time) (*models.Order, error) {
+	if err := Open(cart, now); err != nil {
+		return nil, err
+	}
+	if len(cart.Items) == 0 {
+		return nil, apperrors.Validation("cart is empty",
+			apperrors.FieldError{Field: "items", Message: "must contain at least 1 item"})
+	}
+	if cart.CustomerID == 0 {
+		return nil, apperrors.Validation("customer is required",
+			apperrors.FieldError{Field: "customer_id", Message: "is required"})
+	}
+	if _, err := store.Customers().GetCustomer(ctx, cart.CustomerID); err != nil {
+		if apperrors.Is(err, apperrors.KindNotFound) {
+			return nil, apperrors.Validation("customer does not exist",
+				apperrors.FieldError{Field: "customer_id", Message: "does not exist"})
+		}
+		return nil, err
+	}
+
+	order, err := Order(ctx, store, cart, rates, exchange)
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range cart.Items {
+		if order.Items[i].CatalogPrice != item.UnitPrice {
+			return nil, apperrors.Conflict("prices have changed since the cart was last updated", nil)
+		}
+	}
+
+	discounts, err := promotions.Apply(ctx, store, order, cart.CouponCodes, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, discount := range discounts {
+		order.Discount += discount.Amount
+	}
+	tax.Apply(order, rates)
+	if err := shipping.Apply(ctx, store, order, delivery, exchange); err != nil {
+		return nil, err
+	}
+
+	if err := store.Orders().CreateOrder(ctx, order); err != nil {
+		return nil, err
+	}
+	if err := store.Carts().CheckOut(ctx, cart.ID, order.ID); err != nil {
+		return nil, err
+	}
+	order.CalculateTotals()
+	return order, nil
+}
+
+// Job periodically removes open carts that have expired. Stock is only
+// reserved at checkout, so expiring a cart releases nothing.
+type Job struct {
+	store    repository.Store
+	interval time.Duration
+	logger   *zap.Logger
+}
+
+func NewJob(store repository.Store, interval time.Duration, logger *zap.Logger) *Job {
+	return &Job{store: store, interval: interval, logger: logger}
+}
+
+// Run removes expired carts immediately and then on every interval until
+// ctx is cancelled.
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce removes every open cart that has expired.
+func (j *Job) RunOnce(ctx context.Context) {
+	deleted, err := j.store.Carts().DeleteExpiredCarts(ctx, time.Now())
+	if err != nil {
+		j.logger.Error("Failed to remove expired carts", zap.Error(err))
+		return
+	}
+	if deleted > 0 {
+		j.logger.Info("Removed expired carts", zap.Int64("count", deleted))
+	}
+}
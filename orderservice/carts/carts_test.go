@@ -0,0 +1,218 @@
+package carts
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"orderservice/apperrors"
+	"orderservice/models"
+	"orderservice/money"
+	"orderservice/repository"
+	"orderservice/tax"
+)
+
+var (
+	ctx      = context.Background()
+	now      = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	rates    = tax.Rates{Standard: 0.16, Inclusive: true}
+	exchange = money.NewRates("KES", map[string]float64{"USD": 130})
+)
+
+// seed stores a customer and two products, the second with 2 units in
+// stock, and returns an open cart holding 2 of the first.
+func seed(t *testing.T, store repository.Store) (*models.Cart, []*models.Product) {
+	t.Helper()
+	require.NoError(t, store.Customers().CreateCustomer(ctx, &models.Customer{Name: "Cart Customer", Email: "cart@example.com"}))
+	stock := 2
+	products := []*models.Product{
+		{Name: "Notebook", Price: 50, Category: "stationery"},
+		{Name: "Lamp", Price: 100, Category: "home", Stock: &stock},
+	}
+	for _, p := range products {
+		require.NoError(t, store.Products().CreateProduct(ctx, p))
+	}
+
+	cart := &models.Cart{CustomerID: 1, Status: models.CartOpen, ExpiresAt: now.Add(time.Hour)}
+	require.NoError(t, SetItem(ctx, store, cart, models.CartItemRequest{ProductID: products[0].ID, Quantity: 2}, ""))
+	require.NoError(t, store.Carts().CreateCart(ctx, cart))
+	return cart, products
+}
+
+func TestSetItem(t *testing.T) {
+	store := repository.NewMemoryStore()
+	cart, products := seed(t, store)
+
+	t.Run("Updates quantity and price", func(t *testing.T) {
+		require.NoError(t, SetItem(ctx, store, cart, models.CartItemRequest{ProductID: products[0].ID, Quantity: 5}, ""))
+		require.Len(t, cart.Items, 1)
+		assert.Equal(t, 5, cart.Items[0].Quantity)
+		assert.Equal(t, 50.0, cart.Items[0].UnitPrice)
+	})
+
+	t.Run("More than in stock", func(t *testing.T) {
+		err := SetItem(ctx, store, cart, models.CartItemRequest{ProductID: products[1].ID, Quantity: 3}, "items[1].")
+		require.True(t, apperrors.Is(err, apperrors.KindValidation))
+		assert.Equal(t, "items[1].quantity", err.(*apperrors.Error).Fields[0].Field)
+		assert.Len(t, cart.Items, 1)
+	})
+
+	t.Run("Unknown product", func(t *testing.T) {
+		err := SetItem(ctx, store, cart, models.CartItemRequest{ProductID: 99, Quantity: 1}, "")
+		require.True(t, apperrors.Is(err, apperrors.KindValidation))
+		assert.Equal(t, "product_id", err.(*apperrors.Error).Fields[0].Field)
+	})
+
+	t.Run("Variants are separate lines at their own price", func(t *testing.T) {
+		stock := 1
+		shirt := &models.Product{Name: "Shirt", Price: 20, Variants: []models.ProductVariant{
+			{Name: "Small", Price: 20},
+			{Name: "Large", Price: 24, Stock: &stock},
+		}}
+		require.NoError(t, store.Products().CreateProduct(ctx, shirt))
+		small, large := shirt.Variants[0].ID, shirt.Variants[1].ID
+
+		err := SetItem(ctx, store, cart, models.CartItemRequest{ProductID: shirt.ID, Quantity: 1}, "")
+		require.True(t, apperrors.Is(err, apperrors.KindValidation))
+		assert.Equal(t, "variant_id", err.(*apperrors.Error).Fields[0].Field)
+
+		require.NoError(t, SetItem(ctx, store, cart, models.CartItemRequest{ProductID: shirt.ID, VariantID: small, Quantity: 3}, ""))
+		require.NoError(t, SetItem(ctx, store, cart, models.CartItemRequest{ProductID: shirt.ID, VariantID: large, Quantity: 1}, ""))
+		assert.Equal(t, 24.0, cart.Item(shirt.ID, large).UnitPrice)
+		assert.Equal(t, 3, cart.Item(shirt.ID, small).Quantity)
+
+		err = SetItem(ctx, store, cart, models.CartItemRequest{ProductID: shirt.ID, VariantID: large, Quantity: 2}, "")
+		assert.True(t, apperrors.Is(err, apperrors.KindValidation), "variant stock")
+	})
+}
+
+func TestPrice(t *testing.T) {
+	store := repository.NewMemoryStore()
+	cart, _ := seed(t, store)
+	require.NoError(t, store.Promotions().CreatePromotion(ctx, &models.Promotion{
+		Code: "STATIONERY", Type: models.DiscountPercentage, Value: 10, Categories: []string{"stationery"},
+	}))
+
+	t.Run("Quantities, coupons and tax", func(t *testing.T) {
+		cart.CouponCodes = []string{"STATIONERY"}
+		require.NoError(t, Price(ctx, store, cart, rates, exchange, now))
+
+		totals := cart.Totals
+		assert.Equal(t, 100.0, totals.Subtotal)
+		assert.Equal(t, 10.0, totals.Discount)
+		assert.Equal(t, 90.0, totals.Total)
+		assert.Equal(t, 12.41, totals.TaxAmount)
+		require.Len(t, totals.Lines, 1)
+		assert.Equal(t, 2, totals.Lines[0].Quantity)
+	})
+
+	t.Run("Coupons that no longer apply are left out", func(t *testing.T) {
+		cart.CouponCodes = []string{"STATIONERY", "GONE"}
+		require.NoError(t, Price(ctx, store, cart, rates, exchange, now))
+		assert.Len(t, cart.Totals.Discounts, 1)
+	})
+
+	t.Run("Coupons are not redeemed", func(t *testing.T) {
+		promotion, err := store.Promotions().GetPromotionByCode(ctx, "STATIONERY")
+		require.NoError(t, err)
+		assert.Zero(t, promotion.UsageCount)
+	})
+}
+
+func TestCheckout(t *testing.T) {
+	checkout := func(store repository.Store, cart *models.Cart) (*models.Order, error) {
+		var order *models.Order
+		err := store.WithinTx(ctx, func(tx repository.Store) error {
+			var err error
+			order, err = Checkout(ctx, tx, cart, models.Delivery{}, rates, exchange, now)
+			return err
+		})
+		return order, err
+	}
+
+	t.Run("Creates the order and reserves stock", func(t *testing.T) {
+		store := repository.NewMemoryStore()
+		cart, products := seed(t, store)
+		require.NoError(t, SetItem(ctx, store, cart, models.CartItemRequest{ProductID: products[1].ID, Quantity: 2}, ""))
+
+		order, err := checkout(store, cart)
+		require.NoError(t, err)
+		assert.Equal(t, 300.0, order.Total)
+		assert.Len(t, order.Items, 2)
+
+		lamp, _ := store.Products().GetProduct(ctx, products[1].ID)
+		assert.Equal(t, 0, *lamp.Stock)
+		stored, _ := store.Carts().GetCart(ctx, cart.ID)
+		assert.Equal(t, models.CartCheckedOut, stored.Status)
+		assert.Equal(t, order.ID, *stored.OrderID)
+
+		_, err = checkout(store, stored)
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict), "already checked out")
+	})
+
+	t.Run("Changed price", func(t *testing.T) {
+		store := repository.NewMemoryStore()
+		cart, _ := seed(t, store)
+		cart.Items[0].UnitPrice = 45
+
+		_, err := checkout(store, cart)
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict))
+
+		changed, err := Reprice(ctx, store, cart)
+		require.NoError(t, err)
+		assert.True(t, changed)
+		_, err = checkout(store, cart)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Stock sold in the meantime", func(t *testing.T) {
+		store := repository.NewMemoryStore()
+		cart, products := seed(t, store)
+		require.NoError(t, SetItem(ctx, store, cart, models.CartItemRequest{ProductID: products[1].ID, Quantity: 2}, ""))
+		other := &models.Order{CustomerID: 1, Products: []models.Product{*products[1]}}
+		tax.Apply(other, rates)
+		require.NoError(t, store.Orders().CreateOrder(ctx, other))
+
+		_, err := checkout(store, cart)
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict))
+		stored, _ := store.Carts().GetCart(ctx, cart.ID)
+		assert.Equal(t, models.CartOpen, stored.Status, "failed checkout leaves the cart open")
+	})
+
+	t.Run("Missing customer", func(t *testing.T) {
+		store := repository.NewMemoryStore()
+		cart, _ := seed(t, store)
+		cart.CustomerID = 0
+
+		_, err := checkout(store, cart)
+		require.True(t, apperrors.Is(err, apperrors.KindValidation))
+		assert.Equal(t, "customer_id", err.(*apperrors.Error).Fields[0].Field)
+	})
+
+	t.Run("Expired cart", func(t *testing.T) {
+		store := repository.NewMemoryStore()
+		cart, _ := seed(t, store)
+		cart.ExpiresAt = now
+
+		_, err := checkout(store, cart)
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict))
+	})
+}
+
+func TestJob(t *testing.T) {
+	store := repository.NewMemoryStore()
+	expired := &models.Cart{Status: models.CartOpen, ExpiresAt: time.Now().Add(-time.Minute)}
+	live := &models.Cart{Status: models.CartOpen, ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, store.Carts().CreateCart(ctx, expired))
+	require.NoError(t, store.Carts().CreateCart(ctx, live))
+
+	NewJob(store, time.Hour, zap.NewNop()).RunOnce(ctx)
+
+	_, err := store.Carts().GetCart(ctx, expired.ID)
+	assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+	_, err = store.Carts().GetCart(ctx, live.ID)
+	assert.NoError(t, err)
+}
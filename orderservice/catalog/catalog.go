@@ -0,0 +1,89 @@
+// Package catalog resolves the products and variants that orders and carts
+// refer to.
+package catalog
+
+import (
+	"context"
+
+	"orderservice/apperrors"
+	"orderservice/models"
+	"orderservice/money"
+	"orderservice/repository"
+	"orderservice/tax"
+)
+
+// Resolve loads the product, and the variant when variantID is not zero,
+// and checks they can be ordered. Products with variants must be ordered
+// by variant. Problems are reported as validation errors on productField
+// or variantField.
+func Resolve(ctx context.Context, store repository.Store, productID, variantID uint, productField, variantField string) (*models.Product, *models.ProductVariant, error) {
+	product, err := store.Products().GetProduct(ctx, productID)
+	if apperrors.Is(err, apperrors.KindNotFound) {
+		return nil, nil, apperrors.Validation("product does not exist",
+			apperrors.FieldError{Field: productField, Message: "does not exist"})
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if product.Status == models.ProductArchived {
+		return nil, nil, apperrors.Validation("product is no longer available",
+			apperrors.FieldError{Field: productField, Message: "is no longer available"})
+	}
+
+	if variantID == 0 {
+		if len(product.Variants) > 0 {
+			return nil, nil, apperrors.Validation("product has variants",
+				apperrors.FieldError{Field: variantField, Message: "is required for this product"})
+		}
+		return product, nil, nil
+	}
+	variant := product.Variant(variantID)
+	if variant == nil {
+		return nil, nil, apperrors.Validation("variant does not exist",
+			apperrors.FieldError{Field: variantField, Message: "does not exist"})
+	}
+	return product, variant, nil
+}
+
+// Price returns the unit price of the product, or of variant if it is not
+// nil.
+func Price(product *models.Product, variant *models.ProductVariant) float64 {
+	if variant != nil {
+		return variant.Price
+	}
+	return product.Price
+}
+
+// Stock returns the units available of the product, or of variant if it
+// is not nil. It returns nil when stock is not tracked.
+func Stock(product *models.Product, variant *models.ProductVariant) *int {
+	if variant != nil {
+		return variant.Stock
+	}
+	return product.Stock
+}
+
+// Line returns an unpriced order line for quantity units of product, or of
+// variant if it is not nil, with the catalogue price converted into
+// currency at the current exchange rate.
+func Line(product *models.Product, variant *models.ProductVariant, quantity int, currency string, rates tax.Rates, exchange money.Rates) (models.OrderItem, error) {
+	item := rates.Line(*product, variant, quantity)
+	from := Currency(product, exchange)
+	converted, rate, err := exchange.Convert(money.New(item.UnitPrice, from), currency)
+	if err != nil {
+		return models.OrderItem{}, err
+	}
+	item.CatalogPrice, item.CatalogCurrency, item.ExchangeRate = item.UnitPrice, from, rate
+	item.UnitPrice = converted.Amount()
+	item.Weight = product.Weight
+	return item, nil
+}
+
+// Currency returns the currency product is priced in. Products stored
+// without one are in the base currency.
+func Currency(product *models.Product, exchange money.Rates) string {
+	if product.Currency == "" {
+		return exchange.Base
+	}
+	return product.Currency
+}
@@ -0,0 +1,263 @@
+package config
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"orderservice/auth"
+	"orderservice/documents"
+	"orderservice/money"
+	"orderservice/notify"
+	"orderservice/tax"
+)
+
+// String reads key from the environment, falling back to def when unset.
+func String(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// Duration reads a Go duration such as "15s" from the environment, falling
+// back to def when unset or malformed.
+func Duration(key string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return d
+}
+
+// Int64 reads an integer from the environment, falling back to def when
+// unset or malformed.
+func Int64(key string, def int64) int64 {
+	n, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// Float reads a decimal number from the environment, falling back to def
+// when unset or malformed.
+func Float(key string, def float64) float64 {
+	f, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return def
+	}
+	return f
+}
+
+// Bool reads a boolean such as "true" or "0" from the environment, falling
+// back to def when unset or malformed.
+func Bool(key string, def bool) bool {
+	b, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+// Server holds the HTTP server limits and shutdown behaviour.
+type Server struct {
+	Addr                string
+	ReadHeaderTimeout   time.Duration
+	ReadTimeout         time.Duration
+	WriteTimeout        time.Duration
+	IdleTimeout         time.Duration
+	MaxBodyBytes        int64
+	ShutdownGracePeriod time.Duration
+}
+
+func LoadServer(defaultPort string) Server {
+	return Server{
+		Addr:                ":" + String("PORT", defaultPort),
+		ReadHeaderTimeout:   Duration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:         Duration("HTTP_READ_TIMEOUT", 15*time.Second),
+		WriteTimeout:        Duration("HTTP_WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:         Duration("HTTP_IDLE_TIMEOUT", 60*time.Second),
+		MaxBodyBytes:        Int64("HTTP_MAX_BODY_BYTES", 1<<20),
+		ShutdownGracePeriod: Duration("SHUTDOWN_GRACE_PERIOD", 20*time.Second),
+	}
+}
+
+func (s Server) HTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              s.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: s.ReadHeaderTimeout,
+		ReadTimeout:       s.ReadTimeout,
+		WriteTimeout:      s.WriteTimeout,
+		IdleTimeout:       s.IdleTimeout,
+		MaxHeaderBytes:    1 << 20,
+	}
+}
+
+// Deadlines bounds a single call to each dependency so a hung database
+// or upstream cannot hold a request indefinitely.
+type Deadlines struct {
+	Database        time.Duration
+	PaymentsService time.Duration
+}
+
+func LoadDeadlines() Deadlines {
+	return Deadlines{
+		Database:        Duration("DB_QUERY_TIMEOUT", 5*time.Second),
+		PaymentsService: Duration("PAYMENTS_SERVICE_TIMEOUT", 5*time.Second),
+	}
+}
+
+// LoadTax reads the VAT rates. Prices are VAT-inclusive by default, which
+// keeps order totals equal to the sum of catalogue prices.
+func LoadTax() tax.Rates {
+	return tax.Rates{
+		Standard:  Float("TAX_RATE_STANDARD", 0.16),
+		ZeroRated: Float("TAX_RATE_ZERO_RATED", 0),
+		Inclusive: Bool("TAX_PRICES_INCLUSIVE", true),
+	}
+}
+
+// Carts holds how long an untouched cart lives and how often expired carts
+// are removed.
+type Carts struct {
+	TTL           time.Duration
+	SweepInterval time.Duration
+}
+
+func LoadCarts() Carts {
+	return Carts{
+		TTL:           Duration("CART_TTL", 24*time.Hour),
+		SweepInterval: Duration("CART_SWEEP_INTERVAL", 15*time.Minute),
+	}
+}
+
+// Purge holds how long deleted customers, products, orders and addresses
+// are kept, so they can be restored, and how often older ones are purged.
+type Purge struct {
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+func LoadPurge() Purge {
+	return Purge{
+		Retention: Duration("DELETED_RECORD_RETENTION", 30*24*time.Hour),
+		Interval:  Duration("DELETED_RECORD_PURGE_INTERVAL", 24*time.Hour),
+	}
+}
+
+// LoadExchange reads the base currency from CURRENCY (default KES) and the
+// exchange-rate table from EXCHANGE_RATES, a comma-separated list such as
+// "USD=129.50,EUR=140.20" giving the price of one unit of each currency in
+// the base currency. Unlike other settings a malformed table is an error,
+// since guessing would misprice orders.
+func LoadExchange() (money.Rates, error) {
+	base := strings.ToUpper(String("CURRENCY", "KES"))
+	rates := make(map[string]float64)
+	for _, entry := range strings.Split(os.Getenv("EXCHANGE_RATES"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		currency, value, ok := strings.Cut(entry, "=")
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !ok || err != nil || rate <= 0 {
+			return money.Rates{}, fmt.Errorf("EXCHANGE_RATES: invalid entry %q", entry)
+		}
+		rates[strings.ToUpper(strings.TrimSpace(currency))] = rate
+	}
+	return money.NewRates(base, rates), nil
+}
+
+// LoadBusiness reads the seller details printed on invoices and receipts.
+// BUSINESS_ADDRESS is comma-separated, one part per printed line.
+func LoadBusiness() documents.Business {
+	return documents.Business{
+		Name:    String("BUSINESS_NAME", "Order Management System"),
+		Address: os.Getenv("BUSINESS_ADDRESS"),
+		PIN:     os.Getenv("BUSINESS_KRA_PIN"),
+		Phone:   os.Getenv("BUSINESS_PHONE"),
+		Email:   os.Getenv("BUSINESS_EMAIL"),
+	}
+}
+
+// Notifications holds how customer notifications are delivered. Email is
+// "smtp", "log" or "off" and SMS is "log" or "off"; "log" writes messages
+// to LogFile, or stdout when it is empty, instead of sending them.
+type Notifications struct {
+	Email       string
+	SMS         string
+	SMTP        notify.SMTP
+	LogFile     string
+	Interval    time.Duration
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+// LoadNotifications reads the notification settings. An unknown channel
+// mode is an error rather than a silent "off".
+func LoadNotifications() (Notifications, error) {
+	n := Notifications{
+		Email: strings.ToLower(String("NOTIFY_EMAIL", "log")),
+		SMS:   strings.ToLower(String("NOTIFY_SMS", "log")),
+		SMTP: notify.SMTP{
+			Host:     String("SMTP_HOST", "localhost"),
+			Port:     int(Int64("SMTP_PORT", 587)),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     String("SMTP_FROM", "orders@localhost"),
+		},
+		LogFile:     os.Getenv("NOTIFICATION_LOG_FILE"),
+		Interval:    Duration("NOTIFICATION_INTERVAL", 10*time.Second),
+		MaxAttempts: int(Int64("NOTIFICATION_MAX_ATTEMPTS", 5)),
+		Backoff:     Duration("NOTIFICATION_RETRY_BACKOFF", time.Minute),
+	}
+	switch n.Email {
+	case "smtp", "log", "off":
+	default:
+		return Notifications{}, fmt.Errorf("NOTIFY_EMAIL: unknown mode %q", n.Email)
+	}
+	switch n.SMS {
+	case "log", "off":
+	default:
+		return Notifications{}, fmt.Errorf("NOTIFY_SMS: unknown mode %q", n.SMS)
+	}
+	if n.MaxAttempts < 1 {
+		n.MaxAttempts = 1
+	}
+	return n, nil
+}
+
+// LoadAuth reads how customers and staff authenticate. AUTH_JWT_SECRET
+// signs access tokens and must be at least 32 bytes; when it is unset a
+// random secret is returned and generated is true, so tokens stop working
+// on restart. STAFF_TOKEN, when set, must be at least 32 bytes too.
+func LoadAuth() (cfg auth.Config, generated bool, err error) {
+	cfg = auth.Config{
+		Secret:       []byte(os.Getenv("AUTH_JWT_SECRET")),
+		TokenTTL:     Duration("AUTH_TOKEN_TTL", 24*time.Hour),
+		VerifyTTL:    Duration("AUTH_VERIFY_TTL", 48*time.Hour),
+		ResetTTL:     Duration("AUTH_RESET_TTL", time.Hour),
+		AppURL:       String("APP_URL", "http://localhost:3000"),
+		StaffToken:   os.Getenv("STAFF_TOKEN"),
+		ServiceToken: os.Getenv("PAYMENTS_SERVICE_TOKEN"),
+	}
+	if cfg.StaffToken != "" && len(cfg.StaffToken) < 32 {
+		return auth.Config{}, false, fmt.Errorf("STAFF_TOKEN: must be at least 32 bytes")
+	}
+	switch {
+	case len(cfg.Secret) == 0:
+		cfg.Secret = make([]byte, 32)
+		if _, err := rand.Read(cfg.Secret); err != nil {
+			return auth.Config{}, false, err
+		}
+		generated = true
+	case len(cfg.Secret) < 32:
+		return auth.Config{}, false, fmt.Errorf("AUTH_JWT_SECRET: must be at least 32 bytes")
+	}
+	return cfg, generated, nil
+}
@@ -0,0 +1,220 @@
+// Package documents renders invoices and receipts for orders as HTML and
+// PDF. Both are produced in pure Go so the service needs no system fonts
+// or external renderer.
+package documents
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"orderservice/apperrors"
+	"orderservice/models"
+	"orderservice/money"
+)
+
+// Location is the timezone dates on documents are shown in. It is fixed
+// rather than loaded so the container needs no timezone database.
+var Location = time.FixedZone("EAT", 3*60*60)
+
+// Business holds the seller details printed on every document.
+type Business struct {
+	Name    string
+	Address string
+	PIN     string // KRA PIN
+	Phone   string
+	Email   string
+}
+
+// Lines returns the business address and contact details, one per line.
+func (b Business) Lines() []string {
+	var lines []string
+	for _, line := range strings.Split(b.Address, ",") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if b.PIN != "" {
+		lines = append(lines, "PIN: "+b.PIN)
+	}
+	if b.Phone != "" {
+		lines = append(lines, "Tel: "+b.Phone)
+	}
+	if b.Email != "" {
+		lines = append(lines, b.Email)
+	}
+	return lines
+}
+
+// Kind is the type of document produced for an order.
+type Kind string
+
+const (
+	Invoice Kind = "invoice"
+	Receipt Kind = "receipt"
+)
+
+// Line is a formatted line item.
+type Line struct {
+	Description string
+	Quantity    string
+	UnitPrice   string
+	TaxRate     string
+	Amount      string
+}
+
+// Field is a formatted label and value, such as a total.
+type Field struct {
+	Label string
+	Value string
+}
+
+// Document is an invoice or receipt with every value formatted for
+// display, so the HTML and PDF renderings show the same text.
+type Document struct {
+	Kind     Kind
+	Title    string
+	Number   string
+	Business Business
+	Details  []Field
+	BillTo   []string
+	Lines    []Line
+	Totals   []Field
+	Payment  []Field
+	Footer   string
+}
+
+// Paid reports whether a receipt can be issued for order.
+func Paid(order *models.Order) bool {
+	switch order.Status {
+	case models.OrderPaid, models.OrderPartiallyShipped, models.OrderShipped, models.OrderDelivered:
+		return true
+	}
+	return false
+}
+
+// Allowed returns a conflict for a receipt of an unpaid order or an
+// invoice of a cancelled one.
+func Allowed(kind Kind, order *models.Order) error {
+	switch {
+	case kind == Receipt && !Paid(order):
+		return apperrors.Conflict("order has not been paid", nil)
+	case kind == Invoice && order.Status == models.OrderCancelled:
+		return apperrors.Conflict("order has been cancelled", nil)
+	}
+	return nil
+}
+
+// New builds the document of kind for order under invoice's number. It
+// fails like Allowed.
+func New(kind Kind, business Business, invoice *models.Invoice, order *models.Order, customer *models.Customer) (Document, error) {
+	if err := Allowed(kind, order); err != nil {
+		return Document{}, err
+	}
+
+	currency := order.Currency
+	if currency == "" {
+		currency = "KES"
+	}
+	format := func(amount float64) string {
+		return money.New(amount, currency).String()
+	}
+
+	doc := Document{
+		Kind:     kind,
+		Title:    "Tax invoice",
+		Number:   invoice.Number,
+		Business: business,
+		Details: []Field{
+			{"Invoice number", invoice.Number},
+			{"Invoice date", date(invoice.CreatedAt)},
+			{"Order", "#" + strconv.FormatUint(uint64(order.ID), 10)},
+		},
+		Footer: "Thank you for your business.",
+	}
+	if kind == Receipt {
+		doc.Title = "Receipt"
+	}
+
+	doc.BillTo = []string{customer.Name, customer.Email}
+	if address := order.ShippingAddress; address.Street != "" {
+		doc.BillTo = append(doc.BillTo, address.Recipient, address.Street, address.Town+", "+address.County, address.Phone)
+	}
+	doc.BillTo = compact(doc.BillTo)
+
+	if len(order.Items) > 0 {
+		for _, item := range order.Items {
+			doc.Lines = append(doc.Lines, Line{
+				Description: item.Name,
+				Quantity:    strconv.Itoa(item.Quantity),
+				UnitPrice:   format(item.UnitPrice),
+				TaxRate:     percent(item.TaxRate),
+				Amount:      format(item.Amount()),
+			})
+		}
+	} else {
+		// Orders placed before line items were stored.
+		for _, product := range order.Products {
+			doc.Lines = append(doc.Lines, Line{
+				Description: product.Name,
+				Quantity:    "1",
+				UnitPrice:   format(product.Price),
+				Amount:      format(product.Price),
+			})
+		}
+	}
+
+	doc.Totals = append(doc.Totals, Field{"Subtotal", format(order.Subtotal)})
+	if order.Discount > 0 {
+		doc.Totals = append(doc.Totals, Field{"Discount", "-" + format(order.Discount)})
+	}
+	if order.TaxInclusive {
+		doc.Totals = append(doc.Totals, Field{"VAT included", format(order.TaxAmount)})
+	} else {
+		doc.Totals = append(doc.Totals, Field{"VAT", format(order.TaxAmount)})
+	}
+	if order.ShippingMethod != "" {
+		doc.Totals = append(doc.Totals, Field{"Shipping (" + order.ShippingMethod + ")", format(order.ShippingFee)})
+	}
+	label := "Amount due"
+	if Paid(order) {
+		label = "Total paid"
+	}
+	doc.Totals = append(doc.Totals, Field{label, format(order.Total)})
+
+	if Paid(order) {
+		doc.Payment = append(doc.Payment, Field{"Payment method", "M-Pesa"})
+		if order.PaymentReference != "" {
+			doc.Payment = append(doc.Payment, Field{"M-Pesa receipt", order.PaymentReference})
+		}
+		if order.PaidAt != nil {
+			doc.Payment = append(doc.Payment, Field{"Paid on", date(*order.PaidAt)})
+		}
+	}
+	return doc, nil
+}
+
+func date(t time.Time) string {
+	return t.In(Location).Format("2 January 2006")
+}
+
+func percent(rate float64) string {
+	return strconv.FormatFloat(math.Round(rate*10000)/100, 'f', -1, 64) + "%"
+}
+
+func compact(lines []string) []string {
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.Trim(strings.TrimSpace(line), ","); line != "" {
+			kept = append(kept, strings.TrimSpace(line))
+		}
+	}
+	return kept
+}
+
+// Filename returns the name the document is downloaded under.
+func (d Document) Filename(ext string) string {
+	return fmt.Sprintf("%s-%s.%s", d.Kind, d.Number, ext)
+}
@@ -0,0 +1,149 @@
+package documents
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"orderservice/apperrors"
+	"orderservice/models"
+)
+
+var business = Business{
+	Name:    "Duka La Nyumbani",
+	Address: "Kimathi Street, Nairobi",
+	PIN:     "P051234567X",
+	Phone:   "+254 700 000000",
+}
+
+func testOrder(status string) *models.Order {
+	paidAt := time.Date(2026, 3, 14, 21, 30, 0, 0, time.UTC)
+	order := &models.Order{
+		CustomerID:   1,
+		Status:       status,
+		Currency:     "KES",
+		TaxInclusive: true,
+		TaxAmount:    689.66,
+		Items: []models.OrderItem{
+			{Name: "Kettle (Black)", UnitPrice: 2500, Quantity: 2, TaxRate: 0.16},
+			{Name: "Toaster", UnitPrice: 3200, Quantity: 1, TaxRate: 0.16},
+		},
+		ShippingMethod:   "standard",
+		ShippingFee:      200,
+		ShippingAddress:  models.ShippingAddress{County: "Nairobi", Town: "Westlands", Street: "Waiyaki Way", Phone: "254712345678"},
+		PaymentReference: "QK12ABC3DE",
+		PaidAt:           &paidAt,
+	}
+	order.ID = 42
+	order.CalculateTotals()
+	return order
+}
+
+var (
+	invoice  = &models.Invoice{Number: "INV-000007", CreatedAt: time.Date(2026, 3, 14, 22, 0, 0, 0, time.UTC)}
+	customer = &models.Customer{Name: "Wanjiru", Email: "wanjiru@example.com"}
+)
+
+func TestNew(t *testing.T) {
+	t.Run("Receipt", func(t *testing.T) {
+		doc, err := New(Receipt, business, invoice, testOrder(models.OrderPaid), customer)
+		require.NoError(t, err)
+		assert.Equal(t, "Receipt", doc.Title)
+		assert.Equal(t, Field{"Invoice date", "15 March 2026"}, doc.Details[1], "shown in Kenyan time")
+		assert.Equal(t, []string{"Wanjiru", "wanjiru@example.com", "Waiyaki Way", "Westlands, Nairobi", "254712345678"}, doc.BillTo)
+		require.Len(t, doc.Lines, 2)
+		assert.Equal(t, Line{"Kettle (Black)", "2", "2500.00 KES", "16%", "5000.00 KES"}, doc.Lines[0])
+		assert.Equal(t, []Field{
+			{"Subtotal", "8200.00 KES"},
+			{"VAT included", "689.66 KES"},
+			{"Shipping (standard)", "200.00 KES"},
+			{"Total paid", "8400.00 KES"},
+		}, doc.Totals)
+		assert.Contains(t, doc.Payment, Field{"M-Pesa receipt", "QK12ABC3DE"})
+		assert.Equal(t, "receipt-INV-000007.pdf", doc.Filename("pdf"))
+	})
+
+	t.Run("Invoice of an unpaid order", func(t *testing.T) {
+		doc, err := New(Invoice, business, invoice, testOrder(models.OrderPending), customer)
+		require.NoError(t, err)
+		assert.Equal(t, "Tax invoice", doc.Title)
+		assert.Equal(t, "Amount due", doc.Totals[len(doc.Totals)-1].Label)
+		assert.Empty(t, doc.Payment)
+	})
+
+	t.Run("Not allowed", func(t *testing.T) {
+		_, err := New(Receipt, business, invoice, testOrder(models.OrderPending), customer)
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict))
+		_, err = New(Invoice, business, invoice, testOrder(models.OrderCancelled), customer)
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict))
+	})
+}
+
+func TestHTML(t *testing.T) {
+	order := testOrder(models.OrderPaid)
+	order.Items[1].Name = "<script>alert(1)</script>"
+	doc, err := New(Receipt, business, invoice, order, customer)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, doc.HTML(&out))
+	html := out.String()
+	assert.Contains(t, html, "<title>Receipt INV-000007 - Duka La Nyumbani</title>")
+	assert.Contains(t, html, "PIN: P051234567X")
+	assert.Contains(t, html, "QK12ABC3DE")
+	assert.Contains(t, html, "8400.00 KES")
+	assert.NotContains(t, html, "<script>", "line items are escaped")
+}
+
+func TestPDF(t *testing.T) {
+	order := testOrder(models.OrderPaid)
+	order.Items[0].Name = "Kettle (Black) – 1.7 litres, stainless steel with a very long description that will not fit"
+	doc, err := New(Receipt, business, invoice, order, customer)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, doc.PDF(&out))
+	pdf := out.String()
+	require.True(t, strings.HasPrefix(pdf, "%PDF-1.4\n"))
+	assert.True(t, strings.HasSuffix(pdf, "%%EOF\n"))
+	assert.Contains(t, pdf, "(QK12ABC3DE) Tj")
+	assert.Contains(t, pdf, `(Kettle \(Black\) `+"\x96", "brackets escaped, dash in WinAnsi")
+	assert.Contains(t, pdf, "...) Tj", "long descriptions are shortened")
+
+	t.Run("Cross-reference table", func(t *testing.T) {
+		start, err := strconv.Atoi(regexp.MustCompile(`startxref\n(\d+)`).FindStringSubmatch(pdf)[1])
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(pdf[start:], "xref\n"))
+		offsets := regexp.MustCompile(`(\d{10}) 00000 n`).FindAllStringSubmatch(pdf[start:], -1)
+		require.Len(t, offsets, 6)
+		for i, match := range offsets {
+			offset, _ := strconv.Atoi(match[1])
+			assert.True(t, strings.HasPrefix(pdf[offset:], strconv.Itoa(i+1)+" 0 obj"), "object %d", i+1)
+		}
+	})
+
+	t.Run("Long orders run onto more pages", func(t *testing.T) {
+		order := testOrder(models.OrderPaid)
+		for len(order.Items) < 60 {
+			order.Items = append(order.Items, order.Items[0])
+		}
+		doc, err := New(Invoice, business, invoice, order, customer)
+		require.NoError(t, err)
+		var out bytes.Buffer
+		require.NoError(t, doc.PDF(&out))
+		assert.Contains(t, out.String(), "/Count 2")
+	})
+}
+
+func TestWidth(t *testing.T) {
+	assert.Equal(t, 5.56, width("0", 10, false))
+	assert.Equal(t, 5.84, width("~", 10, true))
+	assert.InDelta(t, 22.78, width("Hello", 10, false), 0.001)
+	assert.Equal(t, "Short", fit("Short", 100, 10, false))
+	assert.LessOrEqual(t, width(fit(strings.Repeat("W", 50), 100, 10, true), 10, true), 100.0)
+}
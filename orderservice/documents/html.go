@@ -0,0 +1,84 @@
+package documents
+
+import (
+	"html/template"
+	"io"
+)
+
+var page = template.Must(template.New("document").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} {{.Number}} - {{.Business.Name}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; font-size: 14px; color: #222; max-width: 800px; margin: 40px auto; }
+header { display: flex; justify-content: space-between; }
+h1 { font-size: 24px; margin: 0 0 8px; text-transform: uppercase; }
+h2 { font-size: 14px; margin: 24px 0 4px; text-transform: uppercase; color: #666; }
+table { width: 100%; border-collapse: collapse; margin-top: 24px; }
+th, td { padding: 6px 4px; text-align: left; }
+th { border-bottom: 2px solid #222; }
+td { border-bottom: 1px solid #ddd; }
+.number { text-align: right; white-space: nowrap; }
+.totals td { border: none; }
+.totals tr:last-child td { font-weight: bold; border-top: 2px solid #222; }
+dl { display: grid; grid-template-columns: max-content auto; gap: 2px 12px; margin: 0; }
+dt { color: #666; }
+dd { margin: 0; }
+footer { margin-top: 32px; color: #666; }
+</style>
+</head>
+<body>
+<header>
+<div>
+<strong>{{.Business.Name}}</strong>
+{{- range .Business.Lines}}<br>{{.}}{{end}}
+</div>
+<div>
+<h1>{{.Title}}</h1>
+<dl>
+{{- range .Details}}
+<dt>{{.Label}}</dt><dd>{{.Value}}</dd>
+{{- end}}
+</dl>
+</div>
+</header>
+
+<h2>Bill to</h2>
+<div>{{range $i, $line := .BillTo}}{{if $i}}<br>{{end}}{{$line}}{{end}}</div>
+
+<table>
+<thead>
+<tr><th>Description</th><th class="number">Qty</th><th class="number">Unit price</th><th class="number">VAT</th><th class="number">Amount</th></tr>
+</thead>
+<tbody>
+{{- range .Lines}}
+<tr><td>{{.Description}}</td><td class="number">{{.Quantity}}</td><td class="number">{{.UnitPrice}}</td><td class="number">{{.TaxRate}}</td><td class="number">{{.Amount}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+
+<table class="totals">
+{{- range .Totals}}
+<tr><td class="number">{{.Label}}</td><td class="number">{{.Value}}</td></tr>
+{{- end}}
+</table>
+{{- if .Payment}}
+
+<h2>Payment</h2>
+<dl>
+{{- range .Payment}}
+<dt>{{.Label}}</dt><dd>{{.Value}}</dd>
+{{- end}}
+</dl>
+{{- end}}
+
+<footer>{{.Footer}}</footer>
+</body>
+</html>
+`))
+
+// HTML writes d as a standalone HTML page.
+func (d Document) HTML(w io.Writer) error {
+	return page.Execute(w, d)
+}
@@ -0,0 +1,258 @@
+package documents
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 page size and margin in points.
+const (
+	pageWidth  = 595.28
+	pageHeight = 841.89
+	margin     = 50.0
+)
+
+// Right edges of the line item columns.
+const (
+	quantityColumn  = 330.0
+	unitPriceColumn = 420.0
+	taxColumn       = 465.0
+	amountColumn    = pageWidth - margin
+)
+
+// PDF writes d as an A4 PDF.
+func (d Document) PDF(w io.Writer) error {
+	var p pdf
+	p.newPage()
+
+	top := p.y
+	p.text(margin, d.Business.Name, 16, true)
+	for _, line := range d.Business.Lines() {
+		p.down(12)
+		p.text(margin, line, 9, false)
+	}
+	bottom := p.y
+
+	p.y = top
+	p.right(amountColumn, strings.ToUpper(d.Title), 18, true)
+	p.down(6)
+	for _, field := range d.Details {
+		p.down(13)
+		p.text(amountColumn-190, field.Label, 9, false)
+		p.right(amountColumn, field.Value, 9, true)
+	}
+	p.y = min(p.y, bottom)
+
+	p.down(36)
+	p.text(margin, "BILL TO", 9, true)
+	for _, line := range d.BillTo {
+		p.down(13)
+		p.text(margin, line, 10, false)
+	}
+
+	p.down(36)
+	p.text(margin, "Description", 9, true)
+	p.right(quantityColumn, "Qty", 9, true)
+	p.right(unitPriceColumn, "Unit price", 9, true)
+	p.right(taxColumn, "VAT", 9, true)
+	p.right(amountColumn, "Amount", 9, true)
+	p.down(6)
+	p.rule(1)
+	for _, line := range d.Lines {
+		p.down(16)
+		p.text(margin, fit(line.Description, quantityColumn-margin-40, 10, false), 10, false)
+		p.right(quantityColumn, line.Quantity, 10, false)
+		p.right(unitPriceColumn, line.UnitPrice, 10, false)
+		p.right(taxColumn, line.TaxRate, 10, false)
+		p.right(amountColumn, line.Amount, 10, false)
+	}
+	p.down(8)
+	p.rule(0.5)
+
+	for i, total := range d.Totals {
+		last := i == len(d.Totals)-1
+		p.down(16)
+		if last {
+			p.down(4)
+		}
+		p.right(taxColumn, total.Label, 10, last)
+		p.right(amountColumn, total.Value, 10, last)
+	}
+
+	if len(d.Payment) > 0 {
+		p.down(36)
+		p.text(margin, "PAYMENT", 9, true)
+		for _, field := range d.Payment {
+			p.down(13)
+			p.text(margin, field.Label, 10, false)
+			p.text(margin+110, field.Value, 10, true)
+		}
+	}
+
+	p.down(36)
+	p.text(margin, d.Footer, 9, false)
+	return p.write(w)
+}
+
+// pdf lays out text on pages using the standard Helvetica fonts, which
+// every PDF reader provides, so no font has to be embedded.
+type pdf struct {
+	pages []*bytes.Buffer
+	y     float64 // baseline of the current line, up from the page bottom
+}
+
+func (p *pdf) newPage() {
+	p.pages = append(p.pages, new(bytes.Buffer))
+	p.y = pageHeight - margin
+}
+
+// down moves the current line down by leading, starting a new page when
+// it would run into the bottom margin.
+func (p *pdf) down(leading float64) {
+	p.y -= leading
+	if p.y < margin {
+		p.newPage()
+	}
+}
+
+// text draws s on the current line starting at x.
+func (p *pdf) text(x float64, s string, size float64, bold bool) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(p.pages[len(p.pages)-1], "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n",
+		font, size, x, p.y, escape(encode(s)))
+}
+
+// right draws s on the current line ending at x.
+func (p *pdf) right(x float64, s string, size float64, bold bool) {
+	p.text(x-width(s, size, bold), s, size, bold)
+}
+
+// rule draws a line across the page just under the current line.
+func (p *pdf) rule(weight float64) {
+	y := p.y - 4
+	fmt.Fprintf(p.pages[len(p.pages)-1], "%.1f w %.2f %.2f m %.2f %.2f l S\n", weight, margin, y, pageWidth-margin, y)
+}
+
+// write outputs the catalog, page tree and two fonts as objects 1 to 4,
+// then each page and its content stream, followed by the cross-reference
+// table.
+func (p *pdf) write(w io.Writer) error {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, content := range p.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pageWidth, pageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.Bytes()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// winAnsi maps the characters outside Latin-1 that WinAnsiEncoding has.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+}
+
+// encode converts s to WinAnsiEncoding, replacing characters the standard
+// fonts cannot show with "?".
+func encode(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch c, ok := winAnsi[r]; {
+		case ok:
+			b = append(b, c)
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			b = append(b, byte(r))
+		default:
+			b = append(b, '?')
+		}
+	}
+	return b
+}
+
+func escape(b []byte) string {
+	var s strings.Builder
+	for _, c := range b {
+		if c == '\\' || c == '(' || c == ')' {
+			s.WriteByte('\\')
+		}
+		s.WriteByte(c)
+	}
+	return s.String()
+}
+
+// Advance widths of the printable ASCII characters, in thousandths of the
+// font size, from the Helvetica and Helvetica-Bold font metrics.
+var (
+	helvetica = [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBold = [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
+
+// width returns how wide s is in points when set at size.
+func width(s string, size float64, bold bool) float64 {
+	widths := &helvetica
+	if bold {
+		widths = &helveticaBold
+	}
+	total := 0
+	for _, c := range encode(s) {
+		if c >= 0x20 && c < 0x7f {
+			total += widths[c-0x20]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// fit shortens s with an ellipsis so it is at most max points wide.
+func fit(s string, max, size float64, bold bool) string {
+	if width(s, size, bold) <= max {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && width(string(runes)+"...", size, bold) > max {
+		runes = runes[:len(runes)-1]
+	}
+	return strings.TrimSpace(string(runes)) + "..."
+}
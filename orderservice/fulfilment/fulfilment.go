@@ -0,0 +1,142 @@
+// Package fulfilment ships orders and keeps their status in step with
+// their shipments.
+package fulfilment
+
+import (
+	"fmt"
+	"time"
+
+	"orderservice/apperrors"
+	"orderservice/models"
+)
+
+// progress orders the statuses an order moves through once paid.
+var progress = map[string]int{
+	models.OrderPaid:             1,
+	models.OrderPartiallyShipped: 2,
+	models.OrderShipped:          3,
+	models.OrderDelivered:        4,
+}
+
+// shipmentProgress orders the statuses a shipment moves through.
+var shipmentProgress = map[string]int{
+	models.ShipmentPending:   1,
+	models.ShipmentShipped:   2,
+	models.ShipmentDelivered: 3,
+}
+
+// Shippable returns a conflict unless new shipments can be added to order.
+func Shippable(order *models.Order) error {
+	switch order.Status {
+	case models.OrderPaid, models.OrderPartiallyShipped:
+		return nil
+	case models.OrderShipped, models.OrderDelivered:
+		return apperrors.Conflict("order has already been shipped in full", nil)
+	default:
+		return apperrors.Conflict("only paid orders can be shipped", nil)
+	}
+}
+
+// Check returns a validation error if items are not lines of order, or ask
+// for more of a line than its existing shipments have left.
+func Check(order *models.Order, shipments []models.Shipment, items []models.ShipmentItem) error {
+	left := make(map[uint]int, len(order.Items))
+	for _, item := range order.Items {
+		left[item.ID] = item.Quantity
+	}
+	for _, shipment := range shipments {
+		for _, item := range shipment.Items {
+			left[item.OrderItemID] -= item.Quantity
+		}
+	}
+
+	for i, item := range items {
+		remaining, ok := left[item.OrderItemID]
+		if !ok {
+			return apperrors.Validation("item is not on the order", apperrors.FieldError{
+				Field:   fmt.Sprintf("items[%d].order_item_id", i),
+				Message: "is not a line of this order",
+			})
+		}
+		if item.Quantity > remaining {
+			return apperrors.Validation("quantity has already been shipped", apperrors.FieldError{
+				Field:   fmt.Sprintf("items[%d].quantity", i),
+				Message: fmt.Sprintf("must be at most %d, the quantity not yet shipped", max(remaining, 0)),
+			})
+		}
+		left[item.OrderItemID] = remaining - item.Quantity
+	}
+	return nil
+}
+
+// Advance moves shipment to status, which must not be behind its current
+// one, and records when it was shipped and delivered. shippedAt and
+// deliveredAt override those times; otherwise a status reached for the
+// first time is stamped with now.
+func Advance(shipment *models.Shipment, status string, shippedAt, deliveredAt *time.Time, now time.Time) error {
+	if shipmentProgress[status] < shipmentProgress[shipment.Status] {
+		return apperrors.Conflict("shipment is already "+shipment.Status, nil)
+	}
+	shipment.Status = status
+	if status != models.ShipmentPending && (shipment.ShippedAt == nil || shippedAt != nil) {
+		shipment.ShippedAt = stamp(shippedAt, now)
+	}
+	if status == models.ShipmentDelivered && (shipment.DeliveredAt == nil || deliveredAt != nil) {
+		shipment.DeliveredAt = stamp(deliveredAt, now)
+	}
+	if shipment.ShippedAt != nil && shipment.DeliveredAt != nil && shipment.DeliveredAt.Before(*shipment.ShippedAt) {
+		return apperrors.Validation("shipment cannot be delivered before it was shipped",
+			apperrors.FieldError{Field: "delivered_at", Message: "must not be before shipped_at"})
+	}
+	return nil
+}
+
+func stamp(at *time.Time, now time.Time) *time.Time {
+	if at != nil {
+		t := at.UTC()
+		return &t
+	}
+	return &now
+}
+
+// Status returns the status order's shipments put it in: delivered once
+// every unit has been delivered, shipped once every unit is on its way,
+// partially shipped once any is, and otherwise its current status. The
+// status never moves backwards, e.g. for an order marked delivered by hand.
+func Status(order *models.Order, shipments []models.Shipment) string {
+	shipped := make(map[uint]int)
+	delivered := make(map[uint]int)
+	var started bool
+	for _, shipment := range shipments {
+		if shipment.Status == models.ShipmentPending {
+			continue
+		}
+		for _, item := range shipment.Items {
+			shipped[item.OrderItemID] += item.Quantity
+			started = true
+			if shipment.Status == models.ShipmentDelivered {
+				delivered[item.OrderItemID] += item.Quantity
+			}
+		}
+	}
+
+	allShipped, allDelivered := len(order.Items) > 0, len(order.Items) > 0
+	for _, item := range order.Items {
+		allShipped = allShipped && shipped[item.ID] >= item.Quantity
+		allDelivered = allDelivered && delivered[item.ID] >= item.Quantity
+	}
+
+	status := order.Status
+	switch {
+	case allDelivered:
+		status = models.OrderDelivered
+	case allShipped:
+		status = models.OrderShipped
+	case started:
+		status = models.OrderPartiallyShipped
+	}
+	if progress[status] <= progress[order.Status] {
+		return order.Status
+	}
+	return status
+}
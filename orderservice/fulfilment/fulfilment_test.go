@@ -0,0 +1,130 @@
+package fulfilment
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"orderservice/apperrors"
+	"orderservice/models"
+)
+
+func order(status string) *models.Order {
+	o := &models.Order{Status: status, Items: []models.OrderItem{{Quantity: 2}, {Quantity: 1}}}
+	o.Items[0].ID, o.Items[1].ID = 10, 11
+	return o
+}
+
+func shipment(status string, items ...models.ShipmentItem) models.Shipment {
+	return models.Shipment{Status: status, Items: items}
+}
+
+func TestShippable(t *testing.T) {
+	assert.NoError(t, Shippable(order(models.OrderPaid)))
+	assert.NoError(t, Shippable(order(models.OrderPartiallyShipped)))
+	for _, status := range []string{models.OrderPending, models.OrderCancelled, models.OrderShipped, models.OrderDelivered} {
+		assert.True(t, apperrors.Is(Shippable(order(status)), apperrors.KindConflict), status)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	existing := []models.Shipment{shipment(models.ShipmentShipped, models.ShipmentItem{OrderItemID: 10, Quantity: 1})}
+	field := func(t *testing.T, err error) string {
+		t.Helper()
+		require.True(t, apperrors.Is(err, apperrors.KindValidation), "%v", err)
+		return err.(*apperrors.Error).Fields[0].Field
+	}
+
+	t.Run("Remaining quantity", func(t *testing.T) {
+		assert.NoError(t, Check(order(models.OrderPaid), existing, []models.ShipmentItem{
+			{OrderItemID: 10, Quantity: 1}, {OrderItemID: 11, Quantity: 1},
+		}))
+	})
+
+	t.Run("Unknown line", func(t *testing.T) {
+		err := Check(order(models.OrderPaid), existing, []models.ShipmentItem{{OrderItemID: 99, Quantity: 1}})
+		assert.Equal(t, "items[0].order_item_id", field(t, err))
+	})
+
+	t.Run("Already shipped", func(t *testing.T) {
+		err := Check(order(models.OrderPaid), existing, []models.ShipmentItem{{OrderItemID: 10, Quantity: 2}})
+		assert.Equal(t, "items[0].quantity", field(t, err))
+		assert.Contains(t, err.(*apperrors.Error).Fields[0].Message, "at most 1")
+	})
+
+	t.Run("Same line twice", func(t *testing.T) {
+		err := Check(order(models.OrderPaid), nil, []models.ShipmentItem{
+			{OrderItemID: 11, Quantity: 1}, {OrderItemID: 11, Quantity: 1},
+		})
+		assert.Equal(t, "items[1].quantity", field(t, err))
+	})
+}
+
+func TestAdvance(t *testing.T) {
+	now := time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC)
+	earlier := now.Add(-48 * time.Hour)
+
+	t.Run("Stamps each status once", func(t *testing.T) {
+		s := shipment(models.ShipmentPending)
+		require.NoError(t, Advance(&s, models.ShipmentShipped, nil, nil, earlier))
+		assert.Equal(t, earlier, *s.ShippedAt)
+		assert.Nil(t, s.DeliveredAt)
+
+		require.NoError(t, Advance(&s, models.ShipmentDelivered, nil, nil, now))
+		assert.Equal(t, earlier, *s.ShippedAt, "shipped time kept")
+		assert.Equal(t, now, *s.DeliveredAt)
+	})
+
+	t.Run("Delivered straight away", func(t *testing.T) {
+		s := shipment(models.ShipmentPending)
+		require.NoError(t, Advance(&s, models.ShipmentDelivered, &earlier, nil, now))
+		assert.Equal(t, earlier, *s.ShippedAt)
+		assert.Equal(t, now, *s.DeliveredAt)
+	})
+
+	t.Run("Never backwards", func(t *testing.T) {
+		s := shipment(models.ShipmentDelivered)
+		err := Advance(&s, models.ShipmentShipped, nil, nil, now)
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict))
+	})
+
+	t.Run("Delivered before shipped", func(t *testing.T) {
+		s := shipment(models.ShipmentPending)
+		err := Advance(&s, models.ShipmentDelivered, &now, &earlier, now)
+		assert.True(t, apperrors.Is(err, apperrors.KindValidation))
+	})
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    string
+		shipments []models.Shipment
+		want      string
+	}{
+		{"Nothing shipped", models.OrderPaid, nil, models.OrderPaid},
+		{"Pending shipments don't count", models.OrderPaid, []models.Shipment{
+			shipment(models.ShipmentPending, models.ShipmentItem{OrderItemID: 10, Quantity: 2}, models.ShipmentItem{OrderItemID: 11, Quantity: 1}),
+		}, models.OrderPaid},
+		{"Some lines shipped", models.OrderPaid, []models.Shipment{
+			shipment(models.ShipmentShipped, models.ShipmentItem{OrderItemID: 10, Quantity: 2}),
+		}, models.OrderPartiallyShipped},
+		{"Every unit shipped", models.OrderPartiallyShipped, []models.Shipment{
+			shipment(models.ShipmentDelivered, models.ShipmentItem{OrderItemID: 10, Quantity: 2}),
+			shipment(models.ShipmentShipped, models.ShipmentItem{OrderItemID: 11, Quantity: 1}),
+		}, models.OrderShipped},
+		{"Every unit delivered", models.OrderShipped, []models.Shipment{
+			shipment(models.ShipmentDelivered, models.ShipmentItem{OrderItemID: 10, Quantity: 1}),
+			shipment(models.ShipmentDelivered, models.ShipmentItem{OrderItemID: 10, Quantity: 1}, models.ShipmentItem{OrderItemID: 11, Quantity: 1}),
+		}, models.OrderDelivered},
+		{"Never backwards", models.OrderDelivered, []models.Shipment{
+			shipment(models.ShipmentShipped, models.ShipmentItem{OrderItemID: 10, Quantity: 1}),
+		}, models.OrderDelivered},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Status(order(tt.status), tt.shipments))
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"orderservice/apperrors"
+	"orderservice/auth"
+	"orderservice/logging"
+	"orderservice/models"
+	"orderservice/notify"
+	"orderservice/repository"
+	"orderservice/validation"
+)
+
+// Storefront pages the links in account emails open.
+const (
+	verifyEmailPath   = "/verify-email"
+	resetPasswordPath = "/reset-password"
+)
+
+// AccountHandler lets customers register, verify their email address, log
+// in, reset a forgotten password and see their own orders.
+type AccountHandler struct {
+	store  repository.Store
+	config auth.Config
+	tokens *auth.Tokens
+	logger *zap.Logger
+}
+
+func NewAccountHandler(store repository.Store, config auth.Config, logger *zap.Logger) *AccountHandler {
+	return &AccountHandler{
+		store:  store,
+		config: config,
+		tokens: config.Tokens(),
+		logger: logger,
+	}
+}
+
+func (h *AccountHandler) log(c *gin.Context) *zap.Logger {
+	return logging.FromContext(c.Request.Context(), h.logger)
+}
+
+// Register creates a customer account and emails a link to verify the
+// address. A customer created by staff can register with their email to
+// take over their existing orders.
+func (h *AccountHandler) Register(c *gin.Context) {
+	var req models.RegisterRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		h.log(c).Error("Invalid registration input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		h.log(c).Error("Registration failed", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	now := time.Now().UTC()
+	var customer *models.Customer
+	err = h.store.WithinTx(ctx, func(tx repository.Store) error {
+		var err error
+		customer, err = tx.Customers().GetCustomerByEmail(ctx, req.Email)
+		switch {
+		case apperrors.Is(err, apperrors.KindNotFound):
+			customer = &models.Customer{Name: req.Name, Email: req.Email, PasswordHash: hash, PasswordChangedAt: &now}
+			err = tx.Customers().CreateCustomer(ctx, customer)
+		case err != nil:
+		case customer.HasAccount(), customer.ErasedAt != nil:
+			err = apperrors.Conflict("email address is already registered", nil)
+		default:
+			err = tx.Customers().SetPassword(ctx, customer.ID, hash, now)
+		}
+		if err != nil {
+			return err
+		}
+		return h.sendToken(ctx, tx, customer, models.TokenVerifyEmail, now)
+	})
+	if err != nil {
+		h.log(c).Error("Registration failed", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	logging.With(c, h.logger, zap.Uint("customer_id", customer.ID)).Info("Customer registered")
+	c.JSON(http.StatusCreated, customer)
+}
+
+// VerifyEmail confirms the customer's email address with the token from
+// their verification email.
+func (h *AccountHandler) VerifyEmail(c *gin.Context) {
+	var req models.TokenRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		h.log(c).Error("Invalid verification input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	now := time.Now().UTC()
+	err := h.store.WithinTx(ctx, func(tx repository.Store) error {
+		token, err := h.useToken(ctx, tx, models.TokenVerifyEmail, req.Token, now)
+		if err != nil {
+			return err
+		}
+		logging.With(c, h.logger, zap.Uint("customer_id", token.CustomerID))
+		return tx.Customers().VerifyEmail(ctx, token.CustomerID, now)
+	})
+	if err != nil {
+		h.log(c).Error("Email verification failed", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	h.log(c).Info("Email address verified")
+	c.JSON(http.StatusOK, gin.H{"message": "Email address verified"})
+}
+
+// ResendVerification emails a new verification link. It responds the same
+// whether or not the address is registered.
+func (h *AccountHandler) ResendVerification(c *gin.Context) {
+	h.sendByEmail(c, models.TokenVerifyEmail, func(customer *models.Customer) bool {
+		return customer.HasAccount() && customer.EmailVerifiedAt == nil
+	})
+}
+
+// ForgotPassword emails a link to choose a new password. It responds the
+// same whether or not the address is registered.
+func (h *AccountHandler) ForgotPassword(c *gin.Context) {
+	h.sendByEmail(c, models.TokenResetPassword, func(*models.Customer) bool { return true })
+}
+
+// sendByEmail emails a token for purpose to the customer with the
+// requested address if wanted approves of them.
+func (h *AccountHandler) sendByEmail(c *gin.Context, purpose string, wanted func(*models.Customer) bool) {
+	var req models.EmailRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		h.log(c).Error("Invalid email input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	err := h.store.WithinTx(ctx, func(tx repository.Store) error {
+		customer, err := tx.Customers().GetCustomerByEmail(ctx, req.Email)
+		if apperrors.Is(err, apperrors.KindNotFound) {
+			return nil
+		}
+		if err != nil || customer.ErasedAt != nil || !wanted(customer) {
+			return err
+		}
+		logging.With(c, h.logger, zap.Uint("customer_id", customer.ID))
+		return h.sendToken(ctx, tx, customer, purpose, time.Now().UTC())
+	})
+	if err != nil {
+		h.log(c).Error("Failed to send account email", zap.String("purpose", purpose), zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the email address is registered, we have sent it a link"})
+}
+
+// ResetPassword sets a new password with the token from a password reset
+// email. Access tokens issued before the reset stop working, and since
+// the link reached the customer's inbox their address counts as verified.
+func (h *AccountHandler) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		h.log(c).Error("Invalid password reset input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		h.log(c).Error("Password reset failed", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	now := time.Now().UTC()
+	err = h.store.WithinTx(ctx, func(tx repository.Store) error {
+		token, err := h.useToken(ctx, tx, models.TokenResetPassword, req.Token, now)
+		if err != nil {
+			return err
+		}
+		logging.With(c, h.logger, zap.Uint("customer_id", token.CustomerID))
+		customer, err := tx.Customers().GetCustomer(ctx, token.CustomerID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Customers().SetPassword(ctx, customer.ID, hash, now); err != nil {
+			return err
+		}
+		if customer.EmailVerifiedAt != nil {
+			return nil
+		}
+		return tx.Customers().VerifyEmail(ctx, customer.ID, now)
+	})
+	if err != nil {
+		h.log(c).Error("Password reset failed", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	h.log(c).Info("Password reset")
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+// Login exchanges an email address and password for an access token.
+// Customers must verify their email address first.
+func (h *AccountHandler) Login(c *gin.Context) {
+	var req models.LoginRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		h.log(c).Error("Invalid login input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	customer, err := h.store.Customers().GetCustomerByEmail(c.Request.Context(), req.Email)
+	if err != nil && !apperrors.Is(err, apperrors.KindNotFound) {
+		h.log(c).Error("Login failed", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	var hash string
+	if err == nil {
+		hash = customer.PasswordHash
+	}
+	if !auth.CheckPassword(hash, req.Password) {
+		h.log(c).Warn("Login refused")
+		apperrors.Respond(c, apperrors.Unauthenticated("invalid email or password", nil))
+		return
+	}
+	logging.With(c, h.logger, zap.Uint("customer_id", customer.ID))
+	if customer.EmailVerifiedAt == nil {
+		h.log(c).Warn("Login refused before email verification")
+		apperrors.Respond(c, apperrors.Forbidden("email address has not been verified", nil))
+		return
+	}
+
+	token, expires, err := h.tokens.Issue(customer.ID, customer.TokenVersion, time.Now())
+	if err != nil {
+		h.log(c).Error("Login failed", zap.Error(err))
+		apperrors.Respond(c, apperrors.Internal("access token could not be issued", err))
+		return
+	}
+
+	h.log(c).Info("Customer logged in")
+	c.JSON(http.StatusOK, models.Session{Token: token, TokenType: "Bearer", ExpiresAt: expires.UTC(), Customer: customer})
+}
+
+// Me returns the logged-in customer.
+func (h *AccountHandler) Me(c *gin.Context) {
+	c.JSON(http.StatusOK, auth.Customer(c))
+}
+
+// MyOrders lists the logged-in customer's orders, newest first, one page
+// at a time. The number of orders across all pages is returned in the
+// X-Total-Count header.
+func (h *AccountHandler) MyOrders(c *gin.Context) {
+	var query models.OrderQuery
+	if err := validation.BindQuery(c, &query); err != nil {
+		h.log(c).Error("Invalid order query", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PerPage == 0 {
+		query.PerPage = 20
+	}
+
+	orders, total, err := h.store.Orders().ListCustomerOrders(c.Request.Context(), auth.Customer(c).ID, query.Page, query.PerPage)
+	if err != nil {
+		h.log(c).Error("Failed to fetch orders", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	if orders == nil {
+		orders = []models.Order{}
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, orders)
+}
+
+// MyOrder returns one of the logged-in customer's orders. Other
+// customers' orders are not found.
+func (h *AccountHandler) MyOrder(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		h.log(c).Error("Invalid order ID", zap.Error(err))
+		apperrors.Respond(c, apperrors.Validation("invalid order ID"))
+		return
+	}
+	logging.With(c, h.logger, zap.Uint64("order_id", id))
+
+	order, err := h.store.Orders().GetOrder(c.Request.Context(), uint(id))
+	if err == nil && order.CustomerID != auth.Customer(c).ID {
+		err = apperrors.NotFound("order not found", nil)
+	}
+	if err != nil {
+		h.log(c).Error("Failed to fetch order", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// sendToken stores a new one-time token for purpose and queues the email
+// carrying it.
+func (h *AccountHandler) sendToken(ctx context.Context, store repository.Store, customer *models.Customer, purpose string, now time.Time) error {
+	token, hash, err := auth.NewToken()
+	if err != nil {
+		return err
+	}
+	ttl, path, event := h.config.VerifyTTL, verifyEmailPath, notify.EventVerifyEmail
+	if purpose == models.TokenResetPassword {
+		ttl, path, event = h.config.ResetTTL, resetPasswordPath, notify.EventResetPassword
+	}
+	err = store.Tokens().CreateToken(ctx, &models.CustomerToken{
+		CustomerID: customer.ID,
+		Purpose:    purpose,
+		TokenHash:  hash,
+		ExpiresAt:  now.Add(ttl),
+	})
+	if err != nil {
+		return err
+	}
+	return notify.QueueAccount(ctx, store, event, customer, h.config.Link(path, token))
+}
+
+// useToken claims a one-time token, reporting an unknown, used or expired
+// one against the token field.
+func (h *AccountHandler) useToken(ctx context.Context, store repository.Store, purpose, token string, now time.Time) (*models.CustomerToken, error) {
+	claimed, err := store.Tokens().UseToken(ctx, purpose, auth.HashToken(token), now)
+	if apperrors.Is(err, apperrors.KindNotFound) {
+		return nil, apperrors.Validation("token is invalid or has expired",
+			apperrors.FieldError{Field: "token", Message: "is invalid or has expired"})
+	}
+	return claimed, err
+}
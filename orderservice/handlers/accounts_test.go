@@ -0,0 +1,213 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"orderservice/auth"
+	"orderservice/handlers"
+	"orderservice/models"
+	"orderservice/notify"
+	"orderservice/repository"
+)
+
+func TestAccounts(t *testing.T) {
+	store := repository.NewMemoryStore()
+	logger, _ := zap.NewDevelopment()
+	config := auth.Config{
+		Secret:    []byte("0123456789abcdef0123456789abcdef"),
+		TokenTTL:  time.Hour,
+		VerifyTTL: time.Hour,
+		ResetTTL:  time.Hour,
+		AppURL:    "https://shop.example.com",
+	}
+	handler := handlers.NewAccountHandler(store, config, logger)
+
+	router := gin.New()
+	router.POST("/auth/register", handler.Register)
+	router.POST("/auth/verify-email", handler.VerifyEmail)
+	router.POST("/auth/verify-email/resend", handler.ResendVerification)
+	router.POST("/auth/login", handler.Login)
+	router.POST("/auth/password/forgot", handler.ForgotPassword)
+	router.POST("/auth/password/reset", handler.ResetPassword)
+	me := router.Group("/me", auth.Middleware(config.Tokens(), store, logger))
+	me.GET("", handler.Me)
+	me.GET("/orders", handler.MyOrders)
+	me.GET("/orders/:id", handler.MyOrder)
+
+	// emailed returns the token in the latest account email of event.
+	link := regexp.MustCompile(`https://shop\.example\.com/[a-z-]+\?token=([\w-]+)`)
+	emailed := func(t *testing.T, event string) string {
+		t.Helper()
+		due, err := store.Notifications().DueNotifications(ctx, time.Now().Add(time.Minute), 100)
+		require.NoError(t, err)
+		for i := len(due) - 1; i >= 0; i-- {
+			if due[i].Event == event {
+				match := link.FindStringSubmatch(due[i].Body)
+				require.NotNil(t, match, due[i].Body)
+				return match[1]
+			}
+		}
+		t.Fatalf("no %s email queued", event)
+		return ""
+	}
+	login := func(email, password string) *httptest.ResponseRecorder {
+		return performRequest(router, "POST", "/auth/login", fmt.Sprintf(`{"email":%q,"password":%q}`, email, password))
+	}
+	authorized := func(method, path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	var session models.Session
+	t.Run("Register, verify and log in", func(t *testing.T) {
+		w := performRequest(router, "POST", "/auth/register",
+			`{"name":"Wanjiru Kamau","email":"wanjiru@example.com","password":"correct horse"}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		assert.NotContains(t, w.Body.String(), "password")
+
+		w = login("wanjiru@example.com", "correct horse")
+		assert.Equal(t, http.StatusForbidden, w.Code, "not verified yet")
+
+		token := emailed(t, notify.EventVerifyEmail)
+		w = performRequest(router, "POST", "/auth/verify-email", fmt.Sprintf(`{"token":%q}`, token))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		w = performRequest(router, "POST", "/auth/verify-email", fmt.Sprintf(`{"token":%q}`, token))
+		assert.Equal(t, http.StatusBadRequest, w.Code, "tokens are single use")
+
+		w = login("Wanjiru@Example.com", "correct horse")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+		assert.Equal(t, "Bearer", session.TokenType)
+		assert.Equal(t, "wanjiru@example.com", session.Customer.Email)
+		assert.NotNil(t, session.Customer.EmailVerifiedAt)
+	})
+
+	t.Run("Bad credentials", func(t *testing.T) {
+		w := login("wanjiru@example.com", "wrong horse")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid email or password")
+		w = login("nobody@example.com", "correct horse")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid email or password", "same answer for unknown emails")
+	})
+
+	t.Run("Duplicate registration", func(t *testing.T) {
+		w := performRequest(router, "POST", "/auth/register",
+			`{"name":"Someone Else","email":"WANJIRU@example.com","password":"another password"}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		w = performRequest(router, "POST", "/auth/register", `{"name":"Short","email":"short@example.com","password":"short"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"password"`)
+	})
+
+	t.Run("Me", func(t *testing.T) {
+		w := authorized("GET", "/me", session.Token)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var customer models.Customer
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &customer))
+		assert.Equal(t, session.Customer.ID, customer.ID)
+
+		w = performRequest(router, "GET", "/me", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Order history", func(t *testing.T) {
+		kettle := &models.Product{Name: "Kettle", Price: 2500}
+		require.NoError(t, store.Products().CreateProduct(ctx, kettle))
+		other := &models.Customer{Name: "Otieno", Email: "otieno@example.com"}
+		require.NoError(t, store.Customers().CreateCustomer(ctx, other))
+		newOrder := func(customerID uint) *models.Order {
+			order := &models.Order{CustomerID: customerID, Products: []models.Product{*kettle}, Currency: "KES", Items: []models.OrderItem{
+				{ProductID: kettle.ID, Name: "Kettle", UnitPrice: 2500, Quantity: 1, Total: 2500},
+			}}
+			require.NoError(t, store.Orders().CreateOrder(ctx, order))
+			return order
+		}
+		first, second, theirs := newOrder(session.Customer.ID), newOrder(session.Customer.ID), newOrder(other.ID)
+		require.NoError(t, store.Orders().UpdateOrderStatus(ctx, first.ID, models.OrderPaid))
+		require.NoError(t, store.Orders().RecordPayment(ctx, first.ID, "QK12ABC3DE", time.Now()))
+
+		w := authorized("GET", "/me/orders?per_page=1", session.Token)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "2", w.Header().Get("X-Total-Count"))
+		var orders []models.Order
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &orders))
+		require.Len(t, orders, 1)
+		assert.Equal(t, second.ID, orders[0].ID, "newest first")
+
+		w = authorized("GET", fmt.Sprintf("/me/orders/%d", first.ID), session.Token)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var order models.Order
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &order))
+		assert.Equal(t, models.OrderPaid, order.Status)
+		assert.Equal(t, "QK12ABC3DE", order.PaymentReference)
+
+		w = authorized("GET", fmt.Sprintf("/me/orders/%d", theirs.ID), session.Token)
+		assert.Equal(t, http.StatusNotFound, w.Code, "other customers' orders are hidden")
+		w = authorized("GET", "/me/orders?per_page=500", session.Token)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Password reset", func(t *testing.T) {
+		w := performRequest(router, "POST", "/auth/password/forgot", `{"email":"nobody@example.com"}`)
+		assert.Equal(t, http.StatusAccepted, w.Code, "unknown emails are not revealed")
+		w = performRequest(router, "POST", "/auth/password/forgot", `{"email":"wanjiru@example.com"}`)
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+		token := emailed(t, notify.EventResetPassword)
+		w = performRequest(router, "POST", "/auth/password/reset", fmt.Sprintf(`{"token":%q,"password":"new password"}`, token))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		w = performRequest(router, "POST", "/auth/password/reset", fmt.Sprintf(`{"token":%q,"password":"newer password"}`, token))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"token"`)
+
+		assert.Equal(t, http.StatusUnauthorized, login("wanjiru@example.com", "correct horse").Code)
+		assert.Equal(t, http.StatusOK, login("wanjiru@example.com", "new password").Code)
+	})
+
+	t.Run("Customers created by staff", func(t *testing.T) {
+		customer := &models.Customer{Name: "Achieng", Email: "achieng@example.com"}
+		require.NoError(t, store.Customers().CreateCustomer(ctx, customer))
+		w := login("achieng@example.com", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = login("achieng@example.com", "anything at all")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = performRequest(router, "POST", "/auth/register",
+			`{"name":"Achieng Odhiambo","email":"achieng@example.com","password":"correct horse"}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var registered models.Customer
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &registered))
+		assert.Equal(t, customer.ID, registered.ID, "takes over the existing customer")
+
+		w = performRequest(router, "POST", "/auth/verify-email/resend", `{"email":"achieng@example.com"}`)
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		token := emailed(t, notify.EventVerifyEmail)
+		w = performRequest(router, "POST", "/auth/verify-email", fmt.Sprintf(`{"token":%q}`, token))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, http.StatusOK, login("achieng@example.com", "correct horse").Code)
+	})
+
+	t.Run("Old sessions end with a password reset", func(t *testing.T) {
+		w := authorized("GET", "/me", session.Token)
+		if !strings.Contains(w.Header().Get("WWW-Authenticate"), "invalid_token") {
+			// The reset and the original login happened in the same second.
+			t.Skip("session was issued in the same second as the reset")
+		}
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
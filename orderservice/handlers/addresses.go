@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"orderservice/apperrors"
+	"orderservice/auth"
+	"orderservice/logging"
+	"orderservice/models"
+	"orderservice/repository"
+	"orderservice/validation"
+)
+
+// AddressHandler manages the saved delivery addresses of the customer
+// signed in through auth.Middleware.
+type AddressHandler struct {
+	store  repository.Store
+	logger *zap.Logger
+}
+
+func NewAddressHandler(store repository.Store, logger *zap.Logger) *AddressHandler {
+	return &AddressHandler{
+		store:  store,
+		logger: logger,
+	}
+}
+
+func (h *AddressHandler) log(c *gin.Context) *zap.Logger {
+	return logging.FromContext(c.Request.Context(), h.logger)
+}
+
+func (h *AddressHandler) CreateAddress(c *gin.Context) {
+	var address models.Address
+	if err := validation.BindJSON(c, &address); err != nil {
+		h.log(c).Error("Invalid address input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	address.CustomerID = auth.Customer(c).ID
+	address.Phone = models.NormalizePhone(address.Phone)
+
+	if err := h.store.Addresses().CreateAddress(c.Request.Context(), &address); err != nil {
+		h.log(c).Error("Failed to create address", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	h.log(c).Info("Address created", zap.Uint("address_id", address.ID))
+	c.JSON(http.StatusCreated, address)
+}
+
+func (h *AddressHandler) GetAddresses(c *gin.Context) {
+	addresses, err := h.store.Addresses().ListAddresses(c.Request.Context(), auth.Customer(c).ID)
+	if err != nil {
+		h.log(c).Error("Failed to fetch addresses", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	if addresses == nil {
+		addresses = []models.Address{}
+	}
+	c.JSON(http.StatusOK, addresses)
+}
+
+func (h *AddressHandler) UpdateAddress(c *gin.Context) {
+	customerID := auth.Customer(c).ID
+	addressID, ok := h.id(c, "address_id", "address")
+	if !ok {
+		return
+	}
+	var address models.Address
+	if err := validation.BindJSON(c, &address); err != nil {
+		h.log(c).Error("Invalid address input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	address.ID = addressID
+	address.CustomerID = customerID
+	address.Phone = models.NormalizePhone(address.Phone)
+
+	ctx := c.Request.Context()
+	err := h.store.WithinTx(ctx, func(tx repository.Store) error {
+		if err := h.owned(ctx, tx, customerID, addressID); err != nil {
+			return err
+		}
+		return tx.Addresses().UpdateAddress(ctx, &address)
+	})
+	if err != nil {
+		h.log(c).Error("Failed to update address", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	h.log(c).Info("Address updated", zap.Uint("address_id", address.ID))
+	c.JSON(http.StatusOK, address)
+}
+
+// DeleteAddress removes a saved address. Orders keep their own copy of the
+// address they were shipped to.
+func (h *AddressHandler) DeleteAddress(c *gin.Context) {
+	customerID := auth.Customer(c).ID
+	addressID, ok := h.id(c, "address_id", "address")
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	err := h.store.WithinTx(ctx, func(tx repository.Store) error {
+		if err := h.owned(ctx, tx, customerID, addressID); err != nil {
+			return err
+		}
+		return tx.Addresses().DeleteAddress(ctx, addressID)
+	})
+	if err != nil {
+		h.log(c).Error("Failed to delete address", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	h.log(c).Info("Address deleted", zap.Uint("address_id", addressID))
+	c.Status(http.StatusNoContent)
+}
+
+// owned returns not found unless the address exists and belongs to the
+// customer, so one customer's addresses cannot be reached through another.
+func (h *AddressHandler) owned(ctx context.Context, store repository.Store, customerID, addressID uint) error {
+	address, err := store.Addresses().GetAddress(ctx, addressID)
+	if err != nil {
+		return err
+	}
+	if address.CustomerID != customerID {
+		return apperrors.NotFound("address not found", nil)
+	}
+	return nil
+}
+
+// id parses the path parameter param, responding with an error naming
+// entity if it is not an ID.
+func (h *AddressHandler) id(c *gin.Context, param, entity string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(param), 10, 0)
+	if err != nil {
+		h.log(c).Error("Invalid "+entity+" ID", zap.Error(err))
+		apperrors.Respond(c, apperrors.Validation("invalid "+entity+" ID"))
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"orderservice/apperrors"
+	"orderservice/logging"
+	"orderservice/models"
+	"orderservice/repository"
+	"orderservice/validation"
+)
+
+// AuditHandler serves the audit log.
+type AuditHandler struct {
+	store  repository.Store
+	logger *zap.Logger
+}
+
+func NewAuditHandler(store repository.Store, logger *zap.Logger) *AuditHandler {
+	return &AuditHandler{
+		store:  store,
+		logger: logger,
+	}
+}
+
+func (h *AuditHandler) log(c *gin.Context) *zap.Logger {
+	return logging.FromContext(c.Request.Context(), h.logger)
+}
+
+// GetAudit lists audit entries, newest first, one page at a time and
+// filtered by the query parameters. The number of matches across all pages
+// is returned in the X-Total-Count header.
+func (h *AuditHandler) GetAudit(c *gin.Context) {
+	var query models.AuditQuery
+	if err := validation.BindQuery(c, &query); err != nil {
+		h.log(c).Error("Invalid audit query", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PerPage == 0 {
+		query.PerPage = 50
+	}
+
+	entries, total, err := h.store.Audit().ListAudit(c.Request.Context(), query)
+	if err != nil {
+		h.log(c).Error("Failed to fetch audit entries", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	if entries == nil {
+		entries = []models.AuditEntry{}
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,92 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"orderservice/audit"
+	"orderservice/auth"
+	"orderservice/handlers"
+	"orderservice/logging"
+	"orderservice/models"
+	"orderservice/repository"
+)
+
+func TestGetAudit(t *testing.T) {
+	store := repository.Audited(repository.NewMemoryStore())
+	logger, _ := zap.NewDevelopment()
+	orders := handlers.NewOrderHandler(store, rates, exchange, logger)
+	handler := handlers.NewAuditHandler(store, logger)
+
+	router := gin.New()
+	router.Use(logging.Middleware(logger), auth.Service(serviceToken), audit.Middleware(auth.Trusted))
+	router.PUT("/orders/:id/status", orders.UpdateOrderStatus)
+	router.GET("/audit", handler.GetAudit)
+
+	_, order := seedOrder(store)
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/orders/%d/status", order.ID), strings.NewReader(`{"status":"paid"}`))
+	req.Header.Set(auth.ServiceHeader, serviceToken)
+	req.Header.Set(audit.ActorHeader, "paymentservice")
+	req.Header.Set(logging.RequestIDHeader, "req-paid")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	list := func(t *testing.T, query string) ([]models.AuditEntry, string) {
+		w := performRequest(router, "GET", "/audit"+query, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var entries []models.AuditEntry
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+		return entries, w.Header().Get("X-Total-Count")
+	}
+
+	t.Run("Who paid the order", func(t *testing.T) {
+		entries, total := list(t, fmt.Sprintf("?entity_type=order&entity_id=%d&action=%s", order.ID, repository.ActionOrderStatusChanged))
+		assert.Equal(t, "1", total)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "paymentservice", entries[0].Actor)
+		assert.Equal(t, "req-paid", entries[0].RequestID)
+		assert.Equal(t, "192.0.2.1", entries[0].SourceIP)
+		assert.JSONEq(t, `{"status":{"before":"pending","after":"paid"}}`, mustJSON(t, entries[0].Changes))
+	})
+
+	t.Run("All entries", func(t *testing.T) {
+		entries, total := list(t, "")
+		assert.Equal(t, "4", total, "customer, product and order created, then paid")
+		assert.Equal(t, repository.ActionOrderStatusChanged, entries[0].Action, "newest first")
+
+		entries, total = list(t, "?per_page=1&page=2&from=2000-01-01T00:00:00Z")
+		assert.Equal(t, "4", total)
+		assert.Len(t, entries, 1)
+
+		entries, total = list(t, "?actor=nobody")
+		assert.Equal(t, "0", total)
+		assert.NotNil(t, entries)
+	})
+
+	t.Run("Invalid query", func(t *testing.T) {
+		for _, query := range []string{
+			"?per_page=500",
+			"?entity_id=abc",
+			"?from=yesterday",
+			"?from=2026-02-01T00:00:00Z&to=2026-01-01T00:00:00Z",
+		} {
+			w := performRequest(router, "GET", "/audit"+query, "")
+			assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		}
+	})
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(data)
+}
@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"orderservice/apperrors"
+	"orderservice/carts"
+	"orderservice/logging"
+	"orderservice/models"
+	"orderservice/money"
+	"orderservice/notify"
+	"orderservice/promotions"
+	"orderservice/repository"
+	"orderservice/tax"
+	"orderservice/validation"
+)
+
+type CartHandler struct {
+	store    repository.Store
+	rates    tax.Rates
+	exchange money.Rates
+	ttl      time.Duration
+	logger   *zap.Logger
+}
+
+// NewCartHandler returns a handler whose carts expire ttl after they were
+// last changed.
+func NewCartHandler(store repository.Store, rates tax.Rates, exchange money.Rates, ttl time.Duration, logger *zap.Logger) *CartHandler {
+	return &CartHandler{
+		store:    store,
+		rates:    rates,
+		exchange: exchange,
+		ttl:      ttl,
+		logger:   logger,
+	}
+}
+
+func (h *CartHandler) log(c *gin.Context) *zap.Logger {
+	return logging.FromContext(c.Request.Context(), h.logger)
+}
+
+func (h *CartHandler) CreateCart(c *gin.Context) {
+	var req models.CreateCartRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		h.log(c).Error("Invalid cart input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	now := time.Now()
+	cart := models.Cart{
+		CustomerID: req.CustomerID,
+		Status:     models.CartOpen,
+		Currency:   req.Currency,
+		ExpiresAt:  now.Add(h.ttl),
+	}
+	if cart.Currency == "" {
+		cart.Currency = h.exchange.Base
+	}
+	err := func() error {
+		if err := checkCurrency(h.exchange, cart.Currency); err != nil {
+			return err
+		}
+		if cart.CustomerID != 0 {
+			if err := checkCustomer(ctx, h.store, cart.CustomerID); err != nil {
+				return err
+			}
+		}
+		for i, item := range req.Items {
+			if existing := cart.Item(item.ProductID, item.VariantID); existing != nil {
+				item.Quantity += existing.Quantity
+			}
+			if err := carts.SetItem(ctx, h.store, &cart, item, fmt.Sprintf("items[%d].", i)); err != nil {
+				return err
+			}
+		}
+		for _, code := range req.CouponCodes {
+			if err := h.addCoupon(c, h.store, &cart, code, now); err != nil {
+				return err
+			}
+		}
+		return h.store.Carts().CreateCart(ctx, &cart)
+	}()
+	if err != nil {
+		h.log(c).Error("Cart creation failed", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	logging.With(c, h.logger, zap.Uint("cart_id", cart.ID)).Info("Cart created")
+	h.respond(c, http.StatusCreated, &cart, now)
+}
+
+func (h *CartHandler) GetCart(c *gin.Context) {
+	cart, ok := h.load(c)
+	if !ok {
+		return
+	}
+	h.respond(c, http.StatusOK, cart, time.Now())
+}
+
+// AddItem adds a product to the cart, or adds to its quantity if the
+// product is already there.
+func (h *CartHandler) AddItem(c *gin.Context) {
+	var req models.CartItemRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		h.log(c).Error("Invalid cart item input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	h.update(c, func(tx repository.Store, cart *models.Cart, now time.Time) error {
+		if existing := cart.Item(req.ProductID, req.VariantID); existing != nil {
+			req.Quantity += existing.Quantity
+		}
+		return carts.SetItem(c.Request.Context(), tx, cart, req, "")
+	})
+}
+
+func (h *CartHandler) UpdateItem(c *gin.Context) {
+	productID, variantID, ok := h.itemKey(c)
+	if !ok {
+		return
+	}
+	var req models.UpdateCartItemRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		h.log(c).Error("Invalid cart item input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	h.update(c, func(tx repository.Store, cart *models.Cart, now time.Time) error {
+		if cart.Item(productID, variantID) == nil {
+			return apperrors.NotFound("product is not in the cart", nil)
+		}
+		item := models.CartItemRequest{ProductID: productID, VariantID: variantID, Quantity: req.Quantity}
+		return carts.SetItem(c.Request.Context(), tx, cart, item, "")
+	})
+}
+
+func (h *CartHandler) RemoveItem(c *gin.Context) {
+	productID, variantID, ok := h.itemKey(c)
+	if !ok {
+		return
+	}
+	h.update(c, func(tx repository.Store, cart *models.Cart, now time.Time) error {
+		for i, item := range cart.Items {
+			if item.ProductID == productID && item.VariantID == variantID {
+				cart.Items = append(cart.Items[:i], cart.Items[i+1:]...)
+				return nil
+			}
+		}
+		return apperrors.NotFound("product is not in the cart", nil)
+	})
+}
+
+// AddCoupon adds a coupon to the cart once it has checked that the coupon
+// applies. The coupon is only redeemed at checkout.
+func (h *CartHandler) AddCoupon(c *gin.Context) {
+	var req models.ApplyCouponRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		h.log(c).Error("Invalid coupon input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	h.update(c, func(tx repository.Store, cart *models.Cart, now time.Time) error {
+		return h.addCoupon(c, tx, cart, req.Code, now)
+	})
+}
+
+func (h *CartHandler) RemoveCoupon(c *gin.Context) {
+	code := models.NormalizeCode(c.Param("code"))
+	h.update(c, func(tx repository.Store, cart *models.Cart, now time.Time) error {
+		for i, existing := range cart.CouponCodes {
+			if existing == code {
+				cart.CouponCodes = append(cart.CouponCodes[:i], cart.CouponCodes[i+1:]...)
+				return nil
+			}
+		}
+		return apperrors.NotFound("coupon is not in the cart", nil)
+	})
+}
+
+// Checkout turns the cart into an order. If any catalogue price has moved
+// since the customer last saw it, the cart is updated to the new prices
+// and checkout is refused so the customer can review them.
+func (h *CartHandler) Checkout(c *gin.Context) {
+	var req models.CheckoutRequest
+	if c.Request.ContentLength != 0 {
+		if err := validation.BindJSON(c, &req); err != nil {
+			h.log(c).Error("Invalid checkout input", zap.Error(err))
+			apperrors.Respond(c, err)
+			return
+		}
+	}
+	cart, ok := h.load(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	now := time.Now()
+	if err := carts.Open(cart, now); err != nil {
+		h.log(c).Error("Checkout refused", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	changed, err := carts.Reprice(ctx, h.store, cart)
+	if err == nil && changed {
+		err = h.store.Carts().SaveCart(ctx, cart)
+		if err == nil {
+			err = apperrors.Conflict("prices have changed since the cart was last updated; review the cart and check out again", nil)
+		}
+	}
+	if err != nil {
+		h.log(c).Error("Checkout refused", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	var order *models.Order
+	err = h.store.WithinTx(ctx, func(tx repository.Store) error {
+		cart, err := tx.Carts().GetCart(ctx, cart.ID)
+		if err != nil {
+			return err
+		}
+		if req.CustomerID != 0 {
+			if cart.CustomerID != 0 && cart.CustomerID != req.CustomerID {
+				return apperrors.Validation("customer does not match the cart",
+					apperrors.FieldError{Field: "customer_id", Message: "does not match the cart's customer"})
+			}
+			cart.CustomerID = req.CustomerID
+		}
+		order, err = carts.Checkout(ctx, tx, cart, req.Delivery(), h.rates, h.exchange, now)
+		if err != nil {
+			return err
+		}
+		return notify.Queue(ctx, tx, notify.EventOrderPlaced, order)
+	})
+	if err != nil {
+		h.log(c).Error("Checkout failed", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	logging.With(c, h.logger, zap.Uint("order_id", order.ID), zap.Uint("customer_id", order.CustomerID)).
+		Info("Cart checked out")
+	c.JSON(http.StatusCreated, withoutAddress(c, order))
+}
+
+// update loads the cart named in the request, applies change to it inside
+// a unit of work, pushes back its expiry and responds with the priced
+// cart.
+func (h *CartHandler) update(c *gin.Context, change func(tx repository.Store, cart *models.Cart, now time.Time) error) {
+	id, ok := h.cartID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	now := time.Now()
+	var cart *models.Cart
+	err := h.store.WithinTx(ctx, func(tx repository.Store) error {
+		var err error
+		if cart, err = tx.Carts().GetCart(ctx, id); err != nil {
+			return err
+		}
+		if err := carts.Open(cart, now); err != nil {
+			return err
+		}
+		if err := change(tx, cart, now); err != nil {
+			return err
+		}
+		cart.ExpiresAt = now.Add(h.ttl)
+		return tx.Carts().SaveCart(ctx, cart)
+	})
+	if err != nil {
+		h.log(c).Error("Cart update failed", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, cart, now)
+}
+
+// addCoupon adds code to cart if it applies on top of the cart's other
+// coupons.
+func (h *CartHandler) addCoupon(c *gin.Context, store repository.Store, cart *models.Cart, code string, now time.Time) error {
+	code = models.NormalizeCode(code)
+	for _, existing := range cart.CouponCodes {
+		if existing == code {
+			return apperrors.Conflict("coupon "+code+" is already applied", nil)
+		}
+	}
+
+	ctx := c.Request.Context()
+	order, err := carts.Quote(ctx, store, cart, h.rates, h.exchange, now)
+	if err != nil {
+		return err
+	}
+	if _, err := promotions.Preview(ctx, store, order, []string{code}, now); err != nil {
+		return err
+	}
+	cart.CouponCodes = append(cart.CouponCodes, code)
+	return nil
+}
+
+// respond prices cart and writes it with status.
+func (h *CartHandler) respond(c *gin.Context, status int, cart *models.Cart, now time.Time) {
+	if err := carts.Price(c.Request.Context(), h.store, cart, h.rates, h.exchange, now); err != nil {
+		h.log(c).Error("Failed to price cart", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	c.JSON(status, cart)
+}
+
+// load fetches the cart named in the request, responding with an error if
+// it cannot.
+func (h *CartHandler) load(c *gin.Context) (*models.Cart, bool) {
+	id, ok := h.cartID(c)
+	if !ok {
+		return nil, false
+	}
+	cart, err := h.store.Carts().GetCart(c.Request.Context(), id)
+	if err != nil {
+		h.log(c).Error("Failed to fetch cart", zap.Error(err))
+		apperrors.Respond(c, err)
+		return nil, false
+	}
+	return cart, true
+}
+
+func (h *CartHandler) cartID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		h.log(c).Error("Invalid cart ID", zap.Error(err))
+		apperrors.Respond(c, apperrors.Validation("invalid cart ID"))
+		return 0, false
+	}
+	logging.With(c, h.logger, zap.Uint64("cart_id", id))
+	return uint(id), true
+}
+
+// itemKey returns the product in the request path and the variant in the
+// variant_id query parameter, which is zero for products without variants.
+func (h *CartHandler) itemKey(c *gin.Context) (productID, variantID uint, ok bool) {
+	id, err := strconv.ParseUint(c.Param("product_id"), 10, 0)
+	if err != nil {
+		h.log(c).Error("Invalid product ID", zap.Error(err))
+		apperrors.Respond(c, apperrors.Validation("invalid product ID"))
+		return 0, 0, false
+	}
+	var variant uint64
+	if v := c.Query("variant_id"); v != "" {
+		if variant, err = strconv.ParseUint(v, 10, 0); err != nil {
+			h.log(c).Error("Invalid variant ID", zap.Error(err))
+			apperrors.Respond(c, apperrors.Validation("invalid variant ID"))
+			return 0, 0, false
+		}
+	}
+	return uint(id), uint(variant), true
+}
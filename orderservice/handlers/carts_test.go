@@ -0,0 +1,153 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"orderservice/handlers"
+	"orderservice/models"
+	"orderservice/repository"
+)
+
+func TestCarts(t *testing.T) {
+	store := repository.NewMemoryStore()
+	logger, _ := zap.NewDevelopment()
+	handler := handlers.NewCartHandler(store, rates, exchange, time.Hour, logger)
+
+	router := gin.New()
+	router.POST("/carts", handler.CreateCart)
+	router.GET("/carts/:id", handler.GetCart)
+	router.POST("/carts/:id/items", handler.AddItem)
+	router.PUT("/carts/:id/items/:product_id", handler.UpdateItem)
+	router.DELETE("/carts/:id/items/:product_id", handler.RemoveItem)
+	router.POST("/carts/:id/coupons", handler.AddCoupon)
+	router.DELETE("/carts/:id/coupons/:code", handler.RemoveCoupon)
+	router.POST("/carts/:id/checkout", handler.Checkout)
+
+	customer := &models.Customer{Name: "Shopper", Email: "shopper@example.com"}
+	store.Customers().CreateCustomer(ctx, customer)
+	stock := 5
+	pen := &models.Product{Name: "Pen", Price: 10, Stock: &stock}
+	store.Products().CreateProduct(ctx, pen)
+	book := &models.Product{Name: "Book", Price: 40}
+	store.Products().CreateProduct(ctx, book)
+	store.Promotions().CreatePromotion(ctx, &models.Promotion{Code: "TENOFF", Type: models.DiscountFixed, Value: 10})
+
+	cartOf := func(t *testing.T, body []byte) *models.Cart {
+		var cart models.Cart
+		require.NoError(t, json.Unmarshal(body, &cart))
+		return &cart
+	}
+
+	var cartID uint
+	t.Run("Create cart", func(t *testing.T) {
+		w := performRequest(router, "POST", "/carts",
+			fmt.Sprintf(`{"items":[{"product_id":%d,"quantity":2},{"product_id":%d,"quantity":1}]}`, pen.ID, pen.ID))
+
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		cart := cartOf(t, w.Body.Bytes())
+		cartID = cart.ID
+		require.Len(t, cart.Items, 1)
+		assert.Equal(t, 3, cart.Items[0].Quantity)
+		assert.Equal(t, 30.0, cart.Totals.Total)
+	})
+
+	t.Run("Add, update and remove items", func(t *testing.T) {
+		w := performRequest(router, "POST", fmt.Sprintf("/carts/%d/items", cartID),
+			fmt.Sprintf(`{"product_id":%d,"quantity":1}`, book.ID))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 70.0, cartOf(t, w.Body.Bytes()).Totals.Total)
+
+		w = performRequest(router, "PUT", fmt.Sprintf("/carts/%d/items/%d", cartID, pen.ID), `{"quantity":1}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 50.0, cartOf(t, w.Body.Bytes()).Totals.Total)
+
+		w = performRequest(router, "DELETE", fmt.Sprintf("/carts/%d/items/%d", cartID, book.ID), "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, cartOf(t, w.Body.Bytes()).Items, 1)
+
+		w = performRequest(router, "DELETE", fmt.Sprintf("/carts/%d/items/%d", cartID, book.ID), "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Quantity above stock", func(t *testing.T) {
+		w := performRequest(router, "PUT", fmt.Sprintf("/carts/%d/items/%d", cartID, pen.ID), `{"quantity":6}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"quantity"`)
+	})
+
+	t.Run("Coupons", func(t *testing.T) {
+		performRequest(router, "POST", fmt.Sprintf("/carts/%d/items", cartID),
+			fmt.Sprintf(`{"product_id":%d,"quantity":1}`, book.ID))
+
+		w := performRequest(router, "POST", fmt.Sprintf("/carts/%d/coupons", cartID), `{"code":"tenoff"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		cart := cartOf(t, w.Body.Bytes())
+		assert.Equal(t, []string{"TENOFF"}, cart.CouponCodes)
+		assert.Equal(t, 40.0, cart.Totals.Total)
+
+		w = performRequest(router, "POST", fmt.Sprintf("/carts/%d/coupons", cartID), `{"code":"BOGUS"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = performRequest(router, "DELETE", fmt.Sprintf("/carts/%d/coupons/bogus", cartID), "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Checkout refuses changed prices", func(t *testing.T) {
+		changed := *book
+		changed.Price = 45
+		store.Products().CreateProduct(ctx, &changed)
+		w := performRequest(router, "POST", fmt.Sprintf("/carts/%d/items", cartID),
+			fmt.Sprintf(`{"product_id":%d,"quantity":1}`, changed.ID))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		// The catalogue price moves after the customer saw it
+		stored, _ := store.Carts().GetCart(ctx, cartID)
+		stored.Item(changed.ID, 0).UnitPrice = 42
+		store.Carts().SaveCart(ctx, stored)
+
+		w = performRequest(router, "POST", fmt.Sprintf("/carts/%d/checkout", cartID),
+			fmt.Sprintf(`{"customer_id":%d}`, customer.ID))
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		w = performRequest(router, "GET", fmt.Sprintf("/carts/%d", cartID), "")
+		assert.Equal(t, 45.0, cartOf(t, w.Body.Bytes()).Item(changed.ID, 0).UnitPrice)
+	})
+
+	t.Run("Checkout", func(t *testing.T) {
+		w := performRequest(router, "POST", fmt.Sprintf("/carts/%d/checkout", cartID),
+			fmt.Sprintf(`{"customer_id":%d}`, customer.ID))
+
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var order models.Order
+		json.Unmarshal(w.Body.Bytes(), &order)
+		assert.Equal(t, customer.ID, order.CustomerID)
+		assert.Len(t, order.Items, 3)
+		assert.Equal(t, 10.0, order.Discount)
+		assert.Equal(t, 85.0, order.Total)
+
+		product, _ := store.Products().GetProduct(ctx, pen.ID)
+		assert.Equal(t, 4, *product.Stock)
+	})
+
+	t.Run("Checked out cart", func(t *testing.T) {
+		w := performRequest(router, "POST", fmt.Sprintf("/carts/%d/checkout", cartID), "")
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		w = performRequest(router, "POST", fmt.Sprintf("/carts/%d/items", cartID),
+			fmt.Sprintf(`{"product_id":%d,"quantity":1}`, pen.ID))
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Unknown cart", func(t *testing.T) {
+		w := performRequest(router, "GET", "/carts/999", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
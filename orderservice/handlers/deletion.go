@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"orderservice/apperrors"
+	"orderservice/auth"
+	"orderservice/logging"
+	"orderservice/repository"
+)
+
+// DeletionHandler soft-deletes customers, products and orders, and
+// restores them until the purge job removes them for good.
+type DeletionHandler struct {
+	store  repository.Store
+	logger *zap.Logger
+}
+
+func NewDeletionHandler(store repository.Store, logger *zap.Logger) *DeletionHandler {
+	return &DeletionHandler{
+		store:  store,
+		logger: logger,
+	}
+}
+
+func (h *DeletionHandler) log(c *gin.Context) *zap.Logger {
+	return logging.FromContext(c.Request.Context(), h.logger)
+}
+
+// DeleteCustomer deletes a customer without open orders, which also ends
+// their sessions.
+func (h *DeletionHandler) DeleteCustomer(c *gin.Context) {
+	h.remove(c, "customer", h.store.Customers().DeleteCustomer)
+}
+
+func (h *DeletionHandler) RestoreCustomer(c *gin.Context) {
+	h.restore(c, "customer", h.store.Customers().RestoreCustomer, func(ctx context.Context, id uint) (interface{}, error) {
+		return h.store.Customers().GetCustomer(ctx, id)
+	})
+}
+
+// DeleteProduct deletes a product that no open order includes. Products
+// still being delivered can be archived instead.
+func (h *DeletionHandler) DeleteProduct(c *gin.Context) {
+	h.remove(c, "product", h.store.Products().DeleteProduct)
+}
+
+func (h *DeletionHandler) RestoreProduct(c *gin.Context) {
+	h.restore(c, "product", h.store.Products().RestoreProduct, func(ctx context.Context, id uint) (interface{}, error) {
+		return h.store.Products().GetProduct(ctx, id)
+	})
+}
+
+// DeleteOrder deletes an order that is no longer open.
+func (h *DeletionHandler) DeleteOrder(c *gin.Context) {
+	h.remove(c, "order", h.store.Orders().DeleteOrder)
+}
+
+func (h *DeletionHandler) RestoreOrder(c *gin.Context) {
+	h.restore(c, "order", h.store.Orders().RestoreOrder, func(ctx context.Context, id uint) (interface{}, error) {
+		return h.store.Orders().GetOrder(ctx, id)
+	})
+}
+
+func (h *DeletionHandler) remove(c *gin.Context, entity string, remove func(ctx context.Context, id uint) error) {
+	id, ok := h.id(c, entity)
+	if !ok {
+		return
+	}
+
+	if err := remove(c.Request.Context(), id); err != nil {
+		h.log(c).Error("Failed to delete "+entity, zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	h.log(c).Info("Deleted " + entity)
+	c.Status(http.StatusNoContent)
+}
+
+// restore undoes the deletion of the entity and responds with it.
+func (h *DeletionHandler) restore(c *gin.Context, entity string, restore func(ctx context.Context, id uint) error,
+	get func(ctx context.Context, id uint) (interface{}, error)) {
+	id, ok := h.id(c, entity)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	var restored interface{}
+	err := restore(ctx, id)
+	if err == nil {
+		restored, err = get(ctx, id)
+	}
+	if err != nil {
+		h.log(c).Error("Failed to restore "+entity, zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	h.log(c).Info("Restored " + entity)
+	c.JSON(http.StatusOK, restored)
+}
+
+func (h *DeletionHandler) id(c *gin.Context, entity string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		h.log(c).Error("Invalid "+entity+" ID", zap.Error(err))
+		apperrors.Respond(c, apperrors.Validation("invalid "+entity+" ID"))
+		return 0, false
+	}
+	logging.With(c, h.logger, zap.Uint64(entity+"_id", id))
+	return uint(id), true
+}
+
+// allowDeleted reports whether the request may see deleted records when it
+// asks for them with include_deleted. Only staff may; anyone else gets a
+// 401 and false.
+func allowDeleted(c *gin.Context, include bool) bool {
+	if include && !auth.IsStaff(c) {
+		apperrors.Respond(c, apperrors.Unauthenticated("staff credentials required to include deleted records", nil))
+		return false
+	}
+	return true
+}
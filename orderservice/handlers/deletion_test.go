@@ -0,0 +1,116 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"orderservice/audit"
+	"orderservice/auth"
+	"orderservice/handlers"
+	"orderservice/models"
+	"orderservice/repository"
+)
+
+func TestDeletion(t *testing.T) {
+	store := repository.Audited(repository.NewMemoryStore())
+	logger, _ := zap.NewDevelopment()
+	handler := handlers.NewDeletionHandler(store, logger)
+	orders := handlers.NewOrderHandler(store, rates, exchange, logger)
+
+	router := gin.New()
+	router.Use(auth.Staff(staffToken), audit.Middleware(auth.Trusted))
+	staff := router.Group("", auth.RequireStaff())
+	staff.DELETE("/customers/:id", handler.DeleteCustomer)
+	staff.POST("/customers/:id/restore", handler.RestoreCustomer)
+	staff.DELETE("/products/:id", handler.DeleteProduct)
+	staff.POST("/products/:id/restore", handler.RestoreProduct)
+	router.GET("/products", orders.GetProducts)
+	staff.DELETE("/orders/:id", handler.DeleteOrder)
+	staff.POST("/orders/:id/restore", handler.RestoreOrder)
+	router.GET("/orders/:id", orders.GetOrder)
+	// asStaff sends a request the way the admin gateway does for staff.
+	asStaff := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set(auth.StaffHeader, staffToken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	customer, order := seedOrder(store)
+	product := order.Products[0]
+	customerPath := fmt.Sprintf("/customers/%d", customer.ID)
+	productPath := fmt.Sprintf("/products/%d", product.ID)
+	orderPath := fmt.Sprintf("/orders/%d", order.ID)
+
+	t.Run("Open orders", func(t *testing.T) {
+		w := asStaff("DELETE", productPath)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "archive it")
+		assert.Equal(t, http.StatusConflict, asStaff("DELETE", customerPath).Code)
+		assert.Equal(t, http.StatusConflict, asStaff("DELETE", orderPath).Code)
+	})
+
+	t.Run("Staff only", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, performRequest(router, "DELETE", productPath, "").Code)
+		assert.Equal(t, http.StatusUnauthorized, performRequest(router, "POST", orderPath+"/restore", "").Code)
+		assert.Equal(t, http.StatusUnauthorized, performRequest(router, "GET", orderPath+"?include_deleted=true", "").Code)
+		assert.Equal(t, http.StatusUnauthorized, performRequest(router, "GET", "/products?include_deleted=true", "").Code)
+		assert.Equal(t, http.StatusOK, performRequest(router, "GET", orderPath+"?include_deleted=false", "").Code)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, store.Orders().UpdateOrderStatus(ctx, order.ID, models.OrderCancelled))
+		for _, path := range []string{productPath, orderPath, customerPath} {
+			w := asStaff("DELETE", path)
+			require.Equal(t, http.StatusNoContent, w.Code, path+": "+w.Body.String())
+			assert.Equal(t, http.StatusNotFound, asStaff("DELETE", path).Code, path)
+		}
+		entries, _, err := store.Audit().ListAudit(ctx, models.AuditQuery{Action: repository.ActionProductDeleted, Page: 1, PerPage: 10})
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		assert.Equal(t, http.StatusNotFound, performRequest(router, "GET", orderPath, "").Code)
+		w := asStaff("GET", orderPath+"?include_deleted=true")
+		require.Equal(t, http.StatusOK, w.Code)
+		var deleted models.Order
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &deleted))
+		assert.True(t, deleted.DeletedAt.Valid)
+		assert.Equal(t, http.StatusBadRequest, asStaff("GET", orderPath+"?include_deleted=maybe").Code)
+
+		w = performRequest(router, "GET", "/products?status=all", "")
+		assert.Equal(t, "0", w.Header().Get("X-Total-Count"))
+		w = asStaff("GET", "/products?status=all&include_deleted=true")
+		assert.Equal(t, "1", w.Header().Get("X-Total-Count"))
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		w := asStaff("POST", productPath+"/restore")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var restored models.Product
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &restored))
+		assert.Equal(t, "Book", restored.Name)
+		assert.False(t, restored.DeletedAt.Valid)
+		assert.Equal(t, http.StatusNotFound, asStaff("POST", productPath+"/restore").Code, "not deleted")
+
+		w = asStaff("POST", customerPath+"/restore")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), customer.Email)
+		w = asStaff("POST", orderPath+"/restore")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, http.StatusOK, performRequest(router, "GET", orderPath, "").Code)
+	})
+
+	t.Run("Invalid ID", func(t *testing.T) {
+		w := asStaff("DELETE", "/products/abc")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid product ID")
+	})
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"orderservice/apperrors"
+	"orderservice/auth"
+	"orderservice/documents"
+	"orderservice/logging"
+	"orderservice/models"
+	"orderservice/repository"
+	"orderservice/validation"
+)
+
+// DocumentHandler renders invoices and receipts for orders. An order's
+// invoice is numbered when it is paid or when staff issue it; documents are
+// only produced once it has one, and every one reuses its number.
+type DocumentHandler struct {
+	store    repository.Store
+	business documents.Business
+	logger   *zap.Logger
+}
+
+func NewDocumentHandler(store repository.Store, business documents.Business, logger *zap.Logger) *DocumentHandler {
+	return &DocumentHandler{
+		store:    store,
+		business: business,
+		logger:   logger,
+	}
+}
+
+func (h *DocumentHandler) log(c *gin.Context) *zap.Logger {
+	return logging.FromContext(c.Request.Context(), h.logger)
+}
+
+// GetInvoice renders any order's invoice for staff.
+func (h *DocumentHandler) GetInvoice(c *gin.Context) {
+	h.render(c, documents.Invoice, false)
+}
+
+// GetReceipt renders any order's receipt for staff.
+func (h *DocumentHandler) GetReceipt(c *gin.Context) {
+	h.render(c, documents.Receipt, false)
+}
+
+// MyInvoice renders the invoice of one of the signed-in customer's orders.
+func (h *DocumentHandler) MyInvoice(c *gin.Context) {
+	h.render(c, documents.Invoice, true)
+}
+
+// MyReceipt renders the receipt of one of the signed-in customer's orders.
+func (h *DocumentHandler) MyReceipt(c *gin.Context) {
+	h.render(c, documents.Receipt, true)
+}
+
+// IssueInvoice numbers the order's invoice ahead of payment, for orders
+// invoiced before they are paid, and returns it. An order keeps the number
+// it already has.
+func (h *DocumentHandler) IssueInvoice(c *gin.Context) {
+	id, ok := h.orderID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	var invoice *models.Invoice
+	err := h.store.WithinTx(ctx, func(tx repository.Store) error {
+		order, err := tx.Orders().GetOrder(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := documents.Allowed(documents.Invoice, order); err != nil {
+			return err
+		}
+		invoice, err = tx.Invoices().IssueInvoice(ctx, order.ID)
+		return err
+	})
+	if err != nil {
+		h.log(c).Error("Failed to issue invoice", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	h.log(c).Info("Invoice issued", zap.String("number", invoice.Number))
+	c.JSON(http.StatusOK, invoice)
+}
+
+// render responds with the order's document of kind as HTML, or as PDF
+// when the format query parameter asks for it. With mine set the order
+// must belong to the signed-in customer.
+func (h *DocumentHandler) render(c *gin.Context, kind documents.Kind, mine bool) {
+	id, ok := h.orderID(c)
+	if !ok {
+		return
+	}
+
+	var req models.DocumentRequest
+	if err := validation.BindQuery(c, &req); err != nil {
+		h.log(c).Error("Invalid document query", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	var owner uint
+	if mine {
+		owner = auth.Customer(c).ID
+	}
+	doc, err := h.document(c.Request.Context(), kind, id, owner)
+	if err != nil {
+		h.log(c).Error("Failed to produce document", zap.String("kind", string(kind)), zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	var body bytes.Buffer
+	contentType := "text/html; charset=utf-8"
+	if req.Format == "pdf" {
+		contentType = "application/pdf"
+		err = doc.PDF(&body)
+		c.Header("Content-Disposition", `inline; filename="`+doc.Filename("pdf")+`"`)
+	} else {
+		err = doc.HTML(&body)
+	}
+	if err != nil {
+		h.log(c).Error("Failed to render document", zap.String("kind", string(kind)), zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	h.log(c).Info("Document produced", zap.String("kind", string(kind)), zap.String("number", doc.Number))
+	c.Data(http.StatusOK, contentType, body.Bytes())
+}
+
+// document builds the order's document of kind under the invoice it was
+// issued. A non-zero owner must be the order's customer.
+func (h *DocumentHandler) document(ctx context.Context, kind documents.Kind, id, owner uint) (documents.Document, error) {
+	order, err := h.store.Orders().GetOrder(ctx, id)
+	if err == nil && owner != 0 && order.CustomerID != owner {
+		err = apperrors.NotFound("order not found", nil)
+	}
+	if err != nil {
+		return documents.Document{}, err
+	}
+	customer, err := h.store.Customers().GetCustomer(ctx, order.CustomerID)
+	if err != nil {
+		return documents.Document{}, err
+	}
+	if err := documents.Allowed(kind, order); err != nil {
+		return documents.Document{}, err
+	}
+	invoice, err := h.store.Invoices().GetInvoice(ctx, order.ID)
+	if apperrors.Is(err, apperrors.KindNotFound) {
+		return documents.Document{}, apperrors.Conflict("order has not been invoiced yet", nil)
+	}
+	if err != nil {
+		return documents.Document{}, err
+	}
+	return documents.New(kind, h.business, invoice, order, customer)
+}
+
+// orderID parses the order ID in the path, responding with an error if it
+// is not one.
+func (h *DocumentHandler) orderID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		h.log(c).Error("Invalid order ID", zap.Error(err))
+		apperrors.Respond(c, apperrors.Validation("invalid order ID"))
+		return 0, false
+	}
+	logging.With(c, h.logger, zap.Uint64("order_id", id))
+	return uint(id), true
+}
@@ -0,0 +1,167 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"orderservice/apperrors"
+	"orderservice/auth"
+	"orderservice/documents"
+	"orderservice/handlers"
+	"orderservice/models"
+	"orderservice/repository"
+)
+
+func TestDocuments(t *testing.T) {
+	store := repository.NewMemoryStore()
+	logger, _ := zap.NewDevelopment()
+	business := documents.Business{Name: "Duka La Nyumbani", PIN: "P051234567X"}
+	handler := handlers.NewDocumentHandler(store, business, logger)
+	orderHandler := handlers.NewOrderHandler(store, rates, exchange, logger)
+
+	tokens := auth.NewTokens([]byte("0123456789abcdef0123456789abcdef"), time.Hour)
+
+	router := gin.New()
+	router.Use(auth.Staff(staffToken))
+	router.PUT("/orders/:id/status", orderHandler.UpdateOrderStatus)
+	staff := router.Group("", auth.RequireStaff())
+	staff.GET("/orders/:id/invoice", handler.GetInvoice)
+	staff.POST("/orders/:id/invoice", handler.IssueInvoice)
+	staff.GET("/orders/:id/receipt", handler.GetReceipt)
+	me := router.Group("/me", auth.Middleware(tokens, store, logger))
+	me.GET("/orders/:id/invoice", handler.MyInvoice)
+	me.GET("/orders/:id/receipt", handler.MyReceipt)
+
+	customer := &models.Customer{Name: "Wanjiru", Email: "wanjiru@example.com"}
+	store.Customers().CreateCustomer(ctx, customer)
+	other := &models.Customer{Name: "Otieno", Email: "otieno@example.com"}
+	store.Customers().CreateCustomer(ctx, other)
+	kettle := &models.Product{Name: "Kettle", Price: 2500}
+	store.Products().CreateProduct(ctx, kettle)
+	newOrder := func() *models.Order {
+		order := &models.Order{CustomerID: customer.ID, Products: []models.Product{*kettle}, Currency: "KES", TaxInclusive: true, Items: []models.OrderItem{
+			{ProductID: kettle.ID, Name: "Kettle", UnitPrice: 2500, Quantity: 1, TaxRate: 0.16, TaxAmount: 344.83, Total: 2500},
+		}}
+		require.NoError(t, store.Orders().CreateOrder(ctx, order))
+		return order
+	}
+	// asStaff sends a request the way the admin gateway does for staff.
+	asStaff := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set(auth.StaffHeader, staffToken)
+		router.ServeHTTP(w, req)
+		return w
+	}
+	// as sends a request signed in as the customer with id.
+	as := func(id uint, path string) *httptest.ResponseRecorder {
+		token, _, err := tokens.Issue(id, 0, time.Now())
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	order := newOrder()
+	invoicePath := fmt.Sprintf("/orders/%d/invoice", order.ID)
+	t.Run("Reading does not number an invoice", func(t *testing.T) {
+		w := asStaff("GET", invoicePath)
+		assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+		_, err := store.Invoices().GetInvoice(ctx, order.ID)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+	})
+
+	t.Run("Invoice issued by staff", func(t *testing.T) {
+		w := asStaff("POST", invoicePath)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), `"number":"INV-000001"`)
+
+		w = asStaff("GET", invoicePath)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "INV-000001")
+		assert.Contains(t, w.Body.String(), "Amount due")
+	})
+
+	t.Run("Staff or the order's customer only", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, performRequest(router, "GET", invoicePath, "").Code)
+		assert.Equal(t, http.StatusUnauthorized, performRequest(router, "POST", invoicePath, "").Code)
+		assert.Equal(t, http.StatusUnauthorized, performRequest(router, "GET", "/me"+invoicePath, "").Code)
+
+		w := as(customer.ID, "/me"+invoicePath)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), "INV-000001")
+		assert.Equal(t, http.StatusNotFound, as(other.ID, "/me"+invoicePath).Code)
+	})
+
+	t.Run("Receipt needs payment", func(t *testing.T) {
+		w := asStaff("GET", fmt.Sprintf("/orders/%d/receipt", order.ID))
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Receipt after M-Pesa payment", func(t *testing.T) {
+		w := performRequest(router, "PUT", fmt.Sprintf("/orders/%d/status", order.ID),
+			`{"status":"paid","payment_reference":"QK12ABC3DE"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		w = as(customer.ID, fmt.Sprintf("/me/orders/%d/receipt", order.ID))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		body := w.Body.String()
+		assert.Contains(t, body, "INV-000001", "same number as the invoice")
+		assert.Contains(t, body, "QK12ABC3DE")
+		assert.Contains(t, body, "2500.00 KES")
+		assert.Contains(t, body, "PIN: P051234567X")
+	})
+
+	t.Run("PDF", func(t *testing.T) {
+		w := asStaff("GET", fmt.Sprintf("/orders/%d/receipt?format=pdf", order.ID))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+		assert.Equal(t, `inline; filename="receipt-INV-000001.pdf"`, w.Header().Get("Content-Disposition"))
+		assert.True(t, strings.HasPrefix(w.Body.String(), "%PDF-"))
+
+		w = asStaff("GET", fmt.Sprintf("/orders/%d/receipt?format=docx", order.ID))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Numbers follow on without gaps", func(t *testing.T) {
+		cancelled := newOrder()
+		require.NoError(t, store.Orders().UpdateOrderStatus(ctx, cancelled.ID, models.OrderCancelled))
+		w := asStaff("POST", fmt.Sprintf("/orders/%d/invoice", cancelled.ID))
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		pending := newOrder()
+		w = asStaff("GET", fmt.Sprintf("/orders/%d/invoice", pending.ID))
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		// Paying an order numbers its invoice
+		paid := newOrder()
+		w = performRequest(router, "PUT", fmt.Sprintf("/orders/%d/status", paid.ID), `{"status":"paid"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		w = asStaff("GET", fmt.Sprintf("/orders/%d/invoice", paid.ID))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), "INV-000002")
+	})
+
+	t.Run("Unknown order", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, asStaff("GET", "/orders/9999/invoice").Code)
+		assert.Equal(t, http.StatusNotFound, asStaff("POST", "/orders/9999/invoice").Code)
+	})
+
+	t.Run("Invalid payment reference", func(t *testing.T) {
+		w := performRequest(router, "PUT", fmt.Sprintf("/orders/%d/status", order.ID),
+			`{"status":"paid","payment_reference":"QK12 ABC!"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"payment_reference"`)
+	})
+}
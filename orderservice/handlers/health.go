@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"orderservice/health"
+	"orderservice/logging"
+)
+
+type HealthHandler struct {
+	checker *health.Checker
+	logger  *zap.Logger
+}
+
+func NewHealthHandler(checker *health.Checker, logger *zap.Logger) *HealthHandler {
+	return &HealthHandler{checker: checker, logger: logger}
+}
+
+// Liveness reports that the process is up and serving requests.
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// Readiness reports the status of every dependency and returns 503 when
+// any of them is unavailable.
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	report := h.checker.Run(c.Request.Context())
+	if report.Status != health.StatusOK {
+		logging.FromContext(c.Request.Context(), h.logger).Warn("Readiness check failed", zap.Any("checks", report.Checks))
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,53 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"orderservice/handlers"
+	"orderservice/health"
+)
+
+func TestHealthHandler(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	dbErr := errors.New("connection refused")
+
+	checker := health.NewChecker(time.Second)
+	checker.Add("database", func(ctx context.Context) error { return dbErr })
+	handler := handlers.NewHealthHandler(checker, logger)
+
+	router := gin.Default()
+	router.GET("/healthz", handler.Liveness)
+	router.GET("/readyz", handler.Readiness)
+
+	t.Run("Liveness", func(t *testing.T) {
+		w := performRequest(router, "GET", "/healthz", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Not ready", func(t *testing.T) {
+		w := performRequest(router, "GET", "/readyz", "")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+		var report health.Report
+		json.Unmarshal(w.Body.Bytes(), &report)
+		assert.Equal(t, health.StatusUnavailable, report.Status)
+		assert.Equal(t, "connection refused", report.Checks["database"].Error)
+	})
+
+	t.Run("Ready", func(t *testing.T) {
+		dbErr = nil
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/readyz", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"orderservice/apperrors"
+	"orderservice/logging"
+	"orderservice/models"
+	"orderservice/repository"
+)
+
+// NotificationHandler shows the messages sent to customers about their
+// orders and lets failed ones be sent again.
+type NotificationHandler struct {
+	store  repository.Store
+	logger *zap.Logger
+}
+
+func NewNotificationHandler(store repository.Store, logger *zap.Logger) *NotificationHandler {
+	return &NotificationHandler{
+		store:  store,
+		logger: logger,
+	}
+}
+
+func (h *NotificationHandler) log(c *gin.Context) *zap.Logger {
+	return logging.FromContext(c.Request.Context(), h.logger)
+}
+
+// GetNotifications lists an order's notifications with their delivery
+// attempts.
+func (h *NotificationHandler) GetNotifications(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		h.log(c).Error("Invalid order ID", zap.Error(err))
+		apperrors.Respond(c, apperrors.Validation("invalid order ID"))
+		return
+	}
+	logging.With(c, h.logger, zap.Uint64("order_id", id))
+
+	ctx := c.Request.Context()
+	var notifications []models.Notification
+	_, err = h.store.Orders().GetOrder(ctx, uint(id))
+	if err == nil {
+		notifications, err = h.store.Notifications().ListNotifications(ctx, uint(id))
+	}
+	if err != nil {
+		h.log(c).Error("Failed to fetch notifications", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	if notifications == nil {
+		notifications = []models.Notification{}
+	}
+	c.JSON(http.StatusOK, notifications)
+}
+
+// RetryNotification queues a failed notification for delivery again with
+// a fresh set of attempts.
+func (h *NotificationHandler) RetryNotification(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		h.log(c).Error("Invalid notification ID", zap.Error(err))
+		apperrors.Respond(c, apperrors.Validation("invalid notification ID"))
+		return
+	}
+	logging.With(c, h.logger, zap.Uint64("notification_id", id))
+
+	ctx := c.Request.Context()
+	var notification *models.Notification
+	err = h.store.WithinTx(ctx, func(tx repository.Store) error {
+		var err error
+		notification, err = tx.Notifications().GetNotification(ctx, uint(id))
+		if err != nil {
+			return err
+		}
+		if notification.Status != models.NotificationFailed {
+			return apperrors.Conflict("only failed notifications can be retried", nil)
+		}
+		now := time.Now()
+		notification.Status = models.NotificationPending
+		notification.Attempts = 0
+		notification.NextAttemptAt = &now
+		return tx.Notifications().UpdateNotification(ctx, notification)
+	})
+	if err != nil {
+		h.log(c).Error("Notification retry failed", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	h.log(c).Info("Notification queued for retry")
+	c.JSON(http.StatusAccepted, notification)
+}
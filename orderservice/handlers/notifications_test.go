@@ -0,0 +1,91 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"orderservice/handlers"
+	"orderservice/models"
+	"orderservice/notify"
+	"orderservice/repository"
+)
+
+func TestNotifications(t *testing.T) {
+	store := repository.NewMemoryStore()
+	logger, _ := zap.NewDevelopment()
+	handler := handlers.NewNotificationHandler(store, logger)
+	orderHandler := handlers.NewOrderHandler(store, rates, exchange, logger)
+
+	router := gin.New()
+	router.PUT("/orders/:id/status", orderHandler.UpdateOrderStatus)
+	router.GET("/orders/:id/notifications", handler.GetNotifications)
+	router.POST("/notifications/:id/retry", handler.RetryNotification)
+
+	customer := &models.Customer{Name: "Wanjiru", Email: "wanjiru@example.com"}
+	store.Customers().CreateCustomer(ctx, customer)
+	kettle := &models.Product{Name: "Kettle", Price: 2500}
+	store.Products().CreateProduct(ctx, kettle)
+	order := &models.Order{CustomerID: customer.ID, Products: []models.Product{*kettle}, Currency: "KES", Items: []models.OrderItem{
+		{ProductID: kettle.ID, Name: "Kettle", UnitPrice: 2500, Quantity: 1, Total: 2500},
+	}}
+	require.NoError(t, store.Orders().CreateOrder(ctx, order))
+
+	list := func(t *testing.T) []models.Notification {
+		w := performRequest(router, "GET", fmt.Sprintf("/orders/%d/notifications", order.ID), "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var notifications []models.Notification
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &notifications))
+		return notifications
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		assert.Empty(t, list(t))
+	})
+
+	t.Run("Status changes are announced once", func(t *testing.T) {
+		for range 2 {
+			w := performRequest(router, "PUT", fmt.Sprintf("/orders/%d/status", order.ID),
+				`{"status":"paid","payment_reference":"QK12ABC3DE"}`)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		}
+		notifications := list(t)
+		require.Len(t, notifications, 1)
+		assert.Equal(t, notify.EventOrderPaid, notifications[0].Event)
+		assert.Equal(t, "wanjiru@example.com", notifications[0].Recipient)
+		assert.Contains(t, notifications[0].Body, "QK12ABC3DE")
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		notification := list(t)[0]
+		path := fmt.Sprintf("/notifications/%d/retry", notification.ID)
+		w := performRequest(router, "POST", path, "")
+		assert.Equal(t, http.StatusConflict, w.Code, "still pending")
+
+		notification.Status = models.NotificationFailed
+		notification.Attempts = 5
+		notification.LastError = "connection refused"
+		require.NoError(t, store.Notifications().UpdateNotification(ctx, &notification))
+		w = performRequest(router, "POST", path, "")
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+		retried := list(t)[0]
+		assert.Equal(t, models.NotificationPending, retried.Status)
+		assert.Zero(t, retried.Attempts)
+		assert.NotNil(t, retried.NextAttemptAt)
+
+		w = performRequest(router, "POST", "/notifications/9999/retry", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Unknown order", func(t *testing.T) {
+		w := performRequest(router, "GET", "/orders/9999/notifications", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = performRequest(router, "PUT", "/orders/9999/status", `{"status":"paid"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
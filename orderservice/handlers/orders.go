@@ -1,78 +1,348 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"gorm.io/gorm"
+	"orderservice/apperrors"
+	"orderservice/auth"
+	"orderservice/catalog"
+	"orderservice/logging"
 	"orderservice/models"
+	"orderservice/money"
+	"orderservice/notify"
+	"orderservice/promotions"
 	"orderservice/repository"
+	"orderservice/shipping"
+	"orderservice/tax"
+	"orderservice/validation"
 )
 
 type OrderHandler struct {
-	repo   *repository.OrderRepository
-	logger *zap.Logger
+	store    repository.Store
+	rates    tax.Rates
+	exchange money.Rates
+	logger   *zap.Logger
 }
 
-func NewOrderHandler(db *gorm.DB, logger *zap.Logger) *OrderHandler {
+func NewOrderHandler(store repository.Store, rates tax.Rates, exchange money.Rates, logger *zap.Logger) *OrderHandler {
 	return &OrderHandler{
-		repo:   repository.NewOrderRepository(db),
-		logger: logger,
+		store:    store,
+		rates:    rates,
+		exchange: exchange,
+		logger:   logger,
 	}
 }
 
+// log returns the request-scoped logger, which carries the request ID and
+// any order or customer IDs already known for the request.
+func (h *OrderHandler) log(c *gin.Context) *zap.Logger {
+	return logging.FromContext(c.Request.Context(), h.logger)
+}
+
 func (h *OrderHandler) CreateCustomer(c *gin.Context) {
 	var customer models.Customer
-	if err := c.ShouldBindJSON(&customer); err != nil {
-		h.logger.Error("Invalid customer input", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := validation.BindJSON(c, &customer); err != nil {
+		h.log(c).Error("Invalid customer input", zap.Error(err))
+		apperrors.Respond(c, err)
 		return
 	}
+	// Only the customer can verify their email address.
+	customer.EmailVerifiedAt = nil
 
-	if err := h.repo.CreateCustomer(&customer); err != nil {
-		h.logger.Error("Failed to create customer", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Customer creation failed"})
+	if err := h.store.Customers().CreateCustomer(c.Request.Context(), &customer); err != nil {
+		h.log(c).Error("Failed to create customer", zap.Error(err))
+		apperrors.Respond(c, err)
 		return
 	}
 
+	logging.With(c, h.logger, zap.Uint("customer_id", customer.ID)).Info("Customer created")
 	c.JSON(http.StatusCreated, customer)
 }
 
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
-	var order models.Order
-	if err := c.ShouldBindJSON(&order); err != nil {
-		h.logger.Error("Invalid order input", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var req models.CreateOrderRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		h.log(c).Error("Invalid order input", zap.Error(err))
+		apperrors.Respond(c, err)
 		return
 	}
+	order := req.Order()
+	if order.Currency == "" {
+		order.Currency = h.exchange.Base
+	}
+
+	logging.With(c, h.logger, zap.Uint("customer_id", order.CustomerID))
 
-	if err := h.repo.CreateOrder(&order); err != nil {
-		h.logger.Error("Order creation failed", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Order creation failed"})
+	ctx := c.Request.Context()
+	err := h.store.WithinTx(ctx, func(tx repository.Store) error {
+		if err := checkCustomer(ctx, tx, order.CustomerID); err != nil {
+			return err
+		}
+		if err := checkCurrency(h.exchange, order.Currency); err != nil {
+			return err
+		}
+		if err := h.loadProducts(ctx, tx, req.Products, &order); err != nil {
+			return err
+		}
+		discounts, err := promotions.Apply(ctx, tx, &order, req.CouponCodes, time.Now())
+		if err != nil {
+			return err
+		}
+		for _, discount := range discounts {
+			order.Discount += discount.Amount
+		}
+		tax.Apply(&order, h.rates)
+		if err := shipping.Apply(ctx, tx, &order, req.Delivery(), h.exchange); err != nil {
+			return err
+		}
+		if err := tx.Orders().CreateOrder(ctx, &order); err != nil {
+			return err
+		}
+		return notify.Queue(ctx, tx, notify.EventOrderPlaced, &order)
+	})
+	if err != nil {
+		h.log(c).Error("Order creation failed", zap.Error(err))
+		apperrors.Respond(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, order)
+	order.CalculateTotals()
+	logging.With(c, h.logger, zap.Uint("order_id", order.ID)).Info("Order created")
+	c.JSON(http.StatusCreated, withoutAddress(c, &order))
 }
 
-func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
-	id, _ := strconv.Atoi(c.Param("id"))
+// ApplyCoupon redeems a coupon against a pending order and returns the
+// order with its updated discount breakdown.
+func (h *OrderHandler) ApplyCoupon(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		h.log(c).Error("Invalid order ID", zap.Error(err))
+		apperrors.Respond(c, apperrors.Validation("invalid order ID"))
+		return
+	}
+	logging.With(c, h.logger, zap.Int("order_id", id))
+
+	var req models.ApplyCouponRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		h.log(c).Error("Invalid coupon input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
 
-	var status struct {
-		Status string `json:"status"`
+	ctx := c.Request.Context()
+	var order *models.Order
+	err = h.store.WithinTx(ctx, func(tx repository.Store) error {
+		var err error
+		if order, err = tx.Orders().GetOrder(ctx, uint(id)); err != nil {
+			return err
+		}
+		if order.Status != models.OrderPending {
+			return apperrors.Conflict("coupons can only be applied to pending orders", nil)
+		}
+		discounts, err := promotions.Apply(ctx, tx, order, []string{req.Code}, time.Now())
+		if err != nil {
+			return err
+		}
+		for _, discount := range discounts {
+			order.Discount += discount.Amount
+		}
+		tax.Apply(order, h.rates)
+		return tx.Orders().ApplyDiscounts(ctx, order, discounts)
+	})
+	if err != nil {
+		h.log(c).Error("Coupon not applied", zap.Error(err), zap.String("code", req.Code))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	order.CalculateTotals()
+	h.log(c).Info("Coupon applied", zap.String("code", models.NormalizeCode(req.Code)))
+	c.JSON(http.StatusOK, withoutAddress(c, order))
+}
+
+// checkCustomer returns a validation error on customer_id if the customer
+// does not exist.
+func checkCustomer(ctx context.Context, store repository.Store, id uint) error {
+	_, err := store.Customers().GetCustomer(ctx, id)
+	if apperrors.Is(err, apperrors.KindNotFound) {
+		return apperrors.Validation("customer does not exist",
+			apperrors.FieldError{Field: "customer_id", Message: "does not exist"})
+	}
+	return err
+}
+
+// checkCurrency returns a validation error on currency if it has no
+// exchange rate.
+func checkCurrency(exchange money.Rates, currency string) error {
+	if !exchange.Supports(currency) {
+		return apperrors.Validation("currency is not supported",
+			apperrors.FieldError{Field: "currency", Message: "has no exchange rate configured"})
+	}
+	return nil
+}
+
+// loadProducts replaces the product references in order with the stored
+// products and adds a line for each, so prices and categories come from
+// the catalogue rather than the request.
+func (h *OrderHandler) loadProducts(ctx context.Context, store repository.Store, refs []models.ProductRef, order *models.Order) error {
+	order.TaxInclusive = h.rates.Inclusive
+	for i, ref := range refs {
+		product, variant, err := catalog.Resolve(ctx, store, ref.ID, ref.VariantID,
+			fmt.Sprintf("products[%d].id", i), fmt.Sprintf("products[%d].variant_id", i))
+		if err != nil {
+			return err
+		}
+		line, err := catalog.Line(product, variant, 1, order.Currency, h.rates, h.exchange)
+		if err != nil {
+			return err
+		}
+		order.Products[i] = *product
+		order.Items = append(order.Items, line)
+	}
+	return nil
+}
+
+// ConvertOrder reprices a pending order in another currency at the current
+// exchange rates, e.g. into KES so it can be paid with M-Pesa. Lines are
+// converted from their catalogue price, and discounts and the shipping fee
+// at the rate between the two order currencies.
+func (h *OrderHandler) ConvertOrder(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		h.log(c).Error("Invalid order ID", zap.Error(err))
+		apperrors.Respond(c, apperrors.Validation("invalid order ID"))
+		return
+	}
+	logging.With(c, h.logger, zap.Int("order_id", id))
+
+	var req models.ConvertOrderRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		h.log(c).Error("Invalid currency input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	var order *models.Order
+	err = h.store.WithinTx(ctx, func(tx repository.Store) error {
+		var err error
+		if order, err = tx.Orders().GetOrder(ctx, uint(id)); err != nil {
+			return err
+		}
+		if order.Status != models.OrderPending {
+			return apperrors.Conflict("only pending orders can be converted", nil)
+		}
+		if err := checkCurrency(h.exchange, req.Currency); err != nil {
+			return err
+		}
+		if err := h.convert(order, req.Currency); err != nil {
+			return err
+		}
+		return tx.Orders().RepriceOrder(ctx, order)
+	})
+	if err != nil {
+		h.log(c).Error("Order not converted", zap.Error(err), zap.String("currency", req.Currency))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	order.CalculateTotals()
+	h.log(c).Info("Order converted", zap.String("currency", order.Currency))
+	c.JSON(http.StatusOK, withoutAddress(c, order))
+}
+
+// convert reprices order in currency and works its tax out again.
+func (h *OrderHandler) convert(order *models.Order, currency string) error {
+	from := order.Currency
+	if from == "" {
+		from = h.exchange.Base
+	}
+	rate, err := h.exchange.Rate(from, currency)
+	if err != nil {
+		return err
+	}
+	// Orders from before line items were stored are priced first.
+	tax.Apply(order, h.rates)
+
+	for i := range order.Items {
+		item := &order.Items[i]
+		if item.CatalogCurrency == "" {
+			item.CatalogPrice, item.CatalogCurrency, item.ExchangeRate = item.UnitPrice, from, 1
+		}
+		converted, itemRate, err := h.exchange.Convert(money.New(item.CatalogPrice, item.CatalogCurrency), currency)
+		if err != nil {
+			return err
+		}
+		item.UnitPrice, item.ExchangeRate = converted.Amount(), itemRate
+	}
+	discount := money.New(0, currency)
+	for i := range order.Discounts {
+		amount := money.New(order.Discounts[i].Amount*rate, currency)
+		order.Discounts[i].Amount = amount.Amount()
+		discount, _ = discount.Add(amount)
+	}
+	order.Discount = discount.Amount()
+	order.ShippingFee = money.New(order.ShippingFee*rate, currency).Amount()
+	order.Currency = currency
+	tax.Apply(order, h.rates)
+	return nil
+}
+
+func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		h.log(c).Error("Invalid order ID", zap.Error(err))
+		apperrors.Respond(c, apperrors.Validation("invalid order ID"))
+		return
 	}
+	logging.With(c, h.logger, zap.Int("order_id", id))
 
-	if err := c.ShouldBindJSON(&status); err != nil {
-		h.logger.Error("Invalid status input", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var status models.UpdateStatusRequest
+	if err := validation.BindJSON(c, &status); err != nil {
+		h.log(c).Error("Invalid status input", zap.Error(err))
+		apperrors.Respond(c, err)
 		return
 	}
 
-	if err := h.repo.UpdateOrderStatus(uint(id), status.Status); err != nil {
-		h.logger.Error("Status update failed", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Status update failed"})
+	ctx := c.Request.Context()
+	err = h.store.WithinTx(ctx, func(tx repository.Store) error {
+		order, err := tx.Orders().GetOrder(ctx, uint(id))
+		if err != nil {
+			return err
+		}
+		if err := tx.Orders().UpdateOrderStatus(ctx, order.ID, status.Status); err != nil {
+			return err
+		}
+		if status.Status == models.OrderPaid && status.PaymentReference != "" {
+			if err := tx.Orders().RecordPayment(ctx, order.ID, status.PaymentReference, time.Now().UTC()); err != nil {
+				return err
+			}
+			order.PaymentReference = status.PaymentReference
+		}
+		// Paid orders are invoiced, so their invoice and receipt can be
+		// read without numbering anything.
+		if status.Status == models.OrderPaid && order.Status != models.OrderPaid {
+			if _, err := tx.Invoices().IssueInvoice(ctx, order.ID); err != nil {
+				return err
+			}
+		}
+		event, ok := notify.Event(status.Status)
+		if order.Status == status.Status || !ok {
+			return nil
+		}
+		order.Status = status.Status
+		return notify.Queue(ctx, tx, event, order)
+	})
+	if err != nil {
+		h.log(c).Error("Status update failed", zap.Error(err))
+		apperrors.Respond(c, err)
 		return
 	}
 
@@ -82,45 +352,182 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 func (h *OrderHandler) GetOrder(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		h.logger.Error("Invalid order ID", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		h.log(c).Error("Invalid order ID", zap.Error(err))
+		apperrors.Respond(c, apperrors.Validation("invalid order ID"))
 		return
 	}
+	logging.With(c, h.logger, zap.Int("order_id", id))
 
-	order, err := h.repo.GetOrder(uint(id))  // Changed from GetOrderByID to GetOrder
+	var query models.GetOrderQuery
+	if err := validation.BindQuery(c, &query); err != nil {
+		h.log(c).Error("Invalid order query", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	if !allowDeleted(c, query.IncludeDeleted) {
+		return
+	}
+
+	get := h.store.Orders().GetOrder
+	if query.IncludeDeleted {
+		get = h.store.Orders().GetOrderIncludingDeleted
+	}
+	order, err := get(c.Request.Context(), uint(id))
 	if err != nil {
-		h.logger.Error("Failed to fetch order", zap.Error(err), zap.Int("id", id))
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		h.log(c).Error("Failed to fetch order", zap.Error(err))
+		apperrors.Respond(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, order)
+	c.JSON(http.StatusOK, withoutAddress(c, order))
+}
+
+// withoutAddress drops the delivery address from an order served on a
+// public route unless staff asked for it. Customers see it on their own
+// orders under /me.
+func withoutAddress(c *gin.Context, order *models.Order) *models.Order {
+	if !auth.IsStaff(c) {
+		order.ShippingAddress = models.ShippingAddress{}
+	}
+	return order
 }
 
 func (h *OrderHandler) CreateProduct(c *gin.Context) {
 	var product models.Product
-	if err := c.ShouldBindJSON(&product); err != nil {
-		h.logger.Error("Invalid product input", zap.Error(err))
-		c.JSON(400, gin.H{"error": err.Error()})
+	if err := validation.BindJSON(c, &product); err != nil {
+		h.log(c).Error("Invalid product input", zap.Error(err))
+		apperrors.Respond(c, err)
 		return
 	}
 
-	if err := h.repo.CreateProduct(&product); err != nil {
-		h.logger.Error("Failed to create product", zap.Error(err))
-		c.JSON(500, gin.H{"error": "Product creation failed"})
+	if product.TaxClass == "" {
+		product.TaxClass = models.TaxStandard
+	}
+	if product.Status == "" {
+		product.Status = models.ProductActive
+	}
+	if product.Currency == "" {
+		product.Currency = h.exchange.Base
+	}
+	err := normalizeProduct(&product)
+	if err == nil {
+		err = checkCurrency(h.exchange, product.Currency)
+	}
+	if err != nil {
+		h.log(c).Error("Invalid product input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	if err := h.store.Products().CreateProduct(c.Request.Context(), &product); err != nil {
+		h.log(c).Error("Failed to create product", zap.Error(err))
+		apperrors.Respond(c, err)
 		return
 	}
 
 	c.JSON(201, product)
 }
 
+// normalizeProduct puts SKUs and tags in their stored form and names
+// unnamed variants after their size and colour. It returns a validation
+// error for a variant with nothing to name it by, or a SKU used twice.
+func normalizeProduct(product *models.Product) error {
+	product.SKU = models.NormalizeSKU(product.SKU)
+	for i, tag := range product.Tags {
+		product.Tags[i] = strings.ToLower(strings.TrimSpace(tag))
+	}
+
+	seen := map[string]bool{product.SKU: product.SKU != ""}
+	for i := range product.Variants {
+		variant := &product.Variants[i]
+		variant.SKU = models.NormalizeSKU(variant.SKU)
+		if variant.SKU != "" && seen[variant.SKU] {
+			return apperrors.Validation("SKU is used twice", apperrors.FieldError{
+				Field:   fmt.Sprintf("variants[%d].sku", i),
+				Message: "is already used by this product",
+			})
+		}
+		seen[variant.SKU] = variant.SKU != ""
+
+		if strings.TrimSpace(variant.Name) == "" {
+			var parts []string
+			for _, part := range []string{variant.Size, variant.Colour} {
+				if part = strings.TrimSpace(part); part != "" {
+					parts = append(parts, part)
+				}
+			}
+			if len(parts) == 0 {
+				return apperrors.Validation("variant needs a name", apperrors.FieldError{
+					Field:   fmt.Sprintf("variants[%d].name", i),
+					Message: "is required when size and colour are empty",
+				})
+			}
+			variant.Name = strings.Join(parts, " / ")
+		}
+	}
+	return nil
+}
+
+// GetProducts lists active products, one page at a time, filtered and
+// sorted by the query parameters. Deleted products are only listed with
+// include_deleted. The number of matches across all pages is returned in
+// the X-Total-Count header.
 func (h *OrderHandler) GetProducts(c *gin.Context) {
-	var products []models.Product
-	if err := h.repo.GetAllProducts(&products); err != nil {
-		h.logger.Error("Failed to fetch products", zap.Error(err))
-		c.JSON(500, gin.H{"error": "Failed to retrieve products"})
+	var query models.ProductQuery
+	if err := validation.BindQuery(c, &query); err != nil {
+		h.log(c).Error("Invalid product query", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	if !allowDeleted(c, query.IncludeDeleted) {
 		return
 	}
+	if query.Status == "" {
+		query.Status = models.ProductActive
+	}
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PerPage == 0 {
+		query.PerPage = 20
+	}
 
+	products, total, err := h.store.Products().SearchProducts(c.Request.Context(), query)
+	if err != nil {
+		h.log(c).Error("Failed to fetch products", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	if products == nil {
+		products = []models.Product{}
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
 	c.JSON(200, products)
+}
+
+// UpdateProductStatus archives a product, or makes an archived product
+// available again. Archived products stay on existing orders.
+func (h *OrderHandler) UpdateProductStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		h.log(c).Error("Invalid product ID", zap.Error(err))
+		apperrors.Respond(c, apperrors.Validation("invalid product ID"))
+		return
+	}
+
+	var req models.UpdateProductStatusRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		h.log(c).Error("Invalid status input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	if err := h.store.Products().UpdateProductStatus(c.Request.Context(), uint(id), req.Status); err != nil {
+		h.log(c).Error("Product status update failed", zap.Error(err), zap.Int("product_id", id))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Status updated successfully"})
 }
\ No newline at end of file
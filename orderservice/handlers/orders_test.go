@@ -1,38 +1,72 @@
 package handlers_test
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"orderservice/apperrors"
 	"orderservice/handlers"
 	"orderservice/models"
+	"orderservice/money"
+	"orderservice/repository"
+	"orderservice/tax"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
-func setupTestDB() *gorm.DB {
-	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
-	if err != nil {
-		panic("failed to connect database")
-	}
-	// Clean up any existing tables
-	db.Migrator().DropTable(&models.Order{}, &models.Customer{}, &models.Product{})
-	// Create fresh tables
-	db.AutoMigrate(&models.Order{}, &models.Customer{}, &models.Product{})
-	return db
+var ctx = context.Background()
+
+var (
+	rates    = tax.Rates{Standard: 0.16, Inclusive: true}
+	exchange = money.NewRates("KES", map[string]float64{"USD": 130})
+)
+
+// Shared secrets for the routes staff and the payment service reach.
+const (
+	staffToken   = "staff-token-0123456789abcdef0123"
+	serviceToken = "service-token-0123456789abcdef01"
+)
+
+// seedOrder stores a customer, a product and an order for that customer.
+func seedOrder(store repository.Store) (*models.Customer, *models.Order) {
+	customer := &models.Customer{Name: "Test Customer", Email: "test@example.com"}
+	store.Customers().CreateCustomer(ctx, customer)
+	product := &models.Product{Name: "Book", Price: 29.99}
+	store.Products().CreateProduct(ctx, product)
+	order := &models.Order{CustomerID: customer.ID, Products: []models.Product{*product}}
+	store.Orders().CreateOrder(ctx, order)
+	return customer, order
+}
+
+// failingStore fails every product query, as an unreachable database would.
+type failingStore struct {
+	repository.Store
+}
+
+func (failingStore) Products() repository.ProductRepository {
+	return failingProducts{}
+}
+
+type failingProducts struct {
+	repository.ProductRepository
+}
+
+func (failingProducts) SearchProducts(context.Context, models.ProductQuery) ([]models.Product, int64, error) {
+	return nil, 0, apperrors.Internal("product operation failed", errors.New("no such table: products"))
 }
 
 func TestCreateCustomer(t *testing.T) {
-	db := setupTestDB()
+	store := repository.NewMemoryStore()
 	logger, _ := zap.NewDevelopment()
-	handler := handlers.NewOrderHandler(db, logger)
+	handler := handlers.NewOrderHandler(store, rates, exchange, logger)
 
 	t.Run("Create valid customer", func(t *testing.T) {
 		w := httptest.NewRecorder()
@@ -53,6 +87,22 @@ func TestCreateCustomer(t *testing.T) {
 		assert.Equal(t, "john@example.com", response.Email)
 	})
 
+	t.Run("Duplicate customer email", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(
+			"POST",
+			"/customers",
+			strings.NewReader(`{"name":"Jane Doe","email":"john@example.com"}`),
+		)
+		c.Request.Header.Add("Content-Type", "application/json")
+
+		handler.CreateCustomer(c)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	})
+
 	t.Run("Invalid customer data", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
@@ -70,15 +120,15 @@ func TestCreateCustomer(t *testing.T) {
 }
 
 func TestCreateOrder(t *testing.T) {
-	db := setupTestDB()
+	store := repository.NewMemoryStore()
 	logger, _ := zap.NewDevelopment()
-	handler := handlers.NewOrderHandler(db, logger)
+	handler := handlers.NewOrderHandler(store, rates, exchange, logger)
 
 	// Create test customer and product first
 	customer := &models.Customer{Name: "Test Customer", Email: "test@example.com"}
-	db.Create(customer)
+	store.Customers().CreateCustomer(ctx, customer)
 	product := &models.Product{Name: "Book", Price: 29.99}
-	db.Create(product)
+	store.Products().CreateProduct(ctx, product)
 
 	t.Run("Create valid order", func(t *testing.T) {
 		w := httptest.NewRecorder()
@@ -97,6 +147,27 @@ func TestCreateOrder(t *testing.T) {
 		json.Unmarshal(w.Body.Bytes(), &response)
 		assert.Equal(t, customer.ID, response.CustomerID)
 		assert.Len(t, response.Products, 1)
+		if assert.Len(t, response.Items, 1) {
+			assert.Equal(t, 0.16, response.Items[0].TaxRate)
+		}
+		assert.Equal(t, 4.14, response.TaxAmount)
+		assert.Equal(t, 29.99, response.Total)
+	})
+
+	t.Run("Unknown customer", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(
+			"POST",
+			"/orders",
+			strings.NewReader(fmt.Sprintf(`{"customer_id":999,"products":[{"id":%d}]}`, product.ID)),
+		)
+		c.Request.Header.Add("Content-Type", "application/json")
+
+		handler.CreateOrder(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"customer_id"`)
 	})
 
 	t.Run("Invalid order data", func(t *testing.T) {
@@ -116,17 +187,12 @@ func TestCreateOrder(t *testing.T) {
 }
 
 func TestUpdateOrderStatus(t *testing.T) {
-	db := setupTestDB()
+	store := repository.NewMemoryStore()
 	logger, _ := zap.NewDevelopment()
-	handler := handlers.NewOrderHandler(db, logger)
+	handler := handlers.NewOrderHandler(store, rates, exchange, logger)
 
 	// Create test order
-	customer := &models.Customer{Name: "Test Customer", Email: "test@example.com"}
-	db.Create(customer)
-	product := &models.Product{Name: "Book", Price: 29.99}
-	db.Create(product)
-	order := &models.Order{CustomerID: customer.ID, Products: []models.Product{*product}}
-	db.Create(order)
+	_, order := seedOrder(store)
 
 	t.Run("Update valid order status", func(t *testing.T) {
 		w := httptest.NewRecorder()
@@ -135,7 +201,7 @@ func TestUpdateOrderStatus(t *testing.T) {
 		c.Request = httptest.NewRequest(
 			"PUT",
 			fmt.Sprintf("/orders/%d/status", order.ID),
-			strings.NewReader(`{"status":"shipped"}`),
+			strings.NewReader(`{"status":"paid"}`),
 		)
 		c.Request.Header.Add("Content-Type", "application/json")
 
@@ -144,6 +210,22 @@ func TestUpdateOrderStatus(t *testing.T) {
 		assert.Equal(t, http.StatusOK, w.Code)
 	})
 
+	t.Run("Move order status backwards", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = []gin.Param{{Key: "id", Value: fmt.Sprint(order.ID)}}
+		c.Request = httptest.NewRequest(
+			"PUT",
+			fmt.Sprintf("/orders/%d/status", order.ID),
+			strings.NewReader(`{"status":"pending"}`),
+		)
+		c.Request.Header.Add("Content-Type", "application/json")
+
+		handler.UpdateOrderStatus(c)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
 	t.Run("Invalid status data", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
@@ -162,17 +244,12 @@ func TestUpdateOrderStatus(t *testing.T) {
 }
 
 func TestGetOrder(t *testing.T) {
-	db := setupTestDB()
+	store := repository.NewMemoryStore()
 	logger, _ := zap.NewDevelopment()
-	handler := handlers.NewOrderHandler(db, logger)
+	handler := handlers.NewOrderHandler(store, rates, exchange, logger)
 
 	// Create test order
-	customer := &models.Customer{Name: "Test Customer", Email: "test@example.com"}
-	db.Create(customer)
-	product := &models.Product{Name: "Book", Price: 29.99}
-	db.Create(product)
-	order := &models.Order{CustomerID: customer.ID, Products: []models.Product{*product}}
-	db.Create(order)
+	customer, order := seedOrder(store)
 
 	t.Run("Get existing order", func(t *testing.T) {
 		w := httptest.NewRecorder()
@@ -213,9 +290,9 @@ func TestGetOrder(t *testing.T) {
 }
 
 func TestCreateProduct(t *testing.T) {
-	db := setupTestDB()
+	store := repository.NewMemoryStore()
 	logger, _ := zap.NewDevelopment()
-	handler := handlers.NewOrderHandler(db, logger)
+	handler := handlers.NewOrderHandler(store, rates, exchange, logger)
 
 	router := gin.Default()
 	router.POST("/products", handler.CreateProduct)
@@ -244,16 +321,137 @@ func TestCreateProduct(t *testing.T) {
 		router.ServeHTTP(w, req)
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
+
+	t.Run("Product with variants", func(t *testing.T) {
+		w := performRequest(router, "POST", "/products", `{"sku":" tee-01 ","name":"T-shirt","price":15,
+			"tags":[" Summer "],"variants":[{"sku":"tee-01-s","size":"S","colour":"Red","price":15},{"name":"Large","price":17}]}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var response models.Product
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, "TEE-01", response.SKU)
+		assert.Equal(t, []string{"summer"}, response.Tags)
+		assert.Equal(t, models.ProductActive, response.Status)
+		require.Len(t, response.Variants, 2)
+		assert.Equal(t, "S / Red", response.Variants[0].Name)
+		assert.Equal(t, "TEE-01-S", response.Variants[0].SKU)
+		assert.NotZero(t, response.Variants[1].ID)
+	})
+
+	t.Run("Duplicate SKU", func(t *testing.T) {
+		w := performRequest(router, "POST", "/products", `{"sku":"TEE-01-S","name":"Other","price":5}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		w = performRequest(router, "POST", "/products", `{"sku":"MUG","name":"Mug","price":5,"variants":[{"sku":"mug","name":"Blue","price":5}]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"variants[0].sku"`)
+	})
+
+	t.Run("Unnamed variant", func(t *testing.T) {
+		w := performRequest(router, "POST", "/products", `{"name":"Cap","price":5,"variants":[{"price":5}]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"variants[0].name"`)
+	})
+}
+
+func TestUpdateProductStatus(t *testing.T) {
+	store := repository.NewMemoryStore()
+	logger, _ := zap.NewDevelopment()
+	handler := handlers.NewOrderHandler(store, rates, exchange, logger)
+
+	router := gin.New()
+	router.PUT("/products/:id/status", handler.UpdateProductStatus)
+	router.POST("/orders", handler.CreateOrder)
+
+	store.Customers().CreateCustomer(ctx, &models.Customer{Name: "Buyer", Email: "buyer@example.com"})
+	product := &models.Product{Name: "Old model", Price: 10}
+	store.Products().CreateProduct(ctx, product)
+
+	t.Run("Archived products cannot be ordered", func(t *testing.T) {
+		w := performRequest(router, "PUT", fmt.Sprintf("/products/%d/status", product.ID), `{"status":"archived"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = performRequest(router, "POST", "/orders", fmt.Sprintf(`{"customer_id":1,"products":[{"id":%d}]}`, product.ID))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "is no longer available")
+	})
+
+	t.Run("Restored products can be ordered", func(t *testing.T) {
+		w := performRequest(router, "PUT", fmt.Sprintf("/products/%d/status", product.ID), `{"status":"active"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = performRequest(router, "POST", "/orders", fmt.Sprintf(`{"customer_id":1,"products":[{"id":%d}]}`, product.ID))
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("Unknown status", func(t *testing.T) {
+		w := performRequest(router, "PUT", fmt.Sprintf("/products/%d/status", product.ID), `{"status":"deleted"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Unknown product", func(t *testing.T) {
+		w := performRequest(router, "PUT", "/products/999/status", `{"status":"archived"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestOrderVariants(t *testing.T) {
+	store := repository.NewMemoryStore()
+	logger, _ := zap.NewDevelopment()
+	handler := handlers.NewOrderHandler(store, rates, exchange, logger)
+
+	router := gin.New()
+	router.POST("/orders", handler.CreateOrder)
+
+	store.Customers().CreateCustomer(ctx, &models.Customer{Name: "Buyer", Email: "buyer@example.com"})
+	stock := 1
+	product := &models.Product{SKU: "TEE", Name: "T-shirt", Price: 15, Variants: []models.ProductVariant{
+		{SKU: "TEE-L", Name: "Large", Price: 17, Stock: &stock},
+	}}
+	store.Products().CreateProduct(ctx, product)
+	large := product.Variants[0].ID
+
+	t.Run("Variant is required", func(t *testing.T) {
+		w := performRequest(router, "POST", "/orders", fmt.Sprintf(`{"customer_id":1,"products":[{"id":%d}]}`, product.ID))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"products[0].variant_id"`)
+	})
+
+	t.Run("Order by variant", func(t *testing.T) {
+		w := performRequest(router, "POST", "/orders",
+			fmt.Sprintf(`{"customer_id":1,"products":[{"id":%d,"variant_id":%d}]}`, product.ID, large))
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var order models.Order
+		json.Unmarshal(w.Body.Bytes(), &order)
+		require.Len(t, order.Items, 1)
+		assert.Equal(t, large, order.Items[0].VariantID)
+		assert.Equal(t, "TEE-L", order.Items[0].SKU)
+		assert.Equal(t, "T-shirt (Large)", order.Items[0].Name)
+		assert.Equal(t, 17.0, order.Total)
+	})
+
+	t.Run("Variant sold out", func(t *testing.T) {
+		w := performRequest(router, "POST", "/orders",
+			fmt.Sprintf(`{"customer_id":1,"products":[{"id":%d,"variant_id":%d}]}`, product.ID, large))
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Unknown variant", func(t *testing.T) {
+		w := performRequest(router, "POST", "/orders",
+			fmt.Sprintf(`{"customer_id":1,"products":[{"id":%d,"variant_id":999}]}`, product.ID))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
 }
 
 func TestGetProducts(t *testing.T) {
-	db := setupTestDB()
+	store := repository.NewMemoryStore()
 	logger, _ := zap.NewDevelopment()
-	handler := handlers.NewOrderHandler(db, logger)
+	handler := handlers.NewOrderHandler(store, rates, exchange, logger)
 
 	// Create test data
-	db.Create(&models.Product{Name: "Product 1", Price: 10.0})
-	db.Create(&models.Product{Name: "Product 2", Price: 20.0})
+	store.Products().CreateProduct(ctx, &models.Product{Name: "Product 1", Price: 10.0})
+	store.Products().CreateProduct(ctx, &models.Product{Name: "Product 2", Price: 20.0})
 
 	router := gin.Default()
 	router.GET("/products", handler.GetProducts)
@@ -273,9 +471,35 @@ func TestGetProducts(t *testing.T) {
 		assert.Equal(t, 10.0, products[0].Price)
 	})
 
+	t.Run("Search, filter and paginate", func(t *testing.T) {
+		store.Products().CreateProduct(ctx, &models.Product{Name: "Garden hose", Price: 25, Category: "garden"})
+		store.Products().CreateProduct(ctx, &models.Product{Name: "Garden gloves", Price: 8, Category: "garden"})
+		store.Products().CreateProduct(ctx, &models.Product{Name: "Garden shed", Price: 500, Category: "garden", Status: models.ProductArchived})
+
+		w := performRequest(router, "GET", "/products?q=garden&category=Garden&sort=-price&per_page=1&page=2", "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "2", w.Header().Get("X-Total-Count"))
+		var products []models.Product
+		json.Unmarshal(w.Body.Bytes(), &products)
+		require.Len(t, products, 1)
+		assert.Equal(t, "Garden gloves", products[0].Name)
+
+		w = performRequest(router, "GET", "/products?category=garden&max_price=100&status=all", "")
+		assert.Equal(t, "2", w.Header().Get("X-Total-Count"))
+
+		w = performRequest(router, "GET", "/products?q=nothing", "")
+		assert.Equal(t, "[]", w.Body.String())
+	})
+
+	t.Run("Invalid query", func(t *testing.T) {
+		w := performRequest(router, "GET", "/products?sort=random&page=0", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"sort"`)
+	})
+
 	t.Run("Database error", func(t *testing.T) {
-		// Drop the products table to simulate a DB error
-		db.Migrator().DropTable(&models.Product{})
+		router := gin.New()
+		router.GET("/products", handlers.NewOrderHandler(failingStore{store}, rates, exchange, logger).GetProducts)
 
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/products", nil)
@@ -292,4 +516,177 @@ func performRequest(r http.Handler, method, path, body string) *httptest.Respons
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	return w
-}
\ No newline at end of file
+}
+func TestValidationErrors(t *testing.T) {
+	store := repository.NewMemoryStore()
+	logger, _ := zap.NewDevelopment()
+	handler := handlers.NewOrderHandler(store, rates, exchange, logger)
+
+	router := gin.New()
+	router.POST("/customers", handler.CreateCustomer)
+	router.POST("/orders", handler.CreateOrder)
+	router.POST("/products", handler.CreateProduct)
+	router.PUT("/orders/:id/status", handler.UpdateOrderStatus)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		field  string
+	}{
+		{"Customer with invalid email", "POST", "/customers", `{"name":"Jane","email":"jane"}`, "email"},
+		{"Product with zero price", "POST", "/products", `{"name":"Free","price":0}`, "price"},
+		{"Order without products", "POST", "/orders", `{"customer_id":1,"products":[]}`, "products"},
+		{"Unknown order status", "PUT", "/orders/1/status", `{"status":"lost"}`, "status"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := performRequest(router, tt.method, tt.path, tt.body)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var problem struct {
+				Errors []struct {
+					Field   string `json:"field"`
+					Message string `json:"message"`
+				} `json:"errors"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &problem)
+			if assert.Len(t, problem.Errors, 1) {
+				assert.Equal(t, tt.field, problem.Errors[0].Field)
+			}
+		})
+	}
+}
+
+func TestCoupons(t *testing.T) {
+	store := repository.NewMemoryStore()
+	logger, _ := zap.NewDevelopment()
+	handler := handlers.NewOrderHandler(store, rates, exchange, logger)
+	promotionHandler := handlers.NewPromotionHandler(store, exchange, logger)
+
+	router := gin.New()
+	router.POST("/orders", handler.CreateOrder)
+	router.POST("/orders/:id/coupon", handler.ApplyCoupon)
+	router.POST("/promotions", promotionHandler.CreatePromotion)
+
+	customer, order := seedOrder(store)
+	product := order.Products[0]
+
+	t.Run("Create promotion", func(t *testing.T) {
+		w := performRequest(router, "POST", "/promotions",
+			`{"code":"save10","type":"percentage","value":10,"stackable":true}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"SAVE10"`)
+
+		w = performRequest(router, "POST", "/promotions", `{"code":"FIVEOFF","type":"fixed","value":5,"stackable":true}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("Coupon at order creation", func(t *testing.T) {
+		w := performRequest(router, "POST", "/orders",
+			fmt.Sprintf(`{"customer_id":%d,"products":[{"id":%d}],"coupon_codes":["SAVE10"]}`, customer.ID, product.ID))
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var response models.Order
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, 3.0, response.Discount)
+		assert.Equal(t, 26.99, response.Total)
+		assert.Len(t, response.Discounts, 1)
+	})
+
+	t.Run("Invalid coupon rolls back the order", func(t *testing.T) {
+		w := performRequest(router, "POST", "/orders",
+			fmt.Sprintf(`{"customer_id":%d,"products":[{"id":%d}],"coupon_codes":["BOGUS"]}`, customer.ID, product.ID))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Apply coupon to existing order", func(t *testing.T) {
+		w := performRequest(router, "POST", fmt.Sprintf("/orders/%d/coupon", order.ID), `{"code":"fiveoff"}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.Order
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, 5.0, response.Discount)
+		assert.Equal(t, 24.99, response.Total)
+	})
+
+	t.Run("Coupon applied twice", func(t *testing.T) {
+		w := performRequest(router, "POST", fmt.Sprintf("/orders/%d/coupon", order.ID), `{"code":"FIVEOFF"}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Order that is no longer pending", func(t *testing.T) {
+		store.Orders().UpdateOrderStatus(ctx, order.ID, models.OrderPaid)
+		w := performRequest(router, "POST", fmt.Sprintf("/orders/%d/coupon", order.ID), `{"code":"SAVE10"}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+}
+
+func TestCurrency(t *testing.T) {
+	store := repository.NewMemoryStore()
+	logger, _ := zap.NewDevelopment()
+	handler := handlers.NewOrderHandler(store, rates, exchange, logger)
+
+	router := gin.New()
+	router.POST("/products", handler.CreateProduct)
+	router.POST("/orders", handler.CreateOrder)
+	router.PUT("/orders/:id/status", handler.UpdateOrderStatus)
+	router.PUT("/orders/:id/currency", handler.ConvertOrder)
+
+	store.Customers().CreateCustomer(ctx, &models.Customer{Name: "Buyer", Email: "buyer@example.com"})
+	var product models.Product
+	t.Run("Products default to the base currency", func(t *testing.T) {
+		w := performRequest(router, "POST", "/products", `{"name":"Tea","price":2.5,"currency":"USD"}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		json.Unmarshal(w.Body.Bytes(), &product)
+		assert.Equal(t, "USD", product.Currency)
+
+		w = performRequest(router, "POST", "/products", `{"name":"Mandazi","price":20}`)
+		assert.Contains(t, w.Body.String(), `"currency":"KES"`)
+
+		w = performRequest(router, "POST", "/products", `{"name":"Scone","price":2,"currency":"GBP"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"currency"`)
+	})
+
+	var order models.Order
+	t.Run("Prices are converted at order time", func(t *testing.T) {
+		w := performRequest(router, "POST", "/orders", fmt.Sprintf(`{"customer_id":1,"products":[{"id":%d}]}`, product.ID))
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		json.Unmarshal(w.Body.Bytes(), &order)
+		assert.Equal(t, "KES", order.Currency)
+		require.Len(t, order.Items, 1)
+		assert.Equal(t, 325.0, order.Items[0].UnitPrice)
+		assert.Equal(t, 2.5, order.Items[0].CatalogPrice)
+		assert.Equal(t, "USD", order.Items[0].CatalogCurrency)
+		assert.Equal(t, 130.0, order.Items[0].ExchangeRate)
+		assert.Equal(t, 325.0, order.Total)
+
+		w = performRequest(router, "POST", "/orders", fmt.Sprintf(`{"customer_id":1,"currency":"EUR","products":[{"id":%d}]}`, product.ID))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Convert a pending order", func(t *testing.T) {
+		w := performRequest(router, "POST", "/orders", fmt.Sprintf(`{"customer_id":1,"currency":"USD","products":[{"id":%d}]}`, product.ID))
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var usd models.Order
+		json.Unmarshal(w.Body.Bytes(), &usd)
+		assert.Equal(t, 2.5, usd.Total)
+
+		w = performRequest(router, "PUT", fmt.Sprintf("/orders/%d/currency", usd.ID), `{"currency":"KES"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var converted models.Order
+		json.Unmarshal(w.Body.Bytes(), &converted)
+		assert.Equal(t, "KES", converted.Currency)
+		assert.Equal(t, 325.0, converted.Total)
+		assert.Equal(t, 44.83, converted.TaxAmount)
+	})
+
+	t.Run("Only pending orders are converted", func(t *testing.T) {
+		performRequest(router, "PUT", fmt.Sprintf("/orders/%d/status", order.ID), `{"status":"paid"}`)
+		w := performRequest(router, "PUT", fmt.Sprintf("/orders/%d/currency", order.ID), `{"currency":"USD"}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"orderservice/apperrors"
+	"orderservice/audit"
+	"orderservice/logging"
+	"orderservice/models"
+	"orderservice/privacy"
+	"orderservice/repository"
+)
+
+// PrivacyHandler answers customers' requests to see or erase the personal
+// data held about them. Every request is recorded in the audit log.
+type PrivacyHandler struct {
+	store    repository.Store
+	payments privacy.Payments
+	logger   *zap.Logger
+}
+
+func NewPrivacyHandler(store repository.Store, payments privacy.Payments, logger *zap.Logger) *PrivacyHandler {
+	return &PrivacyHandler{
+		store:    store,
+		payments: payments,
+		logger:   logger,
+	}
+}
+
+func (h *PrivacyHandler) log(c *gin.Context) *zap.Logger {
+	return logging.FromContext(c.Request.Context(), h.logger)
+}
+
+// ExportCustomer returns everything held about the customer, including
+// their payments from the payment service, as a JSON download.
+func (h *PrivacyHandler) ExportCustomer(c *gin.Context) {
+	id, ok := h.customerID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	export, err := privacy.Collect(ctx, h.store, h.payments, id, time.Now().UTC())
+	if err == nil {
+		err = h.store.Audit().RecordAudit(ctx, audit.Entry(ctx, privacy.ActionExport, "customer", id))
+	}
+	if err != nil {
+		h.log(c).Error("Failed to export customer data", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	h.log(c).Info("Customer data exported")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="customer-%d.json"`, id))
+	c.JSON(http.StatusOK, export)
+}
+
+// EraseCustomer anonymizes the customer's personal data here and in the
+// payment service. Their orders are kept for the accounts, so erasure is
+// refused while any of them is still in progress. Erasing a customer again
+// only repeats the payment service's part, which a failed attempt may have
+// left undone.
+func (h *PrivacyHandler) EraseCustomer(c *gin.Context) {
+	id, ok := h.customerID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	var orders []models.Order
+	customer, err := h.store.Customers().GetCustomer(ctx, id)
+	if err == nil {
+		orders, err = privacy.Orders(ctx, h.store, id)
+	}
+	if err == nil {
+		err = privacy.CheckErasable(orders)
+	}
+	var anonymized int64
+	if err == nil && len(orders) > 0 {
+		anonymized, err = h.payments.AnonymizePayments(ctx, privacy.OrderIDs(orders))
+	}
+	erasedAt := time.Now().UTC()
+	if customer != nil && customer.ErasedAt != nil {
+		erasedAt = *customer.ErasedAt
+	}
+	if err == nil {
+		err = h.store.WithinTx(ctx, func(tx repository.Store) error {
+			if customer.ErasedAt == nil {
+				if err := privacy.Erase(ctx, tx, id, erasedAt); err != nil {
+					return err
+				}
+			}
+			return tx.Audit().RecordAudit(ctx, audit.Entry(ctx, privacy.ActionErase, "customer", id))
+		})
+	}
+	if err != nil {
+		h.log(c).Error("Failed to erase customer data", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	h.log(c).Info("Customer data erased", zap.Int("orders", len(orders)), zap.Int64("payments", anonymized))
+	c.JSON(http.StatusOK, models.Erasure{
+		CustomerID:         id,
+		ErasedAt:           erasedAt,
+		Orders:             len(orders),
+		PaymentsAnonymized: anonymized,
+	})
+}
+
+func (h *PrivacyHandler) customerID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		h.log(c).Error("Invalid customer ID", zap.Error(err))
+		apperrors.Respond(c, apperrors.Validation("invalid customer ID"))
+		return 0, false
+	}
+	logging.With(c, h.logger, zap.Uint64("customer_id", id))
+	return uint(id), true
+}
@@ -0,0 +1,202 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"orderservice/apperrors"
+	"orderservice/audit"
+	"orderservice/auth"
+	"orderservice/handlers"
+	"orderservice/models"
+	"orderservice/privacy"
+	"orderservice/repository"
+)
+
+// fakePayments stands in for the payment service.
+type fakePayments struct {
+	payments []privacy.Payment
+	down     bool
+}
+
+func (f *fakePayments) ListPayments(ctx context.Context, orderIDs []uint) ([]privacy.Payment, error) {
+	if f.down {
+		return nil, apperrors.Upstream("payment service unavailable", errors.New("connection refused"))
+	}
+	var payments []privacy.Payment
+	for _, payment := range f.payments {
+		for _, id := range orderIDs {
+			if payment.OrderID == id {
+				payments = append(payments, payment)
+			}
+		}
+	}
+	return payments, nil
+}
+
+func (f *fakePayments) AnonymizePayments(ctx context.Context, orderIDs []uint) (int64, error) {
+	if f.down {
+		return 0, apperrors.Upstream("payment service unavailable", errors.New("connection refused"))
+	}
+	var n int64
+	for i, payment := range f.payments {
+		for _, id := range orderIDs {
+			if payment.OrderID == id && payment.Phone != "" {
+				f.payments[i].Phone = ""
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+func TestPrivacy(t *testing.T) {
+	store := repository.Audited(repository.NewMemoryStore())
+	// entries returns the audit entries for action, newest first.
+	entries := func(action string) []models.AuditEntry {
+		list, _, err := store.Audit().ListAudit(ctx, models.AuditQuery{Action: action, Page: 1, PerPage: 100})
+		require.NoError(t, err)
+		return list
+	}
+	payments := &fakePayments{}
+	logger, _ := zap.NewDevelopment()
+	handler := handlers.NewPrivacyHandler(store, payments, logger)
+	accounts := handlers.NewAccountHandler(store, auth.Config{Secret: make([]byte, 32), TokenTTL: time.Hour}, logger)
+
+	router := gin.New()
+	router.Use(auth.Staff(staffToken), audit.Middleware(auth.Trusted))
+	router.GET("/customers/:id/export", handler.ExportCustomer)
+	router.POST("/customers/:id/erasure", handler.EraseCustomer)
+	router.POST("/auth/register", accounts.Register)
+
+	customer := &models.Customer{Name: "Wanjiru Kamau", Email: "wanjiru@example.com", PasswordHash: "hash"}
+	require.NoError(t, store.Customers().CreateCustomer(ctx, customer))
+	address := &models.Address{CustomerID: customer.ID, Recipient: "Wanjiru Kamau", County: "Nairobi", Town: "Westlands", Street: "Waiyaki Way", Phone: "0712345678"}
+	require.NoError(t, store.Addresses().CreateAddress(ctx, address))
+	kettle := &models.Product{Name: "Kettle", Price: 2500}
+	require.NoError(t, store.Products().CreateProduct(ctx, kettle))
+	order := &models.Order{CustomerID: customer.ID, Products: []models.Product{*kettle}, ShippingAddress: address.ShippingAddress(),
+		Items: []models.OrderItem{{ProductID: kettle.ID, Name: "Kettle", UnitPrice: 2500, Quantity: 1, Total: 2500}}}
+	require.NoError(t, store.Orders().CreateOrder(ctx, order))
+	require.NoError(t, store.Notifications().CreateNotification(ctx, &models.Notification{
+		OrderID: &order.ID, CustomerID: customer.ID, Event: "order_placed", Channel: "email",
+		Recipient: customer.Email, Subject: "Order received", Body: "Hi Wanjiru"}))
+	payments.payments = []privacy.Payment{
+		{OrderID: order.ID, Phone: "254712345678", Amount: 2500, Status: "paid", ReceiptNumber: "QK12ABC3DE"},
+		{OrderID: 9999, Phone: "254711111111", Amount: 10, Status: "paid"},
+	}
+
+	erase := func(id uint) *httptest.ResponseRecorder {
+		return performRequest(router, "POST", fmt.Sprintf("/customers/%d/erasure", id), "")
+	}
+
+	t.Run("Export", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/customers/%d/export", customer.ID), nil)
+		req.Header.Set(auth.StaffHeader, staffToken)
+		req.Header.Set(audit.ActorHeader, "dpo@example.com")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+
+		var export privacy.Export
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &export))
+		assert.Equal(t, "wanjiru@example.com", export.Customer.Email)
+		assert.Len(t, export.Addresses, 1)
+		require.Len(t, export.Orders, 1)
+		assert.Equal(t, "Waiyaki Way", export.Orders[0].ShippingAddress.Street)
+		assert.Len(t, export.Notifications, 1)
+		require.Len(t, export.Payments, 1, "only the customer's payments")
+		assert.Equal(t, "254712345678", export.Payments[0].Phone)
+		assert.NotContains(t, w.Body.String(), "hash")
+
+		exports := entries(privacy.ActionExport)
+		require.Len(t, exports, 1)
+		assert.Equal(t, "dpo@example.com", exports[0].Actor)
+		assert.Equal(t, customer.ID, exports[0].EntityID)
+		assert.Empty(t, exports[0].Changes)
+
+		assert.Equal(t, http.StatusNotFound, performRequest(router, "GET", "/customers/9999/export", "").Code)
+	})
+
+	t.Run("Payment service down", func(t *testing.T) {
+		payments.down = true
+		defer func() { payments.down = false }()
+		w := performRequest(router, "GET", fmt.Sprintf("/customers/%d/export", customer.ID), "")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		w = erase(customer.ID)
+		assert.Equal(t, http.StatusConflict, w.Code, "the order is still pending")
+	})
+
+	t.Run("Orders in progress", func(t *testing.T) {
+		w := erase(customer.ID)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "still in progress")
+		assert.Empty(t, entries(privacy.ActionErase), "refused requests change nothing")
+	})
+
+	t.Run("Erase", func(t *testing.T) {
+		require.NoError(t, store.Orders().UpdateOrderStatus(ctx, order.ID, models.OrderPaid))
+		require.NoError(t, store.Orders().UpdateOrderStatus(ctx, order.ID, models.OrderDelivered))
+
+		payments.down = true
+		assert.Equal(t, http.StatusServiceUnavailable, erase(customer.ID).Code)
+		payments.down = false
+		fetched, err := store.Customers().GetCustomer(ctx, customer.ID)
+		require.NoError(t, err)
+		assert.Nil(t, fetched.ErasedAt, "nothing is erased until the payment service has been")
+
+		w := erase(customer.ID)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var erasure models.Erasure
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &erasure))
+		assert.Equal(t, 1, erasure.Orders)
+		assert.Equal(t, int64(1), erasure.PaymentsAnonymized)
+
+		fetched, err = store.Customers().GetCustomer(ctx, customer.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.ErasedName, fetched.Name)
+		assert.False(t, fetched.HasAccount())
+		kept, err := store.Orders().GetOrder(ctx, order.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 2500.0, kept.Total, "financial records are kept")
+		assert.Empty(t, kept.ShippingAddress.Phone)
+		assert.Empty(t, payments.payments[0].Phone)
+		assert.Equal(t, "254711111111", payments.payments[1].Phone)
+
+		requests := entries(privacy.ActionErase)
+		require.Len(t, requests, 1)
+		assert.Equal(t, audit.Anonymous, requests[0].Actor)
+		erased := entries(repository.ActionCustomerErased)
+		require.Len(t, erased, 1)
+		assert.Contains(t, erased[0].Changes, "erased_at")
+		assert.Len(t, entries(repository.ActionOrderAddressErased), 1)
+
+		w = erase(customer.ID)
+		require.Equal(t, http.StatusOK, w.Code, "erasing again is harmless")
+		var again models.Erasure
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &again))
+		assert.True(t, erasure.ErasedAt.Equal(again.ErasedAt))
+		assert.Len(t, entries(privacy.ActionErase), 2)
+		assert.Len(t, entries(repository.ActionCustomerErased), 1)
+	})
+
+	t.Run("Erased email cannot be registered", func(t *testing.T) {
+		w := performRequest(router, "POST", "/auth/register", fmt.Sprintf(
+			`{"name":"Someone","email":%q,"password":"correct horse"}`, models.ErasedEmail(customer.ID)))
+		assert.Equal(t, http.StatusConflict, w.Code)
+		w = performRequest(router, "POST", "/auth/register",
+			`{"name":"Wanjiru Kamau","email":"wanjiru@example.com","password":"correct horse"}`)
+		assert.Equal(t, http.StatusCreated, w.Code, "the real address is free again")
+	})
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"orderservice/apperrors"
+	"orderservice/logging"
+	"orderservice/models"
+	"orderservice/money"
+	"orderservice/repository"
+	"orderservice/validation"
+)
+
+type PromotionHandler struct {
+	store    repository.Store
+	exchange money.Rates
+	logger   *zap.Logger
+}
+
+func NewPromotionHandler(store repository.Store, exchange money.Rates, logger *zap.Logger) *PromotionHandler {
+	return &PromotionHandler{
+		store:    store,
+		exchange: exchange,
+		logger:   logger,
+	}
+}
+
+func (h *PromotionHandler) CreatePromotion(c *gin.Context) {
+	log := logging.FromContext(c.Request.Context(), h.logger)
+
+	var promotion models.Promotion
+	if err := validation.BindJSON(c, &promotion); err != nil {
+		log.Error("Invalid promotion input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	promotion.Code = models.NormalizeCode(promotion.Code)
+	promotion.UsageCount = 0
+	if promotion.Currency == "" {
+		promotion.Currency = h.exchange.Base
+	}
+
+	err := checkCurrency(h.exchange, promotion.Currency)
+	if err == nil {
+		err = h.store.Promotions().CreatePromotion(c.Request.Context(), &promotion)
+	}
+	if err != nil {
+		log.Error("Failed to create promotion", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	log.Info("Promotion created", zap.String("code", promotion.Code))
+	c.JSON(http.StatusCreated, promotion)
+}
+
+func (h *PromotionHandler) GetPromotions(c *gin.Context) {
+	promotions, err := h.store.Promotions().GetAllPromotions(c.Request.Context())
+	if err != nil {
+		logging.FromContext(c.Request.Context(), h.logger).Error("Failed to fetch promotions", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, promotions)
+}
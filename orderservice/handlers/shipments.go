@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"orderservice/apperrors"
+	"orderservice/fulfilment"
+	"orderservice/logging"
+	"orderservice/models"
+	"orderservice/notify"
+	"orderservice/repository"
+	"orderservice/validation"
+)
+
+// ShipmentHandler records the shipments that fulfil paid orders and moves
+// each order through partially_shipped, shipped and delivered as they
+// progress.
+type ShipmentHandler struct {
+	store  repository.Store
+	logger *zap.Logger
+}
+
+func NewShipmentHandler(store repository.Store, logger *zap.Logger) *ShipmentHandler {
+	return &ShipmentHandler{
+		store:  store,
+		logger: logger,
+	}
+}
+
+func (h *ShipmentHandler) log(c *gin.Context) *zap.Logger {
+	return logging.FromContext(c.Request.Context(), h.logger)
+}
+
+// CreateShipment sends some or all of the lines of a paid order that have
+// not yet gone out in another shipment.
+func (h *ShipmentHandler) CreateShipment(c *gin.Context) {
+	orderID, ok := h.orderID(c)
+	if !ok {
+		return
+	}
+	var req models.CreateShipmentRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		h.log(c).Error("Invalid shipment input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	status := req.Status
+	if status == "" {
+		status = models.ShipmentShipped
+	}
+
+	ctx := c.Request.Context()
+	shipment := models.Shipment{
+		OrderID:        orderID,
+		Carrier:        req.Carrier,
+		TrackingNumber: req.TrackingNumber,
+		Status:         models.ShipmentPending,
+		Items:          req.Items,
+	}
+	err := h.store.WithinTx(ctx, func(tx repository.Store) error {
+		order, err := tx.Orders().GetOrder(ctx, orderID)
+		if err != nil {
+			return err
+		}
+		if err := fulfilment.Shippable(order); err != nil {
+			return err
+		}
+		shipments, err := tx.Shipments().ListShipments(ctx, orderID)
+		if err != nil {
+			return err
+		}
+		if err := fulfilment.Check(order, shipments, shipment.Items); err != nil {
+			return err
+		}
+		if err := fulfilment.Advance(&shipment, status, req.ShippedAt, req.DeliveredAt, time.Now().UTC()); err != nil {
+			return err
+		}
+		if err := tx.Shipments().CreateShipment(ctx, &shipment); err != nil {
+			return err
+		}
+		return h.sync(ctx, tx, order, append(shipments, shipment))
+	})
+	if err != nil {
+		h.log(c).Error("Shipment creation failed", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	h.log(c).Info("Shipment created", zap.Uint("shipment_id", shipment.ID), zap.String("status", shipment.Status))
+	c.JSON(http.StatusCreated, shipment)
+}
+
+func (h *ShipmentHandler) GetShipments(c *gin.Context) {
+	orderID, ok := h.orderID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	var shipments []models.Shipment
+	_, err := h.store.Orders().GetOrder(ctx, orderID)
+	if err == nil {
+		shipments, err = h.store.Shipments().ListShipments(ctx, orderID)
+	}
+	if err != nil {
+		h.log(c).Error("Failed to fetch shipments", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	if shipments == nil {
+		shipments = []models.Shipment{}
+	}
+	c.JSON(http.StatusOK, shipments)
+}
+
+// UpdateShipment changes a shipment's carrier or tracking number, or moves
+// it on to shipped or delivered.
+func (h *ShipmentHandler) UpdateShipment(c *gin.Context) {
+	orderID, ok := h.orderID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("shipment_id"), 10, 0)
+	if err != nil {
+		h.log(c).Error("Invalid shipment ID", zap.Error(err))
+		apperrors.Respond(c, apperrors.Validation("invalid shipment ID"))
+		return
+	}
+	var req models.UpdateShipmentRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		h.log(c).Error("Invalid shipment input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	var shipment *models.Shipment
+	err = h.store.WithinTx(ctx, func(tx repository.Store) error {
+		var err error
+		if shipment, err = tx.Shipments().GetShipment(ctx, uint(id)); err != nil {
+			return err
+		}
+		if shipment.OrderID != orderID {
+			return apperrors.NotFound("shipment not found", nil)
+		}
+		order, err := tx.Orders().GetOrder(ctx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status == models.OrderCancelled {
+			return apperrors.Conflict("order has been cancelled", nil)
+		}
+
+		if req.Carrier != nil {
+			shipment.Carrier = *req.Carrier
+		}
+		if req.TrackingNumber != nil {
+			shipment.TrackingNumber = *req.TrackingNumber
+		}
+		status := req.Status
+		if status == "" {
+			status = shipment.Status
+		}
+		if err := fulfilment.Advance(shipment, status, req.ShippedAt, req.DeliveredAt, time.Now().UTC()); err != nil {
+			return err
+		}
+		if err := tx.Shipments().UpdateShipment(ctx, shipment); err != nil {
+			return err
+		}
+		shipments, err := tx.Shipments().ListShipments(ctx, orderID)
+		if err != nil {
+			return err
+		}
+		return h.sync(ctx, tx, order, shipments)
+	})
+	if err != nil {
+		h.log(c).Error("Shipment update failed", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	h.log(c).Info("Shipment updated", zap.Uint("shipment_id", shipment.ID), zap.String("status", shipment.Status))
+	c.JSON(http.StatusOK, shipment)
+}
+
+// sync moves order to the status its shipments put it in and tells the
+// customer.
+func (h *ShipmentHandler) sync(ctx context.Context, store repository.Store, order *models.Order, shipments []models.Shipment) error {
+	status := fulfilment.Status(order, shipments)
+	if status == order.Status {
+		return nil
+	}
+	if err := store.Orders().UpdateOrderStatus(ctx, order.ID, status); err != nil {
+		return err
+	}
+	h.logger.Info("Order status follows its shipments",
+		zap.Uint("order_id", order.ID), zap.String("from", order.Status), zap.String("to", status))
+	order.Status = status
+	if event, ok := notify.Event(status); ok {
+		return notify.Queue(ctx, store, event, order)
+	}
+	return nil
+}
+
+func (h *ShipmentHandler) orderID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		h.log(c).Error("Invalid order ID", zap.Error(err))
+		apperrors.Respond(c, apperrors.Validation("invalid order ID"))
+		return 0, false
+	}
+	logging.With(c, h.logger, zap.Uint64("order_id", id))
+	return uint(id), true
+}
@@ -0,0 +1,147 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"orderservice/handlers"
+	"orderservice/models"
+	"orderservice/repository"
+)
+
+func TestShipments(t *testing.T) {
+	store := repository.NewMemoryStore()
+	logger, _ := zap.NewDevelopment()
+	handler := handlers.NewShipmentHandler(store, logger)
+
+	router := gin.New()
+	router.GET("/orders/:id/shipments", handler.GetShipments)
+	router.POST("/orders/:id/shipments", handler.CreateShipment)
+	router.PUT("/orders/:id/shipments/:shipment_id", handler.UpdateShipment)
+
+	customer := &models.Customer{Name: "Achieng", Email: "achieng@example.com"}
+	store.Customers().CreateCustomer(ctx, customer)
+	kettle := &models.Product{Name: "Kettle", Price: 2500}
+	store.Products().CreateProduct(ctx, kettle)
+	toaster := &models.Product{Name: "Toaster", Price: 3200}
+	store.Products().CreateProduct(ctx, toaster)
+
+	newOrder := func(status string) *models.Order {
+		order := &models.Order{CustomerID: customer.ID, Products: []models.Product{*kettle, *toaster}, Items: []models.OrderItem{
+			{ProductID: kettle.ID, Name: "Kettle", UnitPrice: 2500, Quantity: 2, Total: 5000},
+			{ProductID: toaster.ID, Name: "Toaster", UnitPrice: 3200, Quantity: 1, Total: 3200},
+		}}
+		require.NoError(t, store.Orders().CreateOrder(ctx, order))
+		require.NoError(t, store.Orders().UpdateOrderStatus(ctx, order.ID, status))
+		return order
+	}
+	status := func(t *testing.T, order *models.Order) string {
+		t.Helper()
+		fetched, err := store.Orders().GetOrder(ctx, order.ID)
+		require.NoError(t, err)
+		return fetched.Status
+	}
+
+	order := newOrder(models.OrderPaid)
+	path := fmt.Sprintf("/orders/%d/shipments", order.ID)
+	kettleLine, toasterLine := order.Items[0].ID, order.Items[1].ID
+
+	var first models.Shipment
+	t.Run("Partial shipment", func(t *testing.T) {
+		w := performRequest(router, "POST", path, fmt.Sprintf(
+			`{"carrier":"G4S","tracking_number":"G4S-001","items":[{"order_item_id":%d,"quantity":1}]}`, kettleLine))
+
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+		assert.Equal(t, models.ShipmentShipped, first.Status)
+		assert.NotNil(t, first.ShippedAt)
+		assert.Equal(t, models.OrderPartiallyShipped, status(t, order))
+	})
+
+	t.Run("More than is left to ship", func(t *testing.T) {
+		w := performRequest(router, "POST", path, fmt.Sprintf(
+			`{"carrier":"G4S","items":[{"order_item_id":%d,"quantity":2}]}`, kettleLine))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"items[0].quantity"`)
+
+		w = performRequest(router, "POST", path, `{"carrier":"G4S","items":[{"order_item_id":9999,"quantity":1}]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"items[0].order_item_id"`)
+	})
+
+	var second models.Shipment
+	t.Run("Rest of the order", func(t *testing.T) {
+		w := performRequest(router, "POST", path, fmt.Sprintf(
+			`{"carrier":"Sendy","items":[{"order_item_id":%d,"quantity":1},{"order_item_id":%d,"quantity":1}]}`,
+			kettleLine, toasterLine))
+
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &second))
+		assert.Equal(t, models.OrderShipped, status(t, order))
+
+		w = performRequest(router, "POST", path, fmt.Sprintf(
+			`{"carrier":"Sendy","items":[{"order_item_id":%d,"quantity":1}]}`, toasterLine))
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Delivery", func(t *testing.T) {
+		w := performRequest(router, "PUT", fmt.Sprintf("%s/%d", path, first.ID), `{"status":"delivered"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, models.OrderShipped, status(t, order), "second shipment still in transit")
+
+		w = performRequest(router, "PUT", fmt.Sprintf("%s/%d", path, second.ID),
+			`{"tracking_number":"SENDY-42","status":"delivered"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var updated models.Shipment
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+		assert.Equal(t, "SENDY-42", updated.TrackingNumber)
+		assert.NotNil(t, updated.DeliveredAt)
+		assert.Equal(t, models.OrderDelivered, status(t, order))
+
+		w = performRequest(router, "PUT", fmt.Sprintf("%s/%d", path, second.ID), `{"status":"shipped"}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("List shipments", func(t *testing.T) {
+		w := performRequest(router, "GET", path, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var shipments []models.Shipment
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &shipments))
+		require.Len(t, shipments, 2)
+		assert.Equal(t, "G4S-001", shipments[0].TrackingNumber)
+		require.Len(t, shipments[1].Items, 2)
+
+		other := newOrder(models.OrderPaid)
+		w = performRequest(router, "GET", fmt.Sprintf("/orders/%d/shipments", other.ID), "")
+		assert.Equal(t, "[]", w.Body.String())
+
+		w = performRequest(router, "GET", "/orders/9999/shipments", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Shipment of another order", func(t *testing.T) {
+		other := newOrder(models.OrderPaid)
+		w := performRequest(router, "PUT", fmt.Sprintf("/orders/%d/shipments/%d", other.ID, first.ID), `{"carrier":"DHL"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Unpaid order", func(t *testing.T) {
+		pending := newOrder(models.OrderPending)
+		w := performRequest(router, "POST", fmt.Sprintf("/orders/%d/shipments", pending.ID), fmt.Sprintf(
+			`{"carrier":"G4S","items":[{"order_item_id":%d,"quantity":1}]}`, pending.Items[0].ID))
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, models.OrderPending, status(t, pending))
+	})
+
+	t.Run("Invalid shipment", func(t *testing.T) {
+		w := performRequest(router, "POST", path, `{"items":[]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"carrier"`)
+	})
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"orderservice/apperrors"
+	"orderservice/logging"
+	"orderservice/models"
+	"orderservice/money"
+	"orderservice/repository"
+	"orderservice/shipping"
+	"orderservice/validation"
+)
+
+// ShippingHandler manages the shipping methods orders can be sent by and
+// their rates.
+type ShippingHandler struct {
+	store    repository.Store
+	exchange money.Rates
+	logger   *zap.Logger
+}
+
+func NewShippingHandler(store repository.Store, exchange money.Rates, logger *zap.Logger) *ShippingHandler {
+	return &ShippingHandler{
+		store:    store,
+		exchange: exchange,
+		logger:   logger,
+	}
+}
+
+func (h *ShippingHandler) log(c *gin.Context) *zap.Logger {
+	return logging.FromContext(c.Request.Context(), h.logger)
+}
+
+func (h *ShippingHandler) CreateShippingMethod(c *gin.Context) {
+	var method models.ShippingMethod
+	if err := validation.BindJSON(c, &method); err != nil {
+		h.log(c).Error("Invalid shipping method input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	shipping.Normalize(&method)
+	if method.Currency == "" {
+		method.Currency = h.exchange.Base
+	}
+
+	err := checkCurrency(h.exchange, method.Currency)
+	if err == nil {
+		err = h.store.Shipping().CreateShippingMethod(c.Request.Context(), &method)
+	}
+	if err != nil {
+		h.log(c).Error("Failed to create shipping method", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	h.log(c).Info("Shipping method created", zap.String("code", method.Code))
+	c.JSON(http.StatusCreated, method)
+}
+
+func (h *ShippingHandler) GetShippingMethods(c *gin.Context) {
+	methods, err := h.store.Shipping().GetAllShippingMethods(c.Request.Context())
+	if err != nil {
+		h.log(c).Error("Failed to fetch shipping methods", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, methods)
+}
+
+// UpdateShippingMethod replaces the method named in the path, including
+// all of its rates. Orders already placed keep the fee they were charged.
+func (h *ShippingHandler) UpdateShippingMethod(c *gin.Context) {
+	var method models.ShippingMethod
+	if err := validation.BindJSON(c, &method); err != nil {
+		h.log(c).Error("Invalid shipping method input", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	code := models.NormalizeShippingCode(c.Param("code"))
+	if models.NormalizeShippingCode(method.Code) != code {
+		apperrors.Respond(c, apperrors.Validation("code cannot be changed",
+			apperrors.FieldError{Field: "code", Message: "must match the shipping method being updated"}))
+		return
+	}
+	shipping.Normalize(&method)
+	if method.Currency == "" {
+		method.Currency = h.exchange.Base
+	}
+
+	ctx := c.Request.Context()
+	err := h.store.WithinTx(ctx, func(tx repository.Store) error {
+		if err := checkCurrency(h.exchange, method.Currency); err != nil {
+			return err
+		}
+		stored, err := tx.Shipping().GetShippingMethod(ctx, code)
+		if err != nil {
+			return err
+		}
+		method.Model = stored.Model
+		return tx.Shipping().SaveShippingMethod(ctx, &method)
+	})
+	if err != nil {
+		h.log(c).Error("Failed to update shipping method", zap.Error(err), zap.String("code", code))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	h.log(c).Info("Shipping method updated", zap.String("code", method.Code))
+	c.JSON(http.StatusOK, method)
+}
@@ -0,0 +1,252 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"orderservice/auth"
+	"orderservice/handlers"
+	"orderservice/models"
+	"orderservice/repository"
+)
+
+func TestAddresses(t *testing.T) {
+	store := repository.NewMemoryStore()
+	logger, _ := zap.NewDevelopment()
+	handler := handlers.NewAddressHandler(store, logger)
+	tokens := auth.NewTokens([]byte("0123456789abcdef0123456789abcdef"), time.Hour)
+
+	router := gin.New()
+	me := router.Group("/me", auth.Middleware(tokens, store, logger))
+	me.GET("/addresses", handler.GetAddresses)
+	me.POST("/addresses", handler.CreateAddress)
+	me.PUT("/addresses/:address_id", handler.UpdateAddress)
+	me.DELETE("/addresses/:address_id", handler.DeleteAddress)
+
+	customer := &models.Customer{Name: "Wanjiru", Email: "wanjiru@example.com"}
+	store.Customers().CreateCustomer(ctx, customer)
+	other := &models.Customer{Name: "Otieno", Email: "otieno@example.com"}
+	store.Customers().CreateCustomer(ctx, other)
+
+	// as sends a request signed in as the customer with id.
+	as := func(id uint, method, path, body string) *httptest.ResponseRecorder {
+		token, _, err := tokens.Issue(id, 0, time.Now())
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	var address models.Address
+	t.Run("Create address", func(t *testing.T) {
+		w := as(customer.ID, "POST", "/me/addresses",
+			`{"label":"Home","county":"Nairobi","town":"Westlands","street":"Waiyaki Way","phone":"0712 345 678"}`)
+
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &address))
+		assert.Equal(t, customer.ID, address.CustomerID)
+		assert.Equal(t, "254712345678", address.Phone)
+	})
+
+	t.Run("Invalid address", func(t *testing.T) {
+		w := as(customer.ID, "POST", "/me/addresses", `{"county":"Nairobi","phone":"12345"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"phone"`)
+		assert.Contains(t, w.Body.String(), `"field":"street"`)
+	})
+
+	t.Run("Signed out", func(t *testing.T) {
+		w := performRequest(router, "GET", "/me/addresses", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w = performRequest(router, "POST", "/me/addresses",
+			`{"county":"Nairobi","town":"Nairobi","street":"Moi Avenue","phone":"0712345678"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Update and list addresses", func(t *testing.T) {
+		w := as(customer.ID, "PUT", fmt.Sprintf("/me/addresses/%d", address.ID),
+			`{"label":"Home","county":"Kiambu","town":"Ruaka","street":"Limuru Road","phone":"0712345678"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		w = as(customer.ID, "GET", "/me/addresses", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var addresses []models.Address
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &addresses))
+		require.Len(t, addresses, 1)
+		assert.Equal(t, "Kiambu", addresses[0].County)
+	})
+
+	t.Run("Another customer's address", func(t *testing.T) {
+		w := as(other.ID, "DELETE", fmt.Sprintf("/me/addresses/%d", address.ID), "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = as(other.ID, "PUT", fmt.Sprintf("/me/addresses/%d", address.ID),
+			`{"county":"Nairobi","town":"Nairobi","street":"Moi Avenue","phone":"0712345678"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = as(other.ID, "GET", "/me/addresses", "")
+		assert.Equal(t, "[]", w.Body.String())
+	})
+
+	t.Run("Delete address", func(t *testing.T) {
+		w := as(customer.ID, "DELETE", fmt.Sprintf("/me/addresses/%d", address.ID), "")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+
+		w = as(customer.ID, "DELETE", fmt.Sprintf("/me/addresses/%d", address.ID), "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestShipping(t *testing.T) {
+	store := repository.NewMemoryStore()
+	logger, _ := zap.NewDevelopment()
+	shippingHandler := handlers.NewShippingHandler(store, exchange, logger)
+	orderHandler := handlers.NewOrderHandler(store, rates, exchange, logger)
+	cartHandler := handlers.NewCartHandler(store, rates, exchange, time.Hour, logger)
+
+	router := gin.New()
+	router.Use(auth.Staff(staffToken))
+	router.GET("/shipping-methods", shippingHandler.GetShippingMethods)
+	router.POST("/shipping-methods", shippingHandler.CreateShippingMethod)
+	router.PUT("/shipping-methods/:code", shippingHandler.UpdateShippingMethod)
+	router.POST("/orders", orderHandler.CreateOrder)
+	router.GET("/orders/:id", orderHandler.GetOrder)
+	router.PUT("/orders/:id/currency", orderHandler.ConvertOrder)
+	router.POST("/carts", cartHandler.CreateCart)
+	router.POST("/carts/:id/checkout", cartHandler.Checkout)
+
+	customer := &models.Customer{Name: "Kamau", Email: "kamau@example.com"}
+	store.Customers().CreateCustomer(ctx, customer)
+	address := &models.Address{CustomerID: customer.ID, County: "Nairobi", Town: "Nairobi", Street: "Moi Avenue", Phone: "254712345678"}
+	store.Addresses().CreateAddress(ctx, address)
+	kettle := &models.Product{Name: "Kettle", Price: 2600, Weight: 1.5}
+	store.Products().CreateProduct(ctx, kettle)
+
+	t.Run("Create shipping methods", func(t *testing.T) {
+		w := performRequest(router, "POST", "/shipping-methods", `{"code":"Standard","name":"Standard delivery","rates":[
+			{"zone":"Nairobi","counties":["Nairobi"],"max_weight":5,"fee":200},
+			{"zone":"Rest of Kenya","fee":450}]}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var method models.ShippingMethod
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &method))
+		assert.Equal(t, "standard", method.Code)
+		assert.Equal(t, "KES", method.Currency)
+
+		w = performRequest(router, "POST", "/shipping-methods",
+			`{"code":"pickup","name":"Collect in store","pickup":true,"rates":[{"zone":"Shop","fee":0}]}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		w = performRequest(router, "POST", "/shipping-methods", `{"code":"express","name":"Express","rates":[]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = performRequest(router, "GET", "/shipping-methods", "")
+		var methods []models.ShippingMethod
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &methods))
+		assert.Len(t, methods, 2)
+	})
+
+	t.Run("Update shipping method", func(t *testing.T) {
+		w := performRequest(router, "PUT", "/shipping-methods/standard", `{"code":"standard","name":"Standard delivery","rates":[
+			{"zone":"Nairobi","counties":["Nairobi"],"max_weight":5,"fee":260},
+			{"zone":"Rest of Kenya","fee":450}]}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		w = performRequest(router, "PUT", "/shipping-methods/standard", `{"code":"other","name":"Other","rates":[{"zone":"Kenya","fee":1}]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = performRequest(router, "PUT", "/shipping-methods/drone", `{"code":"drone","name":"Drone","rates":[{"zone":"Kenya","fee":1}]}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	var order models.Order
+	t.Run("Order shipped to a saved address", func(t *testing.T) {
+		w := performRequest(router, "POST", "/orders", fmt.Sprintf(
+			`{"customer_id":%d,"products":[{"id":%d}],"shipping_method":"standard","address_id":%d}`,
+			customer.ID, kettle.ID, address.ID))
+
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &order))
+		assert.Equal(t, "standard", order.ShippingMethod)
+		assert.Equal(t, 260.0, order.ShippingFee)
+		assert.Equal(t, 2860.0, order.Total)
+		assert.NotContains(t, w.Body.String(), "shipping_address", "the address is only shown to its customer and staff")
+
+		stored, err := store.Orders().GetOrder(ctx, order.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 2860.0, stored.Total)
+		assert.Equal(t, "Moi Avenue", stored.ShippingAddress.Street)
+	})
+
+	t.Run("Address only shown to staff", func(t *testing.T) {
+		path := fmt.Sprintf("/orders/%d", order.ID)
+		w := performRequest(router, "GET", path, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "shipping_address")
+
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(auth.StaffHeader, staffToken)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "Moi Avenue")
+	})
+
+	t.Run("Converted orders convert the shipping fee", func(t *testing.T) {
+		w := performRequest(router, "POST", "/orders", fmt.Sprintf(
+			`{"customer_id":%d,"products":[{"id":%d}],"currency":"USD","shipping_method":"standard","address_id":%d}`,
+			customer.ID, kettle.ID, address.ID))
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var usd models.Order
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &usd))
+		assert.Equal(t, 2.0, usd.ShippingFee)
+		assert.Equal(t, 22.0, usd.Total)
+
+		w = performRequest(router, "PUT", fmt.Sprintf("/orders/%d/currency", usd.ID), `{"currency":"KES"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &usd))
+		assert.Equal(t, 260.0, usd.ShippingFee)
+		assert.Equal(t, 2860.0, usd.Total)
+	})
+
+	t.Run("Delivery needs an address", func(t *testing.T) {
+		w := performRequest(router, "POST", "/orders", fmt.Sprintf(
+			`{"customer_id":%d,"products":[{"id":%d}],"shipping_method":"standard"}`, customer.ID, kettle.ID))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"shipping_address"`)
+
+		w = performRequest(router, "POST", "/orders", fmt.Sprintf(
+			`{"customer_id":%d,"products":[{"id":%d}],"shipping_method":"standard",
+			  "shipping_address":{"county":"Mombasa","town":"Nyali","street":"Links Road","phone":"not a phone"}}`,
+			customer.ID, kettle.ID))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"shipping_address.phone"`)
+	})
+
+	t.Run("Cart checked out for pickup", func(t *testing.T) {
+		w := performRequest(router, "POST", "/carts",
+			fmt.Sprintf(`{"customer_id":%d,"items":[{"product_id":%d,"quantity":1}]}`, customer.ID, kettle.ID))
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var cart models.Cart
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &cart))
+
+		w = performRequest(router, "POST", fmt.Sprintf("/carts/%d/checkout", cart.ID), `{"shipping_method":"pickup"}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var order models.Order
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &order))
+		assert.Equal(t, "pickup", order.ShippingMethod)
+		assert.Zero(t, order.ShippingFee)
+		assert.NotContains(t, w.Body.String(), "shipping_address")
+	})
+}
@@ -0,0 +1,72 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker(t *testing.T) {
+	t.Run("All checks pass", func(t *testing.T) {
+		checker := NewChecker(time.Second)
+		checker.Add("database", func(ctx context.Context) error { return nil })
+		checker.Add("cache", func(ctx context.Context) error { return nil })
+
+		report := checker.Run(context.Background())
+		assert.Equal(t, StatusOK, report.Status)
+		assert.Len(t, report.Checks, 2)
+		assert.Equal(t, StatusOK, report.Checks["database"].Status)
+	})
+
+	t.Run("One check fails", func(t *testing.T) {
+		checker := NewChecker(time.Second)
+		checker.Add("database", func(ctx context.Context) error { return errors.New("connection refused") })
+		checker.Add("cache", func(ctx context.Context) error { return nil })
+
+		report := checker.Run(context.Background())
+		assert.Equal(t, StatusUnavailable, report.Status)
+		assert.Equal(t, "connection refused", report.Checks["database"].Error)
+		assert.Equal(t, StatusOK, report.Checks["cache"].Status)
+	})
+
+	t.Run("Check exceeds timeout", func(t *testing.T) {
+		checker := NewChecker(10 * time.Millisecond)
+		checker.Add("slow", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		report := checker.Run(context.Background())
+		assert.Equal(t, StatusUnavailable, report.Status)
+	})
+}
+
+func TestCached(t *testing.T) {
+	calls := 0
+	check := Cached(func(ctx context.Context) error {
+		calls++
+		return nil
+	}, time.Minute)
+
+	check(context.Background())
+	check(context.Background())
+	assert.Equal(t, 1, calls)
+}
+
+func TestCheckerHungCheck(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	checker := NewChecker(10 * time.Millisecond)
+	checker.Add("hung", func(ctx context.Context) error {
+		<-block
+		return nil
+	})
+
+	report := checker.Run(context.Background())
+	assert.Equal(t, StatusUnavailable, report.Status)
+	assert.Equal(t, "check timed out", report.Checks["hung"].Error)
+}
@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestMiddleware(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	router := gin.New()
+	router.Use(Middleware(zap.New(core)))
+	router.GET("/orders/:id", func(c *gin.Context) {
+		With(c, nil, zap.String("order_id", c.Param("id")))
+		FromContext(c.Request.Context(), nil).Info("handled")
+		c.String(http.StatusOK, RequestID(c.Request.Context()))
+	})
+
+	t.Run("Accepts caller request ID", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/orders/7", nil)
+		req.Header.Set(RequestIDHeader, "abc-123")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "abc-123", w.Header().Get(RequestIDHeader))
+		assert.Equal(t, "abc-123", w.Body.String())
+
+		entry := logs.TakeAll()[0]
+		assert.Equal(t, "abc-123", entry.ContextMap()["request_id"])
+		assert.Equal(t, "7", entry.ContextMap()["order_id"])
+	})
+
+	t.Run("Generates missing request ID", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/orders/1", nil))
+		assert.Len(t, w.Header().Get(RequestIDHeader), 32)
+		logs.TakeAll()
+	})
+
+	t.Run("Replaces unsafe request ID", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/orders/1", nil)
+		req.Header.Set(RequestIDHeader, "bad id\n"+strings.Repeat("x", 200))
+		router.ServeHTTP(w, req)
+		assert.Len(t, w.Header().Get(RequestIDHeader), 32)
+		logs.TakeAll()
+	})
+}
+
+func TestFromContextFallback(t *testing.T) {
+	fallback := zap.NewNop()
+	req := httptest.NewRequest("GET", "/", nil)
+	assert.Equal(t, fallback, FromContext(req.Context(), fallback))
+	assert.Empty(t, RequestID(req.Context()))
+}
@@ -1,23 +1,52 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.uber.org/zap"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
+	"orderservice/audit"
+	"orderservice/auth"
+	"orderservice/carts"
+	"orderservice/config"
 	"orderservice/handlers"
-	"orderservice/models"
+	"orderservice/health"
+	"orderservice/logging"
+	"orderservice/metrics"
+	"orderservice/middleware"
+	"orderservice/migrations"
+	"orderservice/notify"
+	"orderservice/privacy"
+	"orderservice/purge"
+	"orderservice/repository"
+	"orderservice/tracing"
 )
 
 func main() {
 	logger, _ := zap.NewProduction()
 	defer logger.Sync()
 
+	serverConfig := config.LoadServer("8080")
+	deadlines := config.LoadDeadlines()
+
+	// Creating a migration only touches the source tree
+	if len(os.Args) > 2 && os.Args[1] == "migrate" && os.Args[2] == "create" {
+		os.Exit(runMigrate(nil, os.Args[2:]))
+	}
+
 	// Database connection
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=5432",
 		os.Getenv("DB_HOST"), os.Getenv("DB_USER"),
@@ -28,25 +57,337 @@ func main() {
 		logger.Fatal("Database connection failed", zap.Error(err))
 	}
 
-	// Auto migrate
-	db.AutoMigrate(
-		&models.Customer{},
-		&models.Product{},
-		&models.Order{},
-	)
+	shutdownTracing, err := tracing.Init(context.Background(), "orderservice")
+	if err != nil {
+		logger.Fatal("Tracing initialization failed", zap.Error(err))
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		logger.Fatal("Failed to instrument database", zap.Error(err))
+	}
+
+	if sqlDB, err := db.DB(); err == nil {
+		if err := metrics.RegisterDBStats(sqlDB); err != nil {
+			logger.Error("Failed to register DB pool metrics", zap.Error(err))
+		}
+	}
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		logger.Fatal("Failed to load migrations", zap.Error(err))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(migrator, os.Args[2:]))
+	}
+
+	// Refuse to serve against a schema this binary does not expect
+	if err := migrator.Check(context.Background()); err != nil {
+		logger.Fatal("Database schema check failed; run `orderservice migrate up`", zap.Error(err))
+	}
 
 	// Initialize handler
-	orderHandler := handlers.NewOrderHandler(db, logger)
+	store := repository.Audited(repository.NewGormStore(db, deadlines.Database))
+	rates := config.LoadTax()
+	exchange, err := config.LoadExchange()
+	if err != nil {
+		logger.Fatal("Invalid exchange rates", zap.Error(err))
+	}
+	cartConfig := config.LoadCarts()
+	orderHandler := handlers.NewOrderHandler(store, rates, exchange, logger)
+	promotionHandler := handlers.NewPromotionHandler(store, exchange, logger)
+	cartHandler := handlers.NewCartHandler(store, rates, exchange, cartConfig.TTL, logger)
+	addressHandler := handlers.NewAddressHandler(store, logger)
+	shippingHandler := handlers.NewShippingHandler(store, exchange, logger)
+	shipmentHandler := handlers.NewShipmentHandler(store, logger)
+	documentHandler := handlers.NewDocumentHandler(store, config.LoadBusiness(), logger)
+	notificationHandler := handlers.NewNotificationHandler(store, logger)
+	authConfig, generatedSecret, err := config.LoadAuth()
+	if err != nil {
+		logger.Fatal("Invalid authentication settings", zap.Error(err))
+	}
+	if generatedSecret {
+		logger.Warn("AUTH_JWT_SECRET is not set; using a random secret, so logins end when the service restarts")
+	}
+	if authConfig.StaffToken == "" {
+		logger.Warn("STAFF_TOKEN is not set; staff-only routes refuse every request")
+	}
+	accountHandler := handlers.NewAccountHandler(store, authConfig, logger)
+	payments := privacy.NewClient(config.String("PAYMENTS_SERVICE_URL", "http://localhost:8081"),
+		authConfig.ServiceToken, deadlines.PaymentsService)
+	privacyHandler := handlers.NewPrivacyHandler(store, payments, logger)
+	auditHandler := handlers.NewAuditHandler(store, logger)
+	deletionHandler := handlers.NewDeletionHandler(store, logger)
+	notificationConfig, err := config.LoadNotifications()
+	if err != nil {
+		logger.Fatal("Invalid notification settings", zap.Error(err))
+	}
+	senders, err := notificationSenders(notificationConfig)
+	if err != nil {
+		logger.Fatal("Failed to set up notifications", zap.Error(err))
+	}
+
+	checker := health.NewChecker(config.Duration("READINESS_TIMEOUT", 5*time.Second))
+	checker.Add("database", health.Database(db))
+	checker.Add("migrations", migrator.Check)
+	healthHandler := handlers.NewHealthHandler(checker, logger)
 
 	// Router setup
 	router := gin.Default()
+
+	// Client IPs are recorded in the audit log, so only trust forwarding
+	// headers from known proxies
+	var proxies []string
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		proxies = strings.Split(v, ",")
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		logger.Fatal("Invalid TRUSTED_PROXIES", zap.Error(err))
+	}
+
+	router.Use(otelgin.Middleware("orderservice"))
+	router.Use(logging.Middleware(logger))
+	router.Use(auth.Staff(authConfig.StaffToken))
+	router.Use(auth.Service(authConfig.ServiceToken))
+	router.Use(audit.Middleware(auth.Trusted))
+	router.Use(metrics.Middleware())
+	router.Use(middleware.BodyLimit(serverConfig.MaxBodyBytes))
+	router.GET("/healthz", healthHandler.Liveness)
+	router.GET("/readyz", healthHandler.Readiness)
+	router.GET("/metrics", metrics.Handler())
+	// Staff routes are reached through the admin gateway, which adds the
+	// staff token to the requests of signed-in staff.
+	staff := router.Group("", auth.RequireStaff())
+	// Trusted routes are also called by the payment service.
+	trusted := router.Group("", auth.RequireTrusted())
 	router.POST("/customers", orderHandler.CreateCustomer)
+	staff.DELETE("/customers/:id", deletionHandler.DeleteCustomer)
+	staff.POST("/customers/:id/restore", deletionHandler.RestoreCustomer)
+	staff.GET("/customers/:id/export", privacyHandler.ExportCustomer)
+	staff.POST("/customers/:id/erasure", privacyHandler.EraseCustomer)
+	staff.GET("/audit", auditHandler.GetAudit)
+	router.POST("/auth/register", accountHandler.Register)
+	router.POST("/auth/verify-email", accountHandler.VerifyEmail)
+	router.POST("/auth/verify-email/resend", accountHandler.ResendVerification)
+	router.POST("/auth/login", accountHandler.Login)
+	router.POST("/auth/password/forgot", accountHandler.ForgotPassword)
+	router.POST("/auth/password/reset", accountHandler.ResetPassword)
+	me := router.Group("/me", auth.Middleware(authConfig.Tokens(), store, logger))
+	me.GET("", accountHandler.Me)
+	me.GET("/orders", accountHandler.MyOrders)
+	me.GET("/orders/:id", accountHandler.MyOrder)
+	me.GET("/orders/:id/invoice", documentHandler.MyInvoice)
+	me.GET("/orders/:id/receipt", documentHandler.MyReceipt)
+	me.GET("/addresses", addressHandler.GetAddresses)
+	me.POST("/addresses", addressHandler.CreateAddress)
+	me.PUT("/addresses/:address_id", addressHandler.UpdateAddress)
+	me.DELETE("/addresses/:address_id", addressHandler.DeleteAddress)
 	router.POST("/orders", orderHandler.CreateOrder)
 	router.GET("/orders/:id", orderHandler.GetOrder)
-	router.PUT("/orders/:id/status", orderHandler.UpdateOrderStatus)
+	staff.DELETE("/orders/:id", deletionHandler.DeleteOrder)
+	staff.POST("/orders/:id/restore", deletionHandler.RestoreOrder)
+	trusted.PUT("/orders/:id/status", orderHandler.UpdateOrderStatus)
+	router.POST("/orders/:id/coupon", orderHandler.ApplyCoupon)
+	router.PUT("/orders/:id/currency", orderHandler.ConvertOrder)
+	router.GET("/orders/:id/shipments", shipmentHandler.GetShipments)
+	staff.POST("/orders/:id/shipments", shipmentHandler.CreateShipment)
+	staff.PUT("/orders/:id/shipments/:shipment_id", shipmentHandler.UpdateShipment)
+	staff.GET("/orders/:id/invoice", documentHandler.GetInvoice)
+	staff.POST("/orders/:id/invoice", documentHandler.IssueInvoice)
+	staff.GET("/orders/:id/receipt", documentHandler.GetReceipt)
+	staff.GET("/orders/:id/notifications", notificationHandler.GetNotifications)
+	staff.POST("/notifications/:id/retry", notificationHandler.RetryNotification)
 	router.GET("/products", orderHandler.GetProducts)
-	router.POST("/products", orderHandler.CreateProduct)
+	staff.POST("/products", orderHandler.CreateProduct)
+	staff.PUT("/products/:id/status", orderHandler.UpdateProductStatus)
+	staff.DELETE("/products/:id", deletionHandler.DeleteProduct)
+	staff.POST("/products/:id/restore", deletionHandler.RestoreProduct)
+	staff.GET("/promotions", promotionHandler.GetPromotions)
+	staff.POST("/promotions", promotionHandler.CreatePromotion)
+	router.GET("/shipping-methods", shippingHandler.GetShippingMethods)
+	staff.POST("/shipping-methods", shippingHandler.CreateShippingMethod)
+	staff.PUT("/shipping-methods/:code", shippingHandler.UpdateShippingMethod)
+	router.POST("/carts", cartHandler.CreateCart)
+	router.GET("/carts/:id", cartHandler.GetCart)
+	router.POST("/carts/:id/items", cartHandler.AddItem)
+	router.PUT("/carts/:id/items/:product_id", cartHandler.UpdateItem)
+	router.DELETE("/carts/:id/items/:product_id", cartHandler.RemoveItem)
+	router.POST("/carts/:id/coupons", cartHandler.AddCoupon)
+	router.DELETE("/carts/:id/coupons/:code", cartHandler.RemoveCoupon)
+	router.POST("/carts/:id/checkout", cartHandler.Checkout)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Background workers stop when workerCtx is cancelled during shutdown
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+
+	cartJob := carts.NewJob(store, cartConfig.SweepInterval, logger)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		cartJob.Run(workerCtx)
+	}()
 
-	logger.Info("Starting Orders Service on :8080")
-	http.ListenAndServe(":8080", router)
-}
\ No newline at end of file
+	purgeConfig := config.LoadPurge()
+	purgeJob := purge.NewJob(store, purgeConfig.Retention, purgeConfig.Interval, logger)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		purgeJob.Run(workerCtx)
+	}()
+
+	dispatcher := notify.NewDispatcher(store, senders, notificationConfig.Interval,
+		notificationConfig.MaxAttempts, notificationConfig.Backoff, logger)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		dispatcher.Run(workerCtx)
+	}()
+
+	server := serverConfig.HTTPServer(router)
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Starting Orders Service", zap.String("addr", server.Addr))
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal("Failed to start server", zap.Error(err))
+		}
+	case <-ctx.Done():
+	}
+	stop()
+
+	// Drain in-flight requests, then stop workers and close the connection
+	// pool
+	logger.Info("Shutting down Orders Service",
+		zap.Duration("grace_period", serverConfig.ShutdownGracePeriod))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serverConfig.ShutdownGracePeriod)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Graceful shutdown timed out", zap.Error(err))
+	}
+
+	stopWorkers()
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-shutdownCtx.Done():
+		logger.Error("Background workers did not stop in time")
+	}
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("Failed to flush traces", zap.Error(err))
+	}
+
+	if sqlDB, err := db.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			logger.Error("Failed to close database", zap.Error(err))
+		}
+	}
+
+	logger.Info("Orders Service stopped")
+}
+
+// runMigrate implements `orderservice migrate up|down|status|create NAME`.
+// migrator may be nil for create, which does not need a database.
+func runMigrate(migrator *migrations.Migrator, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: orderservice migrate up|down|status|create NAME")
+		return 2
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate up failed:", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+	case "down":
+		rolledBack, err := migrator.Down()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate down failed:", err)
+			return 1
+		}
+		if rolledBack == nil {
+			fmt.Println("nothing to roll back")
+			return 0
+		}
+		fmt.Printf("rolled back %04d_%s\n", rolledBack.Version, rolledBack.Name)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate status failed:", err)
+			return 1
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-40s %s\n", status.Version, status.Name, applied)
+		}
+	case "create":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: orderservice migrate create NAME")
+			return 2
+		}
+		paths, err := migrations.Create(migrations.Dir, strings.Join(args[1:], "_"))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate create failed:", err)
+			return 1
+		}
+		for _, path := range paths {
+			fmt.Println("created", path)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q\n", args[0])
+		return 2
+	}
+	return 0
+}
+
+// notificationSenders returns the sender for each enabled notification
+// channel. The log file, when used, stays open for the life of the process.
+func notificationSenders(cfg config.Notifications) (map[string]notify.Sender, error) {
+	senders := make(map[string]notify.Sender)
+	if cfg.Email == "off" && cfg.SMS == "off" {
+		return senders, nil
+	}
+
+	sink := &notify.LogSink{W: os.Stdout}
+	if cfg.LogFile != "" && (cfg.Email == "log" || cfg.SMS == "log") {
+		f, err := os.OpenFile(cfg.LogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		sink.W = f
+	}
+
+	switch cfg.Email {
+	case "smtp":
+		smtp := cfg.SMTP
+		senders[notify.ChannelEmail] = &smtp
+	case "log":
+		senders[notify.ChannelEmail] = sink
+	}
+	if cfg.SMS == "log" {
+		senders[notify.ChannelSMS] = notify.SMS(sink)
+	}
+	return senders, nil
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "orderservice"
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	OrdersCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_created_total",
+		Help:      "Orders created by initial status.",
+	}, []string{"status"})
+
+	OrderStatusUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "order_status_updates_total",
+		Help:      "Order status changes by new status.",
+	}, []string{"status"})
+
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Repository operation latency by operation and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "outcome"})
+
+	NotificationsDelivered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notification_deliveries_total",
+		Help:      "Notification delivery attempts by channel and outcome.",
+	}, []string{"channel", "outcome"})
+)
+
+// Middleware records request count and latency per route. Unmatched paths
+// share one label so scanners cannot blow up cardinality.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		HTTPDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the default registry in the Prometheus text format.
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// ObserveQuery records the latency of a repository operation started at
+// start. It returns err so callers can wrap their return statement.
+func ObserveQuery(operation string, start time.Time, err error) error {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	DBQueryDuration.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// RegisterDBStats exports connection pool statistics for db.
+func RegisterDBStats(db *sql.DB) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, namespace))
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/orders/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/metrics", Handler())
+
+	t.Run("Counts requests by route template", func(t *testing.T) {
+		before := testutil.ToFloat64(HTTPRequests.WithLabelValues("GET", "/orders/:id", "200"))
+		for _, path := range []string{"/orders/1", "/orders/2"} {
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		}
+		after := testutil.ToFloat64(HTTPRequests.WithLabelValues("GET", "/orders/:id", "200"))
+		assert.Equal(t, 2.0, after-before)
+	})
+
+	t.Run("Unmatched routes share a label", func(t *testing.T) {
+		before := testutil.ToFloat64(HTTPRequests.WithLabelValues("GET", "unmatched", "404"))
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/wp-admin", nil))
+		after := testutil.ToFloat64(HTTPRequests.WithLabelValues("GET", "unmatched", "404"))
+		assert.Equal(t, 1.0, after-before)
+	})
+
+	t.Run("Exposes metrics", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, strings.Contains(w.Body.String(), "orderservice_http_requests_total"))
+	})
+}
+
+func TestObserveQuery(t *testing.T) {
+	err := errors.New("boom")
+	assert.Equal(t, err, ObserveQuery("test_op", time.Now(), err))
+	assert.NoError(t, ObserveQuery("test_op", time.Now(), nil))
+	assert.Equal(t, 2, testutil.CollectAndCount(DBQueryDuration, "orderservice_db_query_duration_seconds"))
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"orderservice/apperrors"
+)
+
+// BodyLimit rejects requests whose body is larger than limit bytes. Bodies
+// without a declared length are cut off at the limit while being read.
+func BodyLimit(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			apperrors.Write(c, apperrors.Problem{
+				Type:   "/problems/payload-too-large",
+				Title:  http.StatusText(http.StatusRequestEntityTooLarge),
+				Status: http.StatusRequestEntityTooLarge,
+				Detail: "request body exceeds the size limit",
+			})
+			return
+		}
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,292 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Files holds the versioned SQL migrations compiled into the binary.
+//
+//go:embed sql/*.sql
+var Files embed.FS
+
+// Dir is where `migrate create` writes new migrations, relative to the
+// module root.
+const Dir = "migrations/sql"
+
+var ErrSchemaBehind = errors.New("database schema is behind")
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+type schemaMigration struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Load reads NNNN_name.up.sql / NNNN_name.down.sql pairs from the root of
+// fsys, ordered by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	hasUp := make(map[int64]bool)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+			hasUp[version] = true
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if !hasUp[m.Version] {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New returns a migrator for the migrations embedded in the binary.
+func New(db *gorm.DB) (*Migrator, error) {
+	sub, err := fs.Sub(Files, "sql")
+	if err != nil {
+		return nil, err
+	}
+	return NewFromFS(db, sub)
+}
+
+func NewFromFS(db *gorm.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest is the highest version known to this binary.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// applied returns the recorded migrations. A database that has never been
+// migrated has no schema_migrations table and reports none.
+func (m *Migrator) applied() (map[int64]schemaMigration, error) {
+	if !m.db.Migrator().HasTable(&schemaMigration{}) {
+		return map[int64]schemaMigration{}, nil
+	}
+	var rows []schemaMigration
+	if err := m.db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// Version returns the highest applied version, or 0 for an empty database.
+func (m *Migrator) Version() (int64, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	var version int64
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// Pending returns the migrations that have not been applied, in order.
+func (m *Migrator) Pending() ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies every pending migration, each in its own transaction.
+func (m *Migrator) Up() ([]Migration, error) {
+	if err := m.db.AutoMigrate(&schemaMigration{}); err != nil {
+		return nil, err
+	}
+	pending, err := m.Pending()
+	if err != nil {
+		return nil, err
+	}
+	for i, migration := range pending {
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.Up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now().UTC(),
+			}).Error
+		})
+		if err != nil {
+			return pending[:i], fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+	return pending, nil
+}
+
+// Down rolls back the most recently applied migration. It returns nil when
+// there is nothing to roll back.
+func (m *Migrator) Down() (*Migration, error) {
+	version, err := m.Version()
+	if err != nil || version == 0 {
+		return nil, err
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version != version {
+			continue
+		}
+		if migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s has no down script", migration.Version, migration.Name)
+		}
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return nil, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		return &migration, nil
+	}
+	return nil, fmt.Errorf("applied version %d is unknown to this binary", version)
+}
+
+// Status lists every known migration and when it was applied.
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Check returns ErrSchemaBehind when migrations are pending.
+func (m *Migrator) Check(ctx context.Context) error {
+	pending, err := (&Migrator{db: m.db.WithContext(ctx), migrations: m.migrations}).Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d pending, latest is %d", ErrSchemaBehind, len(pending), m.Latest())
+	}
+	return nil
+}
+
+// Create writes an empty up/down pair for the next version into dir and
+// returns the paths written.
+func Create(dir, name string) ([]string, error) {
+	name = strings.Trim(strings.ToLower(regexp.MustCompile(`[^A-Za-z0-9]+`).ReplaceAllString(name, "_")), "_")
+	if name == "" {
+		return nil, errors.New("migration name is required")
+	}
+
+	existing, err := Load(os.DirFS(dir))
+	if err != nil {
+		return nil, err
+	}
+	next := int64(1)
+	if len(existing) > 0 {
+		next = existing[len(existing)-1].Version + 1
+	}
+
+	var paths []string
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(dir, fmt.Sprintf("%04d_%s.%s.sql", next, name, direction))
+		if err := os.WriteFile(path, []byte("-- "+direction+" migration for "+name+"\n"), 0o644); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
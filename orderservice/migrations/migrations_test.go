@@ -0,0 +1,106 @@
+package migrations
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB() *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	db.Exec("DROP TABLE IF EXISTS schema_migrations")
+	db.Exec("DROP TABLE IF EXISTS widgets")
+	return db
+}
+
+var testFS = fstest.MapFS{
+	"0001_widgets.up.sql":         {Data: []byte("CREATE TABLE widgets (id INTEGER PRIMARY KEY, name TEXT);")},
+	"0001_widgets.down.sql":       {Data: []byte("DROP TABLE widgets;")},
+	"0002_widget_colour.up.sql":   {Data: []byte("ALTER TABLE widgets ADD COLUMN colour TEXT;")},
+	"0002_widget_colour.down.sql": {Data: []byte("ALTER TABLE widgets DROP COLUMN colour;")},
+	"README.md":                   {Data: []byte("ignored")},
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("Embedded migrations", func(t *testing.T) {
+		m, err := New(setupTestDB())
+		assert.NoError(t, err)
+		assert.NotZero(t, m.Latest())
+		for i, migration := range m.migrations {
+			assert.Equal(t, int64(i+1), migration.Version, "versions must be contiguous")
+			assert.NotEmpty(t, migration.Down, "%d_%s has no down script", migration.Version, migration.Name)
+		}
+	})
+
+	t.Run("Missing up script", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{"0001_x.down.sql": {Data: []byte("")}})
+		assert.Error(t, err)
+	})
+}
+
+func TestMigrator(t *testing.T) {
+	db := setupTestDB()
+	m, err := NewFromFS(db, testFS)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), m.Latest())
+
+	t.Run("Fresh database is behind", func(t *testing.T) {
+		err := m.Check(context.Background())
+		assert.ErrorIs(t, err, ErrSchemaBehind)
+	})
+
+	t.Run("Up applies pending migrations", func(t *testing.T) {
+		applied, err := m.Up()
+		assert.NoError(t, err)
+		assert.Len(t, applied, 2)
+		assert.True(t, db.Migrator().HasColumn("widgets", "colour"))
+		assert.NoError(t, m.Check(context.Background()))
+
+		applied, err = m.Up()
+		assert.NoError(t, err)
+		assert.Empty(t, applied)
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		statuses, err := m.Status()
+		assert.NoError(t, err)
+		assert.Len(t, statuses, 2)
+		assert.NotNil(t, statuses[1].AppliedAt)
+	})
+
+	t.Run("Down rolls back the latest migration", func(t *testing.T) {
+		rolledBack, err := m.Down()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), rolledBack.Version)
+
+		version, err := m.Version()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), version)
+		assert.False(t, db.Migrator().HasColumn("widgets", "colour"))
+		assert.ErrorIs(t, m.Check(context.Background()), ErrSchemaBehind)
+	})
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "0001_baseline.up.sql"), []byte(""), 0o644)
+
+	paths, err := Create(dir, "Add Coupons")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "0002_add_coupons.up.sql"),
+		filepath.Join(dir, "0002_add_coupons.down.sql"),
+	}, paths)
+
+	_, err = Create(dir, "  ")
+	assert.Error(t, err)
+}
@@ -0,0 +1,39 @@
+-- Baseline schema previously created by gorm AutoMigrate. IF NOT EXISTS lets
+-- databases that were auto-migrated adopt versioned migrations in place.
+CREATE TABLE IF NOT EXISTS customers (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    name       TEXT NOT NULL,
+    email      TEXT NOT NULL CONSTRAINT uni_customers_email UNIQUE
+);
+CREATE INDEX IF NOT EXISTS idx_customers_deleted_at ON customers (deleted_at);
+
+CREATE TABLE IF NOT EXISTS products (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    name       TEXT NOT NULL,
+    price      DECIMAL NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products (deleted_at);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    customer_id BIGINT NOT NULL,
+    status      TEXT DEFAULT 'pending'
+);
+CREATE INDEX IF NOT EXISTS idx_orders_deleted_at ON orders (deleted_at);
+
+CREATE TABLE IF NOT EXISTS order_products (
+    order_id   BIGINT NOT NULL,
+    product_id BIGINT NOT NULL,
+    PRIMARY KEY (order_id, product_id),
+    CONSTRAINT fk_order_products_order FOREIGN KEY (order_id) REFERENCES orders (id),
+    CONSTRAINT fk_order_products_product FOREIGN KEY (product_id) REFERENCES products (id)
+);
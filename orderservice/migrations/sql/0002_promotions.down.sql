@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS order_discounts;
+DROP TABLE IF EXISTS promotions;
+ALTER TABLE orders DROP COLUMN IF EXISTS discount;
+DROP INDEX IF EXISTS idx_products_category;
+ALTER TABLE products DROP COLUMN IF EXISTS category;
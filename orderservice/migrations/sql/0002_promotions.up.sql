@@ -0,0 +1,44 @@
+-- Product categories, coupon promotions and the per-order discount
+-- breakdown.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS category TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_products_category ON products (category);
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS discount DECIMAL NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS promotions (
+    id                 BIGSERIAL PRIMARY KEY,
+    created_at         TIMESTAMPTZ,
+    updated_at         TIMESTAMPTZ,
+    deleted_at         TIMESTAMPTZ,
+    code               TEXT NOT NULL,
+    description        TEXT NOT NULL DEFAULT '',
+    type               TEXT NOT NULL,
+    value              DECIMAL NOT NULL,
+    min_order_amount   DECIMAL NOT NULL DEFAULT 0,
+    product_ids        TEXT,
+    categories         TEXT,
+    starts_at          TIMESTAMPTZ,
+    ends_at            TIMESTAMPTZ,
+    usage_limit        BIGINT NOT NULL DEFAULT 0,
+    usage_count        BIGINT NOT NULL DEFAULT 0,
+    per_customer_limit BIGINT NOT NULL DEFAULT 0,
+    stackable          BOOLEAN NOT NULL DEFAULT FALSE,
+    disabled           BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_promotions_code ON promotions (code);
+CREATE INDEX IF NOT EXISTS idx_promotions_deleted_at ON promotions (deleted_at);
+
+CREATE TABLE IF NOT EXISTS order_discounts (
+    id           BIGSERIAL PRIMARY KEY,
+    order_id     BIGINT NOT NULL,
+    promotion_id BIGINT NOT NULL,
+    code         TEXT NOT NULL,
+    description  TEXT NOT NULL DEFAULT '',
+    stackable    BOOLEAN NOT NULL DEFAULT FALSE,
+    amount       DECIMAL NOT NULL,
+    created_at   TIMESTAMPTZ,
+    CONSTRAINT fk_orders_discounts FOREIGN KEY (order_id) REFERENCES orders (id),
+    CONSTRAINT fk_order_discounts_promotion FOREIGN KEY (promotion_id) REFERENCES promotions (id)
+);
+CREATE INDEX IF NOT EXISTS idx_order_discounts_order_id ON order_discounts (order_id);
+CREATE INDEX IF NOT EXISTS idx_order_discounts_promotion_id ON order_discounts (promotion_id);
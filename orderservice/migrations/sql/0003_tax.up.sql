@@ -0,0 +1,21 @@
+-- VAT classes on products, and priced order lines carrying line-level tax.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS tax_class TEXT NOT NULL DEFAULT 'standard';
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tax_amount DECIMAL NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tax_inclusive BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS order_items (
+    id         BIGSERIAL PRIMARY KEY,
+    order_id   BIGINT NOT NULL,
+    product_id BIGINT NOT NULL,
+    name       TEXT NOT NULL,
+    unit_price DECIMAL NOT NULL,
+    quantity   BIGINT NOT NULL DEFAULT 1,
+    tax_class  TEXT NOT NULL,
+    tax_rate   DECIMAL NOT NULL DEFAULT 0,
+    discount   DECIMAL NOT NULL DEFAULT 0,
+    tax_amount DECIMAL NOT NULL DEFAULT 0,
+    total      DECIMAL NOT NULL,
+    CONSTRAINT fk_orders_items FOREIGN KEY (order_id) REFERENCES orders (id)
+);
+CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items (order_id);
@@ -0,0 +1,27 @@
+-- Server-side shopping carts, and stock levels reserved at checkout.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS stock BIGINT;
+
+CREATE TABLE IF NOT EXISTS carts (
+    id           BIGSERIAL PRIMARY KEY,
+    created_at   TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ,
+    deleted_at   TIMESTAMPTZ,
+    customer_id  BIGINT NOT NULL DEFAULT 0,
+    status       TEXT NOT NULL DEFAULT 'open',
+    coupon_codes TEXT,
+    order_id     BIGINT,
+    expires_at   TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_carts_deleted_at ON carts (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_carts_customer_id ON carts (customer_id);
+CREATE INDEX IF NOT EXISTS idx_carts_expires_at ON carts (expires_at);
+
+CREATE TABLE IF NOT EXISTS cart_items (
+    id         BIGSERIAL PRIMARY KEY,
+    cart_id    BIGINT NOT NULL,
+    product_id BIGINT NOT NULL,
+    quantity   BIGINT NOT NULL,
+    unit_price DECIMAL NOT NULL,
+    CONSTRAINT fk_carts_items FOREIGN KEY (cart_id) REFERENCES carts (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cart_items_product ON cart_items (cart_id, product_id);
@@ -0,0 +1,18 @@
+DROP INDEX IF EXISTS idx_cart_items_product;
+DELETE FROM cart_items WHERE variant_id <> 0;
+ALTER TABLE cart_items DROP COLUMN IF EXISTS variant_id;
+CREATE UNIQUE INDEX idx_cart_items_product ON cart_items (cart_id, product_id);
+
+ALTER TABLE order_items DROP COLUMN IF EXISTS sku;
+ALTER TABLE order_items DROP COLUMN IF EXISTS variant_id;
+
+DROP TABLE IF EXISTS product_variants;
+
+DROP INDEX IF EXISTS idx_products_search;
+DROP INDEX IF EXISTS idx_products_price;
+DROP INDEX IF EXISTS idx_products_status;
+DROP INDEX IF EXISTS idx_products_sku;
+ALTER TABLE products DROP COLUMN IF EXISTS status;
+ALTER TABLE products DROP COLUMN IF EXISTS tags;
+ALTER TABLE products DROP COLUMN IF EXISTS description;
+ALTER TABLE products DROP COLUMN IF EXISTS sku;
@@ -0,0 +1,32 @@
+-- Catalogue: SKUs, descriptions, tags, archiving, variants with their own
+-- price and stock, and full-text search over product names and descriptions.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS sku TEXT NOT NULL DEFAULT '';
+ALTER TABLE products ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+ALTER TABLE products ADD COLUMN IF NOT EXISTS tags TEXT;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_products_sku ON products (sku) WHERE sku <> '';
+CREATE INDEX IF NOT EXISTS idx_products_status ON products (status);
+CREATE INDEX IF NOT EXISTS idx_products_price ON products (price);
+CREATE INDEX IF NOT EXISTS idx_products_search ON products
+    USING GIN (to_tsvector('english', name || ' ' || description));
+
+CREATE TABLE IF NOT EXISTS product_variants (
+    id         BIGSERIAL PRIMARY KEY,
+    product_id BIGINT NOT NULL,
+    sku        TEXT NOT NULL DEFAULT '',
+    name       TEXT NOT NULL,
+    size       TEXT NOT NULL DEFAULT '',
+    colour     TEXT NOT NULL DEFAULT '',
+    price      DECIMAL NOT NULL,
+    stock      BIGINT,
+    CONSTRAINT fk_products_variants FOREIGN KEY (product_id) REFERENCES products (id)
+);
+CREATE INDEX IF NOT EXISTS idx_product_variants_product_id ON product_variants (product_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_variants_sku ON product_variants (sku) WHERE sku <> '';
+
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS variant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS sku TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE cart_items ADD COLUMN IF NOT EXISTS variant_id BIGINT NOT NULL DEFAULT 0;
+DROP INDEX IF EXISTS idx_cart_items_product;
+CREATE UNIQUE INDEX idx_cart_items_product ON cart_items (cart_id, product_id, variant_id);
@@ -0,0 +1,8 @@
+ALTER TABLE order_items DROP COLUMN IF EXISTS exchange_rate;
+ALTER TABLE order_items DROP COLUMN IF EXISTS catalog_currency;
+ALTER TABLE order_items DROP COLUMN IF EXISTS catalog_price;
+
+ALTER TABLE promotions DROP COLUMN IF EXISTS currency;
+ALTER TABLE carts DROP COLUMN IF EXISTS currency;
+ALTER TABLE orders DROP COLUMN IF EXISTS currency;
+ALTER TABLE products DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,11 @@
+-- Multi-currency pricing: products, orders, carts and promotions carry a
+-- currency, and order lines keep the catalogue price and the exchange rate
+-- used to convert it.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'KES';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'KES';
+ALTER TABLE carts ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'KES';
+ALTER TABLE promotions ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'KES';
+
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS catalog_price DECIMAL NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS catalog_currency TEXT NOT NULL DEFAULT '';
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS exchange_rate DECIMAL NOT NULL DEFAULT 1;
@@ -0,0 +1,14 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS shipping_phone;
+ALTER TABLE orders DROP COLUMN IF EXISTS shipping_street;
+ALTER TABLE orders DROP COLUMN IF EXISTS shipping_town;
+ALTER TABLE orders DROP COLUMN IF EXISTS shipping_county;
+ALTER TABLE orders DROP COLUMN IF EXISTS shipping_recipient;
+ALTER TABLE orders DROP COLUMN IF EXISTS shipping_fee;
+ALTER TABLE orders DROP COLUMN IF EXISTS shipping_method;
+
+ALTER TABLE order_items DROP COLUMN IF EXISTS weight;
+ALTER TABLE products DROP COLUMN IF EXISTS weight;
+
+DROP TABLE IF EXISTS shipping_rates;
+DROP TABLE IF EXISTS shipping_methods;
+DROP TABLE IF EXISTS addresses;
@@ -0,0 +1,55 @@
+-- Customer addresses, shipping methods with rates by zone and weight, and
+-- the shipping method, fee and address snapshot stored on orders.
+CREATE TABLE IF NOT EXISTS addresses (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    customer_id BIGINT NOT NULL,
+    label       TEXT NOT NULL DEFAULT '',
+    recipient   TEXT NOT NULL DEFAULT '',
+    county      TEXT NOT NULL,
+    town        TEXT NOT NULL,
+    street      TEXT NOT NULL,
+    phone       TEXT NOT NULL,
+    CONSTRAINT fk_addresses_customer FOREIGN KEY (customer_id) REFERENCES customers (id)
+);
+CREATE INDEX IF NOT EXISTS idx_addresses_deleted_at ON addresses (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_addresses_customer_id ON addresses (customer_id);
+
+CREATE TABLE IF NOT EXISTS shipping_methods (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    code       TEXT NOT NULL,
+    name       TEXT NOT NULL,
+    pickup     BOOLEAN NOT NULL DEFAULT FALSE,
+    currency   TEXT NOT NULL DEFAULT 'KES',
+    disabled   BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_shipping_methods_code ON shipping_methods (code);
+CREATE INDEX IF NOT EXISTS idx_shipping_methods_deleted_at ON shipping_methods (deleted_at);
+
+CREATE TABLE IF NOT EXISTS shipping_rates (
+    id                 BIGSERIAL PRIMARY KEY,
+    shipping_method_id BIGINT NOT NULL,
+    zone               TEXT NOT NULL,
+    counties           TEXT,
+    min_weight         DECIMAL NOT NULL DEFAULT 0,
+    max_weight         DECIMAL,
+    fee                DECIMAL NOT NULL,
+    CONSTRAINT fk_shipping_methods_rates FOREIGN KEY (shipping_method_id) REFERENCES shipping_methods (id)
+);
+CREATE INDEX IF NOT EXISTS idx_shipping_rates_shipping_method_id ON shipping_rates (shipping_method_id);
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS weight DECIMAL NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS weight DECIMAL NOT NULL DEFAULT 0;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_method TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_fee DECIMAL NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_recipient TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_county TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_town TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_street TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_phone TEXT NOT NULL DEFAULT '';
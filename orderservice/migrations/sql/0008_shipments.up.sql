@@ -0,0 +1,28 @@
+-- Shipments fulfilling paid orders, each carrying some quantity of the
+-- order's lines.
+CREATE TABLE IF NOT EXISTS shipments (
+    id              BIGSERIAL PRIMARY KEY,
+    created_at      TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ,
+    deleted_at      TIMESTAMPTZ,
+    order_id        BIGINT NOT NULL,
+    carrier         TEXT NOT NULL DEFAULT '',
+    tracking_number TEXT NOT NULL DEFAULT '',
+    status          TEXT NOT NULL DEFAULT 'pending',
+    shipped_at      TIMESTAMPTZ,
+    delivered_at    TIMESTAMPTZ,
+    CONSTRAINT fk_shipments_order FOREIGN KEY (order_id) REFERENCES orders (id)
+);
+CREATE INDEX IF NOT EXISTS idx_shipments_deleted_at ON shipments (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_shipments_order_id ON shipments (order_id);
+
+CREATE TABLE IF NOT EXISTS shipment_items (
+    id            BIGSERIAL PRIMARY KEY,
+    shipment_id   BIGINT NOT NULL,
+    order_item_id BIGINT NOT NULL,
+    quantity      BIGINT NOT NULL,
+    CONSTRAINT fk_shipments_items FOREIGN KEY (shipment_id) REFERENCES shipments (id),
+    CONSTRAINT fk_shipment_items_order_item FOREIGN KEY (order_item_id) REFERENCES order_items (id)
+);
+CREATE INDEX IF NOT EXISTS idx_shipment_items_shipment_id ON shipment_items (shipment_id);
+CREATE INDEX IF NOT EXISTS idx_shipment_items_order_item_id ON shipment_items (order_item_id);
@@ -0,0 +1,5 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS paid_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS payment_reference;
+
+DROP TABLE IF EXISTS invoices;
+DROP TABLE IF EXISTS invoice_counters;
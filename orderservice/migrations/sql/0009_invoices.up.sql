@@ -0,0 +1,21 @@
+-- Sequentially numbered invoices, the counter they are numbered from, and
+-- the M-Pesa receipt number and payment time stored on paid orders.
+CREATE TABLE IF NOT EXISTS invoice_counters (
+    id    BIGINT PRIMARY KEY,
+    value BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS invoices (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    order_id   BIGINT NOT NULL,
+    sequence   BIGINT NOT NULL,
+    number     TEXT NOT NULL,
+    CONSTRAINT fk_invoices_order FOREIGN KEY (order_id) REFERENCES orders (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invoices_order_id ON invoices (order_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invoices_sequence ON invoices (sequence);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invoices_number ON invoices (number);
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payment_reference TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS paid_at TIMESTAMPTZ;
@@ -0,0 +1,27 @@
+-- Email and SMS messages to customers about their orders, with their
+-- delivery attempts.
+CREATE TABLE IF NOT EXISTS notifications (
+    id              BIGSERIAL PRIMARY KEY,
+    created_at      TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ,
+    deleted_at      TIMESTAMPTZ,
+    order_id        BIGINT NOT NULL,
+    customer_id     BIGINT NOT NULL,
+    event           TEXT NOT NULL,
+    channel         TEXT NOT NULL,
+    recipient       TEXT NOT NULL,
+    subject         TEXT NOT NULL DEFAULT '',
+    body            TEXT NOT NULL,
+    status          TEXT NOT NULL DEFAULT 'pending',
+    attempts        BIGINT NOT NULL DEFAULT 0,
+    last_error      TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ,
+    sent_at         TIMESTAMPTZ,
+    CONSTRAINT fk_notifications_order FOREIGN KEY (order_id) REFERENCES orders (id),
+    CONSTRAINT fk_notifications_customer FOREIGN KEY (customer_id) REFERENCES customers (id)
+);
+CREATE INDEX IF NOT EXISTS idx_notifications_deleted_at ON notifications (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_notifications_order_id ON notifications (order_id);
+CREATE INDEX IF NOT EXISTS idx_notifications_customer_id ON notifications (customer_id);
+CREATE INDEX IF NOT EXISTS idx_notifications_status ON notifications (status);
+CREATE INDEX IF NOT EXISTS idx_notifications_next_attempt_at ON notifications (next_attempt_at);
@@ -0,0 +1,11 @@
+DELETE FROM notifications WHERE order_id IS NULL;
+ALTER TABLE notifications ALTER COLUMN order_id SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_orders_customer_id;
+
+DROP TABLE IF EXISTS customer_tokens;
+
+DROP INDEX IF EXISTS idx_customers_email_lower;
+ALTER TABLE customers DROP COLUMN IF EXISTS email_verified_at;
+ALTER TABLE customers DROP COLUMN IF EXISTS password_changed_at;
+ALTER TABLE customers DROP COLUMN IF EXISTS password_hash;
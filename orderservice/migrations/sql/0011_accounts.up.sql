@@ -0,0 +1,23 @@
+-- Customer passwords and email verification, the one-time tokens emailed
+-- to customers, and account emails, which belong to no order.
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMPTZ;
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_customers_email_lower ON customers (LOWER(email));
+
+CREATE TABLE IF NOT EXISTS customer_tokens (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    customer_id BIGINT NOT NULL,
+    purpose     TEXT NOT NULL,
+    token_hash  TEXT NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    used_at     TIMESTAMPTZ,
+    CONSTRAINT fk_customer_tokens_customer FOREIGN KEY (customer_id) REFERENCES customers (id)
+);
+CREATE INDEX IF NOT EXISTS idx_customer_tokens_customer_id ON customer_tokens (customer_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_customer_tokens_token_hash ON customer_tokens (token_hash);
+
+CREATE INDEX IF NOT EXISTS idx_orders_customer_id ON orders (customer_id);
+
+ALTER TABLE notifications ALTER COLUMN order_id DROP NOT NULL;
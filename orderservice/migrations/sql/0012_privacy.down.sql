@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS audit_entries;
+
+ALTER TABLE customers DROP COLUMN IF EXISTS erased_at;
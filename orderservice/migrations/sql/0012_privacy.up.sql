@@ -0,0 +1,17 @@
+-- When a customer's personal data was erased, and the audit log that
+-- records data subject requests.
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS erased_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS audit_entries (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    actor       TEXT NOT NULL,
+    action      TEXT NOT NULL,
+    entity_type TEXT NOT NULL,
+    entity_id   BIGINT NOT NULL,
+    request_id  TEXT NOT NULL DEFAULT '',
+    source_ip   TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_created_at ON audit_entries (created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_action ON audit_entries (action);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_entity ON audit_entries (entity_type, entity_id);
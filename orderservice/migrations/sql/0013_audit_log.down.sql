@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS audit_entries_no_truncate ON audit_entries;
+DROP TRIGGER IF EXISTS audit_entries_no_change ON audit_entries;
+DROP FUNCTION IF EXISTS audit_entries_append_only();
+
+DROP INDEX IF EXISTS idx_audit_entries_request_id;
+DROP INDEX IF EXISTS idx_audit_entries_actor;
+ALTER TABLE audit_entries DROP COLUMN IF EXISTS changes;
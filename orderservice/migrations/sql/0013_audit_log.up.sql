@@ -0,0 +1,21 @@
+-- Before and after values on audit entries, and triggers that keep the
+-- audit log append-only: rows can be neither changed nor removed.
+ALTER TABLE audit_entries ADD COLUMN IF NOT EXISTS changes TEXT;
+CREATE INDEX IF NOT EXISTS idx_audit_entries_actor ON audit_entries (actor);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_request_id ON audit_entries (request_id) WHERE request_id <> '';
+
+CREATE OR REPLACE FUNCTION audit_entries_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_entries is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_entries_no_change ON audit_entries;
+CREATE TRIGGER audit_entries_no_change
+    BEFORE UPDATE OR DELETE ON audit_entries
+    FOR EACH ROW EXECUTE FUNCTION audit_entries_append_only();
+
+DROP TRIGGER IF EXISTS audit_entries_no_truncate ON audit_entries;
+CREATE TRIGGER audit_entries_no_truncate
+    BEFORE TRUNCATE ON audit_entries
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_entries_append_only();
@@ -0,0 +1,5 @@
+-- Access tokens carry the customer's token version, which moves on when
+-- their password changes. Tokens issued before carry none, so existing
+-- sessions end and customers log in again.
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS token_version BIGINT NOT NULL DEFAULT 0;
+UPDATE customers SET token_version = 1 WHERE password_hash <> '';
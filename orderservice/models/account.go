@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// Purposes of the one-time tokens emailed to customers.
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+)
+
+// CustomerToken is a one-time token emailed to a customer to verify their
+// address or reset their password. Only a hash of the token is stored.
+type CustomerToken struct {
+	ID         uint `gorm:"primaryKey"`
+	CreatedAt  time.Time
+	CustomerID uint      `gorm:"not null;index"`
+	Purpose    string    `gorm:"not null"`
+	TokenHash  string    `gorm:"not null;uniqueIndex"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	UsedAt     *time.Time
+}
+
+// RegisterRequest is the payload accepted by POST /auth/register.
+// Passwords are limited to what bcrypt hashes in full.
+type RegisterRequest struct {
+	Name     string `json:"name" binding:"required,notblank,max=100"`
+	Email    string `json:"email" binding:"required,email,max=254"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+// LoginRequest is the payload accepted by POST /auth/login.
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required,email,max=254"`
+	Password string `json:"password" binding:"required,max=72"`
+}
+
+// TokenRequest is the payload accepted by POST /auth/verify-email.
+type TokenRequest struct {
+	Token string `json:"token" binding:"required,max=128"`
+}
+
+// EmailRequest is the payload accepted by POST /auth/password/forgot and
+// POST /auth/verify-email/resend.
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email,max=254"`
+}
+
+// ResetPasswordRequest is the payload accepted by
+// POST /auth/password/reset.
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required,max=128"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+// Session is returned by a successful login.
+type Session struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Customer  *Customer `json:"customer"`
+}
+
+// OrderQuery is the page accepted by GET /me/orders.
+type OrderQuery struct {
+	Page    int `form:"page" binding:"omitempty,gte=1"`
+	PerPage int `form:"per_page" binding:"omitempty,gte=1,lte=100"`
+}
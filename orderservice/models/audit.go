@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry records who did what to which record, and from where.
+// Entries are only ever appended.
+type AuditEntry struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+	Actor      string    `gorm:"not null" json:"actor"`
+	Action     string    `gorm:"not null;index" json:"action"`
+	EntityType string    `gorm:"not null;index:idx_audit_entries_entity" json:"entity_type"`
+	EntityID   uint      `gorm:"not null;index:idx_audit_entries_entity" json:"entity_id"`
+	// Changes holds the fields the action changed, keyed by their JSON
+	// name. Entries for requests that change nothing, such as exports,
+	// have none.
+	Changes   Changes `gorm:"serializer:json" json:"changes,omitempty"`
+	RequestID string  `gorm:"not null;default:''" json:"request_id,omitempty"`
+	SourceIP  string  `gorm:"not null;default:''" json:"source_ip,omitempty"`
+}
+
+// Change is a field's value before and after an action; null before a
+// record was created. Personal data is shown as Redacted.
+type Change struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// Changes maps field names to how they changed.
+type Changes map[string]Change
+
+// Redacted stands in for personal data in audit entries, so the log keeps
+// nothing an erasure request would have to remove.
+const Redacted = "[redacted]"
+
+// AuditQuery is the filter and page accepted by GET /audit. From and To
+// bound when the entries were recorded, To exclusive.
+type AuditQuery struct {
+	Actor      string     `form:"actor" json:"actor" binding:"max=100"`
+	Action     string     `form:"action" json:"action" binding:"max=100"`
+	EntityType string     `form:"entity_type" json:"entity_type" binding:"max=50"`
+	EntityID   uint       `form:"entity_id" json:"entity_id"`
+	RequestID  string     `form:"request_id" json:"request_id" binding:"max=64"`
+	From       *time.Time `form:"from" json:"from"`
+	To         *time.Time `form:"to" json:"to"`
+	Page       int        `form:"page" json:"page" binding:"omitempty,gte=1"`
+	PerPage    int        `form:"per_page" json:"per_page" binding:"omitempty,gte=1,lte=100"`
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	CartOpen       = "open"
+	CartCheckedOut = "checked_out"
+)
+
+// Cart collects products before they are ordered. Carts without a customer
+// are allowed until checkout. Open carts expire at ExpiresAt, which moves
+// forward whenever the cart changes.
+type Cart struct {
+	gorm.Model
+	CustomerID  uint        `gorm:"not null;default:0;index" json:"customer_id,omitempty"`
+	Status      string      `gorm:"not null;default:'open'" json:"status"`
+	Currency    string      `gorm:"not null;default:'KES'" json:"currency"`
+	Items       []CartItem  `json:"items"`
+	CouponCodes []string    `gorm:"serializer:json" json:"coupon_codes"`
+	OrderID     *uint       `json:"order_id,omitempty"`
+	ExpiresAt   time.Time   `gorm:"not null;index" json:"expires_at"`
+	Totals      *CartTotals `gorm:"-" json:"totals,omitempty"` // Virtual field
+}
+
+// Expired reports whether the cart can no longer be changed or checked out.
+func (c *Cart) Expired(now time.Time) bool {
+	return c.Status == CartOpen && !now.Before(c.ExpiresAt)
+}
+
+// Item returns the cart's line for the product or product variant, or nil
+// if it is not in the cart. variantID is zero for products without
+// variants.
+func (c *Cart) Item(productID, variantID uint) *CartItem {
+	for i := range c.Items {
+		if c.Items[i].ProductID == productID && c.Items[i].VariantID == variantID {
+			return &c.Items[i]
+		}
+	}
+	return nil
+}
+
+// CartItem is a product and quantity in a cart. UnitPrice is the price the
+// customer was shown when the line last changed, in the product's own
+// currency; checkout is refused if the catalogue price has moved since.
+type CartItem struct {
+	ID        uint    `gorm:"primaryKey" json:"-"`
+	CartID    uint    `gorm:"not null;uniqueIndex:idx_cart_items_product" json:"-"`
+	ProductID uint    `gorm:"not null;uniqueIndex:idx_cart_items_product" json:"product_id"`
+	VariantID uint    `gorm:"not null;default:0;uniqueIndex:idx_cart_items_product" json:"variant_id,omitempty"`
+	Quantity  int     `gorm:"not null" json:"quantity"`
+	UnitPrice float64 `gorm:"not null" json:"unit_price"`
+}
+
+// CartTotals is the live pricing of a cart at current catalogue prices and
+// exchange rates, in the cart's currency, with its coupons and tax worked
+// out as they would be at checkout.
+type CartTotals struct {
+	Lines        []OrderItem     `json:"lines"`
+	Discounts    []OrderDiscount `json:"discounts"`
+	Subtotal     float64         `json:"subtotal"`
+	Discount     float64         `json:"discount"`
+	TaxAmount    float64         `json:"tax_amount"`
+	TaxInclusive bool            `json:"tax_inclusive"`
+	Total        float64         `json:"total"`
+}
+
+// CartItemRequest is the payload accepted by POST /carts/:id/items, and
+// one line of CreateCartRequest.
+type CartItemRequest struct {
+	ProductID uint `json:"product_id" binding:"required"`
+	VariantID uint `json:"variant_id"`
+	Quantity  int  `json:"quantity" binding:"required,gte=1,lte=1000"`
+}
+
+// CreateCartRequest is the payload accepted by POST /carts.
+type CreateCartRequest struct {
+	CustomerID  uint              `json:"customer_id"`
+	Items       []CartItemRequest `json:"items" binding:"max=100,dive"`
+	CouponCodes []string          `json:"coupon_codes" binding:"max=5,dive,required,alphanum,max=32"`
+	Currency    string            `json:"currency" binding:"omitempty,currency"`
+}
+
+// UpdateCartItemRequest is the payload accepted by
+// PUT /carts/:id/items/:product_id.
+type UpdateCartItemRequest struct {
+	Quantity int `json:"quantity" binding:"required,gte=1,lte=1000"`
+}
+
+// CheckoutRequest is the payload accepted by POST /carts/:id/checkout. The
+// customer is only needed when the cart was created without one. Shipping
+// is chosen as for CreateOrderRequest.
+type CheckoutRequest struct {
+	CustomerID      uint             `json:"customer_id"`
+	ShippingMethod  string           `json:"shipping_method" binding:"omitempty,alphanum,max=32"`
+	AddressID       uint             `json:"address_id"`
+	ShippingAddress *ShippingAddress `json:"shipping_address"`
+}
+
+// Delivery returns the shipping chosen in the request.
+func (r CheckoutRequest) Delivery() Delivery {
+	return Delivery{Method: r.ShippingMethod, AddressID: r.AddressID, Address: r.ShippingAddress}
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Invoice is the number issued to an order when it is paid or when staff
+// issue its invoice. Numbers run from INV-000001 without gaps.
+type Invoice struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"issued_at"`
+	OrderID   uint      `gorm:"not null;uniqueIndex" json:"order_id"`
+	Sequence  uint      `gorm:"not null;uniqueIndex" json:"-"`
+	Number    string    `gorm:"not null;uniqueIndex" json:"number"`
+}
+
+// InvoiceNumber formats the sequence number of an invoice.
+func InvoiceNumber(sequence uint) string {
+	return fmt.Sprintf("INV-%06d", sequence)
+}
+
+// DocumentRequest is the query accepted by GET /orders/:id/invoice and
+// /receipt, and their /me counterparts.
+type DocumentRequest struct {
+	Format string `form:"format" binding:"omitempty,oneof=html pdf"`
+}
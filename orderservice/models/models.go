@@ -1,33 +1,285 @@
 package models
 
 import (
+	"slices"
+	"strings"
+	"time"
+
 	"gorm.io/gorm"
 )
 
 type Customer struct {
 	gorm.Model
-	Name  string `gorm:"not null" json:"name"`
-	Email string `gorm:"unique;not null" json:"email"`
+	Name  string `gorm:"not null" json:"name" binding:"required,notblank,max=100"`
+	Email string `gorm:"unique;not null" json:"email" binding:"required,email,max=254"`
+
+	// Customers created by staff have no password until they register.
+	PasswordHash      string     `gorm:"not null;default:''" json:"-"`
+	PasswordChangedAt *time.Time `json:"-"`
+	EmailVerifiedAt   *time.Time `json:"email_verified_at,omitempty"`
+	// TokenVersion is carried in access tokens; it moves on whenever the
+	// password changes, so older tokens stop working.
+	TokenVersion uint `gorm:"not null;default:0" json:"-"`
+	// ErasedAt is when the customer's personal data was anonymized.
+	ErasedAt *time.Time `json:"erased_at,omitempty"`
+}
+
+// HasAccount reports whether the customer can log in with a password.
+func (c *Customer) HasAccount() bool {
+	return c.PasswordHash != ""
 }
 
 type Product struct {
 	gorm.Model
-	Name  string  `gorm:"not null" json:"name"`
-	Price float64 `gorm:"not null" json:"price"`
+	SKU         string           `gorm:"not null;default:'';uniqueIndex:idx_products_sku,where:sku <> ''" json:"sku" binding:"omitempty,sku,max=64"`
+	Name        string           `gorm:"not null" json:"name" binding:"required,notblank,max=200"`
+	Description string           `gorm:"not null;default:''" json:"description" binding:"max=2000"`
+	Price       float64          `gorm:"not null" json:"price" binding:"gt=0"`
+	Currency    string           `gorm:"not null;default:'KES'" json:"currency" binding:"omitempty,currency"`
+	Category    string           `gorm:"not null;default:'';index" json:"category" binding:"max=100"`
+	Tags        []string         `gorm:"serializer:json" json:"tags" binding:"max=20,dive,required,max=50"`
+	Status      string           `gorm:"not null;default:'active';index" json:"status" binding:"omitempty,oneof=active archived"`
+	TaxClass    string           `gorm:"not null;default:'standard'" json:"tax_class" binding:"omitempty,oneof=standard zero_rated exempt"`
+	Weight      float64          `gorm:"not null;default:0" json:"weight" binding:"gte=0"` // Kilograms per unit
+	Variants    []ProductVariant `json:"variants" binding:"max=50,dive"`
+	// Stock is the quantity available to order; nil means stock is not
+	// tracked for the product. Products with variants track stock per
+	// variant instead.
+	Stock *int `json:"stock" binding:"omitempty,gte=0"`
+}
+
+// Product statuses. Archived products stay on existing orders but can no
+// longer be ordered and are hidden from the catalogue by default.
+const (
+	ProductActive   = "active"
+	ProductArchived = "archived"
+)
+
+// Variant returns the product's variant with id, or nil if it has none.
+func (p *Product) Variant(id uint) *ProductVariant {
+	for i := range p.Variants {
+		if p.Variants[i].ID == id {
+			return &p.Variants[i]
+		}
+	}
+	return nil
+}
+
+// ProductVariant is one option of a product, such as a size or colour,
+// with its own SKU, price and stock. Its price is in the product's
+// currency.
+type ProductVariant struct {
+	ID        uint    `gorm:"primaryKey" json:"id"`
+	ProductID uint    `gorm:"not null;index" json:"-"`
+	SKU       string  `gorm:"not null;default:'';uniqueIndex:idx_product_variants_sku,where:sku <> ''" json:"sku" binding:"omitempty,sku,max=64"`
+	Name      string  `gorm:"not null" json:"name" binding:"max=100"`
+	Size      string  `gorm:"not null;default:''" json:"size,omitempty" binding:"max=50"`
+	Colour    string  `gorm:"not null;default:''" json:"colour,omitempty" binding:"max=50"`
+	Price     float64 `gorm:"not null" json:"price" binding:"gt=0"`
+	Stock     *int    `json:"stock" binding:"omitempty,gte=0"`
+}
+
+// NormalizeSKU returns the canonical form SKUs are stored and looked up in.
+func NormalizeSKU(sku string) string {
+	return strings.ToUpper(strings.TrimSpace(sku))
+}
+
+// ProductQuery is the filter, sort order and page accepted by
+// GET /products.
+type ProductQuery struct {
+	Search   string   `form:"q" json:"q" binding:"max=200"`
+	Category string   `form:"category" json:"category" binding:"max=100"`
+	Tag      string   `form:"tag" json:"tag" binding:"max=50"`
+	MinPrice *float64 `form:"min_price" json:"min_price" binding:"omitempty,gte=0"`
+	MaxPrice *float64 `form:"max_price" json:"max_price" binding:"omitempty,gte=0"`
+	Status   string   `form:"status" json:"status" binding:"omitempty,oneof=active archived all"`
+	Sort     string   `form:"sort" json:"sort" binding:"omitempty,oneof=name -name price -price created_at -created_at"`
+	Page     int      `form:"page" json:"page" binding:"omitempty,gte=1"`
+	PerPage  int      `form:"per_page" json:"per_page" binding:"omitempty,gte=1,lte=100"`
+
+	// IncludeDeleted also lists deleted products, which have a DeletedAt.
+	IncludeDeleted bool `form:"include_deleted" json:"include_deleted"`
+}
+
+// UpdateProductStatusRequest is the payload accepted by
+// PUT /products/:id/status.
+type UpdateProductStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=active archived"`
+}
+
+// Tax classes. Zero-rated supplies are taxable at 0%; exempt supplies are
+// outside VAT altogether.
+const (
+	TaxStandard  = "standard"
+	TaxZeroRated = "zero_rated"
+	TaxExempt    = "exempt"
+)
+
+const (
+	OrderPending          = "pending"
+	OrderPaid             = "paid"
+	OrderFailed           = "failed"
+	OrderPartiallyShipped = "partially_shipped"
+	OrderShipped          = "shipped"
+	OrderDelivered        = "delivered"
+	OrderCancelled        = "cancelled"
+)
+
+// OpenOrderStatuses are the statuses of orders still being paid for or
+// delivered.
+var OpenOrderStatuses = []string{OrderPending, OrderPaid, OrderPartiallyShipped, OrderShipped}
+
+// Open reports whether the order is still being paid for or delivered.
+func (o *Order) Open() bool {
+	return slices.Contains(OpenOrderStatuses, o.Status)
+}
+
+// orderTransitions lists the statuses an order in each status can move to.
+// A failed payment can be retried; delivered and cancelled orders are final.
+var orderTransitions = map[string][]string{
+	OrderPending:          {OrderPaid, OrderFailed, OrderCancelled},
+	OrderFailed:           {OrderPending, OrderPaid, OrderCancelled},
+	OrderPaid:             {OrderPartiallyShipped, OrderShipped, OrderDelivered, OrderCancelled},
+	OrderPartiallyShipped: {OrderShipped, OrderDelivered},
+	OrderShipped:          {OrderDelivered},
+}
+
+// CanTransition reports whether an order in status from can move to status
+// to. Staying in the same status is always allowed.
+func CanTransition(from, to string) bool {
+	return from == to || slices.Contains(orderTransitions[from], to)
 }
 
 type Order struct {
 	gorm.Model
-	CustomerID uint      `gorm:"not null" json:"customer_id"`
-	Products   []Product `gorm:"many2many:order_products;" json:"products"`
-	Status     string    `gorm:"default:'pending'" json:"status"`
-	Total      float64   `gorm:"-" json:"total"` // Virtual field
+	CustomerID   uint            `gorm:"not null" json:"customer_id"`
+	Products     []Product       `gorm:"many2many:order_products;" json:"products"`
+	Status       string          `gorm:"default:'pending'" json:"status"`
+	Currency     string          `gorm:"not null;default:'KES'" json:"currency"`
+	Items        []OrderItem     `json:"items"`
+	Discounts    []OrderDiscount `json:"discounts"`
+	Discount     float64         `gorm:"not null;default:0" json:"discount"`
+	TaxAmount    float64         `gorm:"not null;default:0" json:"tax_amount"`
+	TaxInclusive bool            `gorm:"not null;default:false" json:"tax_inclusive"`
+	Subtotal     float64         `gorm:"-" json:"subtotal"` // Virtual field
+	Total        float64         `gorm:"-" json:"total"`    // Virtual field
+
+	ShippingMethod  string          `gorm:"not null;default:''" json:"shipping_method,omitempty"`
+	ShippingFee     float64         `gorm:"not null;default:0" json:"shipping_fee"`
+	ShippingAddress ShippingAddress `gorm:"embedded;embeddedPrefix:shipping_" json:"shipping_address,omitzero"`
+
+	PaymentReference string     `gorm:"not null;default:''" json:"payment_reference,omitempty"` // M-Pesa receipt number
+	PaidAt           *time.Time `json:"paid_at,omitempty"`
+}
+
+// OrderItem is one priced line of an order with its share of the order
+// discount and the tax charged on it. Amounts are in the order's currency;
+// CatalogPrice is the unit price in the product's own currency, converted
+// at ExchangeRate when the line was priced.
+type OrderItem struct {
+	ID        uint    `gorm:"primaryKey" json:"id,omitempty"`
+	OrderID   uint    `gorm:"not null;index" json:"-"`
+	ProductID uint    `gorm:"not null" json:"product_id"`
+	VariantID uint    `gorm:"not null;default:0" json:"variant_id,omitempty"`
+	SKU       string  `gorm:"not null;default:''" json:"sku,omitempty"`
+	Name      string  `gorm:"not null" json:"name"`
+	UnitPrice float64 `gorm:"not null" json:"unit_price"`
+	Quantity  int     `gorm:"not null;default:1" json:"quantity"`
+	TaxClass  string  `gorm:"not null" json:"tax_class"`
+	TaxRate   float64 `gorm:"not null;default:0" json:"tax_rate"`
+	Discount  float64 `gorm:"not null;default:0" json:"discount"`
+	TaxAmount float64 `gorm:"not null;default:0" json:"tax_amount"`
+	Total     float64 `gorm:"not null" json:"total"`
+	Weight    float64 `gorm:"not null;default:0" json:"weight,omitempty"` // Kilograms per unit
+
+	CatalogPrice    float64 `gorm:"not null;default:0" json:"catalog_price,omitempty"`
+	CatalogCurrency string  `gorm:"not null;default:''" json:"catalog_currency,omitempty"`
+	ExchangeRate    float64 `gorm:"not null;default:1" json:"exchange_rate,omitempty"`
+}
+
+// Amount is the line price before discount and, for tax-exclusive
+// pricing, before tax.
+func (i OrderItem) Amount() float64 {
+	return i.UnitPrice * float64(i.Quantity)
 }
 
 // Hooks
 func (o *Order) AfterFind(tx *gorm.DB) (err error) {
-	for _, product := range o.Products {
-		o.Total += product.Price
-	}
+	o.CalculateTotals()
 	return nil
-}
\ No newline at end of file
+}
+
+// CalculateTotals sets the virtual Subtotal and Total from the order's
+// lines, or its products for orders placed before line items were stored,
+// and the stored discount, tax and shipping fee.
+func (o *Order) CalculateTotals() {
+	o.Subtotal = 0
+	if len(o.Items) > 0 {
+		for _, item := range o.Items {
+			o.Subtotal += item.Amount()
+		}
+	} else {
+		for _, product := range o.Products {
+			o.Subtotal += product.Price
+		}
+	}
+	o.Total = o.Subtotal - o.Discount + o.ShippingFee
+	if !o.TaxInclusive {
+		o.Total += o.TaxAmount
+	}
+}
+
+// ProductRef identifies an existing product, and for products with
+// variants the variant, in an order payload.
+type ProductRef struct {
+	ID        uint `json:"id" binding:"required"`
+	VariantID uint `json:"variant_id"`
+}
+
+// CreateOrderRequest is the payload accepted by POST /orders. Orders with
+// a shipping method are delivered to the saved address_id or the
+// shipping_address given, unless the method is pickup.
+type CreateOrderRequest struct {
+	CustomerID      uint             `json:"customer_id" binding:"required"`
+	Products        []ProductRef     `json:"products" binding:"required,min=1,max=100,dive"`
+	CouponCodes     []string         `json:"coupon_codes" binding:"max=5,dive,required,alphanum,max=32"`
+	Currency        string           `json:"currency" binding:"omitempty,currency"`
+	ShippingMethod  string           `json:"shipping_method" binding:"omitempty,alphanum,max=32"`
+	AddressID       uint             `json:"address_id"`
+	ShippingAddress *ShippingAddress `json:"shipping_address"`
+}
+
+// Order builds the order to persist from the request.
+func (r CreateOrderRequest) Order() Order {
+	order := Order{CustomerID: r.CustomerID, Currency: r.Currency}
+	for _, ref := range r.Products {
+		var product Product
+		product.ID = ref.ID
+		order.Products = append(order.Products, product)
+	}
+	return order
+}
+
+// Delivery returns the shipping chosen in the request.
+func (r CreateOrderRequest) Delivery() Delivery {
+	return Delivery{Method: r.ShippingMethod, AddressID: r.AddressID, Address: r.ShippingAddress}
+}
+
+// GetOrderQuery is the query accepted by GET /orders/:id. IncludeDeleted
+// also finds a deleted order, which has a DeletedAt.
+type GetOrderQuery struct {
+	IncludeDeleted bool `form:"include_deleted" json:"include_deleted"`
+}
+
+// ConvertOrderRequest is the payload accepted by PUT /orders/:id/currency.
+type ConvertOrderRequest struct {
+	Currency string `json:"currency" binding:"required,currency"`
+}
+
+// UpdateStatusRequest is the payload accepted by PUT /orders/:id/status.
+// PaymentReference is the M-Pesa receipt number of the payment that
+// marked the order paid.
+type UpdateStatusRequest struct {
+	Status           string `json:"status" binding:"required,oneof=pending paid failed partially_shipped shipped delivered cancelled"`
+	PaymentReference string `json:"payment_reference" binding:"omitempty,alphanum,max=32"`
+}
@@ -131,3 +131,16 @@ func TestOrderModel(t *testing.T) {
 		assert.Equal(t, "shipped", fetchedOrder.Status)
 	})
 }
+
+func TestCanTransition(t *testing.T) {
+	assert.True(t, CanTransition(OrderPending, OrderPaid))
+	assert.True(t, CanTransition(OrderFailed, OrderPaid), "payment retried")
+	assert.True(t, CanTransition(OrderPaid, OrderDelivered), "delivered by hand")
+	assert.True(t, CanTransition(OrderShipped, OrderShipped))
+	assert.False(t, CanTransition(OrderPaid, OrderFailed))
+	assert.False(t, CanTransition(OrderShipped, OrderPaid))
+	assert.False(t, CanTransition(OrderPartiallyShipped, OrderCancelled))
+	assert.False(t, CanTransition(OrderPending, OrderShipped))
+	assert.False(t, CanTransition(OrderDelivered, OrderCancelled))
+	assert.False(t, CanTransition(OrderCancelled, OrderPending))
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Notification delivery statuses. Pending notifications are sent, or
+// retried, once NextAttemptAt has passed; failed ones have used up their
+// attempts.
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed"
+)
+
+// Notification is a message to a customer about one of their orders, or
+// about their account when OrderID is nil, rendered when the event
+// happened and delivered in the background.
+type Notification struct {
+	gorm.Model
+	OrderID       *uint      `gorm:"index" json:"order_id,omitempty"`
+	CustomerID    uint       `gorm:"not null;index" json:"customer_id"`
+	Event         string     `gorm:"not null" json:"event"`
+	Channel       string     `gorm:"not null" json:"channel"`
+	Recipient     string     `gorm:"not null" json:"recipient"`
+	Subject       string     `gorm:"not null;default:''" json:"subject,omitempty"`
+	Body          string     `gorm:"not null" json:"body"`
+	Status        string     `gorm:"not null;default:'pending';index" json:"status"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	LastError     string     `gorm:"not null;default:''" json:"last_error,omitempty"`
+	NextAttemptAt *time.Time `gorm:"index" json:"next_attempt_at,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// ErasedName replaces the name of a customer whose data was erased.
+const ErasedName = "Erased customer"
+
+// ErasedEmail returns the placeholder address that replaces the email of
+// erased customer id. The .invalid domain can never receive mail.
+func ErasedEmail(id uint) string {
+	return fmt.Sprintf("erased-%d@erased.invalid", id)
+}
+
+// Erasure is returned by POST /customers/:id/erasure. The customer's
+// orders are kept, without personal data, for the accounts.
+type Erasure struct {
+	CustomerID         uint      `json:"customer_id"`
+	ErasedAt           time.Time `json:"erased_at"`
+	Orders             int       `json:"orders"`
+	PaymentsAnonymized int64     `json:"payments_anonymized"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DiscountPercentage = "percentage"
+	DiscountFixed      = "fixed"
+)
+
+// Promotion is a discount redeemed with a coupon code. An empty ProductIDs
+// and Categories applies it to the whole order; otherwise only matching
+// products are discounted. Fixed values and minimum order amounts are in
+// Currency, so promotions that use them only apply to orders in it.
+type Promotion struct {
+	gorm.Model
+	Code             string     `gorm:"uniqueIndex;not null" json:"code" binding:"required,alphanum,max=32"`
+	Description      string     `gorm:"not null;default:''" json:"description" binding:"max=200"`
+	Type             string     `gorm:"not null" json:"type" binding:"required,oneof=percentage fixed"`
+	Value            float64    `gorm:"not null" json:"value" binding:"gt=0"`
+	MinOrderAmount   float64    `gorm:"not null;default:0" json:"min_order_amount" binding:"gte=0"`
+	Currency         string     `gorm:"not null;default:'KES'" json:"currency" binding:"omitempty,currency"`
+	ProductIDs       []uint     `gorm:"serializer:json" json:"product_ids" binding:"max=100"`
+	Categories       []string   `gorm:"serializer:json" json:"categories" binding:"max=20,dive,required,max=100"`
+	StartsAt         *time.Time `json:"starts_at"`
+	EndsAt           *time.Time `json:"ends_at"`
+	UsageLimit       int        `gorm:"not null;default:0" json:"usage_limit" binding:"gte=0"`
+	UsageCount       int        `gorm:"not null;default:0" json:"usage_count"`
+	PerCustomerLimit int        `gorm:"not null;default:0" json:"per_customer_limit" binding:"gte=0"`
+	Stackable        bool       `gorm:"not null;default:false" json:"stackable"`
+	Disabled         bool       `gorm:"not null;default:false" json:"disabled"`
+}
+
+// NormalizeCode returns the canonical form coupon codes are stored and
+// looked up in.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// OrderDiscount records one promotion applied to an order and the amount it
+// took off.
+type OrderDiscount struct {
+	ID          uint      `gorm:"primaryKey" json:"-"`
+	OrderID     uint      `gorm:"not null;index" json:"-"`
+	PromotionID uint      `gorm:"not null;index" json:"promotion_id"`
+	Code        string    `gorm:"not null" json:"code"`
+	Description string    `gorm:"not null;default:''" json:"description,omitempty"`
+	Stackable   bool      `gorm:"not null;default:false" json:"-"`
+	Amount      float64   `gorm:"not null" json:"amount"`
+	CreatedAt   time.Time `json:"-"`
+}
+
+// ApplyCouponRequest is the payload accepted by POST /orders/:id/coupon.
+type ApplyCouponRequest struct {
+	Code string `json:"code" binding:"required,alphanum,max=32"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Shipment statuses. A shipment only moves forward through them.
+const (
+	ShipmentPending   = "pending"
+	ShipmentShipped   = "shipped"
+	ShipmentDelivered = "delivered"
+)
+
+// Shipment is a parcel sent towards an order's delivery. An order can go
+// out in several shipments, each carrying some of its lines.
+type Shipment struct {
+	gorm.Model
+	OrderID        uint           `gorm:"not null;index" json:"order_id"`
+	Carrier        string         `gorm:"not null;default:''" json:"carrier"`
+	TrackingNumber string         `gorm:"not null;default:''" json:"tracking_number"`
+	Status         string         `gorm:"not null;default:'pending'" json:"status"`
+	ShippedAt      *time.Time     `json:"shipped_at"`
+	DeliveredAt    *time.Time     `json:"delivered_at"`
+	Items          []ShipmentItem `json:"items"`
+}
+
+// ShipmentItem is the quantity of one order line in a shipment.
+type ShipmentItem struct {
+	ID          uint `gorm:"primaryKey" json:"-"`
+	ShipmentID  uint `gorm:"not null;index" json:"-"`
+	OrderItemID uint `gorm:"not null;index" json:"order_item_id" binding:"required"`
+	Quantity    int  `gorm:"not null" json:"quantity" binding:"required,gte=1"`
+}
+
+// CreateShipmentRequest is the payload accepted by
+// POST /orders/:id/shipments. Shipments are created as shipped unless a
+// status says otherwise; ShippedAt and DeliveredAt default to now.
+type CreateShipmentRequest struct {
+	Carrier        string         `json:"carrier" binding:"required,notblank,max=100"`
+	TrackingNumber string         `json:"tracking_number" binding:"max=100"`
+	Status         string         `json:"status" binding:"omitempty,oneof=pending shipped delivered"`
+	ShippedAt      *time.Time     `json:"shipped_at"`
+	DeliveredAt    *time.Time     `json:"delivered_at"`
+	Items          []ShipmentItem `json:"items" binding:"required,min=1,max=100,dive"`
+}
+
+// UpdateShipmentRequest is the payload accepted by
+// PUT /orders/:id/shipments/:shipment_id. Fields left out are unchanged.
+type UpdateShipmentRequest struct {
+	Carrier        *string    `json:"carrier" binding:"omitempty,notblank,max=100"`
+	TrackingNumber *string    `json:"tracking_number" binding:"omitempty,max=100"`
+	Status         string     `json:"status" binding:"omitempty,oneof=pending shipped delivered"`
+	ShippedAt      *time.Time `json:"shipped_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Address is one of a customer's saved delivery addresses. Orders keep a
+// copy of the address they were placed with, so editing or deleting it
+// does not change orders already placed.
+type Address struct {
+	gorm.Model
+	CustomerID uint   `gorm:"not null;index" json:"customer_id"`
+	Label      string `gorm:"not null;default:''" json:"label" binding:"max=50"`
+	Recipient  string `gorm:"not null;default:''" json:"recipient" binding:"max=100"`
+	County     string `gorm:"not null" json:"county" binding:"required,notblank,max=50"`
+	Town       string `gorm:"not null" json:"town" binding:"required,notblank,max=100"`
+	Street     string `gorm:"not null" json:"street" binding:"required,notblank,max=200"`
+	Phone      string `gorm:"not null" json:"phone" binding:"required,phone"`
+}
+
+// ShippingAddress returns the copy of a to keep on an order.
+func (a Address) ShippingAddress() ShippingAddress {
+	return ShippingAddress{
+		Recipient: a.Recipient,
+		County:    a.County,
+		Town:      a.Town,
+		Street:    a.Street,
+		Phone:     a.Phone,
+	}
+}
+
+// ShippingAddress is where an order is delivered, as it was when the order
+// was placed.
+type ShippingAddress struct {
+	Recipient string `gorm:"not null;default:''" json:"recipient,omitempty" binding:"max=100"`
+	County    string `gorm:"not null;default:''" json:"county" binding:"required,notblank,max=50"`
+	Town      string `gorm:"not null;default:''" json:"town" binding:"required,notblank,max=100"`
+	Street    string `gorm:"not null;default:''" json:"street" binding:"required,notblank,max=200"`
+	Phone     string `gorm:"not null;default:''" json:"phone" binding:"required,phone"`
+}
+
+// NormalizePhone returns a Kenyan phone number such as 0712 345678 or
+// +254712345678 in the 254712345678 form it is stored in.
+func NormalizePhone(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+	if len(digits) >= 9 {
+		return "254" + digits[len(digits)-9:]
+	}
+	return digits
+}
+
+// ShippingMethod is a way of getting an order to the customer, such as
+// pickup, standard or express delivery. Fees come from its Rates and are in
+// Currency. Pickup methods do not need a delivery address.
+type ShippingMethod struct {
+	gorm.Model
+	Code     string         `gorm:"uniqueIndex;not null" json:"code" binding:"required,alphanum,max=32"`
+	Name     string         `gorm:"not null" json:"name" binding:"required,notblank,max=100"`
+	Pickup   bool           `gorm:"not null;default:false" json:"pickup"`
+	Currency string         `gorm:"not null;default:'KES'" json:"currency" binding:"omitempty,currency"`
+	Disabled bool           `gorm:"not null;default:false" json:"disabled"`
+	Rates    []ShippingRate `json:"rates" binding:"required,min=1,max=100,dive"`
+}
+
+// NormalizeShippingCode returns the canonical form shipping method codes
+// are stored and looked up in.
+func NormalizeShippingCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
+
+// ShippingRate is the fee for sending a parcel of MinWeight up to, but not
+// including, MaxWeight kilograms to a county in Zone. A rate with no
+// Counties covers every county, and one with no MaxWeight has no upper
+// limit.
+type ShippingRate struct {
+	ID               uint     `gorm:"primaryKey" json:"id"`
+	ShippingMethodID uint     `gorm:"not null;index" json:"-"`
+	Zone             string   `gorm:"not null" json:"zone" binding:"required,notblank,max=50"`
+	Counties         []string `gorm:"serializer:json" json:"counties" binding:"max=47,dive,required,max=50"`
+	MinWeight        float64  `gorm:"not null;default:0" json:"min_weight" binding:"gte=0"`
+	MaxWeight        *float64 `json:"max_weight" binding:"omitempty,gt=0"`
+	Fee              float64  `gorm:"not null" json:"fee" binding:"gte=0"`
+}
+
+// Covers reports whether the rate applies to a parcel of weight kilograms
+// sent to county.
+func (r ShippingRate) Covers(county string, weight float64) bool {
+	if weight < r.MinWeight || r.MaxWeight != nil && weight >= *r.MaxWeight {
+		return false
+	}
+	return len(r.Counties) == 0 || r.Names(county)
+}
+
+// Names reports whether county is one of the rate's counties, ignoring
+// case and surrounding space.
+func (r ShippingRate) Names(county string) bool {
+	county = strings.TrimSpace(county)
+	for _, c := range r.Counties {
+		if strings.EqualFold(strings.TrimSpace(c), county) {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is the shipping chosen for a new order: a method and, unless
+// it is a pickup method, either a saved address or one given with the
+// order.
+type Delivery struct {
+	Method    string
+	AddressID uint
+	Address   *ShippingAddress
+}
@@ -0,0 +1,120 @@
+// Package money holds amounts together with their currency and converts
+// them between currencies.
+package money
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"orderservice/apperrors"
+)
+
+// Money is an amount of a currency, held in the currency's minor units so
+// sums and comparisons are exact.
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+// New returns amount of currency rounded to the currency's minor unit.
+func New(amount float64, currency string) Money {
+	return Money{Minor: int64(math.Round(amount * scale(currency))), Currency: currency}
+}
+
+// Amount returns m in major units, e.g. 12.5 for KES 12.50.
+func (m Money) Amount() float64 {
+	return float64(m.Minor) / scale(m.Currency)
+}
+
+// Add returns the sum of m and other, which must be in the same currency.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("cannot add %s to %s", other.Currency, m.Currency)
+	}
+	return Money{Minor: m.Minor + other.Minor, Currency: m.Currency}, nil
+}
+
+// String formats m with its currency's number of decimals, e.g. "12.50 KES".
+func (m Money) String() string {
+	return fmt.Sprintf("%.*f %s", Digits(m.Currency), m.Amount(), m.Currency)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   float64 `json:"amount"`
+		Currency string  `json:"currency"`
+	}{m.Amount(), m.Currency})
+}
+
+// Digits returns the number of decimals in currency's minor unit.
+func Digits(currency string) int {
+	switch currency {
+	case "BIF", "CLP", "DJF", "GNF", "ISK", "JPY", "KMF", "KRW", "PYG",
+		"RWF", "UGX", "VND", "VUV", "XAF", "XOF", "XPF":
+		return 0
+	case "BHD", "IQD", "JOD", "KWD", "LYD", "OMR", "TND":
+		return 3
+	default:
+		return 2
+	}
+}
+
+// Round rounds amount to currency's minor unit.
+func Round(amount float64, currency string) float64 {
+	return New(amount, currency).Amount()
+}
+
+func scale(currency string) float64 {
+	return math.Pow10(Digits(currency))
+}
+
+// Rates converts between currencies through a base currency.
+type Rates struct {
+	// Base is the currency prices are in unless they say otherwise.
+	Base string
+	// perBase holds the price of one unit of each currency in Base.
+	perBase map[string]float64
+}
+
+// NewRates returns the table for base, where rates gives the price of one
+// unit of each other currency in base.
+func NewRates(base string, rates map[string]float64) Rates {
+	r := Rates{Base: base, perBase: map[string]float64{base: 1}}
+	for currency, rate := range rates {
+		if currency != base {
+			r.perBase[currency] = rate
+		}
+	}
+	return r
+}
+
+// Supports reports whether amounts in currency can be converted.
+func (r Rates) Supports(currency string) bool {
+	_, ok := r.perBase[currency]
+	return ok
+}
+
+// Rate returns how many units of to one unit of from buys. It fails with a
+// validation error if either currency has no rate.
+func (r Rates) Rate(from, to string) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	for _, currency := range []string{from, to} {
+		if !r.Supports(currency) {
+			return 0, apperrors.Validation("no exchange rate for " + currency)
+		}
+	}
+	return r.perBase[from] / r.perBase[to], nil
+}
+
+// Convert returns m in currency to, rounded to its minor unit, with the
+// rate used.
+func (r Rates) Convert(m Money, to string) (Money, float64, error) {
+	rate, err := r.Rate(m.Currency, to)
+	if err != nil {
+		return Money{}, 0, err
+	}
+	return New(m.Amount()*rate, to), rate, nil
+}
@@ -0,0 +1,71 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"orderservice/apperrors"
+)
+
+func TestMoney(t *testing.T) {
+	t.Run("Rounds to the minor unit", func(t *testing.T) {
+		assert.Equal(t, int64(1235), New(12.345, "KES").Minor)
+		assert.Equal(t, int64(12), New(12.345, "JPY").Minor)
+		assert.Equal(t, int64(12345), New(12.345, "KWD").Minor)
+		assert.Equal(t, 0.3, Round(0.1+0.2, "USD"))
+	})
+
+	t.Run("Formats with the currency's decimals", func(t *testing.T) {
+		assert.Equal(t, "12.50 KES", New(12.5, "KES").String())
+		assert.Equal(t, "1200 JPY", New(1200, "JPY").String())
+	})
+
+	t.Run("Adds only the same currency", func(t *testing.T) {
+		sum, err := New(0.1, "USD").Add(New(0.2, "USD"))
+		require.NoError(t, err)
+		assert.Equal(t, 0.3, sum.Amount())
+
+		_, err = New(1, "USD").Add(New(1, "KES"))
+		assert.Error(t, err)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		body, err := json.Marshal(New(9.99, "EUR"))
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"amount":9.99,"currency":"EUR"}`, string(body))
+	})
+}
+
+func TestRates(t *testing.T) {
+	rates := NewRates("KES", map[string]float64{"USD": 130, "EUR": 143})
+
+	t.Run("Converts through the base currency", func(t *testing.T) {
+		converted, rate, err := rates.Convert(New(10, "USD"), "KES")
+		require.NoError(t, err)
+		assert.Equal(t, 130.0, rate)
+		assert.Equal(t, "1300.00 KES", converted.String())
+
+		converted, _, err = rates.Convert(New(260, "KES"), "USD")
+		require.NoError(t, err)
+		assert.Equal(t, 2.0, converted.Amount())
+
+		converted, _, err = rates.Convert(New(100, "EUR"), "USD")
+		require.NoError(t, err)
+		assert.Equal(t, 110.0, converted.Amount())
+	})
+
+	t.Run("Same currency", func(t *testing.T) {
+		rate, err := rates.Rate("EUR", "EUR")
+		require.NoError(t, err)
+		assert.Equal(t, 1.0, rate)
+	})
+
+	t.Run("Unknown currency", func(t *testing.T) {
+		_, _, err := rates.Convert(New(1, "GBP"), "KES")
+		assert.True(t, apperrors.Is(err, apperrors.KindValidation))
+		assert.False(t, rates.Supports("GBP"))
+		assert.True(t, rates.Supports("KES"))
+	})
+}
@@ -0,0 +1,125 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"orderservice/metrics"
+	"orderservice/models"
+	"orderservice/repository"
+)
+
+// batchSize is how many due notifications are delivered per run.
+const batchSize = 50
+
+// errNoSender fails notifications for a channel that is switched off.
+// They are not retried, but can be retried by hand once it is enabled.
+var errNoSender = errors.New("no sender configured for channel")
+
+// Dispatcher periodically delivers pending notifications. Every attempt
+// is recorded on the notification; failures are retried with exponential
+// backoff until maxAttempts is reached, after which the notification is
+// marked failed and can be retried by hand.
+type Dispatcher struct {
+	store       repository.Store
+	senders     map[string]Sender
+	interval    time.Duration
+	maxAttempts int
+	backoff     time.Duration
+	logger      *zap.Logger
+}
+
+// NewDispatcher returns a Dispatcher delivering over senders, keyed by
+// channel. Notifications for a channel without a sender fail at once.
+func NewDispatcher(store repository.Store, senders map[string]Sender, interval time.Duration, maxAttempts int, backoff time.Duration, logger *zap.Logger) *Dispatcher {
+	return &Dispatcher{
+		store:       store,
+		senders:     senders,
+		interval:    interval,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		logger:      logger,
+	}
+}
+
+// Run delivers due notifications immediately and then on every interval
+// until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		d.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce makes one delivery attempt for every notification that is due.
+func (d *Dispatcher) RunOnce(ctx context.Context) {
+	due, err := d.store.Notifications().DueNotifications(ctx, time.Now(), batchSize)
+	if err != nil {
+		d.logger.Error("Failed to load due notifications", zap.Error(err))
+		return
+	}
+	for i := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		d.deliver(ctx, &due[i])
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, notification *models.Notification) {
+	logger := d.logger.With(
+		zap.Uint("notification_id", notification.ID),
+		zap.String("channel", notification.Channel),
+	)
+	if notification.OrderID != nil {
+		logger = logger.With(zap.Uint("order_id", *notification.OrderID))
+	}
+
+	sender, ok := d.senders[notification.Channel]
+	err := errNoSender
+	if ok {
+		err = sender.Send(ctx, Message{
+			Channel: notification.Channel,
+			To:      notification.Recipient,
+			Subject: notification.Subject,
+			Body:    notification.Body,
+		})
+	}
+	now := time.Now()
+	notification.Attempts++
+	outcome := "sent"
+	switch {
+	case err == nil:
+		notification.Status = models.NotificationSent
+		notification.SentAt = &now
+		notification.NextAttemptAt = nil
+		notification.LastError = ""
+	case !ok || notification.Attempts >= d.maxAttempts:
+		outcome = "failed"
+		notification.Status = models.NotificationFailed
+		notification.LastError = err.Error()
+		notification.NextAttemptAt = nil
+		logger.Error("Giving up on notification", zap.Int("attempts", notification.Attempts), zap.Error(err))
+	default:
+		outcome = "retry"
+		next := now.Add(d.backoff << (notification.Attempts - 1))
+		notification.LastError = err.Error()
+		notification.NextAttemptAt = &next
+		logger.Warn("Notification delivery failed, will retry",
+			zap.Int("attempts", notification.Attempts), zap.Time("next_attempt_at", next), zap.Error(err))
+	}
+	metrics.NotificationsDelivered.WithLabelValues(notification.Channel, outcome).Inc()
+
+	if err := d.store.Notifications().UpdateNotification(ctx, notification); err != nil {
+		logger.Error("Failed to record notification delivery", zap.Error(err))
+	}
+}
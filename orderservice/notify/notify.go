@@ -0,0 +1,263 @@
+// Package notify tells customers about their orders by email and SMS.
+// Messages are rendered and stored when an order event happens, in the
+// same unit of work as the change, and a Dispatcher delivers them in the
+// background, retrying failures.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"orderservice/models"
+	"orderservice/money"
+	"orderservice/repository"
+)
+
+// Channels messages are delivered over.
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+// Order events customers are told about.
+const (
+	EventOrderPlaced           = "order_placed"
+	EventOrderPaid             = "order_paid"
+	EventPaymentFailed         = "payment_failed"
+	EventOrderPartiallyShipped = "order_partially_shipped"
+	EventOrderShipped          = "order_shipped"
+	EventOrderDelivered        = "order_delivered"
+	EventOrderCancelled        = "order_cancelled"
+)
+
+// Account events, which are only sent by email.
+const (
+	EventVerifyEmail   = "verify_email"
+	EventResetPassword = "reset_password"
+)
+
+// events maps the order statuses customers are told about to their event.
+var events = map[string]string{
+	models.OrderPaid:             EventOrderPaid,
+	models.OrderFailed:           EventPaymentFailed,
+	models.OrderPartiallyShipped: EventOrderPartiallyShipped,
+	models.OrderShipped:          EventOrderShipped,
+	models.OrderDelivered:        EventOrderDelivered,
+	models.OrderCancelled:        EventOrderCancelled,
+}
+
+// Event returns the event announcing that an order moved to status, and
+// false for statuses customers are not told about.
+func Event(status string) (string, bool) {
+	event, ok := events[status]
+	return event, ok
+}
+
+// message holds the templates for one event. The SMS text is kept short
+// enough for a single message.
+type message struct {
+	subject *template.Template
+	email   *template.Template
+	sms     *template.Template
+}
+
+func newMessage(subject, email, sms string) message {
+	return message{
+		subject: template.Must(template.New("subject").Parse(subject)),
+		email:   template.Must(template.New("email").Parse(email)),
+		sms:     template.Must(template.New("sms").Parse(sms)),
+	}
+}
+
+var messages = map[string]message{
+	EventOrderPlaced: newMessage(
+		"Order #{{.OrderID}} received",
+		`Hi {{.Name}},
+
+Thank you for your order #{{.OrderID}} of {{.Total}}. We will let you know as soon as your payment is confirmed.
+`,
+		"Order #{{.OrderID}} of {{.Total}} received. We will confirm once your payment arrives."),
+	EventOrderPaid: newMessage(
+		"Payment received for order #{{.OrderID}}",
+		`Hi {{.Name}},
+
+We have received your payment of {{.Total}} for order #{{.OrderID}}{{with .Reference}} (M-Pesa receipt {{.}}){{end}}. We will let you know when it ships.
+`,
+		"Payment of {{.Total}} received for order #{{.OrderID}}{{with .Reference}}, M-Pesa receipt {{.}}{{end}}. Thank you!"),
+	EventPaymentFailed: newMessage(
+		"Payment for order #{{.OrderID}} did not go through",
+		`Hi {{.Name}},
+
+Your M-Pesa payment of {{.Total}} for order #{{.OrderID}} was not completed. You can try paying again at any time.
+`,
+		"Your payment for order #{{.OrderID}} did not go through. Please try again."),
+	EventOrderPartiallyShipped: newMessage(
+		"Part of order #{{.OrderID}} is on its way",
+		`Hi {{.Name}},
+
+Part of your order #{{.OrderID}} has been shipped. We will let you know when the rest follows.
+`,
+		"Part of order #{{.OrderID}} has been shipped. The rest will follow."),
+	EventOrderShipped: newMessage(
+		"Order #{{.OrderID}} is on its way",
+		`Hi {{.Name}},
+
+Your order #{{.OrderID}} has been shipped.
+`,
+		"Order #{{.OrderID}} has been shipped."),
+	EventOrderDelivered: newMessage(
+		"Order #{{.OrderID}} has been delivered",
+		`Hi {{.Name}},
+
+Your order #{{.OrderID}} has been delivered. Thank you for shopping with us.
+`,
+		"Order #{{.OrderID}} has been delivered. Thank you!"),
+	EventOrderCancelled: newMessage(
+		"Order #{{.OrderID}} has been cancelled",
+		`Hi {{.Name}},
+
+Your order #{{.OrderID}} has been cancelled.
+`,
+		"Order #{{.OrderID}} has been cancelled."),
+}
+
+var accountMessages = map[string]message{
+	EventVerifyEmail: newMessage(
+		"Confirm your email address",
+		`Hi {{.Name}},
+
+Please confirm your email address by opening this link:
+
+{{.Link}}
+
+If you did not create an account, you can ignore this email.
+`,
+		""),
+	EventResetPassword: newMessage(
+		"Reset your password",
+		`Hi {{.Name}},
+
+We received a request to reset your password. Choose a new one by opening this link:
+
+{{.Link}}
+
+The link expires soon and can only be used once. If you did not ask for this, you can ignore this email.
+`,
+		""),
+}
+
+// data is what message templates are rendered with.
+type data struct {
+	Name      string
+	OrderID   uint
+	Total     string
+	Reference string
+	Link      string
+}
+
+// Queue stores the messages announcing event to the customer who placed
+// order: an email, and an SMS when the order has a delivery phone number.
+// Call it in the unit of work that makes the change, so nothing is sent
+// for a change that rolls back.
+func Queue(ctx context.Context, store repository.Store, event string, order *models.Order) error {
+	msg, ok := messages[event]
+	if !ok {
+		return fmt.Errorf("notify: unknown event %q", event)
+	}
+	customer, err := store.Customers().GetCustomer(ctx, order.CustomerID)
+	if err != nil {
+		return err
+	}
+
+	totals := *order
+	totals.CalculateTotals()
+	currency := order.Currency
+	if currency == "" {
+		currency = "KES"
+	}
+	d := data{
+		Name:      firstName(customer),
+		OrderID:   order.ID,
+		Total:     money.New(totals.Total, currency).String(),
+		Reference: order.PaymentReference,
+	}
+	subject, err := render(msg.subject, d)
+	if err != nil {
+		return err
+	}
+
+	now, orderID := time.Now(), order.ID
+	queue := func(channel, recipient string, body *template.Template, subject string) error {
+		text, err := render(body, d)
+		if err != nil {
+			return err
+		}
+		return store.Notifications().CreateNotification(ctx, &models.Notification{
+			OrderID:       &orderID,
+			CustomerID:    customer.ID,
+			Event:         event,
+			Channel:       channel,
+			Recipient:     recipient,
+			Subject:       subject,
+			Body:          text,
+			Status:        models.NotificationPending,
+			NextAttemptAt: &now,
+		})
+	}
+	if customer.Email != "" {
+		if err := queue(ChannelEmail, customer.Email, msg.email, subject); err != nil {
+			return err
+		}
+	}
+	if phone := order.ShippingAddress.Phone; phone != "" {
+		if err := queue(ChannelSMS, phone, msg.sms, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueueAccount stores the email about event for customer's account, with
+// link for them to follow.
+func QueueAccount(ctx context.Context, store repository.Store, event string, customer *models.Customer, link string) error {
+	msg, ok := accountMessages[event]
+	if !ok {
+		return fmt.Errorf("notify: unknown event %q", event)
+	}
+	d := data{Name: firstName(customer), Link: link}
+	subject, err := render(msg.subject, d)
+	if err != nil {
+		return err
+	}
+	body, err := render(msg.email, d)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return store.Notifications().CreateNotification(ctx, &models.Notification{
+		CustomerID:    customer.ID,
+		Event:         event,
+		Channel:       ChannelEmail,
+		Recipient:     customer.Email,
+		Subject:       subject,
+		Body:          body,
+		Status:        models.NotificationPending,
+		NextAttemptAt: &now,
+	})
+}
+
+func firstName(customer *models.Customer) string {
+	return strings.Fields(customer.Name + " there")[0]
+}
+
+func render(t *template.Template, d data) (string, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, d); err != nil {
+		return "", fmt.Errorf("notify: render %s: %w", t.Name(), err)
+	}
+	return b.String(), nil
+}
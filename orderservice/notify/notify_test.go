@@ -0,0 +1,283 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"orderservice/models"
+	"orderservice/repository"
+)
+
+var ctx = context.Background()
+
+// seed stores a customer and a KES order delivered to phone.
+func seed(t *testing.T, store repository.Store, phone string) *models.Order {
+	t.Helper()
+	customer := &models.Customer{Name: "Wanjiru Kamau", Email: "wanjiru@example.com"}
+	require.NoError(t, store.Customers().CreateCustomer(ctx, customer))
+	kettle := &models.Product{Name: "Kettle", Price: 2500}
+	require.NoError(t, store.Products().CreateProduct(ctx, kettle))
+	order := &models.Order{CustomerID: customer.ID, Currency: "KES", TaxInclusive: true,
+		ShippingAddress: models.ShippingAddress{Phone: phone},
+		Items:           []models.OrderItem{{ProductID: kettle.ID, Name: "Kettle", UnitPrice: 2500, Quantity: 2}}}
+	require.NoError(t, store.Orders().CreateOrder(ctx, order))
+	return order
+}
+
+func TestEvent(t *testing.T) {
+	event, ok := Event(models.OrderPaid)
+	assert.True(t, ok)
+	assert.Equal(t, EventOrderPaid, event)
+	event, ok = Event(models.OrderFailed)
+	assert.True(t, ok)
+	assert.Equal(t, EventPaymentFailed, event)
+	_, ok = Event(models.OrderPending)
+	assert.False(t, ok)
+
+	for _, event := range events {
+		assert.Contains(t, messages, event, "every event has a message")
+	}
+}
+
+func TestQueue(t *testing.T) {
+	t.Run("Email and SMS", func(t *testing.T) {
+		store := repository.NewMemoryStore()
+		order := seed(t, store, "254712345678")
+		order.PaymentReference = "QK12ABC3DE"
+		require.NoError(t, Queue(ctx, store, EventOrderPaid, order))
+
+		queued, err := store.Notifications().ListNotifications(ctx, order.ID)
+		require.NoError(t, err)
+		require.Len(t, queued, 2)
+		email, sms := queued[0], queued[1]
+
+		assert.Equal(t, ChannelEmail, email.Channel)
+		assert.Equal(t, "wanjiru@example.com", email.Recipient)
+		assert.Equal(t, EventOrderPaid, email.Event)
+		assert.Equal(t, models.NotificationPending, email.Status)
+		assert.NotNil(t, email.NextAttemptAt)
+		assert.Equal(t, "Payment received for order #"+strconv.Itoa(int(order.ID)), email.Subject)
+		assert.True(t, strings.HasPrefix(email.Body, "Hi Wanjiru,\n"))
+		assert.Contains(t, email.Body, "5000.00 KES")
+		assert.Contains(t, email.Body, "(M-Pesa receipt QK12ABC3DE)")
+
+		assert.Equal(t, ChannelSMS, sms.Channel)
+		assert.Equal(t, "254712345678", sms.Recipient)
+		assert.Empty(t, sms.Subject)
+		assert.Contains(t, sms.Body, "M-Pesa receipt QK12ABC3DE")
+		assert.LessOrEqual(t, len(sms.Body), 160, "fits in one text message")
+	})
+
+	t.Run("Email only without a phone number", func(t *testing.T) {
+		store := repository.NewMemoryStore()
+		order := seed(t, store, "")
+		require.NoError(t, Queue(ctx, store, EventOrderPlaced, order))
+
+		queued, err := store.Notifications().ListNotifications(ctx, order.ID)
+		require.NoError(t, err)
+		require.Len(t, queued, 1)
+		assert.Equal(t, ChannelEmail, queued[0].Channel)
+	})
+
+	t.Run("Unknown event", func(t *testing.T) {
+		store := repository.NewMemoryStore()
+		order := seed(t, store, "")
+		assert.Error(t, Queue(ctx, store, "order_teleported", order))
+	})
+}
+
+// fakeSender fails its first failures sends and records the rest.
+type fakeSender struct {
+	failures int
+	sent     []Message
+}
+
+func (f *fakeSender) Send(ctx context.Context, msg Message) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("connection refused")
+	}
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	setup := func(t *testing.T, failures int) (repository.Store, *fakeSender, *Dispatcher, uint) {
+		store := repository.NewMemoryStore()
+		order := seed(t, store, "254712345678")
+		require.NoError(t, Queue(ctx, store, EventOrderPlaced, order))
+		email := &fakeSender{failures: failures}
+		dispatcher := NewDispatcher(store, map[string]Sender{ChannelEmail: email}, time.Minute, 3, time.Minute, zap.NewNop())
+		return store, email, dispatcher, order.ID
+	}
+	// due moves every pending notification's next attempt into the past.
+	due := func(t *testing.T, store repository.Store, orderID uint) {
+		queued, err := store.Notifications().ListNotifications(ctx, orderID)
+		require.NoError(t, err)
+		past := time.Now().Add(-time.Second)
+		for i := range queued {
+			if queued[i].Status == models.NotificationPending {
+				queued[i].NextAttemptAt = &past
+				require.NoError(t, store.Notifications().UpdateNotification(ctx, &queued[i]))
+			}
+		}
+	}
+
+	t.Run("Delivers", func(t *testing.T) {
+		store, email, dispatcher, orderID := setup(t, 0)
+		dispatcher.RunOnce(ctx)
+
+		require.Len(t, email.sent, 1)
+		assert.Equal(t, "wanjiru@example.com", email.sent[0].To)
+		queued, err := store.Notifications().ListNotifications(ctx, orderID)
+		require.NoError(t, err)
+		assert.Equal(t, models.NotificationSent, queued[0].Status)
+		assert.Equal(t, 1, queued[0].Attempts)
+		assert.NotNil(t, queued[0].SentAt)
+
+		assert.Equal(t, models.NotificationFailed, queued[1].Status, "SMS is switched off")
+		assert.Equal(t, errNoSender.Error(), queued[1].LastError)
+	})
+
+	t.Run("Retries with backoff", func(t *testing.T) {
+		store, email, dispatcher, orderID := setup(t, 1)
+		start := time.Now()
+		dispatcher.RunOnce(ctx)
+
+		queued, err := store.Notifications().ListNotifications(ctx, orderID)
+		require.NoError(t, err)
+		assert.Equal(t, models.NotificationPending, queued[0].Status)
+		assert.Equal(t, "connection refused", queued[0].LastError)
+		require.NotNil(t, queued[0].NextAttemptAt)
+		assert.WithinDuration(t, start.Add(time.Minute), *queued[0].NextAttemptAt, time.Second)
+
+		dispatcher.RunOnce(ctx)
+		assert.Empty(t, email.sent, "not due yet")
+
+		due(t, store, orderID)
+		dispatcher.RunOnce(ctx)
+		require.Len(t, email.sent, 1)
+		fetched, err := store.Notifications().GetNotification(ctx, queued[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.NotificationSent, fetched.Status)
+		assert.Equal(t, 2, fetched.Attempts)
+		assert.Empty(t, fetched.LastError)
+	})
+
+	t.Run("Gives up", func(t *testing.T) {
+		store, email, dispatcher, orderID := setup(t, 5)
+		var last models.Notification
+		for attempt := 1; attempt <= 3; attempt++ {
+			dispatcher.RunOnce(ctx)
+			queued, err := store.Notifications().ListNotifications(ctx, orderID)
+			require.NoError(t, err)
+			last = queued[0]
+			if attempt == 2 {
+				assert.WithinDuration(t, time.Now().Add(2*time.Minute), *last.NextAttemptAt, time.Second, "backoff doubles")
+			}
+			due(t, store, orderID)
+		}
+		assert.Empty(t, email.sent)
+		assert.Equal(t, models.NotificationFailed, last.Status)
+		assert.Equal(t, 3, last.Attempts)
+		assert.Nil(t, last.NextAttemptAt)
+	})
+}
+
+func TestLogSink(t *testing.T) {
+	var out bytes.Buffer
+	sink := &LogSink{W: &out}
+	require.NoError(t, sink.Send(ctx, Message{Channel: ChannelEmail, To: "wanjiru@example.com", Subject: "Hi", Body: "Hello"}))
+	require.NoError(t, SMS(sink).Send(ctx, Message{Channel: ChannelSMS, To: "254712345678", Body: "Hello"}))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	var sms map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &sms))
+	assert.Equal(t, "sms", sms["channel"])
+	assert.Equal(t, "254712345678", sms["to"])
+	assert.NotContains(t, sms, "subject")
+}
+
+func TestSMTP(t *testing.T) {
+	t.Run("Message", func(t *testing.T) {
+		s := &SMTP{From: "Duka <orders@duka.co.ke>"}
+		date := time.Date(2026, 3, 14, 21, 30, 0, 0, time.UTC)
+		msg := string(s.message(Message{To: "wanjiru@example.com", Subject: "Malipo – order #7", Body: "Hi\nThanks"}, date))
+		assert.Contains(t, msg, "From: Duka <orders@duka.co.ke>\r\n")
+		assert.Contains(t, msg, "Subject: =?utf-8?q?Malipo_=E2=80=93_order_#7?=\r\n")
+		assert.Contains(t, msg, "Date: Sat, 14 Mar 2026 21:30:00 +0000\r\n")
+		assert.True(t, strings.HasSuffix(msg, "\r\n\r\nHi\r\nThanks"))
+	})
+
+	t.Run("Send", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		received := make(chan []string, 1)
+		go serveSMTP(listener, received)
+
+		addr := listener.Addr().(*net.TCPAddr)
+		s := &SMTP{Host: "127.0.0.1", Port: addr.Port, From: "Duka <orders@duka.co.ke>", Timeout: 5 * time.Second}
+		require.NoError(t, s.Send(ctx, Message{Channel: ChannelEmail, To: "wanjiru@example.com", Subject: "Hi", Body: "Hello"}))
+
+		commands := <-received
+		assert.Contains(t, commands, "MAIL FROM:<orders@duka.co.ke>")
+		assert.Contains(t, commands, "RCPT TO:<wanjiru@example.com>")
+		assert.Contains(t, commands, "Hello")
+	})
+}
+
+// serveSMTP accepts one connection, acts as a minimal SMTP server without
+// extensions and sends every line it received.
+func serveSMTP(listener net.Listener, received chan<- []string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	var lines []string
+	reply("220 localhost ESMTP")
+	data := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+		lines = append(lines, line)
+		switch {
+		case data:
+			if line == "." {
+				data = false
+				reply("250 queued")
+			}
+		case strings.HasPrefix(line, "EHLO"), strings.HasPrefix(line, "HELO"):
+			reply("250 localhost")
+		case line == "DATA":
+			data = true
+			reply("354 go ahead")
+		case line == "QUIT":
+			reply("221 bye")
+			received <- lines
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+	received <- lines
+}
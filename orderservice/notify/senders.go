@@ -0,0 +1,167 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a rendered notification ready to deliver.
+type Message struct {
+	Channel string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages over one channel.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTP sends email through an SMTP server, upgrading to TLS when the
+// server offers STARTTLS.
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	Timeout  time.Duration
+}
+
+// Send delivers msg as a plain text email.
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("smtp: dial %s: %w", addr, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.Host}); err != nil {
+			return fmt.Errorf("smtp: starttls: %w", err)
+		}
+	}
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return fmt.Errorf("smtp: auth: %w", err)
+		}
+	}
+
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("smtp: sender %q: %w", s.From, err)
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if _, err := w.Write(s.message(msg, time.Now())); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return client.Quit()
+}
+
+// message formats msg as an RFC 5322 email sent at date.
+func (s *SMTP) message(msg Message, date time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// SMSGateway sends text messages. Implement it for a provider such as
+// Africa's Talking and wrap it with SMS to use it as a Sender.
+type SMSGateway interface {
+	SendSMS(ctx context.Context, to, text string) error
+}
+
+// SMS adapts gateway to a Sender.
+func SMS(gateway SMSGateway) Sender {
+	return smsSender{gateway}
+}
+
+type smsSender struct {
+	gateway SMSGateway
+}
+
+func (s smsSender) Send(ctx context.Context, msg Message) error {
+	return s.gateway.SendSMS(ctx, msg.To, msg.Body)
+}
+
+// LogSink writes messages to W as JSON lines instead of delivering them,
+// for development. It can stand in for both email and SMS.
+type LogSink struct {
+	W  io.Writer
+	mu sync.Mutex
+}
+
+// Send writes msg.
+func (l *LogSink) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	line, err := json.Marshal(struct {
+		Time    time.Time `json:"time"`
+		Channel string    `json:"channel"`
+		To      string    `json:"to"`
+		Subject string    `json:"subject,omitempty"`
+		Body    string    `json:"body"`
+	}{time.Now().UTC(), msg.Channel, msg.To, msg.Subject, msg.Body})
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.W.Write(append(line, '\n'))
+	return err
+}
+
+// SendSMS writes a text message.
+func (l *LogSink) SendSMS(ctx context.Context, to, text string) error {
+	return l.Send(ctx, Message{Channel: ChannelSMS, To: to, Body: text})
+}
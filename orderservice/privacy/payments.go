@@ -0,0 +1,153 @@
+package privacy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"orderservice/apperrors"
+	"orderservice/audit"
+	"orderservice/auth"
+	"orderservice/logging"
+)
+
+// Payment is an M-Pesa payment attempt for one of the customer's orders,
+// as held by the payment service.
+type Payment struct {
+	OrderID         uint       `json:"order_id"`
+	Phone           string     `json:"phone,omitempty"`
+	Amount          float64    `json:"amount"`
+	Status          string     `json:"status"`
+	ResultDesc      string     `json:"result_desc,omitempty"`
+	ReceiptNumber   string     `json:"receipt_number,omitempty"`
+	TransactionDate *time.Time `json:"transaction_date,omitempty"`
+	AnonymizedAt    *time.Time `json:"anonymized_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// Payments is the payment service's side of a data subject request.
+type Payments interface {
+	// ListPayments returns every payment attempt for the orders, oldest
+	// first.
+	ListPayments(ctx context.Context, orderIDs []uint) ([]Payment, error)
+	// AnonymizePayments removes the payer's phone number from the orders'
+	// payments and returns how many payments it changed.
+	AnonymizePayments(ctx context.Context, orderIDs []uint) (int64, error)
+}
+
+// maxOrdersPerRequest is the most orders the payment service takes in one
+// request; longer lists are sent in batches.
+const maxOrdersPerRequest = 1000
+
+// Client calls the payment service over HTTP.
+type Client struct {
+	baseURL string
+	token   string
+	timeout time.Duration
+	http    *http.Client
+}
+
+// NewClient returns a client for the payment service at baseURL that
+// authenticates with token and whose calls are each cancelled after
+// timeout, or only when their context ends if timeout is zero.
+func NewClient(baseURL, token string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		timeout: timeout,
+		http:    &http.Client{Transport: otelhttp.NewTransport(logging.Transport(http.DefaultTransport))},
+	}
+}
+
+func (c *Client) ListPayments(ctx context.Context, orderIDs []uint) ([]Payment, error) {
+	var payments []Payment
+	for batch := range slices.Chunk(orderIDs, maxOrdersPerRequest) {
+		query := url.Values{}
+		for _, id := range batch {
+			query.Add("order_id", strconv.FormatUint(uint64(id), 10))
+		}
+
+		// Payment rows embed gorm.Model, so their creation time is CreatedAt.
+		var rows []struct {
+			Payment
+			CreatedAt time.Time `json:"CreatedAt"`
+		}
+		if err := c.do(ctx, "GET", "/payments?"+query.Encode(), nil, &rows); err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			payment := row.Payment
+			payment.CreatedAt = row.CreatedAt
+			payments = append(payments, payment)
+		}
+	}
+	// Each batch is oldest first; keep the merged list that way too.
+	slices.SortStableFunc(payments, func(a, b Payment) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return payments, nil
+}
+
+func (c *Client) AnonymizePayments(ctx context.Context, orderIDs []uint) (int64, error) {
+	var anonymized int64
+	for batch := range slices.Chunk(orderIDs, maxOrdersPerRequest) {
+		body, _ := json.Marshal(struct {
+			OrderIDs []uint `json:"order_ids"`
+		}{batch})
+		var result struct {
+			Anonymized int64 `json:"anonymized"`
+		}
+		if err := c.do(ctx, "POST", "/payments/anonymize", body, &result); err != nil {
+			return anonymized, err
+		}
+		anonymized += result.Anonymized
+	}
+	return anonymized, nil
+}
+
+// do sends a request to the payment service and decodes its JSON reply
+// into out. Any failure is reported as the payment service being
+// unavailable.
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return apperrors.Internal("payment service request failed", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// The payment service only shows or changes payments by order for
+	// callers holding the shared service token.
+	req.Header.Set(auth.ServiceHeader, c.token)
+	// The payment service records its changes under the same actor.
+	req.Header.Set(audit.ActorHeader, audit.FromContext(ctx).Actor)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return apperrors.Upstream("payment service unavailable", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return apperrors.Upstream("payment service unavailable",
+			fmt.Errorf("%s %s: status %d", method, path, resp.StatusCode))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return apperrors.Upstream("payment service unavailable", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package privacy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"orderservice/apperrors"
+	"orderservice/audit"
+	"orderservice/auth"
+	"orderservice/logging"
+)
+
+func TestClient(t *testing.T) {
+	var requestID, actor string
+	var anonymized []uint
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(auth.ServiceHeader) != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		requestID = r.Header.Get(logging.RequestIDHeader)
+		actor = r.Header.Get(audit.ActorHeader)
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/payments":
+			assert.Equal(t, []string{"1", "2"}, r.URL.Query()["order_id"])
+			w.Write([]byte(`[{"ID":5,"CreatedAt":"2026-03-01T10:00:00Z","order_id":1,` +
+				`"phone":"254712345678","amount":2500,"status":"paid","receipt_number":"QK12ABC3DE"}]`))
+		case r.Method == "POST" && r.URL.Path == "/payments/anonymize":
+			var body struct {
+				OrderIDs []uint `json:"order_ids"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			anonymized = body.OrderIDs
+			w.Write([]byte(`{"anonymized":1}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	client := NewClient(server.URL+"/", "secret", time.Second)
+
+	t.Run("List", func(t *testing.T) {
+		payments, err := client.ListPayments(context.Background(), []uint{1, 2})
+		require.NoError(t, err)
+		require.Len(t, payments, 1)
+		assert.Equal(t, uint(1), payments[0].OrderID)
+		assert.Equal(t, "QK12ABC3DE", payments[0].ReceiptNumber)
+		assert.Equal(t, time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC), payments[0].CreatedAt.UTC())
+	})
+
+	t.Run("Anonymize forwards the request ID and actor", func(t *testing.T) {
+		router := gin.New()
+		router.Use(logging.Middleware(zap.NewNop()), auth.Staff("staff"), audit.Middleware(auth.Trusted))
+		router.POST("/erase", func(c *gin.Context) {
+			n, err := client.AnonymizePayments(c.Request.Context(), []uint{1, 2})
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), n)
+			c.Status(http.StatusOK)
+		})
+		req := httptest.NewRequest("POST", "/erase", nil)
+		req.Header.Set(logging.RequestIDHeader, "abc-123")
+		req.Header.Set(auth.StaffHeader, "staff")
+		req.Header.Set(audit.ActorHeader, "dpo@example.com")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Equal(t, []uint{1, 2}, anonymized)
+		assert.Equal(t, "abc-123", requestID)
+		assert.Equal(t, "dpo@example.com", actor)
+	})
+
+	t.Run("Long order lists are sent in batches", func(t *testing.T) {
+		var sizes []int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "POST" {
+				var body struct {
+					OrderIDs []uint `json:"order_ids"`
+				}
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				sizes = append(sizes, len(body.OrderIDs))
+				w.Write([]byte(`{"anonymized":2}`))
+				return
+			}
+			ids := r.URL.Query()["order_id"]
+			sizes = append(sizes, len(ids))
+			// Later batches hold older payments.
+			created := time.Date(2026, 3, 10-len(sizes), 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+			w.Write([]byte(`[{"CreatedAt":"` + created + `","order_id":` + ids[0] + `}]`))
+		}))
+		defer server.Close()
+		client := NewClient(server.URL, "secret", time.Second)
+		orderIDs := make([]uint, 2500)
+		for i := range orderIDs {
+			orderIDs[i] = uint(i + 1)
+		}
+
+		payments, err := client.ListPayments(context.Background(), orderIDs)
+		require.NoError(t, err)
+		assert.Equal(t, []int{1000, 1000, 500}, sizes)
+		require.Len(t, payments, 3)
+		assert.Equal(t, []uint{2001, 1001, 1}, []uint{payments[0].OrderID, payments[1].OrderID, payments[2].OrderID}, "oldest first")
+
+		sizes = nil
+		n, err := client.AnonymizePayments(context.Background(), orderIDs)
+		require.NoError(t, err)
+		assert.Equal(t, []int{1000, 1000, 500}, sizes)
+		assert.Equal(t, int64(6), n)
+	})
+
+	t.Run("Unavailable", func(t *testing.T) {
+		broken := NewClient(server.URL+"/broken", "secret", time.Second)
+		_, err := broken.ListPayments(context.Background(), []uint{1})
+		assert.True(t, apperrors.Is(err, apperrors.KindUpstream))
+
+		_, err = NewClient(server.URL, "wrong", time.Second).ListPayments(context.Background(), []uint{1})
+		assert.True(t, apperrors.Is(err, apperrors.KindUpstream), "refused credentials")
+
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+		_, err = NewClient(closed.URL, "secret", time.Second).AnonymizePayments(context.Background(), []uint{1})
+		assert.True(t, apperrors.Is(err, apperrors.KindUpstream))
+	})
+}
@@ -0,0 +1,137 @@
+// Package privacy answers data subject requests under the Kenya Data
+// Protection Act and the GDPR: exporting everything held about a customer,
+// and erasing their personal data while keeping the financial records the
+// business must retain.
+package privacy
+
+import (
+	"context"
+	"time"
+
+	"orderservice/apperrors"
+	"orderservice/models"
+	"orderservice/repository"
+)
+
+// Audit log actions for data subject requests. The changes an erasure
+// makes are recorded separately by the store.
+const (
+	ActionExport = "customer.exported"
+	ActionErase  = "customer.erasure_requested"
+)
+
+// erasedReason fails notifications still waiting to be sent when the
+// customer's data is erased.
+const erasedReason = "customer data erased"
+
+// ordersPerPage is how many orders are read at a time.
+const ordersPerPage = 100
+
+// Export is everything held about a customer, as returned by
+// GET /customers/:id/export.
+type Export struct {
+	ExportedAt    time.Time             `json:"exported_at"`
+	Customer      *models.Customer      `json:"customer"`
+	Addresses     []models.Address      `json:"addresses"`
+	Orders        []models.Order        `json:"orders"`
+	Notifications []models.Notification `json:"notifications"`
+	Payments      []Payment             `json:"payments"`
+}
+
+// Collect gathers the customer's data from store and their payments from
+// the payment service.
+func Collect(ctx context.Context, store repository.Store, payments Payments, customerID uint, now time.Time) (*Export, error) {
+	customer, err := store.Customers().GetCustomer(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	export := &Export{
+		ExportedAt:    now,
+		Customer:      customer,
+		Addresses:     []models.Address{},
+		Orders:        []models.Order{},
+		Notifications: []models.Notification{},
+		Payments:      []Payment{},
+	}
+
+	addresses, err := store.Addresses().ListAddresses(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	export.Addresses = append(export.Addresses, addresses...)
+
+	orders, err := Orders(ctx, store, customerID)
+	if err != nil {
+		return nil, err
+	}
+	export.Orders = append(export.Orders, orders...)
+
+	notifications, err := store.Notifications().ListCustomerNotifications(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	export.Notifications = append(export.Notifications, notifications...)
+
+	if len(orders) > 0 {
+		list, err := payments.ListPayments(ctx, OrderIDs(orders))
+		if err != nil {
+			return nil, err
+		}
+		export.Payments = append(export.Payments, list...)
+	}
+	return export, nil
+}
+
+// Orders returns every order the customer placed, newest first.
+func Orders(ctx context.Context, store repository.Store, customerID uint) ([]models.Order, error) {
+	var orders []models.Order
+	for page := 1; ; page++ {
+		batch, total, err := store.Orders().ListCustomerOrders(ctx, customerID, page, ordersPerPage)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, batch...)
+		if len(batch) < ordersPerPage || int64(len(orders)) >= total {
+			return orders, nil
+		}
+	}
+}
+
+// CheckErasable refuses erasure while any of the orders is still being
+// paid for or delivered, since that needs the customer's details.
+func CheckErasable(orders []models.Order) error {
+	for _, order := range orders {
+		if order.Open() {
+			return apperrors.Conflict("customer has orders that are still in progress; deliver or cancel them first", nil)
+		}
+	}
+	return nil
+}
+
+// Erase anonymizes the customer and removes their addresses, contact
+// details on orders and notifications, and one-time tokens. Orders,
+// invoices and amounts are kept. tx should be a single transaction.
+func Erase(ctx context.Context, tx repository.Store, customerID uint, erasedAt time.Time) error {
+	if err := tx.Customers().EraseCustomer(ctx, customerID, erasedAt); err != nil {
+		return err
+	}
+	if err := tx.Addresses().DeleteCustomerAddresses(ctx, customerID); err != nil {
+		return err
+	}
+	if err := tx.Orders().EraseShippingAddresses(ctx, customerID); err != nil {
+		return err
+	}
+	if err := tx.Notifications().EraseNotifications(ctx, customerID, erasedReason); err != nil {
+		return err
+	}
+	return tx.Tokens().DeleteCustomerTokens(ctx, customerID)
+}
+
+// OrderIDs returns the IDs of orders.
+func OrderIDs(orders []models.Order) []uint {
+	ids := make([]uint, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+	}
+	return ids
+}
@@ -0,0 +1,210 @@
+package promotions
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"orderservice/apperrors"
+	"orderservice/models"
+	"orderservice/money"
+	"orderservice/repository"
+)
+
+// Evaluate returns the amount promotion takes off order, given the
+// discounts the order already carries. The order's products must be loaded;
+// when it has lines, their quantities count towards the amounts. The
+// result never takes the order below zero.
+func Evaluate(promotion models.Promotion, order *models.Order, now time.Time) (float64, error) {
+	invalid := func(reason string) (float64, error) {
+		return 0, apperrors.Validation("coupon " + promotion.Code + " " + reason)
+	}
+
+	switch {
+	case promotion.Disabled:
+		return invalid("is not valid")
+	case promotion.StartsAt != nil && now.Before(*promotion.StartsAt):
+		return invalid("is not active yet")
+	case promotion.EndsAt != nil && !now.Before(*promotion.EndsAt):
+		return invalid("has expired")
+	}
+
+	amountsInCurrency := promotion.Type == models.DiscountFixed || promotion.MinOrderAmount > 0
+	if amountsInCurrency && promotion.Currency != "" && order.Currency != "" && promotion.Currency != order.Currency {
+		return invalid("only applies to orders in " + promotion.Currency)
+	}
+
+	for _, applied := range order.Discounts {
+		if applied.PromotionID == promotion.ID {
+			return 0, apperrors.Conflict("coupon "+promotion.Code+" is already applied", nil)
+		}
+		if !applied.Stackable || !promotion.Stackable {
+			return invalid("cannot be combined with " + applied.Code)
+		}
+	}
+
+	var subtotal, eligible float64
+	for _, line := range lines(order) {
+		subtotal += line.amount
+		if appliesTo(promotion, line.product) {
+			eligible += line.amount
+		}
+	}
+	if subtotal < promotion.MinOrderAmount {
+		return invalid("requires a minimum order of " + formatAmount(promotion.MinOrderAmount, order.Currency))
+	}
+	if eligible == 0 {
+		return invalid("does not apply to any product in the order")
+	}
+
+	var amount float64
+	switch promotion.Type {
+	case models.DiscountPercentage:
+		if promotion.Value > 100 {
+			return invalid("is not valid")
+		}
+		amount = eligible * promotion.Value / 100
+	case models.DiscountFixed:
+		amount = math.Min(promotion.Value, eligible)
+	default:
+		return invalid("is not valid")
+	}
+
+	var discounted float64
+	for _, applied := range order.Discounts {
+		discounted += applied.Amount
+	}
+	amount = math.Min(round(amount), round(subtotal-discounted))
+	if amount <= 0 {
+		return invalid("does not reduce the order total")
+	}
+	return amount, nil
+}
+
+// Apply redeems codes against order in turn and returns the discounts to
+// store. Each accepted discount is appended to order.Discounts so later
+// codes are checked against it. Run it inside a unit of work so failed
+// redemptions roll back.
+func Apply(ctx context.Context, store repository.Store, order *models.Order, codes []string, now time.Time) ([]models.OrderDiscount, error) {
+	return apply(ctx, store, order, codes, now, true)
+}
+
+// Preview works out the discounts codes would give order, as Apply does,
+// without redeeming them. The per-customer limit is only checked when the
+// order has a customer.
+func Preview(ctx context.Context, store repository.Store, order *models.Order, codes []string, now time.Time) ([]models.OrderDiscount, error) {
+	return apply(ctx, store, order, codes, now, false)
+}
+
+func apply(ctx context.Context, store repository.Store, order *models.Order, codes []string, now time.Time, redeem bool) ([]models.OrderDiscount, error) {
+	var added []models.OrderDiscount
+	for _, code := range codes {
+		code = models.NormalizeCode(code)
+		promotion, err := store.Promotions().GetPromotionByCode(ctx, code)
+		if apperrors.Is(err, apperrors.KindNotFound) {
+			return nil, apperrors.Validation("coupon "+code+" is not valid",
+				apperrors.FieldError{Field: "code", Message: "is not a valid coupon"})
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		amount, err := Evaluate(*promotion, order, now)
+		if err != nil {
+			return nil, err
+		}
+
+		if promotion.PerCustomerLimit > 0 && order.CustomerID != 0 {
+			used, err := store.Promotions().CountCustomerRedemptions(ctx, promotion.ID, order.CustomerID)
+			if err != nil {
+				return nil, err
+			}
+			if used >= int64(promotion.PerCustomerLimit) {
+				return nil, apperrors.Conflict("coupon "+code+" has already been used the maximum number of times", nil)
+			}
+		}
+		if redeem {
+			if err := store.Promotions().Redeem(ctx, promotion.ID); err != nil {
+				return nil, err
+			}
+		} else if promotion.UsageLimit > 0 && promotion.UsageCount >= promotion.UsageLimit {
+			return nil, apperrors.Conflict("coupon usage limit reached", nil)
+		}
+
+		discount := models.OrderDiscount{
+			PromotionID: promotion.ID,
+			Code:        promotion.Code,
+			Description: promotion.Description,
+			Stackable:   promotion.Stackable,
+			Amount:      amount,
+		}
+		order.Discounts = append(order.Discounts, discount)
+		added = append(added, discount)
+	}
+	return added, nil
+}
+
+type line struct {
+	product models.Product
+	amount  float64
+}
+
+// lines returns the order's lines with the product each one is for, or one
+// line per product for orders that have not been priced yet.
+func lines(order *models.Order) []line {
+	if len(order.Items) == 0 {
+		result := make([]line, 0, len(order.Products))
+		for _, product := range order.Products {
+			result = append(result, line{product: product, amount: product.Price})
+		}
+		return result
+	}
+
+	products := make(map[uint]models.Product, len(order.Products))
+	for _, product := range order.Products {
+		products[product.ID] = product
+	}
+	result := make([]line, 0, len(order.Items))
+	for _, item := range order.Items {
+		product, ok := products[item.ProductID]
+		if !ok {
+			product.ID = item.ProductID
+		}
+		result = append(result, line{product: product, amount: item.Amount()})
+	}
+	return result
+}
+
+// appliesTo reports whether product is covered by the promotion's product
+// and category restrictions.
+func appliesTo(promotion models.Promotion, product models.Product) bool {
+	if len(promotion.ProductIDs) == 0 && len(promotion.Categories) == 0 {
+		return true
+	}
+	for _, id := range promotion.ProductIDs {
+		if id == product.ID {
+			return true
+		}
+	}
+	for _, category := range promotion.Categories {
+		if strings.EqualFold(category, product.Category) {
+			return true
+		}
+	}
+	return false
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// formatAmount formats amount in currency, or with two decimals for orders
+// without one.
+func formatAmount(amount float64, currency string) string {
+	if currency == "" {
+		return strconv.FormatFloat(amount, 'f', 2, 64)
+	}
+	return money.New(amount, currency).String()
+}
@@ -0,0 +1,193 @@
+package promotions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"orderservice/apperrors"
+	"orderservice/models"
+	"orderservice/repository"
+)
+
+var now = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func product(id uint, price float64, category string) models.Product {
+	p := models.Product{Price: price, Category: category}
+	p.ID = id
+	return p
+}
+
+func testOrder() *models.Order {
+	return &models.Order{CustomerID: 1, Products: []models.Product{
+		product(1, 100, "books"),
+		product(2, 50, "toys"),
+	}}
+}
+
+func promotion(id uint, kind string, value float64) models.Promotion {
+	p := models.Promotion{Code: "SAVE", Type: kind, Value: value}
+	p.ID = id
+	return p
+}
+
+func TestEvaluate(t *testing.T) {
+	t.Run("Percentage of the whole order", func(t *testing.T) {
+		amount, err := Evaluate(promotion(1, models.DiscountPercentage, 10), testOrder(), now)
+		require.NoError(t, err)
+		assert.Equal(t, 15.0, amount)
+	})
+
+	t.Run("Percentage over 100", func(t *testing.T) {
+		_, err := Evaluate(promotion(1, models.DiscountPercentage, 150), testOrder(), now)
+		assert.True(t, apperrors.Is(err, apperrors.KindValidation))
+	})
+
+	t.Run("Fixed amount is capped at eligible products", func(t *testing.T) {
+		p := promotion(1, models.DiscountFixed, 80)
+		p.Categories = []string{"Toys"}
+		amount, err := Evaluate(p, testOrder(), now)
+		require.NoError(t, err)
+		assert.Equal(t, 50.0, amount)
+	})
+
+	t.Run("Product restriction", func(t *testing.T) {
+		p := promotion(1, models.DiscountPercentage, 50)
+		p.ProductIDs = []uint{1}
+		amount, err := Evaluate(p, testOrder(), now)
+		require.NoError(t, err)
+		assert.Equal(t, 50.0, amount)
+	})
+
+	t.Run("Line quantities", func(t *testing.T) {
+		order := testOrder()
+		order.Items = []models.OrderItem{
+			{ProductID: 1, UnitPrice: 100, Quantity: 1},
+			{ProductID: 2, UnitPrice: 50, Quantity: 3},
+		}
+		p := promotion(1, models.DiscountPercentage, 10)
+		p.Categories = []string{"toys"}
+		amount, err := Evaluate(p, order, now)
+		require.NoError(t, err)
+		assert.Equal(t, 15.0, amount)
+	})
+
+	t.Run("No eligible products", func(t *testing.T) {
+		p := promotion(1, models.DiscountPercentage, 50)
+		p.Categories = []string{"garden"}
+		_, err := Evaluate(p, testOrder(), now)
+		assert.True(t, apperrors.Is(err, apperrors.KindValidation))
+	})
+
+	t.Run("Minimum order amount", func(t *testing.T) {
+		p := promotion(1, models.DiscountFixed, 5)
+		p.MinOrderAmount = 200
+		_, err := Evaluate(p, testOrder(), now)
+		assert.ErrorContains(t, err, "requires a minimum order of 200.00")
+	})
+
+	t.Run("Amounts are in the promotion's currency", func(t *testing.T) {
+		p := promotion(1, models.DiscountFixed, 5)
+		p.Currency = "KES"
+		order := testOrder()
+		order.Currency = "USD"
+		_, err := Evaluate(p, order, now)
+		assert.ErrorContains(t, err, "only applies to orders in KES")
+
+		p = promotion(1, models.DiscountPercentage, 10)
+		p.Currency = "KES"
+		amount, err := Evaluate(p, order, now)
+		require.NoError(t, err)
+		assert.Equal(t, 15.0, amount, "percentages apply in any currency")
+
+		p.MinOrderAmount = 200
+		order.Currency = "KES"
+		_, err = Evaluate(p, order, now)
+		assert.ErrorContains(t, err, "requires a minimum order of 200.00 KES")
+	})
+
+	t.Run("Validity window", func(t *testing.T) {
+		later, earlier := now.Add(time.Hour), now.Add(-time.Hour)
+
+		p := promotion(1, models.DiscountFixed, 5)
+		p.StartsAt = &later
+		_, err := Evaluate(p, testOrder(), now)
+		assert.ErrorContains(t, err, "is not active yet")
+
+		p = promotion(1, models.DiscountFixed, 5)
+		p.EndsAt = &earlier
+		_, err = Evaluate(p, testOrder(), now)
+		assert.ErrorContains(t, err, "has expired")
+	})
+
+	t.Run("Stacking", func(t *testing.T) {
+		order := testOrder()
+		order.Discounts = []models.OrderDiscount{{PromotionID: 9, Code: "FIRST", Stackable: true, Amount: 140}}
+
+		p := promotion(1, models.DiscountFixed, 20)
+		_, err := Evaluate(p, order, now)
+		assert.ErrorContains(t, err, "cannot be combined with FIRST")
+
+		p.Stackable = true
+		amount, err := Evaluate(p, order, now)
+		require.NoError(t, err)
+		assert.Equal(t, 10.0, amount, "never discounts below zero")
+	})
+
+	t.Run("Same promotion twice", func(t *testing.T) {
+		order := testOrder()
+		order.Discounts = []models.OrderDiscount{{PromotionID: 1, Code: "SAVE", Stackable: true}}
+		p := promotion(1, models.DiscountFixed, 5)
+		p.Stackable = true
+		_, err := Evaluate(p, order, now)
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict))
+	})
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	for _, p := range testOrder().Products {
+		require.NoError(t, store.Products().CreateProduct(ctx, &p))
+	}
+	limited := &models.Promotion{Code: "ONCE", Type: models.DiscountFixed, Value: 5, UsageLimit: 1, Stackable: true}
+	perCustomer := &models.Promotion{Code: "LOYAL", Type: models.DiscountPercentage, Value: 10, PerCustomerLimit: 1, Stackable: true}
+	require.NoError(t, store.Promotions().CreatePromotion(ctx, limited))
+	require.NoError(t, store.Promotions().CreatePromotion(ctx, perCustomer))
+
+	t.Run("Unknown code", func(t *testing.T) {
+		_, err := Apply(ctx, store, testOrder(), []string{"NOPE"}, now)
+		assert.True(t, apperrors.Is(err, apperrors.KindValidation))
+	})
+
+	t.Run("Codes stack in order", func(t *testing.T) {
+		order := testOrder()
+		discounts, err := Apply(ctx, store, order, []string{"once", "LOYAL"}, now)
+		require.NoError(t, err)
+		require.Len(t, discounts, 2)
+		assert.Equal(t, 5.0, discounts[0].Amount)
+		assert.Equal(t, 15.0, discounts[1].Amount)
+		assert.Len(t, order.Discounts, 2)
+
+		require.NoError(t, store.Orders().CreateOrder(ctx, order))
+	})
+
+	t.Run("Global usage limit", func(t *testing.T) {
+		order := testOrder()
+		order.CustomerID = 2
+		_, err := Apply(ctx, store, order, []string{"ONCE"}, now)
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict))
+	})
+
+	t.Run("Per-customer limit", func(t *testing.T) {
+		_, err := Apply(ctx, store, testOrder(), []string{"LOYAL"}, now)
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict))
+
+		other := testOrder()
+		other.CustomerID = 2
+		_, err = Apply(ctx, store, other, []string{"LOYAL"}, now)
+		assert.NoError(t, err)
+	})
+}
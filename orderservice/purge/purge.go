@@ -0,0 +1,77 @@
+// Package purge permanently removes soft-deleted records once they have
+// been kept for the retention period.
+package purge
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"orderservice/repository"
+)
+
+// Job periodically purges records deleted more than retention ago. Records
+// still needed by others, such as a deleted product on a past order, are
+// kept until nothing refers to them.
+type Job struct {
+	store     repository.Store
+	retention time.Duration
+	interval  time.Duration
+	logger    *zap.Logger
+}
+
+func NewJob(store repository.Store, retention, interval time.Duration, logger *zap.Logger) *Job {
+	return &Job{store: store, retention: retention, interval: interval, logger: logger}
+}
+
+// Run purges immediately and then on every interval until ctx is
+// cancelled.
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce purges every record whose retention period has passed. Orders go
+// first, since purging them can free the customers and products they refer
+// to.
+func (j *Job) RunOnce(ctx context.Context) {
+	cutoff := time.Now().Add(-j.retention)
+	j.purge("orders", func() (int, error) {
+		ids, err := j.store.Orders().PurgeOrders(ctx, cutoff)
+		return len(ids), err
+	})
+	j.purge("customers", func() (int, error) {
+		ids, err := j.store.Customers().PurgeCustomers(ctx, cutoff)
+		return len(ids), err
+	})
+	j.purge("products", func() (int, error) {
+		ids, err := j.store.Products().PurgeProducts(ctx, cutoff)
+		return len(ids), err
+	})
+	j.purge("addresses", func() (int, error) {
+		n, err := j.store.Addresses().PurgeAddresses(ctx, cutoff)
+		return int(n), err
+	})
+}
+
+// purge runs one kind of purge and logs its outcome. A failure is logged
+// and left for the next run, without holding up the other kinds.
+func (j *Job) purge(records string, fn func() (int, error)) {
+	n, err := fn()
+	if err != nil {
+		j.logger.Error("Failed to purge deleted records", zap.String("records", records), zap.Error(err))
+		return
+	}
+	if n > 0 {
+		j.logger.Info("Purged deleted records", zap.String("records", records), zap.Int("count", n))
+	}
+}
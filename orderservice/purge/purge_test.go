@@ -0,0 +1,39 @@
+package purge
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"orderservice/models"
+	"orderservice/repository"
+)
+
+var ctx = context.Background()
+
+func TestJob(t *testing.T) {
+	store := repository.NewMemoryStore()
+	customer := &models.Customer{Name: "Former Customer", Email: "former@example.com"}
+	require.NoError(t, store.Customers().CreateCustomer(ctx, customer))
+	product := &models.Product{Name: "Old stock", Price: 20}
+	require.NoError(t, store.Products().CreateProduct(ctx, product))
+	order := &models.Order{CustomerID: customer.ID, Status: models.OrderCancelled,
+		Items: []models.OrderItem{{ProductID: product.ID, Name: "Old stock", UnitPrice: 20, Quantity: 1, Total: 20}}}
+	require.NoError(t, store.Orders().CreateOrder(ctx, order))
+	require.NoError(t, store.Orders().DeleteOrder(ctx, order.ID))
+	require.NoError(t, store.Customers().DeleteCustomer(ctx, customer.ID))
+	require.NoError(t, store.Products().DeleteProduct(ctx, product.ID))
+
+	NewJob(store, time.Hour, time.Hour, zap.NewNop()).RunOnce(ctx)
+	require.NoError(t, store.Products().RestoreProduct(ctx, product.ID), "kept for the retention period")
+	require.NoError(t, store.Products().DeleteProduct(ctx, product.ID))
+
+	NewJob(store, 0, time.Hour, zap.NewNop()).RunOnce(ctx)
+	_, err := store.Orders().GetOrderIncludingDeleted(ctx, order.ID)
+	assert.Error(t, err)
+	assert.Error(t, store.Customers().RestoreCustomer(ctx, customer.ID), "purged once its order was")
+	assert.Error(t, store.Products().RestoreProduct(ctx, product.ID), "purged once its order was")
+}
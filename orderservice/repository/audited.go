@@ -0,0 +1,334 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"orderservice/audit"
+	"orderservice/models"
+)
+
+// Audit log actions recorded by Audited.
+const (
+	ActionCustomerCreated         = "customer.created"
+	ActionCustomerPasswordChanged = "customer.password_changed"
+	ActionCustomerEmailVerified   = "customer.email_verified"
+	ActionCustomerErased          = "customer.erased"
+	ActionCustomerDeleted         = "customer.deleted"
+	ActionCustomerRestored        = "customer.restored"
+	ActionCustomerPurged          = "customer.purged"
+	ActionProductCreated          = "product.created"
+	ActionProductStatusChanged    = "product.status_changed"
+	ActionProductDeleted          = "product.deleted"
+	ActionProductRestored         = "product.restored"
+	ActionProductPurged           = "product.purged"
+	ActionOrderCreated            = "order.created"
+	ActionOrderStatusChanged      = "order.status_changed"
+	ActionOrderDiscountsApplied   = "order.discounts_applied"
+	ActionOrderRepriced           = "order.repriced"
+	ActionOrderPaymentRecorded    = "order.payment_recorded"
+	ActionOrderAddressErased      = "order.shipping_address_erased"
+	ActionOrderDeleted            = "order.deleted"
+	ActionOrderRestored           = "order.restored"
+	ActionOrderPurged             = "order.purged"
+)
+
+// personalFields are the fields of each entity type whose values are
+// redacted in the audit log.
+var personalFields = map[string][]string{
+	"customer": {"name", "email"},
+	"order":    {"shipping_address"},
+}
+
+// Audited returns a Store that records every change made through its
+// customer, product and order repositories in the audit log, with the
+// fields it changed, attributed to the request in the context. A change
+// and its entry are committed together.
+func Audited(store Store) Store {
+	return auditedStore{store}
+}
+
+type auditedStore struct {
+	Store
+}
+
+func (s auditedStore) Customers() CustomerRepository {
+	return auditedCustomers{s.Store.Customers(), s.Store}
+}
+
+func (s auditedStore) Products() ProductRepository {
+	return auditedProducts{s.Store.Products(), s.Store}
+}
+
+func (s auditedStore) Orders() OrderRepository {
+	return auditedOrders{s.Store.Orders(), s.Store}
+}
+
+func (s auditedStore) WithinTx(ctx context.Context, fn func(tx Store) error) error {
+	return s.Store.WithinTx(ctx, func(tx Store) error {
+		return fn(auditedStore{tx})
+	})
+}
+
+// loader reads an entity as it is shown in the audit log.
+type loader func(ctx context.Context, tx Store, id uint) (interface{}, error)
+
+func loadCustomer(ctx context.Context, tx Store, id uint) (interface{}, error) {
+	return tx.Customers().GetCustomer(ctx, id)
+}
+
+func loadProduct(ctx context.Context, tx Store, id uint) (interface{}, error) {
+	return tx.Products().GetProduct(ctx, id)
+}
+
+// loadOrder leaves out the order's products, whose stock changes with
+// every order placed; its items record what was ordered.
+func loadOrder(ctx context.Context, tx Store, id uint) (interface{}, error) {
+	order, err := tx.Orders().GetOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	order.Products = nil
+	return order, nil
+}
+
+// loadAnyOrder is loadOrder that also finds deleted orders.
+func loadAnyOrder(ctx context.Context, tx Store, id uint) (interface{}, error) {
+	order, err := tx.Orders().GetOrderIncludingDeleted(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	order.Products = nil
+	return order, nil
+}
+
+// change runs op in a unit of work and records action on the entity with
+// the changes op made to it. A zero id means op creates the entity and
+// returns its ID.
+func change(ctx context.Context, store Store, action, entityType string, id uint, load loader,
+	op func(tx Store) (uint, error)) error {
+	return store.WithinTx(ctx, func(tx Store) error {
+		var before interface{}
+		if id != 0 {
+			var err error
+			if before, err = load(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		id, err := op(tx)
+		if err != nil {
+			return err
+		}
+		return record(ctx, tx, action, entityType, id, before, load)
+	})
+}
+
+// record appends an entry for action on the entity, comparing before with
+// the entity as it is now.
+func record(ctx context.Context, tx Store, action, entityType string, id uint, before interface{}, load loader) error {
+	after, err := load(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	entry := audit.Entry(ctx, action, entityType, id)
+	if entry.Changes, err = audit.Diff(before, after, personalFields[entityType]...); err != nil {
+		return err
+	}
+	return tx.Audit().RecordAudit(ctx, entry)
+}
+
+// mark runs op in a unit of work and records action on each entity whose
+// ID it returns. Deleting, restoring and purging only change DeletedAt,
+// which the log leaves out, so their entries have no changes.
+func mark(ctx context.Context, store Store, action, entityType string, op func(tx Store) ([]uint, error)) ([]uint, error) {
+	var ids []uint
+	err := store.WithinTx(ctx, func(tx Store) error {
+		var err error
+		if ids, err = op(tx); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := tx.Audit().RecordAudit(ctx, audit.Entry(ctx, action, entityType, id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+type auditedCustomers struct {
+	CustomerRepository
+	store Store
+}
+
+func (r auditedCustomers) CreateCustomer(ctx context.Context, customer *models.Customer) error {
+	return change(ctx, r.store, ActionCustomerCreated, "customer", 0, loadCustomer, func(tx Store) (uint, error) {
+		err := tx.Customers().CreateCustomer(ctx, customer)
+		return customer.ID, err
+	})
+}
+
+func (r auditedCustomers) SetPassword(ctx context.Context, id uint, hash string, changedAt time.Time) error {
+	return change(ctx, r.store, ActionCustomerPasswordChanged, "customer", id, loadCustomer, func(tx Store) (uint, error) {
+		return id, tx.Customers().SetPassword(ctx, id, hash, changedAt)
+	})
+}
+
+func (r auditedCustomers) VerifyEmail(ctx context.Context, id uint, verifiedAt time.Time) error {
+	return change(ctx, r.store, ActionCustomerEmailVerified, "customer", id, loadCustomer, func(tx Store) (uint, error) {
+		return id, tx.Customers().VerifyEmail(ctx, id, verifiedAt)
+	})
+}
+
+func (r auditedCustomers) EraseCustomer(ctx context.Context, id uint, erasedAt time.Time) error {
+	return change(ctx, r.store, ActionCustomerErased, "customer", id, loadCustomer, func(tx Store) (uint, error) {
+		return id, tx.Customers().EraseCustomer(ctx, id, erasedAt)
+	})
+}
+
+func (r auditedCustomers) DeleteCustomer(ctx context.Context, id uint) error {
+	_, err := mark(ctx, r.store, ActionCustomerDeleted, "customer", func(tx Store) ([]uint, error) {
+		return []uint{id}, tx.Customers().DeleteCustomer(ctx, id)
+	})
+	return err
+}
+
+func (r auditedCustomers) RestoreCustomer(ctx context.Context, id uint) error {
+	_, err := mark(ctx, r.store, ActionCustomerRestored, "customer", func(tx Store) ([]uint, error) {
+		return []uint{id}, tx.Customers().RestoreCustomer(ctx, id)
+	})
+	return err
+}
+
+func (r auditedCustomers) PurgeCustomers(ctx context.Context, cutoff time.Time) ([]uint, error) {
+	return mark(ctx, r.store, ActionCustomerPurged, "customer", func(tx Store) ([]uint, error) {
+		return tx.Customers().PurgeCustomers(ctx, cutoff)
+	})
+}
+
+type auditedProducts struct {
+	ProductRepository
+	store Store
+}
+
+func (r auditedProducts) CreateProduct(ctx context.Context, product *models.Product) error {
+	return change(ctx, r.store, ActionProductCreated, "product", 0, loadProduct, func(tx Store) (uint, error) {
+		err := tx.Products().CreateProduct(ctx, product)
+		return product.ID, err
+	})
+}
+
+func (r auditedProducts) UpdateProductStatus(ctx context.Context, id uint, status string) error {
+	return change(ctx, r.store, ActionProductStatusChanged, "product", id, loadProduct, func(tx Store) (uint, error) {
+		return id, tx.Products().UpdateProductStatus(ctx, id, status)
+	})
+}
+
+func (r auditedProducts) DeleteProduct(ctx context.Context, id uint) error {
+	_, err := mark(ctx, r.store, ActionProductDeleted, "product", func(tx Store) ([]uint, error) {
+		return []uint{id}, tx.Products().DeleteProduct(ctx, id)
+	})
+	return err
+}
+
+func (r auditedProducts) RestoreProduct(ctx context.Context, id uint) error {
+	_, err := mark(ctx, r.store, ActionProductRestored, "product", func(tx Store) ([]uint, error) {
+		return []uint{id}, tx.Products().RestoreProduct(ctx, id)
+	})
+	return err
+}
+
+func (r auditedProducts) PurgeProducts(ctx context.Context, cutoff time.Time) ([]uint, error) {
+	return mark(ctx, r.store, ActionProductPurged, "product", func(tx Store) ([]uint, error) {
+		return tx.Products().PurgeProducts(ctx, cutoff)
+	})
+}
+
+type auditedOrders struct {
+	OrderRepository
+	store Store
+}
+
+func (r auditedOrders) CreateOrder(ctx context.Context, order *models.Order) error {
+	return change(ctx, r.store, ActionOrderCreated, "order", 0, loadOrder, func(tx Store) (uint, error) {
+		err := tx.Orders().CreateOrder(ctx, order)
+		return order.ID, err
+	})
+}
+
+func (r auditedOrders) UpdateOrderStatus(ctx context.Context, id uint, status string) error {
+	return change(ctx, r.store, ActionOrderStatusChanged, "order", id, loadOrder, func(tx Store) (uint, error) {
+		return id, tx.Orders().UpdateOrderStatus(ctx, id, status)
+	})
+}
+
+func (r auditedOrders) ApplyDiscounts(ctx context.Context, order *models.Order, discounts []models.OrderDiscount) error {
+	return change(ctx, r.store, ActionOrderDiscountsApplied, "order", order.ID, loadOrder, func(tx Store) (uint, error) {
+		return order.ID, tx.Orders().ApplyDiscounts(ctx, order, discounts)
+	})
+}
+
+func (r auditedOrders) RepriceOrder(ctx context.Context, order *models.Order) error {
+	return change(ctx, r.store, ActionOrderRepriced, "order", order.ID, loadOrder, func(tx Store) (uint, error) {
+		return order.ID, tx.Orders().RepriceOrder(ctx, order)
+	})
+}
+
+func (r auditedOrders) RecordPayment(ctx context.Context, id uint, reference string, paidAt time.Time) error {
+	return change(ctx, r.store, ActionOrderPaymentRecorded, "order", id, loadOrder, func(tx Store) (uint, error) {
+		return id, tx.Orders().RecordPayment(ctx, id, reference, paidAt)
+	})
+}
+
+// EraseShippingAddresses records an entry for each of the customer's
+// orders, deleted ones included.
+func (r auditedOrders) EraseShippingAddresses(ctx context.Context, customerID uint) error {
+	return r.store.WithinTx(ctx, func(tx Store) error {
+		// The erasure reaches deleted orders too, so they are looked up
+		// the same way.
+		ids, err := tx.Orders().CustomerOrderIDs(ctx, customerID)
+		if err != nil {
+			return err
+		}
+		before := make([]interface{}, len(ids))
+		for i, id := range ids {
+			if before[i], err = loadAnyOrder(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Orders().EraseShippingAddresses(ctx, customerID); err != nil {
+			return err
+		}
+		for i, id := range ids {
+			if err := record(ctx, tx, ActionOrderAddressErased, "order", id, before[i], loadAnyOrder); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r auditedOrders) DeleteOrder(ctx context.Context, id uint) error {
+	_, err := mark(ctx, r.store, ActionOrderDeleted, "order", func(tx Store) ([]uint, error) {
+		return []uint{id}, tx.Orders().DeleteOrder(ctx, id)
+	})
+	return err
+}
+
+func (r auditedOrders) RestoreOrder(ctx context.Context, id uint) error {
+	_, err := mark(ctx, r.store, ActionOrderRestored, "order", func(tx Store) ([]uint, error) {
+		return []uint{id}, tx.Orders().RestoreOrder(ctx, id)
+	})
+	return err
+}
+
+func (r auditedOrders) PurgeOrders(ctx context.Context, cutoff time.Time) ([]uint, error) {
+	return mark(ctx, r.store, ActionOrderPurged, "order", func(tx Store) ([]uint, error) {
+		return tx.Orders().PurgeOrders(ctx, cutoff)
+	})
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"orderservice/apperrors"
+	"orderservice/audit"
+	"orderservice/models"
+)
+
+func TestAuditedStoreContract(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		testStore(t, Audited(NewMemoryStore()))
+	})
+	t.Run("Gorm", func(t *testing.T) {
+		testStore(t, Audited(NewGormStore(setupTestDB(), 0)))
+	})
+}
+
+func TestAuditedStore(t *testing.T) {
+	memory := NewMemoryStore()
+	store := Audited(memory)
+	ctx := audit.WithSource(ctx, audit.Source{Actor: "staff@example.com", IP: "192.0.2.1"})
+
+	// last returns the newest entry for action.
+	last := func(t *testing.T, action string) models.AuditEntry {
+		entries, _, err := memory.Audit().ListAudit(ctx, models.AuditQuery{Action: action, Page: 1, PerPage: 1})
+		require.NoError(t, err)
+		require.Len(t, entries, 1, action)
+		return entries[0]
+	}
+	count := func() int64 {
+		_, total, err := memory.Audit().ListAudit(ctx, models.AuditQuery{Page: 1, PerPage: 1})
+		require.NoError(t, err)
+		return total
+	}
+
+	customer := &models.Customer{Name: "Wanjiru Kamau", Email: "wanjiru@example.com"}
+	require.NoError(t, store.Customers().CreateCustomer(ctx, customer))
+	product := &models.Product{Name: "Kettle", Price: 2500}
+	require.NoError(t, store.Products().CreateProduct(ctx, product))
+	order := &models.Order{CustomerID: customer.ID, Products: []models.Product{*product},
+		ShippingAddress: models.ShippingAddress{County: "Nairobi", Town: "Westlands", Street: "Waiyaki Way", Phone: "254712345678"}}
+	require.NoError(t, store.Orders().CreateOrder(ctx, order))
+
+	t.Run("Create", func(t *testing.T) {
+		entry := last(t, ActionCustomerCreated)
+		assert.Equal(t, "staff@example.com", entry.Actor)
+		assert.Equal(t, "192.0.2.1", entry.SourceIP)
+		assert.Equal(t, "customer", entry.EntityType)
+		assert.Equal(t, customer.ID, entry.EntityID)
+		assert.Equal(t, json.RawMessage(`"[redacted]"`), entry.Changes["email"].After, "personal data is redacted")
+		assert.NotContains(t, string(entry.Changes["email"].After), "wanjiru")
+
+		entry = last(t, ActionOrderCreated)
+		assert.Equal(t, order.ID, entry.EntityID)
+		assert.Equal(t, json.RawMessage(`"pending"`), entry.Changes["status"].After)
+		assert.Equal(t, json.RawMessage(`"[redacted]"`), entry.Changes["shipping_address"].After)
+		assert.NotContains(t, entry.Changes, "products")
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		require.NoError(t, store.Products().UpdateProductStatus(ctx, product.ID, models.ProductArchived))
+		entry := last(t, ActionProductStatusChanged)
+		assert.Equal(t, models.Changes{"status": {
+			Before: json.RawMessage(`"active"`), After: json.RawMessage(`"archived"`)}}, entry.Changes)
+
+		require.NoError(t, store.Orders().UpdateOrderStatus(ctx, order.ID, models.OrderPaid))
+		entry = last(t, ActionOrderStatusChanged)
+		assert.Equal(t, models.Changes{"status": {
+			Before: json.RawMessage(`"pending"`), After: json.RawMessage(`"paid"`)}}, entry.Changes)
+
+		require.NoError(t, store.Orders().RecordPayment(ctx, order.ID, "QK12ABC3DE", time.Now()))
+		entry = last(t, ActionOrderPaymentRecorded)
+		assert.Equal(t, json.RawMessage(`"QK12ABC3DE"`), entry.Changes["payment_reference"].After)
+		assert.Contains(t, entry.Changes, "paid_at")
+	})
+
+	t.Run("Failed changes are not recorded", func(t *testing.T) {
+		before := count()
+		err := store.Orders().UpdateOrderStatus(ctx, 9999, models.OrderPaid)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+
+		err = store.WithinTx(ctx, func(tx Store) error {
+			require.NoError(t, tx.Orders().UpdateOrderStatus(ctx, order.ID, models.OrderDelivered))
+			return errors.New("boom")
+		})
+		assert.Error(t, err)
+		assert.Equal(t, before, count(), "entries roll back with their change")
+	})
+
+	t.Run("Erasure", func(t *testing.T) {
+		deleted := &models.Order{CustomerID: customer.ID,
+			ShippingAddress: models.ShippingAddress{County: "Nairobi", Town: "Westlands", Street: "Ring Road", Phone: "254712345678"}}
+		require.NoError(t, store.Orders().CreateOrder(ctx, deleted))
+		require.NoError(t, store.Orders().UpdateOrderStatus(ctx, deleted.ID, models.OrderCancelled))
+		require.NoError(t, store.Orders().DeleteOrder(ctx, deleted.ID))
+
+		require.NoError(t, store.Customers().EraseCustomer(ctx, customer.ID, time.Now()))
+		require.NoError(t, store.Orders().EraseShippingAddresses(ctx, customer.ID))
+
+		entry := last(t, ActionCustomerErased)
+		assert.Equal(t, json.RawMessage(`"[redacted]"`), entry.Changes["name"].Before)
+		assert.Contains(t, entry.Changes, "erased_at")
+		for _, id := range []uint{order.ID, deleted.ID} {
+			entries, _, err := memory.Audit().ListAudit(ctx, models.AuditQuery{
+				Action: ActionOrderAddressErased, EntityID: id, Page: 1, PerPage: 10})
+			require.NoError(t, err)
+			require.Len(t, entries, 1, "every erased order is recorded, deleted ones too")
+			assert.Contains(t, entries[0].Changes, "shipping_address")
+		}
+	})
+
+	t.Run("Background jobs", func(t *testing.T) {
+		require.NoError(t, store.Orders().UpdateOrderStatus(context.Background(), order.ID, models.OrderDelivered))
+		assert.Equal(t, audit.System, last(t, ActionOrderStatusChanged).Actor)
+	})
+
+	t.Run("Deletion", func(t *testing.T) {
+		spare := &models.Product{Name: "Spare lid", Price: 150}
+		require.NoError(t, store.Products().CreateProduct(ctx, spare))
+		require.NoError(t, store.Products().DeleteProduct(ctx, spare.ID))
+		entry := last(t, ActionProductDeleted)
+		assert.Equal(t, "staff@example.com", entry.Actor)
+		assert.Equal(t, spare.ID, entry.EntityID)
+		assert.Empty(t, entry.Changes)
+		require.NoError(t, store.Products().RestoreProduct(ctx, spare.ID))
+		assert.Equal(t, spare.ID, last(t, ActionProductRestored).EntityID)
+
+		before := count()
+		err := store.Customers().DeleteCustomer(ctx, 9999)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+		assert.Equal(t, before, count(), "refused deletes are not recorded")
+
+		require.NoError(t, store.Products().DeleteProduct(ctx, spare.ID))
+		ids, err := store.Products().PurgeProducts(context.Background(), time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, []uint{spare.ID}, ids)
+		entry = last(t, ActionProductPurged)
+		assert.Equal(t, audit.System, entry.Actor)
+		assert.Equal(t, spare.ID, entry.EntityID)
+	})
+}
@@ -0,0 +1,1830 @@
+package repository
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"orderservice/apperrors"
+	"orderservice/models"
+)
+
+// MemoryStore is an in-process Store for tests and local tooling. It
+// enforces the same uniqueness and reference rules as the database and
+// returns the same domain errors.
+type MemoryStore struct {
+	txMu sync.Mutex
+	mu   sync.Mutex
+	data memoryData
+}
+
+type memoryData struct {
+	nextID     uint
+	customers  map[uint]models.Customer
+	products   map[uint]models.Product
+	orders     map[uint]memoryOrder
+	promotions map[uint]models.Promotion
+	carts      map[uint]models.Cart
+	addresses  map[uint]models.Address
+	shipping   map[uint]models.ShippingMethod
+	shipments  map[uint]models.Shipment
+	invoices   map[uint]models.Invoice
+	invoiceSeq uint
+
+	notifications map[uint]models.Notification
+	tokens        map[uint]models.CustomerToken
+	audit         []models.AuditEntry
+
+	// Soft-deleted records are kept apart, so reads that leave them out,
+	// as the database's do, need not check.
+	deletedCustomers map[uint]models.Customer
+	deletedProducts  map[uint]models.Product
+	deletedOrders    map[uint]memoryOrder
+}
+
+// memoryOrder stores product references the way the order_products join
+// table does; products are resolved when the order is read.
+type memoryOrder struct {
+	order      models.Order
+	productIDs []uint
+}
+
+// includes reports whether the order has a line for the product.
+func (o memoryOrder) includes(productID uint) bool {
+	for _, item := range o.order.Items {
+		if item.ProductID == productID {
+			return true
+		}
+	}
+	return slices.Contains(o.productIDs, productID)
+}
+
+func (o memoryOrder) clone() memoryOrder {
+	o.productIDs = append([]uint(nil), o.productIDs...)
+	o.order.Discounts = append([]models.OrderDiscount(nil), o.order.Discounts...)
+	o.order.Items = append([]models.OrderItem(nil), o.order.Items...)
+	return o
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: memoryData{
+		customers:  make(map[uint]models.Customer),
+		products:   make(map[uint]models.Product),
+		orders:     make(map[uint]memoryOrder),
+		promotions: make(map[uint]models.Promotion),
+		carts:      make(map[uint]models.Cart),
+		addresses:  make(map[uint]models.Address),
+		shipping:   make(map[uint]models.ShippingMethod),
+		shipments:  make(map[uint]models.Shipment),
+		invoices:   make(map[uint]models.Invoice),
+
+		notifications: make(map[uint]models.Notification),
+		tokens:        make(map[uint]models.CustomerToken),
+
+		deletedCustomers: make(map[uint]models.Customer),
+		deletedProducts:  make(map[uint]models.Product),
+		deletedOrders:    make(map[uint]memoryOrder),
+	}}
+}
+
+func (s *MemoryStore) Customers() CustomerRepository { return memoryCustomers{s} }
+func (s *MemoryStore) Products() ProductRepository   { return memoryProducts{s} }
+func (s *MemoryStore) Orders() OrderRepository       { return memoryOrders{s} }
+func (s *MemoryStore) Promotions() PromotionRepository {
+	return memoryPromotions{s}
+}
+func (s *MemoryStore) Carts() CartRepository { return memoryCarts{s} }
+func (s *MemoryStore) Addresses() AddressRepository {
+	return memoryAddresses{s}
+}
+func (s *MemoryStore) Shipping() ShippingRepository {
+	return memoryShipping{s}
+}
+func (s *MemoryStore) Shipments() ShipmentRepository {
+	return memoryShipments{s}
+}
+func (s *MemoryStore) Invoices() InvoiceRepository {
+	return memoryInvoices{s}
+}
+func (s *MemoryStore) Notifications() NotificationRepository {
+	return memoryNotifications{s}
+}
+func (s *MemoryStore) Tokens() TokenRepository {
+	return memoryTokens{s}
+}
+func (s *MemoryStore) Audit() AuditRepository {
+	return memoryAudit{s}
+}
+
+// WithinTx runs units of work one at a time and restores the previous
+// contents if fn fails. Writes made outside WithinTx are not isolated from
+// a running unit of work.
+func (s *MemoryStore) WithinTx(ctx context.Context, fn func(tx Store) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.Lock()
+	saved := s.data.clone()
+	s.mu.Unlock()
+
+	if err := fn(memoryTx{s}); err != nil {
+		s.mu.Lock()
+		s.data = saved
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// memoryTx is the Store handed to a unit of work. Nested units of work join
+// the outer one, as GORM does with savepoints.
+type memoryTx struct {
+	*MemoryStore
+}
+
+func (t memoryTx) WithinTx(ctx context.Context, fn func(tx Store) error) error {
+	return fn(t)
+}
+
+func (d memoryData) clone() memoryData {
+	c := memoryData{
+		nextID:     d.nextID,
+		customers:  make(map[uint]models.Customer, len(d.customers)),
+		products:   make(map[uint]models.Product, len(d.products)),
+		orders:     make(map[uint]memoryOrder, len(d.orders)),
+		promotions: make(map[uint]models.Promotion, len(d.promotions)),
+		carts:      make(map[uint]models.Cart, len(d.carts)),
+		addresses:  make(map[uint]models.Address, len(d.addresses)),
+		shipping:   make(map[uint]models.ShippingMethod, len(d.shipping)),
+		shipments:  make(map[uint]models.Shipment, len(d.shipments)),
+		invoices:   make(map[uint]models.Invoice, len(d.invoices)),
+		invoiceSeq: d.invoiceSeq,
+
+		notifications: make(map[uint]models.Notification, len(d.notifications)),
+		tokens:        make(map[uint]models.CustomerToken, len(d.tokens)),
+		audit:         append([]models.AuditEntry(nil), d.audit...),
+
+		deletedCustomers: make(map[uint]models.Customer, len(d.deletedCustomers)),
+		deletedProducts:  make(map[uint]models.Product, len(d.deletedProducts)),
+		deletedOrders:    make(map[uint]memoryOrder, len(d.deletedOrders)),
+	}
+	for id, v := range d.customers {
+		c.customers[id] = v
+	}
+	for id, v := range d.products {
+		c.products[id] = v
+	}
+	for id, v := range d.orders {
+		c.orders[id] = v.clone()
+	}
+	for id, v := range d.promotions {
+		c.promotions[id] = v
+	}
+	for id, v := range d.carts {
+		c.carts[id] = copyCart(v)
+	}
+	for id, v := range d.addresses {
+		c.addresses[id] = v
+	}
+	for id, v := range d.shipping {
+		c.shipping[id] = copyShippingMethod(v)
+	}
+	for id, v := range d.shipments {
+		c.shipments[id] = copyShipment(v)
+	}
+	for id, v := range d.invoices {
+		c.invoices[id] = v
+	}
+	for id, v := range d.notifications {
+		c.notifications[id] = v
+	}
+	for id, v := range d.tokens {
+		c.tokens[id] = v
+	}
+	for id, v := range d.deletedCustomers {
+		c.deletedCustomers[id] = v
+	}
+	for id, v := range d.deletedProducts {
+		c.deletedProducts[id] = v
+	}
+	for id, v := range d.deletedOrders {
+		c.deletedOrders[id] = v.clone()
+	}
+	return c
+}
+
+func (s *MemoryStore) newID() uint {
+	s.data.nextID++
+	return s.data.nextID
+}
+
+type memoryCustomers struct{ s *MemoryStore }
+
+func (r memoryCustomers) CreateCustomer(ctx context.Context, customer *models.Customer) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.allCustomers() {
+		if existing.Email == customer.Email {
+			return apperrors.Conflict("customer already exists", nil)
+		}
+	}
+	now := time.Now()
+	customer.ID = r.s.newID()
+	customer.CreatedAt, customer.UpdatedAt = now, now
+	r.s.data.customers[customer.ID] = *customer
+	return nil
+}
+
+func (r memoryCustomers) GetCustomer(ctx context.Context, id uint) (*models.Customer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	customer, ok := r.s.data.customers[id]
+	if !ok {
+		return nil, apperrors.NotFound("customer not found", nil)
+	}
+	return &customer, nil
+}
+
+func (r memoryCustomers) GetCustomerByEmail(ctx context.Context, email string) (*models.Customer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var found *models.Customer
+	for _, customer := range r.s.data.customers {
+		if strings.EqualFold(customer.Email, email) && (found == nil || customer.ID < found.ID) {
+			found = &customer
+		}
+	}
+	if found == nil {
+		return nil, apperrors.NotFound("customer not found", nil)
+	}
+	return found, nil
+}
+
+func (r memoryCustomers) SetPassword(ctx context.Context, id uint, hash string, changedAt time.Time) error {
+	return r.update(ctx, id, func(customer *models.Customer) {
+		customer.PasswordHash = hash
+		customer.PasswordChangedAt = &changedAt
+		customer.TokenVersion++
+	})
+}
+
+func (r memoryCustomers) VerifyEmail(ctx context.Context, id uint, verifiedAt time.Time) error {
+	return r.update(ctx, id, func(customer *models.Customer) {
+		customer.EmailVerifiedAt = &verifiedAt
+	})
+}
+
+func (r memoryCustomers) EraseCustomer(ctx context.Context, id uint, erasedAt time.Time) error {
+	return r.update(ctx, id, func(customer *models.Customer) {
+		customer.Name = models.ErasedName
+		customer.Email = models.ErasedEmail(id)
+		customer.PasswordHash = ""
+		customer.PasswordChangedAt = &erasedAt
+		customer.TokenVersion++
+		customer.EmailVerifiedAt = nil
+		customer.ErasedAt = &erasedAt
+	})
+}
+
+func (r memoryCustomers) update(ctx context.Context, id uint, fn func(*models.Customer)) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	customer, ok := r.s.data.customers[id]
+	if !ok {
+		return apperrors.NotFound("customer not found", nil)
+	}
+	fn(&customer)
+	customer.UpdatedAt = time.Now()
+	r.s.data.customers[id] = customer
+	return nil
+}
+
+func (r memoryCustomers) DeleteCustomer(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	customer, ok := r.s.data.customers[id]
+	if !ok {
+		return apperrors.NotFound("customer not found", nil)
+	}
+	for _, stored := range r.s.data.orders {
+		if stored.order.CustomerID == id && stored.order.Open() {
+			return apperrors.Conflict("customer has orders that are still in progress; deliver or cancel them first", nil)
+		}
+	}
+	customer.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	delete(r.s.data.customers, id)
+	r.s.data.deletedCustomers[id] = customer
+	return nil
+}
+
+func (r memoryCustomers) RestoreCustomer(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	customer, ok := r.s.data.deletedCustomers[id]
+	if !ok {
+		return apperrors.NotFound("deleted customer not found", nil)
+	}
+	customer.DeletedAt = gorm.DeletedAt{}
+	customer.UpdatedAt = time.Now()
+	delete(r.s.data.deletedCustomers, id)
+	r.s.data.customers[id] = customer
+	return nil
+}
+
+func (r memoryCustomers) PurgeCustomers(ctx context.Context, cutoff time.Time) ([]uint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	kept := make(map[uint]bool)
+	for _, orders := range []map[uint]memoryOrder{r.s.data.orders, r.s.data.deletedOrders} {
+		for _, stored := range orders {
+			kept[stored.order.CustomerID] = true
+		}
+	}
+	var ids []uint
+	for id, customer := range r.s.data.deletedCustomers {
+		if customer.DeletedAt.Time.Before(cutoff) && !kept[id] {
+			ids = append(ids, id)
+		}
+	}
+	sortByID(ids, func(id uint) uint { return id })
+	for _, id := range ids {
+		delete(r.s.data.deletedCustomers, id)
+		for addressID, address := range r.s.data.addresses {
+			if address.CustomerID == id {
+				delete(r.s.data.addresses, addressID)
+			}
+		}
+		for notificationID, notification := range r.s.data.notifications {
+			if notification.CustomerID == id {
+				delete(r.s.data.notifications, notificationID)
+			}
+		}
+		for tokenID, token := range r.s.data.tokens {
+			if token.CustomerID == id {
+				delete(r.s.data.tokens, tokenID)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// allCustomers returns every customer, deleted or not.
+func (s *MemoryStore) allCustomers() map[uint]models.Customer {
+	customers := maps.Clone(s.data.customers)
+	maps.Copy(customers, s.data.deletedCustomers)
+	return customers
+}
+
+type memoryProducts struct{ s *MemoryStore }
+
+func (r memoryProducts) CreateProduct(ctx context.Context, product *models.Product) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	taken := make(map[string]bool)
+	for _, existing := range r.s.allProducts() {
+		taken[existing.SKU] = true
+		for _, variant := range existing.Variants {
+			taken[variant.SKU] = true
+		}
+	}
+	skus := []string{product.SKU}
+	for _, variant := range product.Variants {
+		skus = append(skus, variant.SKU)
+	}
+	for _, sku := range skus {
+		if sku != "" && taken[sku] {
+			return apperrors.Conflict("SKU "+sku+" is already in use", nil)
+		}
+	}
+
+	now := time.Now()
+	product.ID = r.s.newID()
+	product.CreatedAt, product.UpdatedAt = now, now
+	if product.Status == "" {
+		product.Status = models.ProductActive
+	}
+	for i := range product.Variants {
+		product.Variants[i].ID = r.s.newID()
+		product.Variants[i].ProductID = product.ID
+	}
+	r.s.data.products[product.ID] = copyProduct(*product)
+	return nil
+}
+
+func (r memoryProducts) GetProduct(ctx context.Context, id uint) (*models.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	product, ok := r.s.data.products[id]
+	if !ok {
+		return nil, apperrors.NotFound("product not found", nil)
+	}
+	product = copyProduct(product)
+	return &product, nil
+}
+
+func (r memoryProducts) SearchProducts(ctx context.Context, q models.ProductQuery) ([]models.Product, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	products := r.s.data.products
+	if q.IncludeDeleted {
+		products = r.s.allProducts()
+	}
+	search := strings.ToLower(q.Search)
+	var matches []models.Product
+	for _, product := range products {
+		switch {
+		case q.Status != "all" && product.Status != q.Status,
+			search != "" && !strings.Contains(strings.ToLower(product.Name), search) &&
+				!strings.Contains(strings.ToLower(product.Description), search) &&
+				product.SKU != models.NormalizeSKU(q.Search),
+			q.Category != "" && !strings.EqualFold(product.Category, q.Category),
+			q.Tag != "" && !hasTag(product.Tags, strings.ToLower(q.Tag)),
+			q.MinPrice != nil && product.Price < *q.MinPrice,
+			q.MaxPrice != nil && product.Price > *q.MaxPrice:
+			continue
+		}
+		matches = append(matches, copyProduct(product))
+	}
+
+	sortByID(matches, func(p models.Product) uint { return p.ID })
+	less := map[string]func(a, b models.Product) bool{
+		"name":        func(a, b models.Product) bool { return a.Name < b.Name },
+		"-name":       func(a, b models.Product) bool { return a.Name > b.Name },
+		"price":       func(a, b models.Product) bool { return a.Price < b.Price },
+		"-price":      func(a, b models.Product) bool { return a.Price > b.Price },
+		"created_at":  func(a, b models.Product) bool { return a.CreatedAt.Before(b.CreatedAt) },
+		"-created_at": func(a, b models.Product) bool { return a.CreatedAt.After(b.CreatedAt) },
+	}[q.Sort]
+	if less != nil {
+		sort.SliceStable(matches, func(i, j int) bool { return less(matches[i], matches[j]) })
+	}
+
+	total := int64(len(matches))
+	from := (q.Page - 1) * q.PerPage
+	if from >= len(matches) {
+		return nil, total, nil
+	}
+	to := from + q.PerPage
+	if to > len(matches) {
+		to = len(matches)
+	}
+	return matches[from:to], total, nil
+}
+
+func (r memoryProducts) UpdateProductStatus(ctx context.Context, id uint, status string) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	product, ok := r.s.data.products[id]
+	if !ok {
+		return apperrors.NotFound("product not found", nil)
+	}
+	product.Status = status
+	product.UpdatedAt = time.Now()
+	r.s.data.products[id] = product
+	return nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (r memoryProducts) GetAllProducts(ctx context.Context) ([]models.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	products := make([]models.Product, 0, len(r.s.data.products))
+	for _, product := range r.s.data.products {
+		products = append(products, copyProduct(product))
+	}
+	sortByID(products, func(p models.Product) uint { return p.ID })
+	return products, nil
+}
+
+func (r memoryProducts) DeleteProduct(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	product, ok := r.s.data.products[id]
+	if !ok {
+		return apperrors.NotFound("product not found", nil)
+	}
+	for _, stored := range r.s.data.orders {
+		if stored.order.Open() && stored.includes(id) {
+			return apperrors.Conflict("product is on orders that are still in progress; archive it to stop new orders", nil)
+		}
+	}
+	product.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	delete(r.s.data.products, id)
+	r.s.data.deletedProducts[id] = product
+	return nil
+}
+
+func (r memoryProducts) RestoreProduct(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	product, ok := r.s.data.deletedProducts[id]
+	if !ok {
+		return apperrors.NotFound("deleted product not found", nil)
+	}
+	product.DeletedAt = gorm.DeletedAt{}
+	product.UpdatedAt = time.Now()
+	delete(r.s.data.deletedProducts, id)
+	r.s.data.products[id] = product
+	return nil
+}
+
+func (r memoryProducts) PurgeProducts(ctx context.Context, cutoff time.Time) ([]uint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var ids []uint
+	for id, product := range r.s.data.deletedProducts {
+		if product.DeletedAt.Time.Before(cutoff) && !r.s.ordered(id) {
+			ids = append(ids, id)
+		}
+	}
+	sortByID(ids, func(id uint) uint { return id })
+	for _, id := range ids {
+		delete(r.s.data.deletedProducts, id)
+	}
+	return ids, nil
+}
+
+// allProducts returns every product, deleted or not.
+func (s *MemoryStore) allProducts() map[uint]models.Product {
+	products := maps.Clone(s.data.products)
+	maps.Copy(products, s.data.deletedProducts)
+	return products
+}
+
+// ordered reports whether any order, deleted or not, includes the product.
+func (s *MemoryStore) ordered(productID uint) bool {
+	for _, orders := range []map[uint]memoryOrder{s.data.orders, s.data.deletedOrders} {
+		for _, stored := range orders {
+			if stored.includes(productID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type memoryOrders struct{ s *MemoryStore }
+
+func (r memoryOrders) CreateOrder(ctx context.Context, order *models.Order) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	ids := make([]uint, 0, len(order.Products))
+	for _, product := range order.Products {
+		if _, ok := r.s.data.products[product.ID]; !ok {
+			return apperrors.Validation("order references a record that does not exist")
+		}
+		ids = append(ids, product.ID)
+	}
+
+	// Work out every product's remaining stock before changing any, so a
+	// short line leaves stock untouched.
+	remaining := make(map[stockKey]int)
+	for _, item := range order.Items {
+		key := stockKey{item.ProductID, item.VariantID}
+		stock, ok := r.s.stock(key)
+		if ok && stock == nil {
+			continue
+		}
+		available, seen := remaining[key]
+		if !seen && ok {
+			available = *stock
+		}
+		if !ok || available < item.Quantity {
+			return apperrors.Conflict("insufficient stock for "+item.Name, nil)
+		}
+		remaining[key] = available - item.Quantity
+	}
+	for key, stock := range remaining {
+		r.s.setStock(key, stock)
+	}
+
+	if order.Status == "" {
+		order.Status = models.OrderPending
+	}
+	now := time.Now()
+	order.ID = r.s.newID()
+	order.CreatedAt, order.UpdatedAt = now, now
+	for i := range order.Discounts {
+		order.Discounts[i].ID = r.s.newID()
+		order.Discounts[i].OrderID = order.ID
+		order.Discounts[i].CreatedAt = now
+	}
+	for i := range order.Items {
+		order.Items[i].ID = r.s.newID()
+		order.Items[i].OrderID = order.ID
+	}
+
+	stored := *order
+	stored.Products = nil
+	stored.Discounts = append([]models.OrderDiscount(nil), order.Discounts...)
+	stored.Items = append([]models.OrderItem(nil), order.Items...)
+	r.s.data.orders[order.ID] = memoryOrder{order: stored, productIDs: ids}
+	return nil
+}
+
+func (r memoryOrders) GetOrder(ctx context.Context, id uint) (*models.Order, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.data.orders[id]
+	if !ok {
+		return nil, apperrors.NotFound("order not found", nil)
+	}
+	order := r.read(stored)
+	return &order, nil
+}
+
+// read returns a copy of the stored order with its products resolved, as
+// the database returns it.
+func (r memoryOrders) read(stored memoryOrder) models.Order {
+	order := stored.order
+	order.Discounts = append([]models.OrderDiscount(nil), stored.order.Discounts...)
+	order.Items = append([]models.OrderItem(nil), stored.order.Items...)
+	for _, productID := range stored.productIDs {
+		product, ok := r.s.data.products[productID]
+		if !ok {
+			product = r.s.data.deletedProducts[productID]
+		}
+		order.Products = append(order.Products, copyProduct(product))
+	}
+	order.AfterFind(nil)
+	return order
+}
+
+func (r memoryOrders) ListCustomerOrders(ctx context.Context, customerID uint, page, perPage int) ([]models.Order, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var orders []models.Order
+	for _, stored := range r.s.data.orders {
+		if stored.order.CustomerID == customerID {
+			orders = append(orders, r.read(stored))
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		if !orders[i].CreatedAt.Equal(orders[j].CreatedAt) {
+			return orders[i].CreatedAt.After(orders[j].CreatedAt)
+		}
+		return orders[i].ID > orders[j].ID
+	})
+	total := int64(len(orders))
+	from := min((page-1)*perPage, len(orders))
+	to := min(from+perPage, len(orders))
+	return orders[from:to], total, nil
+}
+
+func (r memoryOrders) CustomerOrderIDs(ctx context.Context, customerID uint) ([]uint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var ids []uint
+	for _, orders := range []map[uint]memoryOrder{r.s.data.orders, r.s.data.deletedOrders} {
+		for id, stored := range orders {
+			if stored.order.CustomerID == customerID {
+				ids = append(ids, id)
+			}
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (r memoryOrders) EraseShippingAddresses(ctx context.Context, customerID uint) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, orders := range []map[uint]memoryOrder{r.s.data.orders, r.s.data.deletedOrders} {
+		for id, stored := range orders {
+			if stored.order.CustomerID == customerID {
+				address := &stored.order.ShippingAddress
+				address.Recipient, address.Street, address.Phone = "", "", ""
+				stored.order.UpdatedAt = time.Now()
+				orders[id] = stored
+			}
+		}
+	}
+	return nil
+}
+
+func (r memoryOrders) GetOrderIncludingDeleted(ctx context.Context, id uint) (*models.Order, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.data.orders[id]
+	if !ok {
+		stored, ok = r.s.data.deletedOrders[id]
+	}
+	if !ok {
+		return nil, apperrors.NotFound("order not found", nil)
+	}
+	order := r.read(stored)
+	return &order, nil
+}
+
+func (r memoryOrders) DeleteOrder(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.data.orders[id]
+	switch {
+	case !ok:
+		return apperrors.NotFound("order not found", nil)
+	case stored.order.Open():
+		return apperrors.Conflict("order is still in progress; deliver or cancel it first", nil)
+	}
+	stored.order.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	delete(r.s.data.orders, id)
+	r.s.data.deletedOrders[id] = stored
+	return nil
+}
+
+func (r memoryOrders) RestoreOrder(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.data.deletedOrders[id]
+	if !ok {
+		return apperrors.NotFound("deleted order not found", nil)
+	}
+	stored.order.DeletedAt = gorm.DeletedAt{}
+	stored.order.UpdatedAt = time.Now()
+	delete(r.s.data.deletedOrders, id)
+	r.s.data.orders[id] = stored
+	return nil
+}
+
+func (r memoryOrders) PurgeOrders(ctx context.Context, cutoff time.Time) ([]uint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	kept := make(map[uint]bool)
+	for _, invoice := range r.s.data.invoices {
+		kept[invoice.OrderID] = true
+	}
+	for _, shipment := range r.s.data.shipments {
+		kept[shipment.OrderID] = true
+	}
+	var ids []uint
+	for id, stored := range r.s.data.deletedOrders {
+		order := stored.order
+		if order.DeletedAt.Time.Before(cutoff) && order.PaidAt == nil && order.PaymentReference == "" && !kept[id] {
+			ids = append(ids, id)
+		}
+	}
+	sortByID(ids, func(id uint) uint { return id })
+	for _, id := range ids {
+		delete(r.s.data.deletedOrders, id)
+		for notificationID, notification := range r.s.data.notifications {
+			if notification.OrderID != nil && *notification.OrderID == id {
+				delete(r.s.data.notifications, notificationID)
+			}
+		}
+	}
+	return ids, nil
+}
+
+func (r memoryOrders) UpdateOrderStatus(ctx context.Context, id uint, status string) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	// Like the SQL update, a missing order is not an error.
+	if stored, ok := r.s.data.orders[id]; ok && stored.order.Status != status {
+		if !models.CanTransition(stored.order.Status, status) {
+			return apperrors.Conflict("order cannot move from "+stored.order.Status+" to "+status, nil)
+		}
+		if status == models.OrderCancelled {
+			for _, item := range stored.order.Items {
+				key := stockKey{item.ProductID, item.VariantID}
+				if stock, ok := r.s.stock(key); ok && stock != nil {
+					r.s.setStock(key, *stock+item.Quantity)
+				}
+			}
+			for _, discount := range stored.order.Discounts {
+				if promotion, ok := r.s.data.promotions[discount.PromotionID]; ok && promotion.UsageCount > 0 {
+					promotion.UsageCount--
+					r.s.data.promotions[discount.PromotionID] = promotion
+				}
+			}
+		}
+		stored.order.Status = status
+		stored.order.UpdatedAt = time.Now()
+		r.s.data.orders[id] = stored
+	}
+	return nil
+}
+
+func (r memoryOrders) RecordPayment(ctx context.Context, id uint, reference string, paidAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.data.orders[id]
+	if !ok {
+		return apperrors.NotFound("order not found", nil)
+	}
+	stored.order.PaymentReference = reference
+	stored.order.PaidAt = &paidAt
+	stored.order.UpdatedAt = time.Now()
+	r.s.data.orders[id] = stored
+	return nil
+}
+
+func (r memoryOrders) RepriceOrder(ctx context.Context, order *models.Order) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.data.orders[order.ID]
+	if !ok {
+		return apperrors.NotFound("order not found", nil)
+	}
+	for i := range order.Items {
+		if order.Items[i].ID == 0 {
+			order.Items[i].ID = r.s.newID()
+		}
+		order.Items[i].OrderID = order.ID
+	}
+	amounts := make(map[uint]float64, len(order.Discounts))
+	for _, discount := range order.Discounts {
+		amounts[discount.ID] = discount.Amount
+	}
+	discounts := append([]models.OrderDiscount(nil), stored.order.Discounts...)
+	for i := range discounts {
+		if amount, ok := amounts[discounts[i].ID]; ok {
+			discounts[i].Amount = amount
+		}
+	}
+	stored.order.Discounts = discounts
+	stored.order.Items = append([]models.OrderItem(nil), order.Items...)
+	stored.order.Currency = order.Currency
+	stored.order.Discount = order.Discount
+	stored.order.TaxAmount = order.TaxAmount
+	stored.order.ShippingFee = order.ShippingFee
+	stored.order.UpdatedAt = time.Now()
+	r.s.data.orders[order.ID] = stored
+	return nil
+}
+
+func (r memoryOrders) ApplyDiscounts(ctx context.Context, order *models.Order, discounts []models.OrderDiscount) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.data.orders[order.ID]
+	if !ok {
+		return apperrors.Validation("order references a record that does not exist")
+	}
+	now := time.Now()
+	for i := range discounts {
+		discounts[i].ID = r.s.newID()
+		discounts[i].OrderID = order.ID
+		discounts[i].CreatedAt = now
+	}
+	for i := range order.Items {
+		if order.Items[i].ID == 0 {
+			order.Items[i].ID = r.s.newID()
+		}
+		order.Items[i].OrderID = order.ID
+	}
+	stored.order.Discounts = append(append([]models.OrderDiscount(nil), stored.order.Discounts...), discounts...)
+	stored.order.Items = append([]models.OrderItem(nil), order.Items...)
+	stored.order.Discount = order.Discount
+	stored.order.TaxAmount = order.TaxAmount
+	stored.order.UpdatedAt = now
+	r.s.data.orders[order.ID] = stored
+	return nil
+}
+
+type memoryPromotions struct{ s *MemoryStore }
+
+func (r memoryPromotions) CreatePromotion(ctx context.Context, promotion *models.Promotion) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.data.promotions {
+		if existing.Code == promotion.Code {
+			return apperrors.Conflict("promotion already exists", nil)
+		}
+	}
+	now := time.Now()
+	promotion.ID = r.s.newID()
+	promotion.CreatedAt, promotion.UpdatedAt = now, now
+	r.s.data.promotions[promotion.ID] = *promotion
+	return nil
+}
+
+func (r memoryPromotions) GetPromotionByCode(ctx context.Context, code string) (*models.Promotion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, promotion := range r.s.data.promotions {
+		if promotion.Code == code {
+			return &promotion, nil
+		}
+	}
+	return nil, apperrors.NotFound("promotion not found", nil)
+}
+
+func (r memoryPromotions) GetAllPromotions(ctx context.Context) ([]models.Promotion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	promotions := make([]models.Promotion, 0, len(r.s.data.promotions))
+	for _, promotion := range r.s.data.promotions {
+		promotions = append(promotions, promotion)
+	}
+	sortByID(promotions, func(p models.Promotion) uint { return p.ID })
+	return promotions, nil
+}
+
+func (r memoryPromotions) CountCustomerRedemptions(ctx context.Context, promotionID, customerID uint) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var count int64
+	for _, stored := range r.s.data.orders {
+		if stored.order.CustomerID != customerID || stored.order.Status == models.OrderCancelled {
+			continue
+		}
+		for _, discount := range stored.order.Discounts {
+			if discount.PromotionID == promotionID {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+func (r memoryPromotions) Redeem(ctx context.Context, promotionID uint) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	promotion, ok := r.s.data.promotions[promotionID]
+	if !ok || (promotion.UsageLimit > 0 && promotion.UsageCount >= promotion.UsageLimit) {
+		return apperrors.Conflict("coupon usage limit reached", nil)
+	}
+	promotion.UsageCount++
+	r.s.data.promotions[promotionID] = promotion
+	return nil
+}
+
+type memoryCarts struct{ s *MemoryStore }
+
+func (r memoryCarts) CreateCart(ctx context.Context, cart *models.Cart) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if cart.Status == "" {
+		cart.Status = models.CartOpen
+	}
+	now := time.Now()
+	cart.ID = r.s.newID()
+	cart.CreatedAt, cart.UpdatedAt = now, now
+	r.s.setItemIDs(cart)
+	r.s.data.carts[cart.ID] = copyCart(*cart)
+	return nil
+}
+
+func (r memoryCarts) GetCart(ctx context.Context, id uint) (*models.Cart, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	cart, ok := r.s.data.carts[id]
+	if !ok {
+		return nil, apperrors.NotFound("cart not found", nil)
+	}
+	cart = copyCart(cart)
+	return &cart, nil
+}
+
+func (r memoryCarts) SaveCart(ctx context.Context, cart *models.Cart) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.data.carts[cart.ID]
+	if !ok {
+		return apperrors.NotFound("cart not found", nil)
+	}
+	for i := range cart.Items {
+		cart.Items[i].ID = 0
+	}
+	r.s.setItemIDs(cart)
+	stored.CustomerID = cart.CustomerID
+	stored.CouponCodes = cart.CouponCodes
+	stored.ExpiresAt = cart.ExpiresAt
+	stored.Items = cart.Items
+	stored.UpdatedAt = time.Now()
+	r.s.data.carts[cart.ID] = copyCart(stored)
+	return nil
+}
+
+func (r memoryCarts) CheckOut(ctx context.Context, id, orderID uint) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	cart, ok := r.s.data.carts[id]
+	if !ok || cart.Status != models.CartOpen {
+		return apperrors.Conflict("cart has already been checked out", nil)
+	}
+	cart.Status = models.CartCheckedOut
+	cart.OrderID = &orderID
+	cart.UpdatedAt = time.Now()
+	r.s.data.carts[id] = cart
+	return nil
+}
+
+func (r memoryCarts) DeleteExpiredCarts(ctx context.Context, cutoff time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var deleted int64
+	for id, cart := range r.s.data.carts {
+		if cart.Status == models.CartOpen && cart.ExpiresAt.Before(cutoff) {
+			delete(r.s.data.carts, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+type memoryAddresses struct{ s *MemoryStore }
+
+func (r memoryAddresses) CreateAddress(ctx context.Context, address *models.Address) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.data.customers[address.CustomerID]; !ok {
+		return apperrors.Validation("address references a record that does not exist")
+	}
+	now := time.Now()
+	address.ID = r.s.newID()
+	address.CreatedAt, address.UpdatedAt = now, now
+	r.s.data.addresses[address.ID] = *address
+	return nil
+}
+
+func (r memoryAddresses) GetAddress(ctx context.Context, id uint) (*models.Address, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	address, ok := r.s.data.addresses[id]
+	if !ok {
+		return nil, apperrors.NotFound("address not found", nil)
+	}
+	return &address, nil
+}
+
+func (r memoryAddresses) ListAddresses(ctx context.Context, customerID uint) ([]models.Address, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var addresses []models.Address
+	for _, address := range r.s.data.addresses {
+		if address.CustomerID == customerID {
+			addresses = append(addresses, address)
+		}
+	}
+	sortByID(addresses, func(a models.Address) uint { return a.ID })
+	return addresses, nil
+}
+
+func (r memoryAddresses) UpdateAddress(ctx context.Context, address *models.Address) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.data.addresses[address.ID]
+	if !ok {
+		return apperrors.NotFound("address not found", nil)
+	}
+	stored.Label, stored.Recipient = address.Label, address.Recipient
+	stored.County, stored.Town, stored.Street = address.County, address.Town, address.Street
+	stored.Phone = address.Phone
+	stored.UpdatedAt = time.Now()
+	r.s.data.addresses[address.ID] = stored
+	*address = stored
+	return nil
+}
+
+func (r memoryAddresses) DeleteAddress(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.data.addresses[id]; !ok {
+		return apperrors.NotFound("address not found", nil)
+	}
+	delete(r.s.data.addresses, id)
+	return nil
+}
+
+func (r memoryAddresses) DeleteCustomerAddresses(ctx context.Context, customerID uint) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, address := range r.s.data.addresses {
+		if address.CustomerID == customerID {
+			delete(r.s.data.addresses, id)
+		}
+	}
+	return nil
+}
+
+// PurgeAddresses has nothing to do: the memory store removes deleted
+// addresses straight away.
+func (r memoryAddresses) PurgeAddresses(ctx context.Context, cutoff time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, apperrors.Upstream("database unavailable", err)
+	}
+	return 0, nil
+}
+
+type memoryShipping struct{ s *MemoryStore }
+
+func (r memoryShipping) CreateShippingMethod(ctx context.Context, method *models.ShippingMethod) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.data.shipping {
+		if existing.Code == method.Code {
+			return apperrors.Conflict("shipping method already exists", nil)
+		}
+	}
+	now := time.Now()
+	method.ID = r.s.newID()
+	method.CreatedAt, method.UpdatedAt = now, now
+	r.s.setRateIDs(method)
+	r.s.data.shipping[method.ID] = copyShippingMethod(*method)
+	return nil
+}
+
+func (r memoryShipping) GetShippingMethod(ctx context.Context, code string) (*models.ShippingMethod, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, method := range r.s.data.shipping {
+		if method.Code == code {
+			method = copyShippingMethod(method)
+			return &method, nil
+		}
+	}
+	return nil, apperrors.NotFound("shipping method not found", nil)
+}
+
+func (r memoryShipping) GetAllShippingMethods(ctx context.Context) ([]models.ShippingMethod, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	methods := make([]models.ShippingMethod, 0, len(r.s.data.shipping))
+	for _, method := range r.s.data.shipping {
+		methods = append(methods, copyShippingMethod(method))
+	}
+	sortByID(methods, func(m models.ShippingMethod) uint { return m.ID })
+	return methods, nil
+}
+
+func (r memoryShipping) SaveShippingMethod(ctx context.Context, method *models.ShippingMethod) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.data.shipping[method.ID]
+	if !ok {
+		return apperrors.NotFound("shipping method not found", nil)
+	}
+	for i := range method.Rates {
+		method.Rates[i].ID = 0
+	}
+	r.s.setRateIDs(method)
+	stored.Name, stored.Pickup = method.Name, method.Pickup
+	stored.Currency, stored.Disabled = method.Currency, method.Disabled
+	stored.Rates = method.Rates
+	stored.UpdatedAt = time.Now()
+	r.s.data.shipping[method.ID] = copyShippingMethod(stored)
+	return nil
+}
+
+// setRateIDs assigns IDs to new shipping rates and points them at the
+// method.
+func (s *MemoryStore) setRateIDs(method *models.ShippingMethod) {
+	for i := range method.Rates {
+		if method.Rates[i].ID == 0 {
+			method.Rates[i].ID = s.newID()
+		}
+		method.Rates[i].ShippingMethodID = method.ID
+	}
+}
+
+func copyShippingMethod(method models.ShippingMethod) models.ShippingMethod {
+	rates := make([]models.ShippingRate, len(method.Rates))
+	for i, rate := range method.Rates {
+		rate.Counties = append([]string(nil), rate.Counties...)
+		if rate.MaxWeight != nil {
+			max := *rate.MaxWeight
+			rate.MaxWeight = &max
+		}
+		rates[i] = rate
+	}
+	method.Rates = rates
+	return method
+}
+
+type memoryShipments struct{ s *MemoryStore }
+
+func (r memoryShipments) CreateShipment(ctx context.Context, shipment *models.Shipment) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.data.orders[shipment.OrderID]; !ok {
+		return apperrors.Validation("shipment references a record that does not exist")
+	}
+	if shipment.Status == "" {
+		shipment.Status = models.ShipmentPending
+	}
+	now := time.Now()
+	shipment.ID = r.s.newID()
+	shipment.CreatedAt, shipment.UpdatedAt = now, now
+	for i := range shipment.Items {
+		shipment.Items[i].ID = r.s.newID()
+		shipment.Items[i].ShipmentID = shipment.ID
+	}
+	r.s.data.shipments[shipment.ID] = copyShipment(*shipment)
+	return nil
+}
+
+func (r memoryShipments) GetShipment(ctx context.Context, id uint) (*models.Shipment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	shipment, ok := r.s.data.shipments[id]
+	if !ok {
+		return nil, apperrors.NotFound("shipment not found", nil)
+	}
+	shipment = copyShipment(shipment)
+	return &shipment, nil
+}
+
+func (r memoryShipments) ListShipments(ctx context.Context, orderID uint) ([]models.Shipment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var shipments []models.Shipment
+	for _, shipment := range r.s.data.shipments {
+		if shipment.OrderID == orderID {
+			shipments = append(shipments, copyShipment(shipment))
+		}
+	}
+	sortByID(shipments, func(s models.Shipment) uint { return s.ID })
+	return shipments, nil
+}
+
+func (r memoryShipments) UpdateShipment(ctx context.Context, shipment *models.Shipment) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.data.shipments[shipment.ID]
+	if !ok {
+		return apperrors.NotFound("shipment not found", nil)
+	}
+	stored.Carrier, stored.TrackingNumber = shipment.Carrier, shipment.TrackingNumber
+	stored.Status = shipment.Status
+	stored.ShippedAt, stored.DeliveredAt = shipment.ShippedAt, shipment.DeliveredAt
+	stored.UpdatedAt = time.Now()
+	r.s.data.shipments[shipment.ID] = copyShipment(stored)
+	return nil
+}
+
+func copyShipment(shipment models.Shipment) models.Shipment {
+	shipment.Items = append([]models.ShipmentItem(nil), shipment.Items...)
+	if shipment.ShippedAt != nil {
+		at := *shipment.ShippedAt
+		shipment.ShippedAt = &at
+	}
+	if shipment.DeliveredAt != nil {
+		at := *shipment.DeliveredAt
+		shipment.DeliveredAt = &at
+	}
+	return shipment
+}
+
+// setItemIDs assigns IDs to new cart items and points them at the cart.
+func (s *MemoryStore) setItemIDs(cart *models.Cart) {
+	for i := range cart.Items {
+		if cart.Items[i].ID == 0 {
+			cart.Items[i].ID = s.newID()
+		}
+		cart.Items[i].CartID = cart.ID
+	}
+}
+
+func copyCart(cart models.Cart) models.Cart {
+	cart.Items = append([]models.CartItem(nil), cart.Items...)
+	cart.CouponCodes = append([]string(nil), cart.CouponCodes...)
+	cart.Totals = nil
+	if cart.OrderID != nil {
+		id := *cart.OrderID
+		cart.OrderID = &id
+	}
+	return cart
+}
+
+// stockKey identifies where a line's stock is held: the variant if it has
+// one, otherwise the product.
+type stockKey struct {
+	productID, variantID uint
+}
+
+// stock returns the tracked stock for key, and false if the product or
+// variant does not exist. The caller must hold s.mu.
+func (s *MemoryStore) stock(key stockKey) (*int, bool) {
+	product, ok := s.data.products[key.productID]
+	if !ok {
+		return nil, false
+	}
+	if key.variantID == 0 {
+		return product.Stock, true
+	}
+	variant := product.Variant(key.variantID)
+	if variant == nil {
+		return nil, false
+	}
+	return variant.Stock, true
+}
+
+// setStock stores n as the stock for key. Stored products are shared with
+// earlier snapshots, so the product is copied rather than changed in
+// place. The caller must hold s.mu.
+func (s *MemoryStore) setStock(key stockKey, n int) {
+	product := copyProduct(s.data.products[key.productID])
+	if key.variantID == 0 {
+		product.Stock = intPtr(n)
+	} else {
+		product.Variant(key.variantID).Stock = intPtr(n)
+	}
+	s.data.products[key.productID] = product
+}
+
+// copyProduct returns product with its own variants, tags and stock.
+func copyProduct(product models.Product) models.Product {
+	product.Tags = append([]string(nil), product.Tags...)
+	product.Variants = append([]models.ProductVariant(nil), product.Variants...)
+	if product.Stock != nil {
+		product.Stock = intPtr(*product.Stock)
+	}
+	for i := range product.Variants {
+		if stock := product.Variants[i].Stock; stock != nil {
+			product.Variants[i].Stock = intPtr(*stock)
+		}
+	}
+	return product
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func sortByID[T any](items []T, id func(T) uint) {
+	sort.Slice(items, func(i, j int) bool { return id(items[i]) < id(items[j]) })
+}
+
+type memoryInvoices struct{ s *MemoryStore }
+
+func (r memoryInvoices) IssueInvoice(ctx context.Context, orderID uint) (*models.Invoice, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, invoice := range r.s.data.invoices {
+		if invoice.OrderID == orderID {
+			return &invoice, nil
+		}
+	}
+	if _, ok := r.s.data.orders[orderID]; !ok {
+		return nil, apperrors.Validation("invoice references a record that does not exist")
+	}
+	r.s.data.invoiceSeq++
+	invoice := models.Invoice{
+		ID:        r.s.newID(),
+		CreatedAt: time.Now(),
+		OrderID:   orderID,
+		Sequence:  r.s.data.invoiceSeq,
+		Number:    models.InvoiceNumber(r.s.data.invoiceSeq),
+	}
+	r.s.data.invoices[invoice.ID] = invoice
+	return &invoice, nil
+}
+
+func (r memoryInvoices) GetInvoice(ctx context.Context, orderID uint) (*models.Invoice, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, invoice := range r.s.data.invoices {
+		if invoice.OrderID == orderID {
+			return &invoice, nil
+		}
+	}
+	return nil, apperrors.NotFound("invoice not found", nil)
+}
+
+type memoryNotifications struct{ s *MemoryStore }
+
+func (r memoryNotifications) CreateNotification(ctx context.Context, notification *models.Notification) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	_, ok := r.s.data.customers[notification.CustomerID]
+	if notification.OrderID != nil {
+		_, ok = r.s.data.orders[*notification.OrderID]
+	}
+	if !ok {
+		return apperrors.Validation("notification references a record that does not exist")
+	}
+	if notification.Status == "" {
+		notification.Status = models.NotificationPending
+	}
+	now := time.Now()
+	notification.ID = r.s.newID()
+	notification.CreatedAt, notification.UpdatedAt = now, now
+	r.s.data.notifications[notification.ID] = *notification
+	return nil
+}
+
+func (r memoryNotifications) GetNotification(ctx context.Context, id uint) (*models.Notification, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	notification, ok := r.s.data.notifications[id]
+	if !ok {
+		return nil, apperrors.NotFound("notification not found", nil)
+	}
+	return &notification, nil
+}
+
+func (r memoryNotifications) ListNotifications(ctx context.Context, orderID uint) ([]models.Notification, error) {
+	return r.list(ctx, 0, func(n models.Notification) bool { return n.OrderID != nil && *n.OrderID == orderID })
+}
+
+func (r memoryNotifications) DueNotifications(ctx context.Context, now time.Time, limit int) ([]models.Notification, error) {
+	return r.list(ctx, limit, func(n models.Notification) bool {
+		return n.Status == models.NotificationPending && n.NextAttemptAt != nil && !n.NextAttemptAt.After(now)
+	})
+}
+
+// list returns up to limit notifications matching keep, oldest first. A
+// zero limit returns them all.
+func (r memoryNotifications) list(ctx context.Context, limit int, keep func(models.Notification) bool) ([]models.Notification, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var notifications []models.Notification
+	for _, notification := range r.s.data.notifications {
+		if keep(notification) {
+			notifications = append(notifications, notification)
+		}
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].ID < notifications[j].ID })
+	if limit > 0 && len(notifications) > limit {
+		notifications = notifications[:limit]
+	}
+	return notifications, nil
+}
+
+func (r memoryNotifications) UpdateNotification(ctx context.Context, notification *models.Notification) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.data.notifications[notification.ID]
+	if !ok {
+		return apperrors.NotFound("notification not found", nil)
+	}
+	stored.Status = notification.Status
+	stored.Attempts = notification.Attempts
+	stored.LastError = notification.LastError
+	stored.NextAttemptAt = notification.NextAttemptAt
+	stored.SentAt = notification.SentAt
+	stored.UpdatedAt = time.Now()
+	r.s.data.notifications[notification.ID] = stored
+	return nil
+}
+
+func (r memoryNotifications) ListCustomerNotifications(ctx context.Context, customerID uint) ([]models.Notification, error) {
+	return r.list(ctx, 0, func(n models.Notification) bool { return n.CustomerID == customerID })
+}
+
+func (r memoryNotifications) EraseNotifications(ctx context.Context, customerID uint, reason string) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, notification := range r.s.data.notifications {
+		if notification.CustomerID != customerID {
+			continue
+		}
+		if notification.Status == models.NotificationPending {
+			notification.Status = models.NotificationFailed
+			notification.LastError = reason
+			notification.NextAttemptAt = nil
+		}
+		notification.Recipient, notification.Body = "", ""
+		notification.UpdatedAt = time.Now()
+		r.s.data.notifications[id] = notification
+	}
+	return nil
+}
+
+type memoryTokens struct{ s *MemoryStore }
+
+func (r memoryTokens) CreateToken(ctx context.Context, token *models.CustomerToken) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.data.customers[token.CustomerID]; !ok {
+		return apperrors.Validation("token references a record that does not exist")
+	}
+	for _, existing := range r.s.data.tokens {
+		if existing.TokenHash == token.TokenHash {
+			return apperrors.Conflict("token already exists", nil)
+		}
+	}
+	token.ID = r.s.newID()
+	token.CreatedAt = time.Now()
+	r.s.data.tokens[token.ID] = *token
+	return nil
+}
+
+func (r memoryTokens) UseToken(ctx context.Context, purpose, hash string, now time.Time) (*models.CustomerToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, token := range r.s.data.tokens {
+		if token.TokenHash == hash && token.Purpose == purpose && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			token.UsedAt = &now
+			r.s.data.tokens[id] = token
+			return &token, nil
+		}
+	}
+	return nil, apperrors.NotFound("token is invalid or has expired", nil)
+}
+
+func (r memoryTokens) DeleteCustomerTokens(ctx context.Context, customerID uint) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, token := range r.s.data.tokens {
+		if token.CustomerID == customerID {
+			delete(r.s.data.tokens, id)
+		}
+	}
+	return nil
+}
+
+type memoryAudit struct{ s *MemoryStore }
+
+func (r memoryAudit) RecordAudit(ctx context.Context, entry *models.AuditEntry) error {
+	if err := ctx.Err(); err != nil {
+		return apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	entry.ID = r.s.newID()
+	entry.CreatedAt = time.Now()
+	r.s.data.audit = append(r.s.data.audit, *entry)
+	return nil
+}
+
+func (r memoryAudit) ListAudit(ctx context.Context, q models.AuditQuery) ([]models.AuditEntry, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, apperrors.Upstream("database unavailable", err)
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	// Entries are appended in order, so the newest are last.
+	var entries []models.AuditEntry
+	for i := len(r.s.data.audit) - 1; i >= 0; i-- {
+		entry := r.s.data.audit[i]
+		switch {
+		case q.Actor != "" && entry.Actor != q.Actor,
+			q.Action != "" && entry.Action != q.Action,
+			q.EntityType != "" && entry.EntityType != q.EntityType,
+			q.EntityID != 0 && entry.EntityID != q.EntityID,
+			q.RequestID != "" && entry.RequestID != q.RequestID,
+			q.From != nil && entry.CreatedAt.Before(*q.From),
+			q.To != nil && !entry.CreatedAt.Before(*q.To):
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	total := int64(len(entries))
+	from := min((q.Page-1)*q.PerPage, len(entries))
+	to := min(from+q.PerPage, len(entries))
+	return entries[from:to], total, nil
+}
@@ -0,0 +1,872 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"orderservice/apperrors"
+	"orderservice/models"
+)
+
+func TestMemoryStoreContract(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+
+	t.Run("Unknown product in order", func(t *testing.T) {
+		var missing models.Product
+		missing.ID = 99
+		err := store.Orders().CreateOrder(ctx, &models.Order{CustomerID: 1, Products: []models.Product{missing}})
+		assert.True(t, apperrors.Is(err, apperrors.KindValidation))
+	})
+
+	t.Run("Cancelled context", func(t *testing.T) {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := store.Products().GetAllProducts(cancelled)
+		assert.True(t, apperrors.Is(err, apperrors.KindUpstream))
+	})
+
+	t.Run("Returned records are copies", func(t *testing.T) {
+		product := &models.Product{Name: "Lamp", Price: 15}
+		require.NoError(t, store.Products().CreateProduct(ctx, product))
+		fetched, err := store.Products().GetProduct(ctx, product.ID)
+		require.NoError(t, err)
+		fetched.Name = "Changed"
+
+		again, _ := store.Products().GetProduct(ctx, product.ID)
+		assert.Equal(t, "Lamp", again.Name)
+	})
+}
+
+// testStore checks the behaviour every Store implementation must share.
+func testStore(t *testing.T, store Store) {
+	t.Run("Order round trip", func(t *testing.T) {
+		customer := &models.Customer{Name: "Contract Customer", Email: "contract@example.com"}
+		require.NoError(t, store.Customers().CreateCustomer(ctx, customer))
+		product := &models.Product{Name: "Pen", Price: 10}
+		require.NoError(t, store.Products().CreateProduct(ctx, product))
+
+		order := &models.Order{CustomerID: customer.ID, Products: []models.Product{*product}}
+		require.NoError(t, store.Orders().CreateOrder(ctx, order))
+
+		fetched, err := store.Orders().GetOrder(ctx, order.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.OrderPending, fetched.Status)
+		assert.Len(t, fetched.Products, 1)
+		assert.Equal(t, 10.0, fetched.Total)
+
+		require.NoError(t, store.Orders().UpdateOrderStatus(ctx, order.ID, models.OrderPaid))
+		fetched, _ = store.Orders().GetOrder(ctx, order.ID)
+		assert.Equal(t, models.OrderPaid, fetched.Status)
+	})
+
+	t.Run("Missing records", func(t *testing.T) {
+		_, err := store.Customers().GetCustomer(ctx, 999)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+		_, err = store.Products().GetProduct(ctx, 999)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+		_, err = store.Orders().GetOrder(ctx, 999)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+	})
+
+	t.Run("Duplicate email", func(t *testing.T) {
+		err := store.Customers().CreateCustomer(ctx, &models.Customer{Name: "Again", Email: "contract@example.com"})
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict))
+	})
+
+	t.Run("Unit of work commits", func(t *testing.T) {
+		var id uint
+		err := store.WithinTx(ctx, func(tx Store) error {
+			customer := &models.Customer{Name: "Committed", Email: "committed@example.com"}
+			err := tx.Customers().CreateCustomer(ctx, customer)
+			id = customer.ID
+			return err
+		})
+		require.NoError(t, err)
+
+		_, err = store.Customers().GetCustomer(ctx, id)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Unit of work rolls back", func(t *testing.T) {
+		boom := errors.New("boom")
+		var id uint
+		err := store.WithinTx(ctx, func(tx Store) error {
+			customer := &models.Customer{Name: "Rolled Back", Email: "rollback@example.com"}
+			if err := tx.Customers().CreateCustomer(ctx, customer); err != nil {
+				return err
+			}
+			id = customer.ID
+			return boom
+		})
+		assert.ErrorIs(t, err, boom)
+
+		_, err = store.Customers().GetCustomer(ctx, id)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+	})
+
+	t.Run("Promotions", func(t *testing.T) {
+		promotion := &models.Promotion{Code: "CONTRACT", Type: models.DiscountFixed, Value: 5, UsageLimit: 1, Categories: []string{"books"}}
+		require.NoError(t, store.Promotions().CreatePromotion(ctx, promotion))
+
+		fetched, err := store.Promotions().GetPromotionByCode(ctx, "CONTRACT")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"books"}, fetched.Categories)
+
+		err = store.Promotions().CreatePromotion(ctx, &models.Promotion{Code: "CONTRACT", Type: models.DiscountFixed, Value: 1})
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict))
+
+		require.NoError(t, store.Promotions().Redeem(ctx, promotion.ID))
+		err = store.Promotions().Redeem(ctx, promotion.ID)
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict), "usage limit reached")
+	})
+
+	t.Run("Order discounts", func(t *testing.T) {
+		customer := &models.Customer{Name: "Discount Customer", Email: "discount@example.com"}
+		require.NoError(t, store.Customers().CreateCustomer(ctx, customer))
+		product := &models.Product{Name: "Novel", Price: 40, Category: "books"}
+		require.NoError(t, store.Products().CreateProduct(ctx, product))
+		promotion, err := store.Promotions().GetPromotionByCode(ctx, "CONTRACT")
+		require.NoError(t, err)
+
+		order := &models.Order{
+			CustomerID: customer.ID,
+			Products:   []models.Product{*product},
+			Items: []models.OrderItem{{
+				ProductID: product.ID, Name: "Novel", UnitPrice: 40, Quantity: 1,
+				TaxClass: models.TaxStandard, TaxRate: 0.16, Discount: 5, TaxAmount: 5.6, Total: 40.6,
+			}},
+			Discount:  5,
+			TaxAmount: 5.6,
+			Discounts: []models.OrderDiscount{{PromotionID: promotion.ID, Code: "CONTRACT", Amount: 5}},
+		}
+		require.NoError(t, store.Orders().CreateOrder(ctx, order))
+
+		order.Discount = 7.5
+		order.TaxAmount = 5.2
+		order.Items[0].Discount, order.Items[0].TaxAmount, order.Items[0].Total = 7.5, 5.2, 37.7
+		require.NoError(t, store.Orders().ApplyDiscounts(ctx, order,
+			[]models.OrderDiscount{{PromotionID: promotion.ID, Code: "CONTRACT", Amount: 2.5}}))
+
+		fetched, err := store.Orders().GetOrder(ctx, order.ID)
+		require.NoError(t, err)
+		assert.Len(t, fetched.Discounts, 2)
+		require.Len(t, fetched.Items, 1)
+		assert.Equal(t, 5.2, fetched.Items[0].TaxAmount)
+		assert.Equal(t, 7.5, fetched.Discount)
+		assert.Equal(t, 40.0, fetched.Subtotal)
+		assert.InDelta(t, 37.7, fetched.Total, 0.001)
+
+		used, err := store.Promotions().CountCustomerRedemptions(ctx, promotion.ID, customer.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), used)
+
+		// Cancelling the order gives back its coupon uses
+		require.NoError(t, store.Orders().UpdateOrderStatus(ctx, order.ID, models.OrderCancelled))
+		used, err = store.Promotions().CountCustomerRedemptions(ctx, promotion.ID, customer.ID)
+		require.NoError(t, err)
+		assert.Zero(t, used)
+		promotion, err = store.Promotions().GetPromotionByCode(ctx, "CONTRACT")
+		require.NoError(t, err)
+		assert.Zero(t, promotion.UsageCount)
+		assert.NoError(t, store.Promotions().Redeem(ctx, promotion.ID), "usage limit freed")
+	})
+
+	t.Run("Stock reservation", func(t *testing.T) {
+		stock := 3
+		product := &models.Product{Name: "Mug", Price: 8, Stock: &stock}
+		require.NoError(t, store.Products().CreateProduct(ctx, product))
+		line := func(quantity int) []models.OrderItem {
+			return []models.OrderItem{{ProductID: product.ID, Name: "Mug", UnitPrice: 8, Quantity: quantity, TaxClass: models.TaxStandard, Total: 8}}
+		}
+		stockLeft := func() int {
+			fetched, err := store.Products().GetProduct(ctx, product.ID)
+			require.NoError(t, err)
+			require.NotNil(t, fetched.Stock)
+			return *fetched.Stock
+		}
+
+		order := &models.Order{CustomerID: 1, Products: []models.Product{*product}, Items: line(2)}
+		require.NoError(t, store.Orders().CreateOrder(ctx, order))
+		assert.Equal(t, 1, stockLeft())
+
+		err := store.Orders().CreateOrder(ctx, &models.Order{CustomerID: 1, Products: []models.Product{*product}, Items: line(2)})
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict), "insufficient stock")
+		assert.Equal(t, 1, stockLeft())
+
+		require.NoError(t, store.Orders().UpdateOrderStatus(ctx, order.ID, models.OrderCancelled))
+		require.NoError(t, store.Orders().UpdateOrderStatus(ctx, order.ID, models.OrderCancelled))
+		assert.Equal(t, 3, stockLeft(), "stock is released once")
+
+		err = store.Orders().UpdateOrderStatus(ctx, order.ID, models.OrderPending)
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict), "cancelled is final")
+		require.NoError(t, store.Orders().UpdateOrderStatus(ctx, order.ID, models.OrderCancelled))
+		assert.Equal(t, 3, stockLeft(), "cancelled -> pending -> cancelled releases nothing")
+		fetched, err := store.Orders().GetOrder(ctx, order.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.OrderCancelled, fetched.Status)
+	})
+
+	t.Run("Carts", func(t *testing.T) {
+		now := time.Now()
+		cart := &models.Cart{
+			Status:      models.CartOpen,
+			Items:       []models.CartItem{{ProductID: 1, Quantity: 2, UnitPrice: 10}},
+			CouponCodes: []string{"CONTRACT"},
+			ExpiresAt:   now.Add(time.Hour),
+		}
+		require.NoError(t, store.Carts().CreateCart(ctx, cart))
+
+		fetched, err := store.Carts().GetCart(ctx, cart.ID)
+		require.NoError(t, err)
+		require.Len(t, fetched.Items, 1)
+		assert.Equal(t, 2, fetched.Items[0].Quantity)
+		assert.Equal(t, []string{"CONTRACT"}, fetched.CouponCodes)
+
+		fetched.CustomerID = 1
+		fetched.Items = []models.CartItem{{ProductID: 2, Quantity: 1, UnitPrice: 5}, {ProductID: 1, Quantity: 4, UnitPrice: 10}}
+		require.NoError(t, store.Carts().SaveCart(ctx, fetched))
+		fetched, _ = store.Carts().GetCart(ctx, cart.ID)
+		assert.Equal(t, uint(1), fetched.CustomerID)
+		if assert.Len(t, fetched.Items, 2) {
+			assert.Equal(t, uint(2), fetched.Items[0].ProductID)
+		}
+
+		require.NoError(t, store.Carts().CheckOut(ctx, cart.ID, 42))
+		err = store.Carts().CheckOut(ctx, cart.ID, 43)
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict), "already checked out")
+		fetched, _ = store.Carts().GetCart(ctx, cart.ID)
+		assert.Equal(t, models.CartCheckedOut, fetched.Status)
+		if assert.NotNil(t, fetched.OrderID) {
+			assert.Equal(t, uint(42), *fetched.OrderID)
+		}
+
+		expired := &models.Cart{Status: models.CartOpen, ExpiresAt: now.Add(-time.Minute)}
+		require.NoError(t, store.Carts().CreateCart(ctx, expired))
+		deleted, err := store.Carts().DeleteExpiredCarts(ctx, now)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+		_, err = store.Carts().GetCart(ctx, expired.ID)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+		_, err = store.Carts().GetCart(ctx, cart.ID)
+		assert.NoError(t, err, "checked out carts are kept")
+	})
+
+	t.Run("Reprice order", func(t *testing.T) {
+		promotion := &models.Promotion{Code: "REPRICE", Type: models.DiscountFixed, Value: 1}
+		require.NoError(t, store.Promotions().CreatePromotion(ctx, promotion))
+		product := &models.Product{Name: "Line", Price: 2, Currency: "USD"}
+		require.NoError(t, store.Products().CreateProduct(ctx, product))
+		order := &models.Order{
+			CustomerID:   1,
+			Currency:     "USD",
+			Products:     []models.Product{*product},
+			Items:        []models.OrderItem{{ProductID: product.ID, Name: "Line", UnitPrice: 2, Quantity: 1, TaxClass: models.TaxStandard, Total: 1}},
+			Discounts:    []models.OrderDiscount{{PromotionID: promotion.ID, Code: "REPRICE", Amount: 1}},
+			Discount:     1,
+			TaxInclusive: true,
+		}
+		require.NoError(t, store.Orders().CreateOrder(ctx, order))
+
+		order.Currency = "KES"
+		order.Items[0].UnitPrice, order.Items[0].ExchangeRate, order.Items[0].Total = 260, 130, 130
+		order.Discounts[0].Amount, order.Discount, order.TaxAmount = 130, 130, 17.93
+		require.NoError(t, store.Orders().RepriceOrder(ctx, order))
+
+		fetched, err := store.Orders().GetOrder(ctx, order.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "KES", fetched.Currency)
+		require.Len(t, fetched.Items, 1)
+		assert.Equal(t, 260.0, fetched.Items[0].UnitPrice)
+		assert.Equal(t, 130.0, fetched.Items[0].ExchangeRate)
+		require.Len(t, fetched.Discounts, 1)
+		assert.Equal(t, 130.0, fetched.Discounts[0].Amount)
+		assert.Equal(t, 130.0, fetched.Total)
+
+		missing := &models.Order{}
+		missing.ID = 9999
+		err = store.Orders().RepriceOrder(ctx, missing)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+	})
+
+	t.Run("Addresses", func(t *testing.T) {
+		customer := &models.Customer{Name: "Address Customer", Email: "address@example.com"}
+		require.NoError(t, store.Customers().CreateCustomer(ctx, customer))
+		home := &models.Address{CustomerID: customer.ID, Label: "Home", County: "Nairobi", Town: "Nairobi",
+			Street: "Moi Avenue", Phone: "254712345678"}
+		work := &models.Address{CustomerID: customer.ID, Label: "Work", County: "Mombasa", Town: "Nyali",
+			Street: "Links Road", Phone: "254712345678"}
+		require.NoError(t, store.Addresses().CreateAddress(ctx, home))
+		require.NoError(t, store.Addresses().CreateAddress(ctx, work))
+
+		home.Street = "Kenyatta Avenue"
+		require.NoError(t, store.Addresses().UpdateAddress(ctx, home))
+		fetched, err := store.Addresses().GetAddress(ctx, home.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Kenyatta Avenue", fetched.Street)
+
+		require.NoError(t, store.Addresses().DeleteAddress(ctx, work.ID))
+		addresses, err := store.Addresses().ListAddresses(ctx, customer.ID)
+		require.NoError(t, err)
+		require.Len(t, addresses, 1)
+		assert.Equal(t, home.ID, addresses[0].ID)
+
+		_, err = store.Addresses().GetAddress(ctx, work.ID)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+		err = store.Addresses().DeleteAddress(ctx, work.ID)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+		missing := &models.Address{}
+		missing.ID = work.ID
+		err = store.Addresses().UpdateAddress(ctx, missing)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+	})
+
+	t.Run("Shipping methods", func(t *testing.T) {
+		limit := 5.0
+		method := &models.ShippingMethod{Code: "standard", Name: "Standard", Rates: []models.ShippingRate{
+			{Zone: "Nairobi", Counties: []string{"Nairobi"}, MaxWeight: &limit, Fee: 200},
+			{Zone: "Rest of Kenya", Fee: 450},
+		}}
+		require.NoError(t, store.Shipping().CreateShippingMethod(ctx, method))
+		err := store.Shipping().CreateShippingMethod(ctx, &models.ShippingMethod{Code: "standard", Name: "Again"})
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict))
+
+		fetched, err := store.Shipping().GetShippingMethod(ctx, "standard")
+		require.NoError(t, err)
+		require.Len(t, fetched.Rates, 2)
+		assert.Equal(t, []string{"Nairobi"}, fetched.Rates[0].Counties)
+		assert.Equal(t, 5.0, *fetched.Rates[0].MaxWeight)
+
+		fetched.Name = "Standard delivery"
+		fetched.Rates = []models.ShippingRate{{Zone: "Kenya", Fee: 300}}
+		require.NoError(t, store.Shipping().SaveShippingMethod(ctx, fetched))
+		methods, err := store.Shipping().GetAllShippingMethods(ctx)
+		require.NoError(t, err)
+		require.Len(t, methods, 1)
+		assert.Equal(t, "Standard delivery", methods[0].Name)
+		require.Len(t, methods[0].Rates, 1)
+		assert.Equal(t, 300.0, methods[0].Rates[0].Fee)
+
+		_, err = store.Shipping().GetShippingMethod(ctx, "express")
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+	})
+
+	t.Run("Shipments", func(t *testing.T) {
+		product := &models.Product{Name: "Lamp", Price: 40}
+		require.NoError(t, store.Products().CreateProduct(ctx, product))
+		order := &models.Order{CustomerID: 1, Products: []models.Product{*product}, Items: []models.OrderItem{
+			{ProductID: product.ID, Name: "Lamp", UnitPrice: 40, Quantity: 3, Total: 120},
+		}}
+		require.NoError(t, store.Orders().CreateOrder(ctx, order))
+		line := order.Items[0].ID
+
+		shipment := &models.Shipment{OrderID: order.ID, Carrier: "G4S", Items: []models.ShipmentItem{{OrderItemID: line, Quantity: 2}}}
+		require.NoError(t, store.Shipments().CreateShipment(ctx, shipment))
+		assert.NotZero(t, shipment.ID)
+		assert.Equal(t, models.ShipmentPending, shipment.Status)
+
+		shipped := time.Now().UTC().Truncate(time.Second)
+		shipment.Status = models.ShipmentShipped
+		shipment.TrackingNumber = "G4S-1"
+		shipment.ShippedAt = &shipped
+		require.NoError(t, store.Shipments().UpdateShipment(ctx, shipment))
+
+		fetched, err := store.Shipments().GetShipment(ctx, shipment.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "G4S-1", fetched.TrackingNumber)
+		assert.Equal(t, models.ShipmentShipped, fetched.Status)
+		assert.True(t, shipped.Equal(*fetched.ShippedAt))
+		require.Len(t, fetched.Items, 1)
+		assert.Equal(t, 2, fetched.Items[0].Quantity)
+
+		require.NoError(t, store.Shipments().CreateShipment(ctx, &models.Shipment{OrderID: order.ID, Carrier: "Sendy",
+			Items: []models.ShipmentItem{{OrderItemID: line, Quantity: 1}}}))
+		shipments, err := store.Shipments().ListShipments(ctx, order.ID)
+		require.NoError(t, err)
+		require.Len(t, shipments, 2)
+		assert.Equal(t, "G4S", shipments[0].Carrier)
+		assert.Equal(t, "Sendy", shipments[1].Carrier)
+
+		_, err = store.Shipments().GetShipment(ctx, 9999)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+		missing := &models.Shipment{}
+		missing.ID = 9999
+		assert.True(t, apperrors.Is(store.Shipments().UpdateShipment(ctx, missing), apperrors.KindNotFound))
+	})
+
+	t.Run("Payment reference", func(t *testing.T) {
+		order := &models.Order{CustomerID: 1}
+		require.NoError(t, store.Orders().CreateOrder(ctx, order))
+		paidAt := time.Now().UTC().Truncate(time.Second)
+		require.NoError(t, store.Orders().RecordPayment(ctx, order.ID, "QK12ABC3DE", paidAt))
+
+		fetched, err := store.Orders().GetOrder(ctx, order.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "QK12ABC3DE", fetched.PaymentReference)
+		require.NotNil(t, fetched.PaidAt)
+		assert.True(t, paidAt.Equal(*fetched.PaidAt))
+
+		err = store.Orders().RecordPayment(ctx, 9999, "QK12ABC3DE", paidAt)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+	})
+
+	t.Run("Invoice numbers", func(t *testing.T) {
+		var orders [3]*models.Order
+		for i := range orders {
+			orders[i] = &models.Order{CustomerID: 1}
+			require.NoError(t, store.Orders().CreateOrder(ctx, orders[i]))
+		}
+
+		_, err := store.Invoices().GetInvoice(ctx, orders[0].ID)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound), "not issued yet")
+
+		first, err := store.Invoices().IssueInvoice(ctx, orders[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "INV-000001", first.Number)
+		fetched, err := store.Invoices().GetInvoice(ctx, orders[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, first.Number, fetched.Number)
+		again, err := store.Invoices().IssueInvoice(ctx, orders[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, first.ID, again.ID, "one invoice per order")
+
+		boom := errors.New("boom")
+		err = store.WithinTx(ctx, func(tx Store) error {
+			if _, err := tx.Invoices().IssueInvoice(ctx, orders[1].ID); err != nil {
+				return err
+			}
+			return boom
+		})
+		assert.ErrorIs(t, err, boom)
+
+		second, err := store.Invoices().IssueInvoice(ctx, orders[2].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "INV-000002", second.Number, "rolled back numbers are reused")
+	})
+
+	t.Run("Notifications", func(t *testing.T) {
+		order := &models.Order{CustomerID: 1}
+		require.NoError(t, store.Orders().CreateOrder(ctx, order))
+		now := time.Now().UTC().Truncate(time.Second)
+		later := now.Add(time.Hour)
+		create := func(channel string, next time.Time) *models.Notification {
+			notification := &models.Notification{OrderID: &order.ID, CustomerID: 1, Event: "order_placed",
+				Channel: channel, Recipient: "contract@example.com", Body: "Hi", NextAttemptAt: &next}
+			require.NoError(t, store.Notifications().CreateNotification(ctx, notification))
+			return notification
+		}
+		email := create("email", now.Add(-time.Minute))
+		sms := create("sms", now)
+		create("email", later)
+		assert.Equal(t, models.NotificationPending, email.Status)
+
+		due, err := store.Notifications().DueNotifications(ctx, now, 10)
+		require.NoError(t, err)
+		require.Len(t, due, 2)
+		assert.Equal(t, email.ID, due[0].ID)
+		assert.Equal(t, sms.ID, due[1].ID)
+		due, err = store.Notifications().DueNotifications(ctx, now, 1)
+		require.NoError(t, err)
+		assert.Len(t, due, 1)
+
+		email.Status = models.NotificationSent
+		email.Attempts = 1
+		email.SentAt = &now
+		email.NextAttemptAt = nil
+		require.NoError(t, store.Notifications().UpdateNotification(ctx, email))
+		sms.Attempts = 1
+		sms.LastError = "gateway timeout"
+		sms.NextAttemptAt = &later
+		require.NoError(t, store.Notifications().UpdateNotification(ctx, sms))
+
+		due, err = store.Notifications().DueNotifications(ctx, now, 10)
+		require.NoError(t, err)
+		assert.Empty(t, due)
+
+		fetched, err := store.Notifications().GetNotification(ctx, sms.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "gateway timeout", fetched.LastError)
+		assert.Equal(t, 1, fetched.Attempts)
+		assert.True(t, later.Equal(*fetched.NextAttemptAt))
+
+		listed, err := store.Notifications().ListNotifications(ctx, order.ID)
+		require.NoError(t, err)
+		require.Len(t, listed, 3)
+		assert.Equal(t, models.NotificationSent, listed[0].Status)
+		require.NotNil(t, listed[0].SentAt)
+
+		_, err = store.Notifications().GetNotification(ctx, 9999)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+		missing := &models.Notification{}
+		missing.ID = 9999
+		assert.True(t, apperrors.Is(store.Notifications().UpdateNotification(ctx, missing), apperrors.KindNotFound))
+	})
+
+	t.Run("Accounts", func(t *testing.T) {
+		customer := &models.Customer{Name: "Account Customer", Email: "Account@Example.com"}
+		require.NoError(t, store.Customers().CreateCustomer(ctx, customer))
+		assert.False(t, customer.HasAccount())
+
+		found, err := store.Customers().GetCustomerByEmail(ctx, "account@example.COM")
+		require.NoError(t, err)
+		assert.Equal(t, customer.ID, found.ID, "emails match regardless of case")
+		_, err = store.Customers().GetCustomerByEmail(ctx, "nobody@example.com")
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+
+		now := time.Now().UTC().Truncate(time.Second)
+		require.NoError(t, store.Customers().SetPassword(ctx, customer.ID, "hash", now))
+		require.NoError(t, store.Customers().VerifyEmail(ctx, customer.ID, now))
+		fetched, err := store.Customers().GetCustomer(ctx, customer.ID)
+		require.NoError(t, err)
+		assert.True(t, fetched.HasAccount())
+		assert.True(t, now.Equal(*fetched.PasswordChangedAt))
+		assert.True(t, now.Equal(*fetched.EmailVerifiedAt))
+		assert.True(t, apperrors.Is(store.Customers().SetPassword(ctx, 9999, "hash", now), apperrors.KindNotFound))
+		assert.True(t, apperrors.Is(store.Customers().VerifyEmail(ctx, 9999, now), apperrors.KindNotFound))
+
+		create := func(purpose, hash string, expires time.Time) {
+			require.NoError(t, store.Tokens().CreateToken(ctx, &models.CustomerToken{
+				CustomerID: customer.ID, Purpose: purpose, TokenHash: hash, ExpiresAt: expires}))
+		}
+		create(models.TokenResetPassword, "reset", now.Add(time.Hour))
+		create(models.TokenResetPassword, "expired", now.Add(-time.Second))
+		create(models.TokenVerifyEmail, "verify", now.Add(time.Hour))
+
+		token, err := store.Tokens().UseToken(ctx, models.TokenResetPassword, "reset", now)
+		require.NoError(t, err)
+		assert.Equal(t, customer.ID, token.CustomerID)
+		_, err = store.Tokens().UseToken(ctx, models.TokenResetPassword, "reset", now)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound), "tokens are single use")
+		_, err = store.Tokens().UseToken(ctx, models.TokenResetPassword, "expired", now)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+		_, err = store.Tokens().UseToken(ctx, models.TokenResetPassword, "verify", now)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound), "tokens only serve their purpose")
+	})
+
+	t.Run("Customer orders", func(t *testing.T) {
+		customer := &models.Customer{Name: "History Customer", Email: "history@example.com"}
+		require.NoError(t, store.Customers().CreateCustomer(ctx, customer))
+		var ids []uint
+		for range 3 {
+			order := &models.Order{CustomerID: customer.ID}
+			require.NoError(t, store.Orders().CreateOrder(ctx, order))
+			ids = append(ids, order.ID)
+		}
+
+		orders, total, err := store.Orders().ListCustomerOrders(ctx, customer.ID, 1, 2)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), total)
+		require.Len(t, orders, 2)
+		assert.Equal(t, ids[2], orders[0].ID, "newest first")
+		assert.Equal(t, ids[1], orders[1].ID)
+
+		orders, _, err = store.Orders().ListCustomerOrders(ctx, customer.ID, 2, 2)
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		assert.Equal(t, ids[0], orders[0].ID)
+
+		orders, total, err = store.Orders().ListCustomerOrders(ctx, 9999, 1, 20)
+		require.NoError(t, err)
+		assert.Zero(t, total)
+		assert.Empty(t, orders)
+	})
+
+	t.Run("Erasure", func(t *testing.T) {
+		customer := &models.Customer{Name: "Erased Customer", Email: "erase@example.com", PasswordHash: "hash"}
+		require.NoError(t, store.Customers().CreateCustomer(ctx, customer))
+		other := &models.Customer{Name: "Kept Customer", Email: "kept@example.com"}
+		require.NoError(t, store.Customers().CreateCustomer(ctx, other))
+		address := models.Address{County: "Nairobi", Town: "Westlands", Street: "Waiyaki Way", Recipient: "Erased Customer", Phone: "0712345678"}
+		for _, id := range []uint{customer.ID, other.ID} {
+			address := address
+			address.CustomerID = id
+			require.NoError(t, store.Addresses().CreateAddress(ctx, &address))
+		}
+		order := &models.Order{CustomerID: customer.ID, ShippingAddress: address.ShippingAddress()}
+		require.NoError(t, store.Orders().CreateOrder(ctx, order))
+		next := time.Now()
+		require.NoError(t, store.Notifications().CreateNotification(ctx, &models.Notification{
+			OrderID: &order.ID, CustomerID: customer.ID, Event: "order_placed", Channel: "sms",
+			Recipient: "0712345678", Body: "Hi Erased", NextAttemptAt: &next}))
+		require.NoError(t, store.Tokens().CreateToken(ctx, &models.CustomerToken{
+			CustomerID: customer.ID, Purpose: models.TokenResetPassword, TokenHash: "erase", ExpiresAt: next.Add(time.Hour)}))
+
+		notifications, err := store.Notifications().ListCustomerNotifications(ctx, customer.ID)
+		require.NoError(t, err)
+		require.Len(t, notifications, 1)
+
+		erasedAt := time.Now().UTC().Truncate(time.Second)
+		require.NoError(t, store.Customers().EraseCustomer(ctx, customer.ID, erasedAt))
+		require.NoError(t, store.Addresses().DeleteCustomerAddresses(ctx, customer.ID))
+		require.NoError(t, store.Orders().EraseShippingAddresses(ctx, customer.ID))
+		require.NoError(t, store.Notifications().EraseNotifications(ctx, customer.ID, "customer data erased"))
+		require.NoError(t, store.Tokens().DeleteCustomerTokens(ctx, customer.ID))
+
+		fetched, err := store.Customers().GetCustomer(ctx, customer.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.ErasedName, fetched.Name)
+		assert.Equal(t, models.ErasedEmail(customer.ID), fetched.Email)
+		assert.False(t, fetched.HasAccount())
+		assert.True(t, erasedAt.Equal(*fetched.ErasedAt))
+		assert.True(t, apperrors.Is(store.Customers().EraseCustomer(ctx, 9999, erasedAt), apperrors.KindNotFound))
+
+		addresses, err := store.Addresses().ListAddresses(ctx, customer.ID)
+		require.NoError(t, err)
+		assert.Empty(t, addresses)
+		addresses, err = store.Addresses().ListAddresses(ctx, other.ID)
+		require.NoError(t, err)
+		assert.Len(t, addresses, 1, "other customers are untouched")
+
+		erased, err := store.Orders().GetOrder(ctx, order.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.ShippingAddress{County: "Nairobi", Town: "Westlands"}, erased.ShippingAddress)
+
+		notifications, err = store.Notifications().ListCustomerNotifications(ctx, customer.ID)
+		require.NoError(t, err)
+		require.Len(t, notifications, 1)
+		assert.Empty(t, notifications[0].Recipient)
+		assert.Empty(t, notifications[0].Body)
+		assert.Equal(t, models.NotificationFailed, notifications[0].Status)
+		assert.Equal(t, "customer data erased", notifications[0].LastError)
+
+		_, err = store.Tokens().UseToken(ctx, models.TokenResetPassword, "erase", time.Now())
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+
+		entry := &models.AuditEntry{Actor: "staff", Action: "customer.erased", EntityType: "customer", EntityID: customer.ID}
+		require.NoError(t, store.Audit().RecordAudit(ctx, entry))
+		assert.NotZero(t, entry.ID)
+	})
+
+	t.Run("Audit log", func(t *testing.T) {
+		for i, action := range []string{"order.created", "order.status_changed", "order.status_changed"} {
+			require.NoError(t, store.Audit().RecordAudit(ctx, &models.AuditEntry{
+				Actor: "auditor", Action: action, EntityType: "order", EntityID: uint(100 + i%2),
+				RequestID: "req-audit", Changes: models.Changes{"status": {Before: []byte(`null`), After: []byte(`"paid"`)}}}))
+		}
+		page := func(q models.AuditQuery) ([]models.AuditEntry, int64) {
+			q.Page, q.PerPage = max(q.Page, 1), 2
+			entries, total, err := store.Audit().ListAudit(ctx, q)
+			require.NoError(t, err)
+			return entries, total
+		}
+
+		entries, total := page(models.AuditQuery{Actor: "auditor"})
+		assert.EqualValues(t, 3, total)
+		require.Len(t, entries, 2)
+		assert.Greater(t, entries[0].ID, entries[1].ID, "newest first")
+		assert.Equal(t, json.RawMessage(`"paid"`), entries[0].Changes["status"].After)
+		entries, _ = page(models.AuditQuery{Actor: "auditor", Page: 2})
+		assert.Len(t, entries, 1)
+
+		_, total = page(models.AuditQuery{Actor: "auditor", Action: "order.status_changed"})
+		assert.EqualValues(t, 2, total)
+		_, total = page(models.AuditQuery{EntityType: "order", EntityID: 101, RequestID: "req-audit"})
+		assert.EqualValues(t, 1, total)
+		_, total = page(models.AuditQuery{Actor: "nobody"})
+		assert.Zero(t, total)
+
+		hour := time.Now().Add(-time.Hour)
+		_, total = page(models.AuditQuery{Actor: "auditor", From: &hour})
+		assert.EqualValues(t, 3, total)
+		_, total = page(models.AuditQuery{Actor: "auditor", To: &hour})
+		assert.Zero(t, total)
+	})
+
+	t.Run("Soft delete", func(t *testing.T) {
+		customer := &models.Customer{Name: "Leaving Customer", Email: "leaving@example.com"}
+		require.NoError(t, store.Customers().CreateCustomer(ctx, customer))
+		product := &models.Product{SKU: "GONE-1", Name: "Discontinued", Price: 10}
+		require.NoError(t, store.Products().CreateProduct(ctx, product))
+		line := models.OrderItem{ProductID: product.ID, Name: "Discontinued", UnitPrice: 10, Quantity: 1, TaxClass: models.TaxStandard, Total: 10}
+		order := &models.Order{CustomerID: customer.ID, Products: []models.Product{*product}, Items: []models.OrderItem{line}}
+		require.NoError(t, store.Orders().CreateOrder(ctx, order))
+
+		err := store.Products().DeleteProduct(ctx, product.ID)
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict), "product on an open order")
+		err = store.Customers().DeleteCustomer(ctx, customer.ID)
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict), "customer with an open order")
+		err = store.Orders().DeleteOrder(ctx, order.ID)
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict), "open order")
+		_, err = store.Products().GetProduct(ctx, product.ID)
+		assert.NoError(t, err, "refused deletes change nothing")
+
+		require.NoError(t, store.Orders().UpdateOrderStatus(ctx, order.ID, models.OrderCancelled))
+		require.NoError(t, store.Products().DeleteProduct(ctx, product.ID))
+		require.NoError(t, store.Orders().DeleteOrder(ctx, order.ID))
+		require.NoError(t, store.Customers().DeleteCustomer(ctx, customer.ID))
+
+		_, err = store.Products().GetProduct(ctx, product.ID)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+		_, err = store.Orders().GetOrder(ctx, order.ID)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+		ids, err := store.Orders().CustomerOrderIDs(ctx, customer.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []uint{order.ID}, ids, "deleted orders are listed")
+		_, err = store.Customers().GetCustomerByEmail(ctx, customer.Email)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+		err = store.Products().DeleteProduct(ctx, product.ID)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound), "already deleted")
+		err = store.Orders().DeleteOrder(ctx, 99999)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+
+		query := models.ProductQuery{Search: "GONE-1", Status: "all", Page: 1, PerPage: 10}
+		_, total, err := store.Products().SearchProducts(ctx, query)
+		require.NoError(t, err)
+		assert.Zero(t, total)
+		query.IncludeDeleted = true
+		products, _, err := store.Products().SearchProducts(ctx, query)
+		require.NoError(t, err)
+		require.Len(t, products, 1)
+		assert.True(t, products[0].DeletedAt.Valid)
+		err = store.Products().CreateProduct(ctx, &models.Product{SKU: "GONE-1", Name: "Copy", Price: 1})
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict), "deleted products keep their SKUs")
+		err = store.Customers().CreateCustomer(ctx, &models.Customer{Name: "Copy", Email: customer.Email})
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict), "deleted customers keep their email")
+
+		deleted, err := store.Orders().GetOrderIncludingDeleted(ctx, order.ID)
+		require.NoError(t, err)
+		assert.True(t, deleted.DeletedAt.Valid)
+		require.Len(t, deleted.Products, 1, "deleted products stay on orders")
+		assert.Equal(t, "Discontinued", deleted.Products[0].Name)
+
+		require.NoError(t, store.Customers().RestoreCustomer(ctx, customer.ID))
+		_, err = store.Customers().GetCustomer(ctx, customer.ID)
+		assert.NoError(t, err)
+		err = store.Customers().RestoreCustomer(ctx, customer.ID)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound), "not deleted")
+		require.NoError(t, store.Customers().DeleteCustomer(ctx, customer.ID))
+
+		// Nothing deleted since the cutoff is purged, nor anything an
+		// order still refers to.
+		ids, err = store.Orders().PurgeOrders(ctx, time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		assert.NotContains(t, ids, order.ID)
+		soon := time.Now().Add(time.Minute)
+		ids, err = store.Customers().PurgeCustomers(ctx, soon)
+		require.NoError(t, err)
+		assert.NotContains(t, ids, customer.ID)
+		ids, err = store.Products().PurgeProducts(ctx, soon)
+		require.NoError(t, err)
+		assert.NotContains(t, ids, product.ID)
+
+		ids, err = store.Orders().PurgeOrders(ctx, soon)
+		require.NoError(t, err)
+		assert.Contains(t, ids, order.ID)
+		ids, err = store.Customers().PurgeCustomers(ctx, soon)
+		require.NoError(t, err)
+		assert.Contains(t, ids, customer.ID)
+		ids, err = store.Products().PurgeProducts(ctx, soon)
+		require.NoError(t, err)
+		assert.Contains(t, ids, product.ID)
+		_, err = store.Orders().GetOrderIncludingDeleted(ctx, order.ID)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+		err = store.Products().RestoreProduct(ctx, product.ID)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+		require.NoError(t, store.Products().CreateProduct(ctx, &models.Product{SKU: "GONE-1", Name: "Relaunched", Price: 12}))
+
+		paid := &models.Order{CustomerID: 1}
+		require.NoError(t, store.Orders().CreateOrder(ctx, paid))
+		require.NoError(t, store.Orders().RecordPayment(ctx, paid.ID, "QK12ABC3DE", time.Now()))
+		require.NoError(t, store.Orders().UpdateOrderStatus(ctx, paid.ID, models.OrderPaid))
+		require.NoError(t, store.Orders().UpdateOrderStatus(ctx, paid.ID, models.OrderDelivered))
+		require.NoError(t, store.Orders().DeleteOrder(ctx, paid.ID))
+		ids, err = store.Orders().PurgeOrders(ctx, soon)
+		require.NoError(t, err)
+		assert.NotContains(t, ids, paid.ID, "paid orders are kept for the accounts")
+		require.NoError(t, store.Orders().RestoreOrder(ctx, paid.ID))
+		_, err = store.Orders().GetOrder(ctx, paid.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Variants", func(t *testing.T) {
+		stock := 2
+		product := &models.Product{SKU: "TEE", Name: "T-shirt", Price: 15, Variants: []models.ProductVariant{
+			{SKU: "TEE-S", Name: "Small", Price: 15, Stock: &stock},
+			{SKU: "TEE-L", Name: "Large", Price: 17},
+		}}
+		require.NoError(t, store.Products().CreateProduct(ctx, product))
+		fetched, err := store.Products().GetProduct(ctx, product.ID)
+		require.NoError(t, err)
+		require.Len(t, fetched.Variants, 2)
+		assert.Equal(t, models.ProductActive, fetched.Status)
+		small := fetched.Variants[0]
+
+		err = store.Products().CreateProduct(ctx, &models.Product{Name: "Copy", Price: 1, SKU: "TEE-L"})
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict), "SKU taken by a variant")
+
+		line := models.OrderItem{ProductID: product.ID, VariantID: small.ID, Name: "T-shirt (Small)", UnitPrice: 15, Quantity: 2, TaxClass: models.TaxStandard, Total: 30}
+		order := &models.Order{CustomerID: 1, Products: []models.Product{*product}, Items: []models.OrderItem{line}}
+		require.NoError(t, store.Orders().CreateOrder(ctx, order))
+		fetched, _ = store.Products().GetProduct(ctx, product.ID)
+		assert.Equal(t, 0, *fetched.Variant(small.ID).Stock)
+		assert.Nil(t, fetched.Stock, "product stock is untouched")
+
+		err = store.Orders().CreateOrder(ctx, &models.Order{CustomerID: 1, Products: []models.Product{*product}, Items: []models.OrderItem{line}})
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict), "variant sold out")
+
+		require.NoError(t, store.Orders().UpdateOrderStatus(ctx, order.ID, models.OrderCancelled))
+		fetched, _ = store.Products().GetProduct(ctx, product.ID)
+		assert.Equal(t, 2, *fetched.Variant(small.ID).Stock)
+	})
+
+	t.Run("Product search", func(t *testing.T) {
+		products := []*models.Product{
+			{SKU: "LAMP-1", Name: "Desk lamp", Description: "Adjustable reading light", Price: 30, Category: "Lighting", Tags: []string{"office"}},
+			{Name: "Floor lamp", Price: 80, Category: "lighting"},
+			{Name: "Lamp shade", Price: 10, Category: "lighting", Tags: []string{"office", "sale"}},
+			{Name: "Night light", Description: "A small lamp for kids", Price: 12, Category: "lighting"},
+		}
+		for _, p := range products {
+			require.NoError(t, store.Products().CreateProduct(ctx, p))
+		}
+		require.NoError(t, store.Products().UpdateProductStatus(ctx, products[3].ID, models.ProductArchived))
+		err := store.Products().UpdateProductStatus(ctx, 9999, models.ProductArchived)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
+
+		search := func(q models.ProductQuery) ([]string, int64) {
+			t.Helper()
+			q.Category = "LIGHTING"
+			if q.Status == "" {
+				q.Status = models.ProductActive
+			}
+			q.Page, q.PerPage = max(q.Page, 1), 20
+			found, total, err := store.Products().SearchProducts(ctx, q)
+			require.NoError(t, err)
+			var names []string
+			for _, p := range found {
+				names = append(names, p.Name)
+			}
+			return names, total
+		}
+
+		names, total := search(models.ProductQuery{Sort: "-price"})
+		assert.Equal(t, []string{"Floor lamp", "Desk lamp", "Lamp shade"}, names)
+		assert.Equal(t, int64(3), total)
+
+		names, _ = search(models.ProductQuery{Search: "reading", Status: "all"})
+		assert.Equal(t, []string{"Desk lamp"}, names)
+		names, _ = search(models.ProductQuery{Search: "lamp-1"})
+		assert.Equal(t, []string{"Desk lamp"}, names, "exact SKU")
+		names, _ = search(models.ProductQuery{Tag: "OFFICE", Sort: "name"})
+		assert.Equal(t, []string{"Desk lamp", "Lamp shade"}, names)
+
+		low, high := 10.0, 30.0
+		names, _ = search(models.ProductQuery{MinPrice: &low, MaxPrice: &high, Sort: "price"})
+		assert.Equal(t, []string{"Lamp shade", "Desk lamp"}, names)
+
+		names, _ = search(models.ProductQuery{Status: models.ProductArchived})
+		assert.Equal(t, []string{"Night light"}, names)
+
+		names, total = search(models.ProductQuery{Sort: "name", Page: 3})
+		assert.Empty(t, names)
+		assert.Equal(t, int64(3), total)
+	})
+}
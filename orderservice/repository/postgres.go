@@ -1,40 +1,1338 @@
 package repository
 
 import (
-	"orderservice/models"
+	"context"
+	"errors"
+	"strings"
+	"time"
+
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"orderservice/apperrors"
+	"orderservice/metrics"
+	"orderservice/models"
 )
 
-type OrderRepository struct {
-	db *gorm.DB
+// GormStore is the Store backed by the service database.
+type GormStore struct {
+	conn
+}
+
+// NewGormStore returns a store whose queries are each cancelled after
+// queryTimeout, or only when their context ends if queryTimeout is zero.
+func NewGormStore(db *gorm.DB, queryTimeout time.Duration) *GormStore {
+	return &GormStore{conn{db: db, timeout: queryTimeout}}
+}
+
+func (s *GormStore) Customers() CustomerRepository {
+	return &customerRepository{s.conn}
+}
+
+func (s *GormStore) Products() ProductRepository {
+	return &productRepository{s.conn}
+}
+
+func (s *GormStore) Orders() OrderRepository {
+	return &orderRepository{s.conn}
+}
+
+func (s *GormStore) Promotions() PromotionRepository {
+	return &promotionRepository{s.conn}
+}
+
+func (s *GormStore) Carts() CartRepository {
+	return &cartRepository{s.conn}
+}
+
+func (s *GormStore) Addresses() AddressRepository {
+	return &addressRepository{s.conn}
+}
+
+func (s *GormStore) Shipping() ShippingRepository {
+	return &shippingRepository{s.conn}
+}
+
+func (s *GormStore) Shipments() ShipmentRepository {
+	return &shipmentRepository{s.conn}
+}
+
+func (s *GormStore) Invoices() InvoiceRepository {
+	return &invoiceRepository{s.conn}
+}
+
+func (s *GormStore) Notifications() NotificationRepository {
+	return &notificationRepository{s.conn}
+}
+
+func (s *GormStore) Tokens() TokenRepository {
+	return &tokenRepository{s.conn}
+}
+
+func (s *GormStore) Audit() AuditRepository {
+	return &auditRepository{s.conn}
+}
+
+func (s *GormStore) WithinTx(ctx context.Context, fn func(tx Store) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&GormStore{conn{db: tx, timeout: s.timeout}})
+	})
+}
+
+// conn is a database handle that bounds each query by timeout.
+type conn struct {
+	db      *gorm.DB
+	timeout time.Duration
+}
+
+// query returns the handle to run a single query under ctx. The caller must
+// call cancel once the query has finished.
+func (c conn) query(ctx context.Context) (db *gorm.DB, cancel context.CancelFunc) {
+	if c.timeout <= 0 {
+		return c.db.WithContext(ctx), func() {}
+	}
+	ctx, cancel = context.WithTimeout(ctx, c.timeout)
+	return c.db.WithContext(ctx), cancel
+}
+
+type customerRepository struct {
+	conn
+}
+
+func (r *customerRepository) CreateCustomer(ctx context.Context, customer *models.Customer) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Create(customer).Error
+	return metrics.ObserveQuery("create_customer", start, translate(err, "customer"))
+}
+
+func (r *customerRepository) GetCustomer(ctx context.Context, id uint) (*models.Customer, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var customer models.Customer
+	err := db.First(&customer, id).Error
+	return &customer, metrics.ObserveQuery("get_customer", start, translate(err, "customer"))
+}
+
+func (r *customerRepository) GetCustomerByEmail(ctx context.Context, email string) (*models.Customer, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var customer models.Customer
+	err := db.Where("LOWER(email) = ?", strings.ToLower(email)).Order("id").First(&customer).Error
+	return &customer, metrics.ObserveQuery("get_customer_by_email", start, translate(err, "customer"))
+}
+
+func (r *customerRepository) SetPassword(ctx context.Context, id uint, hash string, changedAt time.Time) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	result := db.Model(&models.Customer{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"password_hash":       hash,
+		"password_changed_at": changedAt,
+		"token_version":       gorm.Expr("token_version + 1"),
+	})
+	err := result.Error
+	if err == nil && result.RowsAffected == 0 {
+		err = apperrors.NotFound("customer not found", nil)
+	}
+	return metrics.ObserveQuery("set_customer_password", start, translate(err, "customer"))
+}
+
+func (r *customerRepository) VerifyEmail(ctx context.Context, id uint, verifiedAt time.Time) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	result := db.Model(&models.Customer{}).Where("id = ?", id).Update("email_verified_at", verifiedAt)
+	err := result.Error
+	if err == nil && result.RowsAffected == 0 {
+		err = apperrors.NotFound("customer not found", nil)
+	}
+	return metrics.ObserveQuery("verify_customer_email", start, translate(err, "customer"))
+}
+
+func (r *customerRepository) EraseCustomer(ctx context.Context, id uint, erasedAt time.Time) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	result := db.Model(&models.Customer{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"name":                models.ErasedName,
+		"email":               models.ErasedEmail(id),
+		"password_hash":       "",
+		"password_changed_at": erasedAt,
+		"token_version":       gorm.Expr("token_version + 1"),
+		"email_verified_at":   nil,
+		"erased_at":           erasedAt,
+	})
+	err := result.Error
+	if err == nil && result.RowsAffected == 0 {
+		err = apperrors.NotFound("customer not found", nil)
+	}
+	return metrics.ObserveQuery("erase_customer", start, translate(err, "customer"))
+}
+
+func (r *customerRepository) DeleteCustomer(ctx context.Context, id uint) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.Customer{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return apperrors.NotFound("customer not found", nil)
+		}
+		var open int64
+		err := tx.Model(&models.Order{}).
+			Where("customer_id = ? AND status IN ?", id, models.OpenOrderStatuses).
+			Count(&open).Error
+		if err == nil && open > 0 {
+			err = apperrors.Conflict("customer has orders that are still in progress; deliver or cancel them first", nil)
+		}
+		return err
+	})
+	return metrics.ObserveQuery("delete_customer", start, translate(err, "customer"))
+}
+
+func (r *customerRepository) RestoreCustomer(ctx context.Context, id uint) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := restore(db, &models.Customer{}, id, "customer")
+	return metrics.ObserveQuery("restore_customer", start, translate(err, "customer"))
 }
 
-func NewOrderRepository(db *gorm.DB) *OrderRepository {
-	return &OrderRepository{db: db}
+func (r *customerRepository) PurgeCustomers(ctx context.Context, cutoff time.Time) ([]uint, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var ids []uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(&models.Customer{}).
+			Where("deleted_at < ?", cutoff).
+			Where("NOT EXISTS (SELECT 1 FROM orders WHERE orders.customer_id = customers.id)").
+			Order("id").Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		for _, model := range []interface{}{&models.Address{}, &models.Notification{}, &models.CustomerToken{}} {
+			if err := tx.Unscoped().Where("customer_id IN ?", ids).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Delete(&models.Customer{}, ids).Error
+	})
+	if err != nil {
+		ids = nil
+	}
+	return ids, metrics.ObserveQuery("purge_customers", start, translate(err, "customer"))
 }
 
-func (r *OrderRepository) CreateOrder(order *models.Order) error {
-	return r.db.Create(order).Error
+// restore undoes the soft delete of the row of model with id. It fails with
+// not found unless the row exists and is deleted.
+func restore(db *gorm.DB, model interface{}, id uint, entity string) error {
+	result := db.Unscoped().Model(model).Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return apperrors.NotFound("deleted "+entity+" not found", nil)
+	}
+	return result.Error
 }
 
-func (r *OrderRepository) GetOrder(id uint) (*models.Order, error) {
+type productRepository struct {
+	conn
+}
+
+func (r *productRepository) CreateProduct(ctx context.Context, product *models.Product) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := checkSKUs(tx, product); err != nil {
+			return err
+		}
+		return tx.Create(product).Error
+	})
+	return metrics.ObserveQuery("create_product", start, translate(err, "product"))
+}
+
+// checkSKUs fails with a conflict if a SKU of product or its variants is
+// taken in either table, including by a deleted product, which keeps its
+// SKUs until it is purged. The unique indexes only cover one table each.
+func checkSKUs(tx *gorm.DB, product *models.Product) error {
+	var skus []string
+	if product.SKU != "" {
+		skus = append(skus, product.SKU)
+	}
+	for _, variant := range product.Variants {
+		if variant.SKU != "" {
+			skus = append(skus, variant.SKU)
+		}
+	}
+	if len(skus) == 0 {
+		return nil
+	}
+	for _, model := range []interface{}{&models.Product{}, &models.ProductVariant{}} {
+		var taken []string
+		if err := tx.Unscoped().Model(model).Where("sku IN ?", skus).Pluck("sku", &taken).Error; err != nil {
+			return err
+		}
+		if len(taken) > 0 {
+			return apperrors.Conflict("SKU "+taken[0]+" is already in use", nil)
+		}
+	}
+	return nil
+}
+
+func (r *productRepository) GetProduct(ctx context.Context, id uint) (*models.Product, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var product models.Product
+	err := db.Preload("Variants").First(&product, id).Error
+	return &product, metrics.ObserveQuery("get_product", start, translate(err, "product"))
+}
+
+func (r *productRepository) GetAllProducts(ctx context.Context) ([]models.Product, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var products []models.Product
+	err := db.Preload("Variants").Find(&products).Error
+	return products, metrics.ObserveQuery("get_all_products", start, translate(err, "product"))
+}
+
+// productSorts maps the sort keys accepted by GET /products to columns.
+var productSorts = map[string]string{
+	"name":        "name",
+	"-name":       "name DESC",
+	"price":       "price",
+	"-price":      "price DESC",
+	"created_at":  "created_at",
+	"-created_at": "created_at DESC",
+}
+
+// productDocument is the text searched on Postgres. It matches the
+// expression of the full-text index created by migration 0005.
+const productDocument = "to_tsvector('english', name || ' ' || description)"
+
+// SearchProducts uses Postgres full-text search, ranking matches by
+// relevance unless another order is asked for. Other databases fall back
+// to substring matching. Either way an exact SKU also matches.
+func (r *productRepository) SearchProducts(ctx context.Context, q models.ProductQuery) ([]models.Product, int64, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+
+	fullText := db.Dialector.Name() == "postgres"
+	query := db.Model(&models.Product{})
+	if q.IncludeDeleted {
+		query = query.Unscoped()
+	}
+	if q.Status != "all" {
+		query = query.Where("status = ?", q.Status)
+	}
+	if q.Search != "" {
+		sku := models.NormalizeSKU(q.Search)
+		if fullText {
+			query = query.Where("("+productDocument+" @@ plainto_tsquery('english', ?) OR sku = ?)", q.Search, sku)
+		} else {
+			pattern := "%" + escapeLike(strings.ToLower(q.Search)) + "%"
+			query = query.Where(`(LOWER(name) LIKE ? ESCAPE '\' OR LOWER(description) LIKE ? ESCAPE '\' OR sku = ?)`,
+				pattern, pattern, sku)
+		}
+	}
+	if q.Category != "" {
+		query = query.Where("LOWER(category) = ?", strings.ToLower(q.Category))
+	}
+	if q.Tag != "" {
+		// Tags are stored as a JSON array of lower-case strings.
+		query = query.Where(`tags LIKE ? ESCAPE '\'`, `%"`+escapeLike(strings.ToLower(q.Tag))+`"%`)
+	}
+	if q.MinPrice != nil {
+		query = query.Where("price >= ?", *q.MinPrice)
+	}
+	if q.MaxPrice != nil {
+		query = query.Where("price <= ?", *q.MaxPrice)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	var products []models.Product
+	err := query.Count(&total).Error
+	if err == nil && total > 0 {
+		page := query.Preload("Variants")
+		switch {
+		case q.Sort != "":
+			page = page.Order(productSorts[q.Sort]).Order("id")
+		case q.Search != "" && fullText:
+			page = page.Order(clause.Expr{
+				SQL:  "ts_rank(" + productDocument + ", plainto_tsquery('english', ?)) DESC, id",
+				Vars: []interface{}{q.Search},
+			})
+		default:
+			page = page.Order("id")
+		}
+		err = page.Limit(q.PerPage).Offset((q.Page - 1) * q.PerPage).Find(&products).Error
+	}
+	return products, total, metrics.ObserveQuery("search_products", start, translate(err, "product"))
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (r *productRepository) UpdateProductStatus(ctx context.Context, id uint, status string) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	result := db.Model(&models.Product{}).Where("id = ?", id).Update("status", status)
+	err := result.Error
+	if err == nil && result.RowsAffected == 0 {
+		err = apperrors.NotFound("product not found", nil)
+	}
+	return metrics.ObserveQuery("update_product_status", start, translate(err, "product"))
+}
+
+// DeleteProduct deletes before looking for open orders, so an order
+// reserving the product's stock meanwhile waits for the row and then finds
+// no product to reserve.
+func (r *productRepository) DeleteProduct(ctx context.Context, id uint) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.Product{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return apperrors.NotFound("product not found", nil)
+		}
+		var open int64
+		err := tx.Model(&models.Order{}).
+			Where("status IN ?", models.OpenOrderStatuses).
+			Where("(id IN (SELECT order_id FROM order_items WHERE product_id = ?) OR "+
+				"id IN (SELECT order_id FROM order_products WHERE product_id = ?))", id, id).
+			Count(&open).Error
+		if err == nil && open > 0 {
+			err = apperrors.Conflict("product is on orders that are still in progress; archive it to stop new orders", nil)
+		}
+		return err
+	})
+	return metrics.ObserveQuery("delete_product", start, translate(err, "product"))
+}
+
+func (r *productRepository) RestoreProduct(ctx context.Context, id uint) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := restore(db, &models.Product{}, id, "product")
+	return metrics.ObserveQuery("restore_product", start, translate(err, "product"))
+}
+
+func (r *productRepository) PurgeProducts(ctx context.Context, cutoff time.Time) ([]uint, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var ids []uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(&models.Product{}).
+			Where("deleted_at < ?", cutoff).
+			Where("NOT EXISTS (SELECT 1 FROM order_items WHERE order_items.product_id = products.id)").
+			Where("NOT EXISTS (SELECT 1 FROM order_products WHERE order_products.product_id = products.id)").
+			Order("id").Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		if err := tx.Where("product_id IN ?", ids).Delete(&models.ProductVariant{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.Product{}, ids).Error
+	})
+	if err != nil {
+		ids = nil
+	}
+	return ids, metrics.ObserveQuery("purge_products", start, translate(err, "product"))
+}
+
+type orderRepository struct {
+	conn
+}
+
+func (r *orderRepository) CreateOrder(ctx context.Context, order *models.Order) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := reserveStock(tx, order.Items); err != nil {
+			return err
+		}
+		return tx.Create(order).Error
+	})
+	if err == nil {
+		status := order.Status
+		if status == "" {
+			status = models.OrderPending
+		}
+		metrics.OrdersCreated.WithLabelValues(status).Inc()
+	}
+	return metrics.ObserveQuery("create_order", start, translate(err, "order"))
+}
+
+func (r *orderRepository) GetOrder(ctx context.Context, id uint) (*models.Order, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var order models.Order
+	err := preloadOrder(db).First(&order, id).Error
+	return &order, metrics.ObserveQuery("get_order", start, translate(err, "order"))
+}
+
+func (r *orderRepository) GetOrderIncludingDeleted(ctx context.Context, id uint) (*models.Order, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
 	var order models.Order
-	err := r.db.Preload("Products").First(&order, id).Error
-	return &order, err
+	err := preloadOrder(db).Unscoped().First(&order, id).Error
+	return &order, metrics.ObserveQuery("get_order_including_deleted", start, translate(err, "order"))
+}
+
+// preloadOrder loads an order's products, including deleted ones, which
+// stay on the orders placed before, with its lines and discounts.
+func preloadOrder(db *gorm.DB) *gorm.DB {
+	return db.Preload("Products", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Preload("Items").Preload("Discounts")
+}
+
+func (r *orderRepository) UpdateOrderStatus(ctx context.Context, id uint, status string) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var updated bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		err := tx.Select("id", "status").First(&order, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && order.Status == status) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !models.CanTransition(order.Status, status) {
+			return apperrors.Conflict("order cannot move from "+order.Status+" to "+status, nil)
+		}
+
+		// Only the update that moves the order from the status read above
+		// succeeds, so concurrent cancellations cannot restock twice.
+		result := tx.Model(&models.Order{}).
+			Where("id = ? AND status = ?", id, order.Status).
+			Update("status", status)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return apperrors.Conflict("order status changed while updating it; retry", nil)
+		}
+		updated = true
+		if status != models.OrderCancelled {
+			return nil
+		}
+		var items []models.OrderItem
+		if err := tx.Where("order_id = ?", id).Find(&items).Error; err != nil {
+			return err
+		}
+		if err := releaseStock(tx, items); err != nil {
+			return err
+		}
+		var discounts []models.OrderDiscount
+		if err := tx.Where("order_id = ?", id).Find(&discounts).Error; err != nil {
+			return err
+		}
+		return releaseRedemptions(tx, discounts)
+	})
+	if err == nil && updated {
+		metrics.OrderStatusUpdates.WithLabelValues(status).Inc()
+	}
+	return metrics.ObserveQuery("update_order_status", start, translate(err, "order"))
+}
+
+func (r *orderRepository) ApplyDiscounts(ctx context.Context, order *models.Order, discounts []models.OrderDiscount) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	for i := range discounts {
+		discounts[i].OrderID = order.ID
+	}
+	for i := range order.Items {
+		order.Items[i].OrderID = order.ID
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if len(discounts) > 0 {
+			if err := tx.Create(&discounts).Error; err != nil {
+				return err
+			}
+		}
+		for i := range order.Items {
+			if err := tx.Save(&order.Items[i]).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{
+			"discount":   order.Discount,
+			"tax_amount": order.TaxAmount,
+		}).Error
+	})
+	return metrics.ObserveQuery("apply_order_discounts", start, translate(err, "order"))
+}
+
+func (r *orderRepository) RecordPayment(ctx context.Context, id uint, reference string, paidAt time.Time) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	result := db.Model(&models.Order{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"payment_reference": reference,
+		"paid_at":           paidAt,
+	})
+	err := result.Error
+	if err == nil && result.RowsAffected == 0 {
+		err = apperrors.NotFound("order not found", nil)
+	}
+	return metrics.ObserveQuery("record_order_payment", start, translate(err, "order"))
+}
+
+func (r *orderRepository) ListCustomerOrders(ctx context.Context, customerID uint, page, perPage int) ([]models.Order, int64, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	query := db.Model(&models.Order{}).Where("customer_id = ?", customerID).Session(&gorm.Session{})
+
+	var total int64
+	var orders []models.Order
+	err := query.Count(&total).Error
+	if err == nil && total > 0 {
+		err = preloadOrder(query).
+			Order("created_at DESC").Order("id DESC").
+			Offset((page - 1) * perPage).Limit(perPage).Find(&orders).Error
+	}
+	return orders, total, metrics.ObserveQuery("list_customer_orders", start, translate(err, "order"))
+}
+
+func (r *orderRepository) CustomerOrderIDs(ctx context.Context, customerID uint) ([]uint, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var ids []uint
+	err := db.Unscoped().Model(&models.Order{}).Where("customer_id = ?", customerID).Order("id").Pluck("id", &ids).Error
+	return ids, metrics.ObserveQuery("customer_order_ids", start, translate(err, "order"))
+}
+
+func (r *orderRepository) EraseShippingAddresses(ctx context.Context, customerID uint) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Unscoped().Model(&models.Order{}).Where("customer_id = ?", customerID).Updates(map[string]interface{}{
+		"shipping_recipient": "",
+		"shipping_street":    "",
+		"shipping_phone":     "",
+	}).Error
+	return metrics.ObserveQuery("erase_order_addresses", start, translate(err, "order"))
+}
+
+func (r *orderRepository) DeleteOrder(ctx context.Context, id uint) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("status NOT IN ?", models.OpenOrderStatuses).Delete(&models.Order{}, id)
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result.Error
+		}
+		var order models.Order
+		if err := tx.Select("id", "status").First(&order, id).Error; err != nil {
+			return err
+		}
+		return apperrors.Conflict("order is still in progress; deliver or cancel it first", nil)
+	})
+	return metrics.ObserveQuery("delete_order", start, translate(err, "order"))
+}
+
+func (r *orderRepository) RestoreOrder(ctx context.Context, id uint) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := restore(db, &models.Order{}, id, "order")
+	return metrics.ObserveQuery("restore_order", start, translate(err, "order"))
+}
+
+func (r *orderRepository) PurgeOrders(ctx context.Context, cutoff time.Time) ([]uint, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var ids []uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(&models.Order{}).
+			Where("deleted_at < ? AND paid_at IS NULL AND payment_reference = ''", cutoff).
+			Where("NOT EXISTS (SELECT 1 FROM invoices WHERE invoices.order_id = orders.id)").
+			Where("NOT EXISTS (SELECT 1 FROM shipments WHERE shipments.order_id = orders.id)").
+			Order("id").Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		for _, model := range []interface{}{&models.Notification{}, &models.OrderDiscount{}, &models.OrderItem{}} {
+			if err := tx.Unscoped().Where("order_id IN ?", ids).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Exec("DELETE FROM order_products WHERE order_id IN ?", ids).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.Order{}, ids).Error
+	})
+	if err != nil {
+		ids = nil
+	}
+	return ids, metrics.ObserveQuery("purge_orders", start, translate(err, "order"))
+}
+
+func (r *orderRepository) RepriceOrder(ctx context.Context, order *models.Order) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i := range order.Items {
+			order.Items[i].OrderID = order.ID
+			if err := tx.Save(&order.Items[i]).Error; err != nil {
+				return err
+			}
+		}
+		for _, discount := range order.Discounts {
+			err := tx.Model(&models.OrderDiscount{}).Where("id = ?", discount.ID).
+				Update("amount", discount.Amount).Error
+			if err != nil {
+				return err
+			}
+		}
+		result := tx.Model(&models.Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{
+			"currency":     order.Currency,
+			"discount":     order.Discount,
+			"tax_amount":   order.TaxAmount,
+			"shipping_fee": order.ShippingFee,
+		})
+		if result.Error == nil && result.RowsAffected == 0 {
+			return apperrors.NotFound("order not found", nil)
+		}
+		return result.Error
+	})
+	return metrics.ObserveQuery("reprice_order", start, translate(err, "order"))
+}
+
+// stockOf returns the row that holds the stock for item: its variant if it
+// has one, otherwise its product.
+func stockOf(tx *gorm.DB, item models.OrderItem) *gorm.DB {
+	if item.VariantID != 0 {
+		return tx.Model(&models.ProductVariant{}).Where("id = ?", item.VariantID)
+	}
+	return tx.Model(&models.Product{}).Where("id = ?", item.ProductID)
+}
+
+// reserveStock takes each line's quantity off its product's or variant's
+// stock. The conditional update keeps concurrent orders from selling the
+// same units; rows without tracked stock always match.
+func reserveStock(tx *gorm.DB, items []models.OrderItem) error {
+	for _, item := range items {
+		result := stockOf(tx, item).
+			Where("stock IS NULL OR stock >= ?", item.Quantity).
+			Update("stock", gorm.Expr("stock - ?", item.Quantity))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return apperrors.Conflict("insufficient stock for "+item.Name, nil)
+		}
+	}
+	return nil
+}
+
+// releaseStock returns each line's quantity to its product's or variant's
+// stock.
+func releaseStock(tx *gorm.DB, items []models.OrderItem) error {
+	for _, item := range items {
+		err := stockOf(tx, item).
+			Where("stock IS NOT NULL").
+			Update("stock", gorm.Expr("stock + ?", item.Quantity)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseRedemptions gives back the use each discount made of its
+// promotion.
+func releaseRedemptions(tx *gorm.DB, discounts []models.OrderDiscount) error {
+	for _, discount := range discounts {
+		err := tx.Model(&models.Promotion{}).
+			Where("id = ? AND usage_count > 0", discount.PromotionID).
+			Update("usage_count", gorm.Expr("usage_count - 1")).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type promotionRepository struct {
+	conn
+}
+
+func (r *promotionRepository) CreatePromotion(ctx context.Context, promotion *models.Promotion) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Create(promotion).Error
+	return metrics.ObserveQuery("create_promotion", start, translate(err, "promotion"))
+}
+
+func (r *promotionRepository) GetPromotionByCode(ctx context.Context, code string) (*models.Promotion, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var promotion models.Promotion
+	err := db.Where("code = ?", code).First(&promotion).Error
+	return &promotion, metrics.ObserveQuery("get_promotion", start, translate(err, "promotion"))
+}
+
+func (r *promotionRepository) GetAllPromotions(ctx context.Context) ([]models.Promotion, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var promotions []models.Promotion
+	err := db.Order("id").Find(&promotions).Error
+	return promotions, metrics.ObserveQuery("get_all_promotions", start, translate(err, "promotion"))
+}
+
+func (r *promotionRepository) CountCustomerRedemptions(ctx context.Context, promotionID, customerID uint) (int64, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var count int64
+	err := db.Model(&models.OrderDiscount{}).
+		Joins("JOIN orders ON orders.id = order_discounts.order_id").
+		Where("order_discounts.promotion_id = ? AND orders.customer_id = ? AND orders.status <> ?",
+			promotionID, customerID, models.OrderCancelled).
+		Count(&count).Error
+	return count, metrics.ObserveQuery("count_redemptions", start, translate(err, "promotion"))
+}
+
+// Redeem increments the usage count in a single conditional update so
+// concurrent orders cannot exceed the limit.
+func (r *promotionRepository) Redeem(ctx context.Context, promotionID uint) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	result := db.Model(&models.Promotion{}).
+		Where("id = ? AND (usage_limit = 0 OR usage_count < usage_limit)", promotionID).
+		Update("usage_count", gorm.Expr("usage_count + 1"))
+	err := result.Error
+	if err == nil && result.RowsAffected == 0 {
+		err = apperrors.Conflict("coupon usage limit reached", nil)
+	}
+	return metrics.ObserveQuery("redeem_promotion", start, translate(err, "promotion"))
+}
+
+type cartRepository struct {
+	conn
+}
+
+func (r *cartRepository) CreateCart(ctx context.Context, cart *models.Cart) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Create(cart).Error
+	return metrics.ObserveQuery("create_cart", start, translate(err, "cart"))
+}
+
+func (r *cartRepository) GetCart(ctx context.Context, id uint) (*models.Cart, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var cart models.Cart
+	err := db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).First(&cart, id).Error
+	return &cart, metrics.ObserveQuery("get_cart", start, translate(err, "cart"))
+}
+
+func (r *cartRepository) SaveCart(ctx context.Context, cart *models.Cart) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(cart).Select("CustomerID", "CouponCodes", "ExpiresAt").Updates(cart).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("cart_id = ?", cart.ID).Delete(&models.CartItem{}).Error; err != nil {
+			return err
+		}
+		if len(cart.Items) == 0 {
+			return nil
+		}
+		for i := range cart.Items {
+			cart.Items[i].ID = 0
+			cart.Items[i].CartID = cart.ID
+		}
+		return tx.Create(&cart.Items).Error
+	})
+	return metrics.ObserveQuery("save_cart", start, translate(err, "cart"))
+}
+
+func (r *cartRepository) CheckOut(ctx context.Context, id, orderID uint) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	result := db.Model(&models.Cart{}).
+		Where("id = ? AND status = ?", id, models.CartOpen).
+		Updates(map[string]interface{}{"status": models.CartCheckedOut, "order_id": orderID})
+	err := result.Error
+	if err == nil && result.RowsAffected == 0 {
+		err = apperrors.Conflict("cart has already been checked out", nil)
+	}
+	return metrics.ObserveQuery("check_out_cart", start, translate(err, "cart"))
+}
+
+func (r *cartRepository) DeleteExpiredCarts(ctx context.Context, cutoff time.Time) (int64, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var deleted int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		err := tx.Model(&models.Cart{}).
+			Where("status = ? AND expires_at < ?", models.CartOpen, cutoff).
+			Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		if err := tx.Where("cart_id IN ?", ids).Delete(&models.CartItem{}).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Delete(&models.Cart{}, ids)
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	return deleted, metrics.ObserveQuery("delete_expired_carts", start, translate(err, "cart"))
+}
+
+type addressRepository struct {
+	conn
+}
+
+func (r *addressRepository) CreateAddress(ctx context.Context, address *models.Address) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Create(address).Error
+	return metrics.ObserveQuery("create_address", start, translate(err, "address"))
+}
+
+func (r *addressRepository) GetAddress(ctx context.Context, id uint) (*models.Address, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var address models.Address
+	err := db.First(&address, id).Error
+	return &address, metrics.ObserveQuery("get_address", start, translate(err, "address"))
+}
+
+func (r *addressRepository) ListAddresses(ctx context.Context, customerID uint) ([]models.Address, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var addresses []models.Address
+	err := db.Where("customer_id = ?", customerID).Order("id").Find(&addresses).Error
+	return addresses, metrics.ObserveQuery("list_addresses", start, translate(err, "address"))
+}
+
+func (r *addressRepository) UpdateAddress(ctx context.Context, address *models.Address) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(address).Select("Label", "Recipient", "County", "Town", "Street", "Phone").Updates(address)
+		if result.Error == nil && result.RowsAffected == 0 {
+			return apperrors.NotFound("address not found", nil)
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		return tx.First(address, address.ID).Error
+	})
+	return metrics.ObserveQuery("update_address", start, translate(err, "address"))
+}
+
+func (r *addressRepository) DeleteAddress(ctx context.Context, id uint) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	result := db.Delete(&models.Address{}, id)
+	err := result.Error
+	if err == nil && result.RowsAffected == 0 {
+		err = apperrors.NotFound("address not found", nil)
+	}
+	return metrics.ObserveQuery("delete_address", start, translate(err, "address"))
+}
+
+func (r *addressRepository) DeleteCustomerAddresses(ctx context.Context, customerID uint) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Unscoped().Where("customer_id = ?", customerID).Delete(&models.Address{}).Error
+	return metrics.ObserveQuery("delete_customer_addresses", start, translate(err, "address"))
+}
+
+func (r *addressRepository) PurgeAddresses(ctx context.Context, cutoff time.Time) (int64, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	result := db.Unscoped().Where("deleted_at < ?", cutoff).Delete(&models.Address{})
+	return result.RowsAffected, metrics.ObserveQuery("purge_addresses", start, translate(result.Error, "address"))
 }
 
-func (r *OrderRepository) UpdateOrderStatus(id uint, status string) error {
-	return r.db.Model(&models.Order{}).Where("id = ?", id).Update("status", status).Error
+type shippingRepository struct {
+	conn
 }
 
-func (r *OrderRepository) CreateCustomer(customer *models.Customer) error {
-	return r.db.Create(customer).Error
+func (r *shippingRepository) CreateShippingMethod(ctx context.Context, method *models.ShippingMethod) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Create(method).Error
+	return metrics.ObserveQuery("create_shipping_method", start, translate(err, "shipping method"))
 }
 
-func (r *OrderRepository) CreateProduct(product *models.Product) error {
-	return r.db.Create(product).Error
+func (r *shippingRepository) GetShippingMethod(ctx context.Context, code string) (*models.ShippingMethod, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var method models.ShippingMethod
+	err := db.Preload("Rates", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("code = ?", code).First(&method).Error
+	return &method, metrics.ObserveQuery("get_shipping_method", start, translate(err, "shipping method"))
 }
 
-func (r *OrderRepository) GetAllProducts(products *[]models.Product) error {
-	return r.db.Find(products).Error
-}
\ No newline at end of file
+func (r *shippingRepository) GetAllShippingMethods(ctx context.Context) ([]models.ShippingMethod, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var methods []models.ShippingMethod
+	err := db.Preload("Rates", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Order("id").Find(&methods).Error
+	return methods, metrics.ObserveQuery("get_all_shipping_methods", start, translate(err, "shipping method"))
+}
+
+func (r *shippingRepository) SaveShippingMethod(ctx context.Context, method *models.ShippingMethod) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(method).Select("Name", "Pickup", "Currency", "Disabled").Updates(method)
+		if result.Error == nil && result.RowsAffected == 0 {
+			return apperrors.NotFound("shipping method not found", nil)
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		err := tx.Where("shipping_method_id = ?", method.ID).Delete(&models.ShippingRate{}).Error
+		if err != nil {
+			return err
+		}
+		for i := range method.Rates {
+			method.Rates[i].ID = 0
+			method.Rates[i].ShippingMethodID = method.ID
+		}
+		return tx.Create(&method.Rates).Error
+	})
+	return metrics.ObserveQuery("save_shipping_method", start, translate(err, "shipping method"))
+}
+
+type shipmentRepository struct {
+	conn
+}
+
+func (r *shipmentRepository) CreateShipment(ctx context.Context, shipment *models.Shipment) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Create(shipment).Error
+	return metrics.ObserveQuery("create_shipment", start, translate(err, "shipment"))
+}
+
+func (r *shipmentRepository) GetShipment(ctx context.Context, id uint) (*models.Shipment, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var shipment models.Shipment
+	err := db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).First(&shipment, id).Error
+	return &shipment, metrics.ObserveQuery("get_shipment", start, translate(err, "shipment"))
+}
+
+func (r *shipmentRepository) ListShipments(ctx context.Context, orderID uint) ([]models.Shipment, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var shipments []models.Shipment
+	err := db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("order_id = ?", orderID).Order("id").Find(&shipments).Error
+	return shipments, metrics.ObserveQuery("list_shipments", start, translate(err, "shipment"))
+}
+
+func (r *shipmentRepository) UpdateShipment(ctx context.Context, shipment *models.Shipment) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	result := db.Model(shipment).
+		Select("Carrier", "TrackingNumber", "Status", "ShippedAt", "DeliveredAt").
+		Updates(shipment)
+	err := result.Error
+	if err == nil && result.RowsAffected == 0 {
+		err = apperrors.NotFound("shipment not found", nil)
+	}
+	return metrics.ObserveQuery("update_shipment", start, translate(err, "shipment"))
+}
+
+type invoiceRepository struct {
+	conn
+}
+
+// invoiceCounter is the single row holding the last invoice sequence
+// number issued.
+type invoiceCounter struct {
+	ID    uint `gorm:"primaryKey;autoIncrement:false"`
+	Value uint `gorm:"not null"`
+}
+
+func (r *invoiceRepository) IssueInvoice(ctx context.Context, orderID uint) (*models.Invoice, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var invoice models.Invoice
+	issue := func(tx *gorm.DB) error {
+		err := tx.Where("order_id = ?", orderID).First(&invoice).Error
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		// The counter row stays locked until the transaction ends and is
+		// rolled back with it, so a failed issue gives its number back.
+		var sequence uint
+		err = tx.Raw(`INSERT INTO invoice_counters (id, value) VALUES (1, 1)
+			ON CONFLICT (id) DO UPDATE SET value = invoice_counters.value + 1
+			RETURNING value`).Scan(&sequence).Error
+		if err != nil {
+			return err
+		}
+		invoice = models.Invoice{OrderID: orderID, Sequence: sequence, Number: models.InvoiceNumber(sequence)}
+		return tx.Create(&invoice).Error
+	}
+	err := db.Transaction(issue)
+	if apperrors.Is(translate(err, "invoice"), apperrors.KindConflict) {
+		// A concurrent request issued the order's invoice first.
+		err = db.Where("order_id = ?", orderID).First(&invoice).Error
+	}
+	return &invoice, metrics.ObserveQuery("issue_invoice", start, translate(err, "invoice"))
+}
+
+func (r *invoiceRepository) GetInvoice(ctx context.Context, orderID uint) (*models.Invoice, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var invoice models.Invoice
+	err := db.Where("order_id = ?", orderID).First(&invoice).Error
+	return &invoice, metrics.ObserveQuery("get_invoice", start, translate(err, "invoice"))
+}
+
+type notificationRepository struct {
+	conn
+}
+
+func (r *notificationRepository) CreateNotification(ctx context.Context, notification *models.Notification) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Create(notification).Error
+	return metrics.ObserveQuery("create_notification", start, translate(err, "notification"))
+}
+
+func (r *notificationRepository) GetNotification(ctx context.Context, id uint) (*models.Notification, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var notification models.Notification
+	err := db.First(&notification, id).Error
+	return &notification, metrics.ObserveQuery("get_notification", start, translate(err, "notification"))
+}
+
+func (r *notificationRepository) ListNotifications(ctx context.Context, orderID uint) ([]models.Notification, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var notifications []models.Notification
+	err := db.Where("order_id = ?", orderID).Order("id").Find(&notifications).Error
+	return notifications, metrics.ObserveQuery("list_notifications", start, translate(err, "notification"))
+}
+
+func (r *notificationRepository) DueNotifications(ctx context.Context, now time.Time, limit int) ([]models.Notification, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var notifications []models.Notification
+	err := db.Where("status = ? AND next_attempt_at <= ?", models.NotificationPending, now).
+		Order("id").Limit(limit).Find(&notifications).Error
+	return notifications, metrics.ObserveQuery("due_notifications", start, translate(err, "notification"))
+}
+
+func (r *notificationRepository) UpdateNotification(ctx context.Context, notification *models.Notification) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	result := db.Model(notification).
+		Select("Status", "Attempts", "LastError", "NextAttemptAt", "SentAt").
+		Updates(notification)
+	err := result.Error
+	if err == nil && result.RowsAffected == 0 {
+		err = apperrors.NotFound("notification not found", nil)
+	}
+	return metrics.ObserveQuery("update_notification", start, translate(err, "notification"))
+}
+
+func (r *notificationRepository) ListCustomerNotifications(ctx context.Context, customerID uint) ([]models.Notification, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var notifications []models.Notification
+	err := db.Where("customer_id = ?", customerID).Order("id").Find(&notifications).Error
+	return notifications, metrics.ObserveQuery("list_customer_notifications", start, translate(err, "notification"))
+}
+
+func (r *notificationRepository) EraseNotifications(ctx context.Context, customerID uint, reason string) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Notification{}).
+			Where("customer_id = ? AND status = ?", customerID, models.NotificationPending).
+			Updates(map[string]interface{}{
+				"status":          models.NotificationFailed,
+				"last_error":      reason,
+				"next_attempt_at": nil,
+			}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&models.Notification{}).Where("customer_id = ?", customerID).
+			Updates(map[string]interface{}{"recipient": "", "body": ""}).Error
+	})
+	return metrics.ObserveQuery("erase_notifications", start, translate(err, "notification"))
+}
+
+type tokenRepository struct {
+	conn
+}
+
+func (r *tokenRepository) CreateToken(ctx context.Context, token *models.CustomerToken) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Create(token).Error
+	return metrics.ObserveQuery("create_customer_token", start, translate(err, "token"))
+}
+
+// UseToken claims the token with a conditional update, so of two
+// concurrent uses only one succeeds.
+func (r *tokenRepository) UseToken(ctx context.Context, purpose, hash string, now time.Time) (*models.CustomerToken, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var token models.CustomerToken
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.CustomerToken{}).
+			Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", hash, purpose, now).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return apperrors.NotFound("token is invalid or has expired", nil)
+		}
+		return tx.Where("token_hash = ?", hash).First(&token).Error
+	})
+	return &token, metrics.ObserveQuery("use_customer_token", start, translate(err, "token"))
+}
+
+func (r *tokenRepository) DeleteCustomerTokens(ctx context.Context, customerID uint) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Where("customer_id = ?", customerID).Delete(&models.CustomerToken{}).Error
+	return metrics.ObserveQuery("delete_customer_tokens", start, translate(err, "token"))
+}
+
+type auditRepository struct {
+	conn
+}
+
+func (r *auditRepository) RecordAudit(ctx context.Context, entry *models.AuditEntry) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Create(entry).Error
+	return metrics.ObserveQuery("record_audit", start, translate(err, "audit entry"))
+}
+
+func (r *auditRepository) ListAudit(ctx context.Context, q models.AuditQuery) ([]models.AuditEntry, int64, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+
+	query := db.Model(&models.AuditEntry{})
+	if q.Actor != "" {
+		query = query.Where("actor = ?", q.Actor)
+	}
+	if q.Action != "" {
+		query = query.Where("action = ?", q.Action)
+	}
+	if q.EntityType != "" {
+		query = query.Where("entity_type = ?", q.EntityType)
+	}
+	if q.EntityID != 0 {
+		query = query.Where("entity_id = ?", q.EntityID)
+	}
+	if q.RequestID != "" {
+		query = query.Where("request_id = ?", q.RequestID)
+	}
+	if q.From != nil {
+		query = query.Where("created_at >= ?", *q.From)
+	}
+	if q.To != nil {
+		query = query.Where("created_at < ?", *q.To)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	var entries []models.AuditEntry
+	err := query.Count(&total).Error
+	if err == nil && total > 0 {
+		err = query.Order("created_at DESC, id DESC").
+			Limit(q.PerPage).Offset((q.Page - 1) * q.PerPage).Find(&entries).Error
+	}
+	return entries, total, metrics.ObserveQuery("list_audit", start, translate(err, "audit entry"))
+}
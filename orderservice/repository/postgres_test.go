@@ -1,11 +1,14 @@
 package repository
 
 import (
+	"context"
 	"testing"
+	"time"
 	"orderservice/models"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"github.com/stretchr/testify/assert"
+	"orderservice/apperrors"
 )
 
 func setupTestDB() *gorm.DB {
@@ -13,23 +16,25 @@ func setupTestDB() *gorm.DB {
 	if err != nil {
 		panic("failed to connect database")
 	}
-	db.Migrator().DropTable(&models.Order{}, &models.Customer{}, &models.Product{})
-	db.AutoMigrate(&models.Order{}, &models.Customer{}, &models.Product{})
+	db.Migrator().DropTable("order_products", &models.AuditEntry{}, &models.CustomerToken{}, &models.Notification{}, &invoiceCounter{}, &models.Invoice{}, &models.ShipmentItem{}, &models.Shipment{}, &models.ShippingRate{}, &models.ShippingMethod{}, &models.Address{}, &models.CartItem{}, &models.Cart{}, &models.OrderItem{}, &models.OrderDiscount{}, &models.Promotion{}, &models.Order{}, &models.Customer{}, &models.ProductVariant{}, &models.Product{})
+	db.AutoMigrate(&models.Order{}, &models.Customer{}, &models.Product{}, &models.ProductVariant{}, &models.Promotion{}, &models.OrderDiscount{}, &models.OrderItem{}, &models.Cart{}, &models.CartItem{}, &models.Address{}, &models.ShippingMethod{}, &models.ShippingRate{}, &models.Shipment{}, &models.ShipmentItem{}, &models.Invoice{}, &invoiceCounter{}, &models.Notification{}, &models.CustomerToken{}, &models.AuditEntry{})
 	return db
 }
 
+var ctx = context.Background()
+
 func TestOrderRepository(t *testing.T) {
 	db := setupTestDB()
-	repo := NewOrderRepository(db)
+	repo := NewGormStore(db, 0)
 
 	t.Run("Create and get order", func(t *testing.T) {
 		customer := &models.Customer{Name: "Test Customer", Email: "test@example.com"}
-		err := repo.CreateCustomer(customer)
+		err := repo.Customers().CreateCustomer(ctx, customer)
 		assert.NoError(t, err)
 		assert.NotZero(t, customer.ID)
 
 		product := &models.Product{Name: "Test Product", Price: 29.99}
-		err = repo.CreateProduct(product)
+		err = repo.Products().CreateProduct(ctx, product)
 		assert.NoError(t, err)
 		assert.NotZero(t, product.ID)
 
@@ -37,11 +42,11 @@ func TestOrderRepository(t *testing.T) {
 			CustomerID: customer.ID,
 			Products:   []models.Product{*product},
 		}
-		err = repo.CreateOrder(order)
+		err = repo.Orders().CreateOrder(ctx, order)
 		assert.NoError(t, err)
 		assert.NotZero(t, order.ID)
 
-		fetchedOrder, err := repo.GetOrder(order.ID)
+		fetchedOrder, err := repo.Orders().GetOrder(ctx, order.ID)
 		assert.NoError(t, err)
 		assert.Equal(t, order.ID, fetchedOrder.ID)
 		assert.Equal(t, customer.ID, fetchedOrder.CustomerID)
@@ -50,42 +55,48 @@ func TestOrderRepository(t *testing.T) {
 	})
 
 	t.Run("Get non-existent order", func(t *testing.T) {
-		_, err := repo.GetOrder(999)
+		_, err := repo.Orders().GetOrder(ctx, 999)
 		assert.Error(t, err)
+		assert.True(t, apperrors.Is(err, apperrors.KindNotFound))
 	})
 
 	t.Run("Update order status", func(t *testing.T) {
 		customer := &models.Customer{Name: "Test Customer", Email: "test@example.com"}
-		repo.CreateCustomer(customer)
+		repo.Customers().CreateCustomer(ctx, customer)
 		product := &models.Product{Name: "Test Product", Price: 29.99}
-		repo.CreateProduct(product)
+		repo.Products().CreateProduct(ctx, product)
 		order := &models.Order{CustomerID: customer.ID, Products: []models.Product{*product}}
-		repo.CreateOrder(order)
+		repo.Orders().CreateOrder(ctx, order)
 
-		err := repo.UpdateOrderStatus(order.ID, "shipped")
+		err := repo.Orders().UpdateOrderStatus(ctx, order.ID, "paid")
+		assert.NoError(t, err)
+		err = repo.Orders().UpdateOrderStatus(ctx, order.ID, "shipped")
 		assert.NoError(t, err)
 
-		updatedOrder, err := repo.GetOrder(order.ID)
+		updatedOrder, err := repo.Orders().GetOrder(ctx, order.ID)
 		assert.NoError(t, err)
 		assert.Equal(t, "shipped", updatedOrder.Status)
+
+		err = repo.Orders().UpdateOrderStatus(ctx, order.ID, "pending")
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict), "orders do not move backwards")
 	})
 
 	t.Run("Update non-existent order status", func(t *testing.T) {
-		err := repo.UpdateOrderStatus(999, "shipped")
+		err := repo.Orders().UpdateOrderStatus(ctx, 999, "shipped")
 		assert.NoError(t, err)
 	})
 }
 
 func TestCustomerRepository(t *testing.T) {
 	db := setupTestDB()
-	repo := NewOrderRepository(db)
+	repo := NewGormStore(db, 0)
 
 	t.Run("Create customer", func(t *testing.T) {
 		customer := &models.Customer{
 			Name:  "John Doe",
 			Email: "john@example.com",
 		}
-		err := repo.CreateCustomer(customer)
+		err := repo.Customers().CreateCustomer(ctx, customer)
 		assert.NoError(t, err)
 		assert.NotZero(t, customer.ID)
 
@@ -95,18 +106,32 @@ func TestCustomerRepository(t *testing.T) {
 		assert.Equal(t, customer.Name, fetchedCustomer.Name)
 		assert.Equal(t, customer.Email, fetchedCustomer.Email)
 	})
+
+	t.Run("Create customer with duplicate email", func(t *testing.T) {
+		err := repo.Customers().CreateCustomer(ctx, &models.Customer{Name: "Jane Doe", Email: "john@example.com"})
+		assert.True(t, apperrors.Is(err, apperrors.KindConflict))
+	})
+
+	t.Run("Database unavailable", func(t *testing.T) {
+		closed := setupTestDB()
+		sqlDB, _ := closed.DB()
+		sqlDB.Close()
+
+		_, err := NewGormStore(closed, 0).Orders().GetOrder(ctx, 1)
+		assert.True(t, apperrors.Is(err, apperrors.KindUpstream))
+	})
 }
 
 func TestProductRepository(t *testing.T) {
 	db := setupTestDB()
-	repo := NewOrderRepository(db)
+	repo := NewGormStore(db, 0)
 
 	t.Run("Create product", func(t *testing.T) {
 		product := &models.Product{
 			Name:  "Test Product",
 			Price: 29.99,
 		}
-		err := repo.CreateProduct(product)
+		err := repo.Products().CreateProduct(ctx, product)
 		assert.NoError(t, err)
 		assert.NotZero(t, product.ID)
 	})
@@ -120,8 +145,7 @@ func TestProductRepository(t *testing.T) {
 			db.Create(&p)
 		}
 
-		var fetchedProducts []models.Product
-		err := repo.GetAllProducts(&fetchedProducts)
+		fetchedProducts, err := repo.Products().GetAllProducts(ctx)
 		assert.NoError(t, err)
 		assert.GreaterOrEqual(t, len(fetchedProducts), 2)
 	})
@@ -130,9 +154,28 @@ func TestProductRepository(t *testing.T) {
 		db.Migrator().DropTable(&models.Product{})
 		db.AutoMigrate(&models.Product{})
 
-		var products []models.Product
-		err := repo.GetAllProducts(&products)
+		products, err := repo.Products().GetAllProducts(ctx)
 		assert.NoError(t, err)
 		assert.Empty(t, products)
 	})
-}
\ No newline at end of file
+}
+
+func TestGormStoreContract(t *testing.T) {
+	testStore(t, NewGormStore(setupTestDB(), 0))
+}
+
+func TestQueryDeadlines(t *testing.T) {
+	db := setupTestDB()
+
+	t.Run("Query timeout", func(t *testing.T) {
+		_, err := NewGormStore(db, time.Nanosecond).Products().GetAllProducts(ctx)
+		assert.True(t, apperrors.Is(err, apperrors.KindUpstream))
+	})
+
+	t.Run("Cancelled request", func(t *testing.T) {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := NewGormStore(db, time.Minute).Orders().GetOrder(cancelled, 1)
+		assert.True(t, apperrors.Is(err, apperrors.KindUpstream))
+	})
+}
@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"orderservice/models"
+)
+
+type CustomerRepository interface {
+	CreateCustomer(ctx context.Context, customer *models.Customer) error
+	GetCustomer(ctx context.Context, id uint) (*models.Customer, error)
+	// GetCustomerByEmail looks the customer up by email address, ignoring
+	// case.
+	GetCustomerByEmail(ctx context.Context, email string) (*models.Customer, error)
+	// SetPassword stores the customer's password hash and when it was
+	// changed, and moves their token version on.
+	SetPassword(ctx context.Context, id uint, hash string, changedAt time.Time) error
+	// VerifyEmail records when the customer proved they own their email
+	// address.
+	VerifyEmail(ctx context.Context, id uint, verifiedAt time.Time) error
+	// EraseCustomer replaces the customer's name and email with
+	// placeholders, removes their password, ending their sessions, and
+	// records when their data was erased.
+	EraseCustomer(ctx context.Context, id uint, erasedAt time.Time) error
+	// DeleteCustomer soft-deletes the customer, which ends their sessions.
+	// It fails with a conflict while any of their orders is open.
+	DeleteCustomer(ctx context.Context, id uint) error
+	// RestoreCustomer undoes DeleteCustomer.
+	RestoreCustomer(ctx context.Context, id uint) error
+	// PurgeCustomers permanently removes customers deleted before cutoff,
+	// with their addresses, notifications and one-time tokens, and returns
+	// their IDs. Customers with orders, deleted or not, are kept for the
+	// accounts.
+	PurgeCustomers(ctx context.Context, cutoff time.Time) ([]uint, error)
+}
+
+type ProductRepository interface {
+	// CreateProduct stores the product with its variants. It fails with a
+	// conflict if any of their SKUs is already in use by a product or
+	// variant.
+	CreateProduct(ctx context.Context, product *models.Product) error
+	GetProduct(ctx context.Context, id uint) (*models.Product, error)
+	GetAllProducts(ctx context.Context) ([]models.Product, error)
+	// SearchProducts returns one page of the products matching query and
+	// the number of matches across all pages. The query's page and status
+	// must already be defaulted.
+	SearchProducts(ctx context.Context, query models.ProductQuery) ([]models.Product, int64, error)
+	UpdateProductStatus(ctx context.Context, id uint, status string) error
+	// DeleteProduct soft-deletes the product, so it can no longer be
+	// ordered. It fails with a conflict while an open order includes it.
+	DeleteProduct(ctx context.Context, id uint) error
+	// RestoreProduct undoes DeleteProduct.
+	RestoreProduct(ctx context.Context, id uint) error
+	// PurgeProducts permanently removes products deleted before cutoff,
+	// with their variants, and returns their IDs. Products on any order,
+	// deleted or not, are kept.
+	PurgeProducts(ctx context.Context, cutoff time.Time) ([]uint, error)
+}
+
+type OrderRepository interface {
+	// CreateOrder stores the order and reserves stock for each of its
+	// lines. It fails with a conflict when a product does not have enough
+	// stock.
+	CreateOrder(ctx context.Context, order *models.Order) error
+	GetOrder(ctx context.Context, id uint) (*models.Order, error)
+	// GetOrderIncludingDeleted is GetOrder that also finds deleted orders.
+	GetOrderIncludingDeleted(ctx context.Context, id uint) (*models.Order, error)
+	// UpdateOrderStatus sets the order's status, failing with a conflict
+	// unless models.CanTransition allows the move. Cancelling an order
+	// returns its reserved stock and its coupon uses.
+	UpdateOrderStatus(ctx context.Context, id uint, status string) error
+	// ApplyDiscounts stores new discounts against an existing order along
+	// with the order's updated discount, tax and line items.
+	ApplyDiscounts(ctx context.Context, order *models.Order, discounts []models.OrderDiscount) error
+	// RepriceOrder stores the order's currency, discount, tax and
+	// shipping fee along with its updated line items and discount amounts.
+	RepriceOrder(ctx context.Context, order *models.Order) error
+	// RecordPayment stores the M-Pesa receipt number of the payment for the
+	// order and when it was received.
+	RecordPayment(ctx context.Context, id uint, reference string, paidAt time.Time) error
+	// ListCustomerOrders returns one page of the customer's orders, newest
+	// first, and how many orders they have across all pages.
+	ListCustomerOrders(ctx context.Context, customerID uint, page, perPage int) ([]models.Order, int64, error)
+	// CustomerOrderIDs returns the IDs of every order the customer placed,
+	// deleted ones included, in ascending order.
+	CustomerOrderIDs(ctx context.Context, customerID uint) ([]uint, error)
+	// EraseShippingAddresses removes the recipient, street and phone from
+	// the delivery address of every order the customer placed. The county
+	// and town stay with the accounts.
+	EraseShippingAddresses(ctx context.Context, customerID uint) error
+	// DeleteOrder soft-deletes the order. It fails with a conflict while
+	// the order is open.
+	DeleteOrder(ctx context.Context, id uint) error
+	// RestoreOrder undoes DeleteOrder.
+	RestoreOrder(ctx context.Context, id uint) error
+	// PurgeOrders permanently removes orders deleted before cutoff, with
+	// their lines, discounts and notifications, and returns their IDs.
+	// Orders that were paid, invoiced or shipped are kept for the accounts.
+	PurgeOrders(ctx context.Context, cutoff time.Time) ([]uint, error)
+}
+
+type PromotionRepository interface {
+	CreatePromotion(ctx context.Context, promotion *models.Promotion) error
+	GetPromotionByCode(ctx context.Context, code string) (*models.Promotion, error)
+	GetAllPromotions(ctx context.Context) ([]models.Promotion, error)
+	// CountCustomerRedemptions returns how many of the customer's orders,
+	// other than cancelled ones, used the promotion.
+	CountCustomerRedemptions(ctx context.Context, promotionID, customerID uint) (int64, error)
+	// Redeem records one use of the promotion. It fails with a conflict
+	// once the promotion's usage limit is reached. Cancelling an order gives
+	// back the uses its discounts made.
+	Redeem(ctx context.Context, promotionID uint) error
+}
+
+type CartRepository interface {
+	CreateCart(ctx context.Context, cart *models.Cart) error
+	GetCart(ctx context.Context, id uint) (*models.Cart, error)
+	// SaveCart stores the cart's customer, coupons and expiry and replaces
+	// its items.
+	SaveCart(ctx context.Context, cart *models.Cart) error
+	// CheckOut marks an open cart as turned into orderID. It fails with a
+	// conflict if the cart was already checked out.
+	CheckOut(ctx context.Context, id, orderID uint) error
+	// DeleteExpiredCarts removes open carts that expired before cutoff and
+	// returns how many were removed.
+	DeleteExpiredCarts(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+type AddressRepository interface {
+	CreateAddress(ctx context.Context, address *models.Address) error
+	GetAddress(ctx context.Context, id uint) (*models.Address, error)
+	// ListAddresses returns the customer's addresses, oldest first.
+	ListAddresses(ctx context.Context, customerID uint) ([]models.Address, error)
+	// UpdateAddress replaces the address's label, recipient, location and
+	// phone.
+	UpdateAddress(ctx context.Context, address *models.Address) error
+	DeleteAddress(ctx context.Context, id uint) error
+	// DeleteCustomerAddresses permanently removes every address the
+	// customer has saved, including deleted ones.
+	DeleteCustomerAddresses(ctx context.Context, customerID uint) error
+	// PurgeAddresses permanently removes addresses deleted before cutoff
+	// and returns how many were removed.
+	PurgeAddresses(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+type ShippingRepository interface {
+	// CreateShippingMethod stores the method with its rates.
+	CreateShippingMethod(ctx context.Context, method *models.ShippingMethod) error
+	GetShippingMethod(ctx context.Context, code string) (*models.ShippingMethod, error)
+	GetAllShippingMethods(ctx context.Context) ([]models.ShippingMethod, error)
+	// SaveShippingMethod stores the method's name, pickup flag, currency
+	// and disabled flag and replaces its rates.
+	SaveShippingMethod(ctx context.Context, method *models.ShippingMethod) error
+}
+
+type ShipmentRepository interface {
+	// CreateShipment stores the shipment with its items.
+	CreateShipment(ctx context.Context, shipment *models.Shipment) error
+	GetShipment(ctx context.Context, id uint) (*models.Shipment, error)
+	// ListShipments returns the order's shipments with their items, oldest
+	// first.
+	ListShipments(ctx context.Context, orderID uint) ([]models.Shipment, error)
+	// UpdateShipment stores the shipment's carrier, tracking number,
+	// status and timestamps.
+	UpdateShipment(ctx context.Context, shipment *models.Shipment) error
+}
+
+type InvoiceRepository interface {
+	// IssueInvoice returns the order's invoice, numbering a new one if the
+	// order has none. Numbers are only taken by committed invoices, so they
+	// run without gaps.
+	IssueInvoice(ctx context.Context, orderID uint) (*models.Invoice, error)
+	// GetInvoice returns the order's invoice, failing with not found if none
+	// has been issued.
+	GetInvoice(ctx context.Context, orderID uint) (*models.Invoice, error)
+}
+
+type NotificationRepository interface {
+	CreateNotification(ctx context.Context, notification *models.Notification) error
+	GetNotification(ctx context.Context, id uint) (*models.Notification, error)
+	// ListNotifications returns the order's notifications, oldest first.
+	ListNotifications(ctx context.Context, orderID uint) ([]models.Notification, error)
+	// DueNotifications returns up to limit pending notifications whose next
+	// attempt is due at now, oldest first.
+	DueNotifications(ctx context.Context, now time.Time, limit int) ([]models.Notification, error)
+	// UpdateNotification stores the notification's status, attempts, last
+	// error and delivery times.
+	UpdateNotification(ctx context.Context, notification *models.Notification) error
+	// ListCustomerNotifications returns every notification to the
+	// customer, oldest first.
+	ListCustomerNotifications(ctx context.Context, customerID uint) ([]models.Notification, error)
+	// EraseNotifications removes the recipient and body of every
+	// notification to the customer and fails those still pending with
+	// reason, so nothing more is sent.
+	EraseNotifications(ctx context.Context, customerID uint, reason string) error
+}
+
+type TokenRepository interface {
+	CreateToken(ctx context.Context, token *models.CustomerToken) error
+	// UseToken marks the unused, unexpired token for purpose with hash as
+	// used at now and returns it. Each token can only be used once; any
+	// other token is not found.
+	UseToken(ctx context.Context, purpose, hash string, now time.Time) (*models.CustomerToken, error)
+	// DeleteCustomerTokens removes the customer's one-time tokens, used or
+	// not.
+	DeleteCustomerTokens(ctx context.Context, customerID uint) error
+}
+
+type AuditRepository interface {
+	// RecordAudit appends entry to the audit log.
+	RecordAudit(ctx context.Context, entry *models.AuditEntry) error
+	// ListAudit returns one page of the entries matching query, newest
+	// first, and the number of matches across all pages. The query's page
+	// must already be defaulted.
+	ListAudit(ctx context.Context, query models.AuditQuery) ([]models.AuditEntry, int64, error)
+}
+
+// Store gives access to every repository and runs units of work across
+// them.
+type Store interface {
+	Customers() CustomerRepository
+	Products() ProductRepository
+	Orders() OrderRepository
+	Promotions() PromotionRepository
+	Carts() CartRepository
+	Addresses() AddressRepository
+	Shipping() ShippingRepository
+	Shipments() ShipmentRepository
+	Invoices() InvoiceRepository
+	Notifications() NotificationRepository
+	Tokens() TokenRepository
+	Audit() AuditRepository
+
+	// WithinTx runs fn against a Store whose repositories share a single
+	// transaction. It commits when fn returns nil and rolls back otherwise.
+	WithinTx(ctx context.Context, fn func(tx Store) error) error
+}
@@ -0,0 +1,126 @@
+// Package shipping prices the delivery of orders and records where they are
+// going.
+package shipping
+
+import (
+	"context"
+	"strings"
+
+	"orderservice/apperrors"
+	"orderservice/models"
+	"orderservice/money"
+	"orderservice/repository"
+)
+
+// Apply sets order's shipping method, address and fee from delivery. Orders
+// without a method are collected or delivered outside the service and are
+// left unchanged. The fee is converted into the order's currency and
+// charged on top of the discounted, taxed total. Problems with the choice
+// are validation errors on the request's shipping fields.
+func Apply(ctx context.Context, store repository.Store, order *models.Order, delivery models.Delivery, exchange money.Rates) error {
+	if delivery.Method == "" {
+		if delivery.AddressID != 0 || delivery.Address != nil {
+			return invalid("shipping_method", "is required when an address is given")
+		}
+		return nil
+	}
+
+	method, err := store.Shipping().GetShippingMethod(ctx, models.NormalizeShippingCode(delivery.Method))
+	if apperrors.Is(err, apperrors.KindNotFound) {
+		return invalid("shipping_method", "does not exist")
+	}
+	if err != nil {
+		return err
+	}
+	if method.Disabled {
+		return invalid("shipping_method", "is not available")
+	}
+
+	var address models.ShippingAddress
+	switch {
+	case delivery.AddressID != 0 && delivery.Address != nil:
+		return invalid("address_id", "cannot be given with shipping_address")
+	case delivery.AddressID != 0:
+		saved, err := store.Addresses().GetAddress(ctx, delivery.AddressID)
+		if apperrors.Is(err, apperrors.KindNotFound) || err == nil && saved.CustomerID != order.CustomerID {
+			return invalid("address_id", "does not exist")
+		}
+		if err != nil {
+			return err
+		}
+		address = saved.ShippingAddress()
+	case delivery.Address != nil:
+		address = *delivery.Address
+		address.Phone = models.NormalizePhone(address.Phone)
+	case !method.Pickup:
+		return invalid("shipping_address", "is required for delivery")
+	}
+
+	fee, ok := Fee(method, address.County, Weight(order))
+	if !ok {
+		return invalid("shipping_method", "does not deliver this order to "+address.County)
+	}
+	currency := method.Currency
+	if currency == "" {
+		currency = exchange.Base
+	}
+	converted, _, err := exchange.Convert(money.New(fee, currency), order.Currency)
+	if err != nil {
+		return err
+	}
+
+	order.ShippingMethod = method.Code
+	order.ShippingAddress = address
+	order.ShippingFee = converted.Amount()
+	return nil
+}
+
+// Fee returns what method charges, in its currency, to send weight
+// kilograms to county, and false if none of its rates covers the parcel.
+// Rates that name the county take precedence over those covering every
+// county; otherwise the first matching rate wins.
+func Fee(method *models.ShippingMethod, county string, weight float64) (float64, bool) {
+	var fallback *models.ShippingRate
+	for i, rate := range method.Rates {
+		if !rate.Covers(county, weight) {
+			continue
+		}
+		if len(rate.Counties) > 0 {
+			return rate.Fee, true
+		}
+		if fallback == nil {
+			fallback = &method.Rates[i]
+		}
+	}
+	if fallback == nil {
+		return 0, false
+	}
+	return fallback.Fee, true
+}
+
+// Weight returns the total weight of order's lines in kilograms.
+func Weight(order *models.Order) float64 {
+	var weight float64
+	for _, item := range order.Items {
+		weight += item.Weight * float64(item.Quantity)
+	}
+	return weight
+}
+
+// Normalize puts method's code in its stored form and tidies the county
+// names of its rates.
+func Normalize(method *models.ShippingMethod) {
+	method.Code = models.NormalizeShippingCode(method.Code)
+	for i := range method.Rates {
+		for j, county := range method.Rates[i].Counties {
+			method.Rates[i].Counties[j] = strings.TrimSpace(county)
+		}
+	}
+}
+
+// invalid returns a validation error on field, e.g. "address does not
+// exist" with the field error on address_id.
+func invalid(field, message string) error {
+	subject := strings.ReplaceAll(strings.TrimSuffix(field, "_id"), "_", " ")
+	return apperrors.Validation(subject+" "+message, apperrors.FieldError{Field: field, Message: message})
+}
@@ -0,0 +1,140 @@
+package shipping
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"orderservice/apperrors"
+	"orderservice/models"
+	"orderservice/money"
+	"orderservice/repository"
+)
+
+var (
+	ctx      = context.Background()
+	exchange = money.NewRates("KES", map[string]float64{"USD": 125})
+)
+
+func weight(kg float64) *float64 { return &kg }
+
+func standard() *models.ShippingMethod {
+	return &models.ShippingMethod{Code: "standard", Name: "Standard", Currency: "KES", Rates: []models.ShippingRate{
+		{Zone: "Rest of Kenya", MaxWeight: weight(5), Fee: 450},
+		{Zone: "Nairobi", Counties: []string{"Nairobi", "Kiambu"}, MaxWeight: weight(5), Fee: 200},
+		{Zone: "Nairobi", Counties: []string{"Nairobi", "Kiambu"}, MinWeight: 5, Fee: 500},
+	}}
+}
+
+func TestFee(t *testing.T) {
+	tests := []struct {
+		name   string
+		county string
+		weight float64
+		fee    float64
+		ok     bool
+	}{
+		{"Named county beats the catch-all", "nairobi ", 1, 200, true},
+		{"Catch-all", "Kisumu", 1, 450, true},
+		{"Heavier band", "Kiambu", 5, 500, true},
+		{"No rate for heavy parcels elsewhere", "Kisumu", 12, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fee, ok := Fee(standard(), tt.county, tt.weight)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.fee, fee)
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	store := repository.NewMemoryStore()
+	customer := &models.Customer{Name: "Shipping Customer", Email: "shipping@example.com"}
+	require.NoError(t, store.Customers().CreateCustomer(ctx, customer))
+	other := &models.Customer{Name: "Other Customer", Email: "other@example.com"}
+	require.NoError(t, store.Customers().CreateCustomer(ctx, other))
+	home := &models.Address{CustomerID: customer.ID, County: "Nairobi", Town: "Nairobi", Street: "Moi Avenue", Phone: "254712345678"}
+	require.NoError(t, store.Addresses().CreateAddress(ctx, home))
+	theirs := &models.Address{CustomerID: other.ID, County: "Nairobi", Town: "Nairobi", Street: "Koinange Street", Phone: "254712345678"}
+	require.NoError(t, store.Addresses().CreateAddress(ctx, theirs))
+	require.NoError(t, store.Shipping().CreateShippingMethod(ctx, standard()))
+	require.NoError(t, store.Shipping().CreateShippingMethod(ctx, &models.ShippingMethod{
+		Code: "pickup", Name: "Pickup", Pickup: true, Rates: []models.ShippingRate{{Zone: "Shop", Fee: 0}},
+	}))
+	require.NoError(t, store.Shipping().CreateShippingMethod(ctx, &models.ShippingMethod{
+		Code: "express", Name: "Express", Disabled: true, Rates: []models.ShippingRate{{Zone: "Kenya", Fee: 900}},
+	}))
+
+	newOrder := func(currency string) *models.Order {
+		return &models.Order{CustomerID: customer.ID, Currency: currency, Items: []models.OrderItem{
+			{Name: "Kettle", UnitPrice: 2500, Quantity: 2, Weight: 1.5},
+		}}
+	}
+	field := func(t *testing.T, err error) string {
+		t.Helper()
+		require.True(t, apperrors.Is(err, apperrors.KindValidation), "%v", err)
+		return err.(*apperrors.Error).Fields[0].Field
+	}
+
+	t.Run("Saved address", func(t *testing.T) {
+		order := newOrder("KES")
+		require.NoError(t, Apply(ctx, store, order, models.Delivery{Method: "Standard", AddressID: home.ID}, exchange))
+		assert.Equal(t, "standard", order.ShippingMethod)
+		assert.Equal(t, 200.0, order.ShippingFee)
+		assert.Equal(t, "Moi Avenue", order.ShippingAddress.Street)
+	})
+
+	t.Run("Address given with the order", func(t *testing.T) {
+		order := newOrder("USD")
+		address := &models.ShippingAddress{County: "Kisumu", Town: "Kisumu", Street: "Oginga Odinga Road", Phone: "0712 345 678"}
+		require.NoError(t, Apply(ctx, store, order, models.Delivery{Method: "standard", Address: address}, exchange))
+		assert.Equal(t, 3.6, order.ShippingFee, "converted into the order's currency")
+		assert.Equal(t, "254712345678", order.ShippingAddress.Phone)
+	})
+
+	t.Run("Pickup needs no address", func(t *testing.T) {
+		order := newOrder("KES")
+		require.NoError(t, Apply(ctx, store, order, models.Delivery{Method: "pickup"}, exchange))
+		assert.Equal(t, "pickup", order.ShippingMethod)
+		assert.Zero(t, order.ShippingFee)
+	})
+
+	t.Run("No method", func(t *testing.T) {
+		order := newOrder("KES")
+		require.NoError(t, Apply(ctx, store, order, models.Delivery{}, exchange))
+		assert.Empty(t, order.ShippingMethod)
+
+		err := Apply(ctx, store, order, models.Delivery{AddressID: home.ID}, exchange)
+		assert.Equal(t, "shipping_method", field(t, err))
+	})
+
+	t.Run("Invalid choices", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			delivery models.Delivery
+			field    string
+		}{
+			{"Unknown method", models.Delivery{Method: "drone", AddressID: home.ID}, "shipping_method"},
+			{"Disabled method", models.Delivery{Method: "express", AddressID: home.ID}, "shipping_method"},
+			{"Delivery without an address", models.Delivery{Method: "standard"}, "shipping_address"},
+			{"Another customer's address", models.Delivery{Method: "standard", AddressID: theirs.ID}, "address_id"},
+			{"Both kinds of address", models.Delivery{Method: "standard", AddressID: home.ID,
+				Address: &models.ShippingAddress{County: "Nairobi"}}, "address_id"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				assert.Equal(t, tt.field, field(t, Apply(ctx, store, newOrder("KES"), tt.delivery, exchange)))
+			})
+		}
+	})
+
+	t.Run("Too heavy for any rate", func(t *testing.T) {
+		order := newOrder("KES")
+		order.Items[0].Quantity = 10
+		address := &models.ShippingAddress{County: "Kisumu", Town: "Kisumu", Street: "Oginga Odinga Road", Phone: "0712345678"}
+		err := Apply(ctx, store, order, models.Delivery{Method: "standard", Address: address}, exchange)
+		assert.Equal(t, "shipping_method", field(t, err))
+	})
+}
@@ -0,0 +1,100 @@
+package tax
+
+import (
+	"math"
+
+	"orderservice/models"
+)
+
+// Rates holds the VAT rate for each tax class and whether catalogue prices
+// already include VAT.
+type Rates struct {
+	Standard  float64
+	ZeroRated float64
+	Inclusive bool
+}
+
+// Rate returns the rate for class. Exempt supplies carry no VAT and
+// unknown classes are charged at the standard rate.
+func (r Rates) Rate(class string) float64 {
+	switch class {
+	case models.TaxExempt:
+		return 0
+	case models.TaxZeroRated:
+		return r.ZeroRated
+	default:
+		return r.Standard
+	}
+}
+
+// Line returns an unpriced order line for quantity units of product, or of
+// variant if it is not nil, at the rate for the product's tax class.
+func (r Rates) Line(product models.Product, variant *models.ProductVariant, quantity int) models.OrderItem {
+	class := product.TaxClass
+	if class == "" {
+		class = models.TaxStandard
+	}
+	item := models.OrderItem{
+		ProductID: product.ID,
+		SKU:       product.SKU,
+		Name:      product.Name,
+		UnitPrice: product.Price,
+		Quantity:  quantity,
+		TaxClass:  class,
+		TaxRate:   r.Rate(class),
+	}
+	if variant != nil {
+		item.VariantID = variant.ID
+		item.SKU = variant.SKU
+		item.Name += " (" + variant.Name + ")"
+		item.UnitPrice = variant.Price
+	}
+	return item
+}
+
+// Apply prices order: it builds one line per product when the order has no
+// lines yet, spreads order.Discount across the lines in proportion to
+// their amounts and sets the tax on each line and on the order. Existing
+// lines keep the rate they were priced at.
+func Apply(order *models.Order, rates Rates) {
+	if len(order.Items) == 0 {
+		order.TaxInclusive = rates.Inclusive
+		for _, product := range order.Products {
+			order.Items = append(order.Items, rates.Line(product, nil, 1))
+		}
+	}
+
+	var subtotal float64
+	for _, item := range order.Items {
+		subtotal += item.Amount()
+	}
+
+	// The last line takes the rounding remainder so line discounts add up
+	// to the order discount exactly.
+	remaining := order.Discount
+	order.TaxAmount = 0
+	for i := range order.Items {
+		item := &order.Items[i]
+		if i == len(order.Items)-1 {
+			item.Discount = round(remaining)
+		} else if subtotal > 0 {
+			item.Discount = round(order.Discount * item.Amount() / subtotal)
+		}
+		remaining -= item.Discount
+
+		base := item.Amount() - item.Discount
+		if order.TaxInclusive {
+			item.TaxAmount = round(base * item.TaxRate / (1 + item.TaxRate))
+			item.Total = round(base)
+		} else {
+			item.TaxAmount = round(base * item.TaxRate)
+			item.Total = round(base + item.TaxAmount)
+		}
+		order.TaxAmount += item.TaxAmount
+	}
+	order.TaxAmount = round(order.TaxAmount)
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,104 @@
+package tax
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"orderservice/models"
+)
+
+func product(id uint, price float64, class string) models.Product {
+	p := models.Product{Name: "Item", Price: price, TaxClass: class}
+	p.ID = id
+	return p
+}
+
+func testOrder() *models.Order {
+	return &models.Order{Products: []models.Product{
+		product(1, 116, models.TaxStandard),
+		product(2, 50, models.TaxZeroRated),
+		product(3, 34, models.TaxExempt),
+	}}
+}
+
+func TestApply(t *testing.T) {
+	rates := Rates{Standard: 0.16}
+
+	t.Run("Tax-exclusive prices", func(t *testing.T) {
+		order := testOrder()
+		Apply(order, rates)
+
+		require.Len(t, order.Items, 3)
+		assert.Equal(t, 0.16, order.Items[0].TaxRate)
+		assert.Equal(t, 18.56, order.Items[0].TaxAmount)
+		assert.Equal(t, 134.56, order.Items[0].Total)
+		assert.Zero(t, order.Items[1].TaxAmount)
+		assert.Zero(t, order.Items[2].TaxAmount)
+		assert.Equal(t, 18.56, order.TaxAmount)
+
+		order.CalculateTotals()
+		assert.Equal(t, 200.0, order.Subtotal)
+		assert.Equal(t, 218.56, order.Total)
+	})
+
+	t.Run("Tax-inclusive prices", func(t *testing.T) {
+		inclusive := rates
+		inclusive.Inclusive = true
+		order := testOrder()
+		Apply(order, inclusive)
+
+		assert.True(t, order.TaxInclusive)
+		assert.Equal(t, 16.0, order.Items[0].TaxAmount)
+		assert.Equal(t, 116.0, order.Items[0].Total)
+		assert.Equal(t, 16.0, order.TaxAmount)
+
+		order.CalculateTotals()
+		assert.Equal(t, 200.0, order.Total, "VAT is already in the prices")
+	})
+
+	t.Run("Discount reduces the taxable amount", func(t *testing.T) {
+		order := testOrder()
+		order.Discount = 20
+		Apply(order, rates)
+
+		assert.Equal(t, 11.6, order.Items[0].Discount)
+		assert.Equal(t, 5.0, order.Items[1].Discount)
+		assert.Equal(t, 3.4, order.Items[2].Discount)
+		assert.Equal(t, 16.7, order.TaxAmount)
+	})
+
+	t.Run("Line discounts add up to the order discount", func(t *testing.T) {
+		order := &models.Order{Discount: 10, Products: []models.Product{
+			product(1, 10, models.TaxStandard),
+			product(2, 10, models.TaxStandard),
+			product(3, 10, models.TaxStandard),
+		}}
+		Apply(order, rates)
+
+		var total float64
+		for _, item := range order.Items {
+			total += item.Discount
+		}
+		assert.InDelta(t, 10.0, total, 0.0001)
+		assert.Equal(t, 3.34, order.Items[2].Discount)
+	})
+
+	t.Run("Existing lines keep their rate", func(t *testing.T) {
+		order := testOrder()
+		Apply(order, rates)
+
+		order.Discount = 116
+		Apply(order, Rates{Standard: 0.2})
+		assert.Equal(t, 0.16, order.Items[0].TaxRate)
+		assert.False(t, order.TaxInclusive)
+	})
+}
+
+func TestRate(t *testing.T) {
+	rates := Rates{Standard: 0.16, ZeroRated: 0}
+	assert.Equal(t, 0.16, rates.Rate(models.TaxStandard))
+	assert.Equal(t, 0.16, rates.Rate(""))
+	assert.Zero(t, rates.Rate(models.TaxZeroRated))
+	assert.Zero(t, rates.Rate(models.TaxExempt))
+}
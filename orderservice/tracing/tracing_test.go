@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type widget struct {
+	ID   uint
+	Name string
+}
+
+func TestGormPlugin(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := NewProvider("test", sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	defer provider.Shutdown(context.Background())
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&widget{}))
+	assert.NoError(t, db.Use(GormPlugin{}))
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	db.WithContext(ctx).Create(&widget{Name: "a"})
+	var found widget
+	db.WithContext(ctx).First(&found)
+	parent.End()
+
+	spans := exporter.GetSpans()
+	var names []string
+	for _, span := range spans {
+		if span.Name == "request" {
+			continue
+		}
+		names = append(names, span.Name)
+		assert.Equal(t, parent.SpanContext().TraceID(), span.SpanContext.TraceID())
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent.SpanID())
+	}
+	assert.Equal(t, []string{"gorm.create", "gorm.query"}, names)
+}
+
+func TestInit(t *testing.T) {
+	t.Setenv("OTEL_TRACES_EXPORTER", "none")
+	shutdown, err := Init(context.Background(), "test")
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	t.Setenv("OTEL_TRACES_EXPORTER", "zipkin")
+	_, err = Init(context.Background(), "test")
+	assert.Error(t, err)
+}
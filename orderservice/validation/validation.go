@@ -0,0 +1,203 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"orderservice/apperrors"
+	"orderservice/models"
+)
+
+var (
+	currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+	skuFormat    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	// phoneFormat matches Kenyan mobile and landline numbers written
+	// locally (07XXXXXXXX) or internationally (+2547XXXXXXXX).
+	phoneFormat = regexp.MustCompile(`^(?:\+?254|0)[17]\d{8}$`)
+)
+
+var validate = newValidator()
+
+// newValidator reads the same `binding` tags Gin uses, reports fields by
+// their JSON names and adds the custom rules shared by every input path.
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.SetTagName("binding")
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	v.RegisterValidation("currency", func(fl validator.FieldLevel) bool {
+		return currencyCode.MatchString(fl.Field().String())
+	})
+	v.RegisterValidation("notblank", func(fl validator.FieldLevel) bool {
+		return strings.TrimSpace(fl.Field().String()) != ""
+	})
+	v.RegisterValidation("sku", func(fl validator.FieldLevel) bool {
+		return skuFormat.MatchString(strings.TrimSpace(fl.Field().String()))
+	})
+	v.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+		return phoneFormat.MatchString(strings.ReplaceAll(fl.Field().String(), " ", ""))
+	})
+	v.RegisterStructValidation(promotionRules, models.Promotion{})
+	v.RegisterStructValidation(productQueryRules, models.ProductQuery{})
+	v.RegisterStructValidation(shippingRateRules, models.ShippingRate{})
+	v.RegisterStructValidation(auditQueryRules, models.AuditQuery{})
+	return v
+}
+
+// promotionRules covers the promotion constraints that span fields.
+func promotionRules(sl validator.StructLevel) {
+	p := sl.Current().Interface().(models.Promotion)
+	if p.Type == models.DiscountPercentage && p.Value > 100 {
+		sl.ReportError(p.Value, "value", "Value", "percent", "100")
+	}
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		sl.ReportError(p.EndsAt, "ends_at", "EndsAt", "after", "starts_at")
+	}
+}
+
+// productQueryRules checks the price range is the right way round.
+func productQueryRules(sl validator.StructLevel) {
+	q := sl.Current().Interface().(models.ProductQuery)
+	if q.MinPrice != nil && q.MaxPrice != nil && *q.MaxPrice < *q.MinPrice {
+		sl.ReportError(q.MaxPrice, "max_price", "MaxPrice", "gtefield", "min_price")
+	}
+}
+
+// shippingRateRules checks the weight band is the right way round.
+func shippingRateRules(sl validator.StructLevel) {
+	r := sl.Current().Interface().(models.ShippingRate)
+	if r.MaxWeight != nil && *r.MaxWeight <= r.MinWeight {
+		sl.ReportError(r.MaxWeight, "max_weight", "MaxWeight", "gtfield", "min_weight")
+	}
+}
+
+// auditQueryRules checks the time range is the right way round.
+func auditQueryRules(sl validator.StructLevel) {
+	q := sl.Current().Interface().(models.AuditQuery)
+	if q.From != nil && q.To != nil && !q.To.After(*q.From) {
+		sl.ReportError(q.To, "to", "To", "gtfield", "from")
+	}
+}
+
+// Struct validates v against its `binding` tags. Failures are returned as
+// a validation error listing every invalid field.
+func Struct(v interface{}) error {
+	err := validate.Struct(v)
+	if err == nil {
+		return nil
+	}
+
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return apperrors.Validation(err.Error())
+	}
+	fields := make([]apperrors.FieldError, 0, len(invalid))
+	for _, fe := range invalid {
+		fields = append(fields, apperrors.FieldError{
+			Field:   fieldPath(fe),
+			Message: message(fe),
+		})
+	}
+	return apperrors.Validation("request has invalid fields", fields...)
+}
+
+// BindJSON decodes the request body into v and validates it.
+func BindJSON(c *gin.Context, v interface{}) error {
+	if c.Request.Body == nil {
+		return apperrors.Validation("request body is required")
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return apperrors.Validation("request body is required")
+		}
+		return apperrors.Validation("invalid request body: " + err.Error())
+	}
+	return Struct(v)
+}
+
+// BindQuery decodes the request's query parameters into v by their `form`
+// tags and validates it.
+func BindQuery(c *gin.Context, v interface{}) error {
+	if err := binding.MapFormWithTag(v, c.Request.URL.Query(), "form"); err != nil {
+		return apperrors.Validation("invalid query: " + err.Error())
+	}
+	return Struct(v)
+}
+
+// fieldPath drops the top-level struct name, e.g. "products[0].id".
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if i := strings.Index(ns, "."); i >= 0 {
+		return ns[i+1:]
+	}
+	return ns
+}
+
+func message(fe validator.FieldError) string {
+	isString := fe.Kind() == reflect.String
+	switch fe.Tag() {
+	case "required", "notblank":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "currency":
+		return "must be a 3-letter ISO 4217 currency code"
+	case "sku":
+		return "must contain only letters, digits, '-', '_' or '.'"
+	case "gtefield":
+		return "must be at least " + fe.Param()
+	case "gtfield":
+		return "must be greater than " + fe.Param()
+	case "phone":
+		return "must be a Kenyan phone number such as 0712345678 or +254712345678"
+	case "percent":
+		return "must be at most 100 for percentage discounts"
+	case "after":
+		return "must be after " + fe.Param()
+	case "alphanum":
+		return "must contain only letters and digits"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte":
+		return "must be at least " + fe.Param()
+	case "lte":
+		return "must be at most " + fe.Param()
+	case "min":
+		if isString {
+			return fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must contain at least %s %s", fe.Param(), items(fe.Param()))
+	case "max":
+		if isString {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must contain at most %s %s", fe.Param(), items(fe.Param()))
+	default:
+		return "failed the " + fe.Tag() + " rule"
+	}
+}
+
+func items(n string) string {
+	if n == "1" {
+		return "item"
+	}
+	return "items"
+}
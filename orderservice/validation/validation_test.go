@@ -0,0 +1,185 @@
+package validation
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"orderservice/apperrors"
+	"orderservice/models"
+)
+
+func fieldErrors(t *testing.T, err error) map[string]string {
+	t.Helper()
+	var appErr *apperrors.Error
+	require.ErrorAs(t, err, &appErr)
+	assert.Equal(t, apperrors.KindValidation, appErr.Kind)
+	fields := make(map[string]string)
+	for _, fe := range appErr.Fields {
+		fields[fe.Field] = fe.Message
+	}
+	return fields
+}
+
+func TestStruct(t *testing.T) {
+	t.Run("Valid customer", func(t *testing.T) {
+		assert.NoError(t, Struct(&models.Customer{Name: "Jane", Email: "jane@example.com"}))
+	})
+
+	t.Run("Customer field errors use JSON names", func(t *testing.T) {
+		fields := fieldErrors(t, Struct(&models.Customer{Name: "  ", Email: "not-an-email"}))
+		assert.Equal(t, "is required", fields["name"])
+		assert.Equal(t, "must be a valid email address", fields["email"])
+	})
+
+	t.Run("Product price must be positive", func(t *testing.T) {
+		fields := fieldErrors(t, Struct(&models.Product{Name: "Book", Price: 0}))
+		assert.Equal(t, "must be greater than 0", fields["price"])
+	})
+
+	t.Run("Name length is capped", func(t *testing.T) {
+		fields := fieldErrors(t, Struct(&models.Product{Name: strings.Repeat("x", 201), Price: 1}))
+		assert.Equal(t, "must be at most 200 characters", fields["name"])
+	})
+
+	t.Run("Order needs at least one product", func(t *testing.T) {
+		fields := fieldErrors(t, Struct(&models.CreateOrderRequest{CustomerID: 1, Products: []models.ProductRef{}}))
+		assert.Equal(t, "must contain at least 1 item", fields["products"])
+	})
+
+	t.Run("Nested fields report their path", func(t *testing.T) {
+		fields := fieldErrors(t, Struct(&models.CreateOrderRequest{CustomerID: 1, Products: []models.ProductRef{{ID: 1}, {}}}))
+		assert.Equal(t, "is required", fields["products[1].id"])
+	})
+
+	t.Run("Unknown status", func(t *testing.T) {
+		fields := fieldErrors(t, Struct(&models.UpdateStatusRequest{Status: "lost"}))
+		assert.Contains(t, fields["status"], "must be one of: pending, paid")
+	})
+
+	t.Run("Currency codes", func(t *testing.T) {
+		type priced struct {
+			Currency string `json:"currency" binding:"currency"`
+		}
+		assert.NoError(t, Struct(&priced{Currency: "KES"}))
+		fields := fieldErrors(t, Struct(&priced{Currency: "kes"}))
+		assert.Equal(t, "must be a 3-letter ISO 4217 currency code", fields["currency"])
+	})
+
+	t.Run("SKU characters", func(t *testing.T) {
+		assert.NoError(t, Struct(&models.Product{SKU: "TSHIRT-RED_L.2", Name: "T-shirt", Price: 1}))
+		fields := fieldErrors(t, Struct(&models.Product{Name: "T-shirt", Price: 1,
+			Variants: []models.ProductVariant{{SKU: "-RED L", Price: 1}}}))
+		assert.Equal(t, "must contain only letters, digits, '-', '_' or '.'", fields["variants[0].sku"])
+	})
+
+	t.Run("Phone numbers", func(t *testing.T) {
+		address := models.Address{County: "Nairobi", Town: "Nairobi", Street: "Moi Avenue"}
+		for _, phone := range []string{"0712345678", "+254712345678", "254 112 345 678"} {
+			address.Phone = phone
+			assert.NoError(t, Struct(&address), phone)
+		}
+		address.Phone = "0812345678"
+		fields := fieldErrors(t, Struct(&address))
+		assert.Contains(t, fields["phone"], "must be a Kenyan phone number")
+	})
+
+	t.Run("Shipping weight bands", func(t *testing.T) {
+		max := 2.0
+		fields := fieldErrors(t, Struct(&models.ShippingMethod{Code: "express", Name: "Express",
+			Rates: []models.ShippingRate{{Zone: "Nairobi", MinWeight: 2, MaxWeight: &max, Fee: 300}}}))
+		assert.Equal(t, "must be greater than min_weight", fields["rates[0].max_weight"])
+	})
+}
+
+func TestBindJSON(t *testing.T) {
+	bind := func(body string) error {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/customers", strings.NewReader(body))
+		var customer models.Customer
+		return BindJSON(c, &customer)
+	}
+
+	t.Run("Valid body", func(t *testing.T) {
+		assert.NoError(t, bind(`{"name":"Jane","email":"jane@example.com"}`))
+	})
+
+	t.Run("Empty body", func(t *testing.T) {
+		err := bind(``)
+		assert.Equal(t, apperrors.KindValidation, apperrors.KindOf(err))
+		assert.Contains(t, err.Error(), "request body is required")
+	})
+
+	t.Run("Malformed JSON", func(t *testing.T) {
+		err := bind(`{"name":`)
+		assert.Equal(t, apperrors.KindValidation, apperrors.KindOf(err))
+		assert.Contains(t, err.Error(), "invalid request body")
+	})
+
+	t.Run("Rule violations", func(t *testing.T) {
+		fields := fieldErrors(t, bind(`{"name":"Jane"}`))
+		assert.Equal(t, "is required", fields["email"])
+	})
+}
+
+func TestBindQuery(t *testing.T) {
+	bind := func(query string) (models.ProductQuery, error) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/products?"+query, nil)
+		var q models.ProductQuery
+		err := BindQuery(c, &q)
+		return q, err
+	}
+
+	t.Run("Valid query", func(t *testing.T) {
+		q, err := bind("q=red+shirt&min_price=5&sort=-price&page=2")
+		require.NoError(t, err)
+		assert.Equal(t, "red shirt", q.Search)
+		assert.Equal(t, 5.0, *q.MinPrice)
+		assert.Nil(t, q.MaxPrice)
+		assert.Equal(t, "-price", q.Sort)
+		assert.Equal(t, 2, q.Page)
+	})
+
+	t.Run("Malformed number", func(t *testing.T) {
+		_, err := bind("page=two")
+		assert.Equal(t, apperrors.KindValidation, apperrors.KindOf(err))
+		assert.Contains(t, err.Error(), "invalid query")
+	})
+
+	t.Run("Rule violations", func(t *testing.T) {
+		_, err := bind("sort=popularity&per_page=500&min_price=10&max_price=5")
+		fields := fieldErrors(t, err)
+		assert.Contains(t, fields["sort"], "must be one of: name, -name")
+		assert.Equal(t, "must be at most 100", fields["per_page"])
+		assert.Equal(t, "must be at least min_price", fields["max_price"])
+	})
+}
+
+func TestPromotionRules(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(-time.Hour)
+
+	t.Run("Valid promotion", func(t *testing.T) {
+		assert.NoError(t, Struct(&models.Promotion{Code: "SAVE10", Type: models.DiscountPercentage, Value: 10}))
+	})
+
+	t.Run("Percentage over 100", func(t *testing.T) {
+		fields := fieldErrors(t, Struct(&models.Promotion{Code: "SAVE", Type: models.DiscountPercentage, Value: 150}))
+		assert.Equal(t, "must be at most 100 for percentage discounts", fields["value"])
+	})
+
+	t.Run("Window ends before it starts", func(t *testing.T) {
+		fields := fieldErrors(t, Struct(&models.Promotion{Code: "SAVE", Type: models.DiscountFixed, Value: 5, StartsAt: &start, EndsAt: &end}))
+		assert.Equal(t, "must be after starts_at", fields["ends_at"])
+	})
+
+	t.Run("Code characters", func(t *testing.T) {
+		fields := fieldErrors(t, Struct(&models.ApplyCouponRequest{Code: "SAVE 10!"}))
+		assert.Equal(t, "must contain only letters and digits", fields["code"])
+	})
+}
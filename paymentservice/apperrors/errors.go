@@ -0,0 +1,89 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kind classifies a failure by how callers should react to it.
+type Kind string
+
+const (
+	KindInternal   Kind = "internal"
+	KindNotFound   Kind = "not-found"
+	KindConflict   Kind = "conflict"
+	KindValidation Kind = "validation"
+	KindUpstream   Kind = "upstream-failure"
+	KindRateLimit  Kind = "rate-limited"
+	// KindUnauthenticated is a request without valid credentials.
+	KindUnauthenticated Kind = "unauthenticated"
+)
+
+// FieldError describes one invalid input field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is a domain error carrying its Kind, a client-safe message and the
+// underlying cause, which is never shown to clients.
+type Error struct {
+	Kind    Kind
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func NotFound(message string, err error) *Error {
+	return &Error{Kind: KindNotFound, Message: message, Err: err}
+}
+
+func Conflict(message string, err error) *Error {
+	return &Error{Kind: KindConflict, Message: message, Err: err}
+}
+
+func Validation(message string, fields ...FieldError) *Error {
+	return &Error{Kind: KindValidation, Message: message, Fields: fields}
+}
+
+func Upstream(message string, err error) *Error {
+	return &Error{Kind: KindUpstream, Message: message, Err: err}
+}
+
+func RateLimited(message string) *Error {
+	return &Error{Kind: KindRateLimit, Message: message}
+}
+
+func Unauthenticated(message string, err error) *Error {
+	return &Error{Kind: KindUnauthenticated, Message: message, Err: err}
+}
+
+func Internal(message string, err error) *Error {
+	return &Error{Kind: KindInternal, Message: message, Err: err}
+}
+
+// KindOf returns the Kind of the first *Error in err's chain, or
+// KindInternal for untyped errors.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindInternal
+}
+
+// Is reports whether err is a domain error of kind.
+func Is(err error, kind Kind) bool {
+	return err != nil && KindOf(err) == kind
+}
@@ -0,0 +1,73 @@
+package apperrors
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"paymentservice/logging"
+)
+
+// ContentType is the RFC 7807 media type for problem details.
+const ContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details body.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+var statuses = map[Kind]int{
+	KindInternal:   http.StatusInternalServerError,
+	KindNotFound:   http.StatusNotFound,
+	KindConflict:   http.StatusConflict,
+	KindValidation: http.StatusBadRequest,
+	KindUpstream:   http.StatusServiceUnavailable,
+	KindRateLimit:  http.StatusTooManyRequests,
+
+	KindUnauthenticated: http.StatusUnauthorized,
+}
+
+// Status returns the HTTP status for err.
+func Status(err error) int {
+	return statuses[KindOf(err)]
+}
+
+// ProblemFor converts err into problem details. Only the message of a
+// typed error is shown; untyped errors get a generic detail so causes never
+// leak to clients.
+func ProblemFor(err error) Problem {
+	status := Status(err)
+	problem := Problem{
+		Type:   "/problems/" + string(KindOf(err)),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: "An unexpected error occurred",
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		problem.Detail = e.Message
+		problem.Errors = e.Fields
+	}
+	return problem
+}
+
+// Respond aborts the request with err rendered as problem+json.
+func Respond(c *gin.Context, err error) {
+	Write(c, ProblemFor(err))
+}
+
+// Write aborts the request with problem, filling in the instance and
+// request ID.
+func Write(c *gin.Context, problem Problem) {
+	problem.Instance = c.Request.URL.Path
+	problem.RequestID = logging.RequestID(c.Request.Context())
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
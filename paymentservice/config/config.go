@@ -0,0 +1,135 @@
+package config
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"paymentservice/ratelimit"
+)
+
+// String reads key from the environment, falling back to def when unset.
+func String(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// Duration reads a Go duration such as "15s" from the environment, falling
+// back to def when unset or malformed.
+func Duration(key string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return d
+}
+
+// Int64 reads an integer from the environment, falling back to def when
+// unset or malformed.
+func Int64(key string, def int64) int64 {
+	n, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// Server holds the HTTP server limits and shutdown behaviour.
+type Server struct {
+	Addr                string
+	ReadHeaderTimeout   time.Duration
+	ReadTimeout         time.Duration
+	WriteTimeout        time.Duration
+	IdleTimeout         time.Duration
+	MaxBodyBytes        int64
+	ShutdownGracePeriod time.Duration
+}
+
+func LoadServer(defaultPort string) Server {
+	return Server{
+		Addr:                ":" + String("PORT", defaultPort),
+		ReadHeaderTimeout:   Duration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:         Duration("HTTP_READ_TIMEOUT", 15*time.Second),
+		WriteTimeout:        Duration("HTTP_WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:         Duration("HTTP_IDLE_TIMEOUT", 60*time.Second),
+		MaxBodyBytes:        Int64("HTTP_MAX_BODY_BYTES", 1<<20),
+		ShutdownGracePeriod: Duration("SHUTDOWN_GRACE_PERIOD", 20*time.Second),
+	}
+}
+
+func (s Server) HTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              s.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: s.ReadHeaderTimeout,
+		ReadTimeout:       s.ReadTimeout,
+		WriteTimeout:      s.WriteTimeout,
+		IdleTimeout:       s.IdleTimeout,
+		MaxHeaderBytes:    1 << 20,
+	}
+}
+
+// Deadlines bounds a single call to each dependency so a hung database or
+// upstream cannot hold a request, or a background job, indefinitely.
+type Deadlines struct {
+	Database      time.Duration
+	Mpesa         time.Duration
+	OrdersService time.Duration
+}
+
+func LoadDeadlines() Deadlines {
+	return Deadlines{
+		Database:      Duration("DB_QUERY_TIMEOUT", 5*time.Second),
+		Mpesa:         Duration("MPESA_TIMEOUT", 15*time.Second),
+		OrdersService: Duration("ORDERS_SERVICE_TIMEOUT", 5*time.Second),
+	}
+}
+
+// PaymentLimits throttles STK push initiation so prompts cannot be spammed
+// to a phone. Limits are written as "<limit>/<window>", or "off".
+type PaymentLimits struct {
+	PerPhone      ratelimit.Rule
+	PerOrder      ratelimit.Rule
+	PerClient     ratelimit.Rule
+	PhoneCooldown ratelimit.Rule
+}
+
+func LoadPaymentLimits() PaymentLimits {
+	return PaymentLimits{
+		PerPhone:  rule("phone", "PAYMENT_LIMIT_PER_PHONE", "5/1h"),
+		PerOrder:  rule("order", "PAYMENT_LIMIT_PER_ORDER", "5/1h"),
+		PerClient: rule("client", "PAYMENT_LIMIT_PER_CLIENT", "30/1m"),
+		PhoneCooldown: ratelimit.Rule{
+			Name:   "phone_cooldown",
+			Limit:  1,
+			Window: Duration("PAYMENT_PHONE_COOLDOWN", time.Minute),
+		},
+	}
+}
+
+// rule reads a rate limit from the environment, falling back to def when
+// unset or malformed.
+func rule(name, key, def string) ratelimit.Rule {
+	r, err := ratelimit.ParseRule(name, String(key, def))
+	if err != nil {
+		r, _ = ratelimit.ParseRule(name, def)
+	}
+	return r
+}
+
+// Retention is how long payment records keep the payer's personal data.
+// A zero MaxAge keeps it indefinitely.
+type Retention struct {
+	MaxAge   time.Duration
+	Interval time.Duration
+}
+
+func LoadRetention() Retention {
+	return Retention{
+		MaxAge:   Duration("PAYMENT_DATA_RETENTION", 180*24*time.Hour),
+		Interval: Duration("PAYMENT_RETENTION_INTERVAL", 24*time.Hour),
+	}
+}
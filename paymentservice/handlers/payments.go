@@ -2,46 +2,137 @@ package handlers
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"os"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"paymentservice/apperrors"
+	"paymentservice/audit"
+	"paymentservice/config"
+	"paymentservice/logging"
+	"paymentservice/metrics"
+	"paymentservice/middleware"
+	"paymentservice/models"
+	"paymentservice/ratelimit"
+	"paymentservice/reconciliation"
+	"paymentservice/repository"
+	"paymentservice/validation"
 )
 
+// mpesaCurrency is the only currency Daraja accepts.
+const mpesaCurrency = "KES"
+
 type PaymentHandler struct {
-	Logger *zap.Logger
+	Logger    *zap.Logger
+	repo      *repository.PaymentRepository
+	mpesa     *http.Client
+	orders    *http.Client
+	deadlines config.Deadlines
+	limiter   *ratelimit.Limiter
+	limits    config.PaymentLimits
 }
 
-func NewPaymentHandler(logger *zap.Logger) *PaymentHandler {
+func NewPaymentHandler(db *gorm.DB, deadlines config.Deadlines, limiter *ratelimit.Limiter, limits config.PaymentLimits, logger *zap.Logger) *PaymentHandler {
 	return &PaymentHandler{
-		Logger: logger,
+		Logger:    logger,
+		repo:      repository.NewPaymentRepository(db, deadlines.Database),
+		deadlines: deadlines,
+		limiter:   limiter,
+		limits:    limits,
+		mpesa: &http.Client{Transport: otelhttp.NewTransport(
+			metrics.MpesaTransport(http.DefaultTransport),
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				return "mpesa " + r.URL.Path
+			}),
+		)},
+		orders: &http.Client{Transport: otelhttp.NewTransport(logging.Transport(http.DefaultTransport))},
 	}
 }
 
+// log returns the request-scoped logger, which carries the request ID and
+// any order or checkout IDs already known for the request.
+func (h *PaymentHandler) log(c *gin.Context) *zap.Logger {
+	return logging.FromContext(c.Request.Context(), h.Logger)
+}
+
 func (h *PaymentHandler) ProcessPayment(c *gin.Context) {
-	var paymentRequest struct {
-		OrderID     uint   `json:"order_id" binding:"required"`
-		Amount      string `json:"amount" binding:"required"`
-		PhoneNumber string `json:"phone" binding:"required"`
+	var paymentRequest models.PaymentRequest
+	if err := validation.BindJSON(c, &paymentRequest); err != nil {
+		h.log(c).Error("Invalid payment request", zap.Error(err))
+		metrics.PaymentAttempts.WithLabelValues("invalid").Inc()
+		apperrors.Respond(c, err)
+		return
 	}
 
-	if err := c.ShouldBindJSON(&paymentRequest); err != nil {
-		h.Logger.Error("Invalid payment request", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+	ctx := c.Request.Context()
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int64("order.id", int64(paymentRequest.OrderID)))
+	logging.With(c, h.Logger, zap.Uint("order_id", paymentRequest.OrderID))
+
+	// M-Pesa only moves KES. Orders priced in another currency have to be
+	// converted by the order service before they can be paid.
+	if paymentRequest.Currency != "" && paymentRequest.Currency != mpesaCurrency {
+		h.log(c).Warn("Payment refused for non-KES order", zap.String("currency", paymentRequest.Currency))
+		metrics.PaymentAttempts.WithLabelValues("invalid").Inc()
+		apperrors.Respond(c, apperrors.Validation("M-Pesa payments must be in KES",
+			apperrors.FieldError{Field: "currency", Message: "must be KES for M-Pesa payments; convert the order to KES first"}))
+		return
+	}
+
+	if !h.allow(c, paymentRequest) {
+		return
+	}
+
+	// The amount rule has already checked this parses to a positive number.
+	amount, _ := strconv.ParseFloat(paymentRequest.Amount, 64)
+
+	// The request's currency and amount are the caller's word; the order
+	// they must match is the Orders Service's.
+	order, err := h.getOrder(ctx, paymentRequest.OrderID)
+	if err != nil {
+		h.log(c).Error("Failed to fetch order", zap.Error(err))
+		metrics.PaymentAttempts.WithLabelValues("order_error").Inc()
+		apperrors.Respond(c, err)
+		return
+	}
+	if order.Currency != mpesaCurrency {
+		h.log(c).Warn("Payment refused for non-KES order", zap.String("currency", order.Currency))
+		metrics.PaymentAttempts.WithLabelValues("invalid").Inc()
+		apperrors.Respond(c, apperrors.Conflict("order is in "+order.Currency+"; convert it to KES before paying with M-Pesa", nil))
+		return
+	}
+	if math.Abs(amount-order.Total) >= 0.005 {
+		h.log(c).Warn("Payment amount does not match order total",
+			zap.Float64("amount", amount),
+			zap.Float64("total", order.Total),
+		)
+		metrics.PaymentAttempts.WithLabelValues("invalid").Inc()
+		apperrors.Respond(c, apperrors.Validation("payment amount does not match the order",
+			apperrors.FieldError{Field: "amount", Message: "must equal the order total of " + strconv.FormatFloat(order.Total, 'f', 2, 64)}))
 		return
 	}
 
 	// 1. Get M-Pesa OAuth Token
-	token, err := h.getMpesaToken()
+	token, err := h.getMpesaToken(ctx)
 	if err != nil {
-		h.Logger.Error("Failed to get M-Pesa token", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Payment initialization failed"})
+		h.log(c).Error("Failed to get M-Pesa token", zap.Error(err))
+		metrics.PaymentAttempts.WithLabelValues("token_error").Inc()
+		apperrors.Respond(c, apperrors.Upstream("payment initialization failed", err))
 		return
 	}
 
@@ -69,7 +160,9 @@ func (h *PaymentHandler) ProcessPayment(c *gin.Context) {
 	}
 
 	payload, _ := json.Marshal(stkRequest)
-	req, _ := http.NewRequest("POST",
+	mpesaCtx, cancel := withDeadline(ctx, h.deadlines.Mpesa)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(mpesaCtx, "POST",
 		"https://sandbox.safaricom.co.ke/mpesa/stkpush/v1/processrequest",
 		bytes.NewBuffer(payload),
 	)
@@ -77,11 +170,15 @@ func (h *PaymentHandler) ProcessPayment(c *gin.Context) {
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Authorization", "Bearer "+token)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := h.mpesa.Do(req)
 	if err != nil {
-		h.Logger.Error("STK Push request failed", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Payment processing failed"})
+		h.log(c).Error("STK Push request failed", zap.Error(err))
+		metrics.PaymentAttempts.WithLabelValues("upstream_error").Inc()
+		message := "payment processing failed"
+		if errors.Is(err, context.DeadlineExceeded) {
+			message = "M-Pesa did not respond in time"
+		}
+		apperrors.Respond(c, apperrors.Upstream(message, err))
 		return
 	}
 	defer resp.Body.Close()
@@ -90,54 +187,179 @@ func (h *PaymentHandler) ProcessPayment(c *gin.Context) {
 	json.NewDecoder(resp.Body).Decode(&result)
 
 	if resp.StatusCode != http.StatusOK {
-		h.Logger.Error("STK Push failed",
+		h.log(c).Error("STK Push failed",
 			zap.Any("response", result),
 			zap.Int("status_code", resp.StatusCode),
 		)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":  "Payment failed",
-			"detail": result,
-		})
+		metrics.PaymentAttempts.WithLabelValues("rejected").Inc()
+		message, _ := result["errorMessage"].(string)
+		if message == "" {
+			message = "M-Pesa rejected the payment request"
+		}
+		if resp.StatusCode == http.StatusBadRequest {
+			apperrors.Respond(c, apperrors.Validation(message))
+		} else {
+			apperrors.Respond(c, apperrors.Upstream(message, fmt.Errorf("STK push returned %d", resp.StatusCode)))
+		}
 		return
 	}
 
-	h.Logger.Info("Payment initiated successfully",
+	checkoutRequestID, _ := result["CheckoutRequestID"].(string)
+	merchantRequestID, _ := result["MerchantRequestID"].(string)
+	span.SetAttributes(attribute.String("mpesa.checkout_request_id", checkoutRequestID))
+	logging.With(c, h.Logger, zap.String("checkout_request_id", checkoutRequestID))
+	payment := &models.Payment{
+		OrderID:           paymentRequest.OrderID,
+		CheckoutRequestID: checkoutRequestID,
+		MerchantRequestID: merchantRequestID,
+		PhoneNumber:       paymentRequest.PhoneNumber,
+		Amount:            amount,
+		Status:            models.PaymentPending,
+	}
+	if err := h.repo.CreatePayment(ctx, payment); err != nil {
+		h.log(c).Error("Failed to record payment",
+			zap.Error(err),
+		)
+		metrics.PaymentAttempts.WithLabelValues("store_error").Inc()
+		apperrors.Respond(c, err)
+		return
+	}
+	metrics.PaymentAttempts.WithLabelValues("initiated").Inc()
+
+	h.log(c).Info("Payment initiated successfully",
 		zap.Any("response", result),
-		zap.Uint("order_id", paymentRequest.OrderID),
 	)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":             "Payment initiated",
-		"checkout_request_id": result["CheckoutRequestID"],
+		"checkout_request_id": checkoutRequestID,
 	})
 }
 
-func (h *PaymentHandler) getMpesaToken() (string, error) {
+// order is the part of an Orders Service order a payment is checked
+// against.
+type order struct {
+	Currency string  `json:"currency"`
+	Total    float64 `json:"total"`
+}
+
+// getOrder fetches the order being paid for from the Orders Service.
+func (h *PaymentHandler) getOrder(ctx context.Context, id uint) (*order, error) {
+	ctx, cancel := withDeadline(ctx, h.deadlines.OrdersService)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET",
+		fmt.Sprintf("%s/orders/%d", os.Getenv("ORDERS_SERVICE_URL"), id),
+		nil,
+	)
+	resp, err := h.orders.Do(req)
+	if err != nil {
+		return nil, apperrors.Upstream("could not reach the Orders Service", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, apperrors.NotFound("order not found", nil)
+	default:
+		return nil, apperrors.Upstream("could not fetch the order", fmt.Errorf("orders service returned %d", resp.StatusCode))
+	}
+	var result order
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, apperrors.Upstream("could not fetch the order", err)
+	}
+	return &result, nil
+}
+
+// allow applies the STK push rate limits and, when one is exceeded, responds
+// with 429 and a Retry-After header.
+func (h *PaymentHandler) allow(c *gin.Context, req models.PaymentRequest) bool {
+	decision, err := h.limiter.Allow(c.Request.Context(),
+		ratelimit.Check{Key: req.PhoneNumber, Rule: h.limits.PhoneCooldown},
+		ratelimit.Check{Key: req.PhoneNumber, Rule: h.limits.PerPhone},
+		ratelimit.Check{Key: strconv.FormatUint(uint64(req.OrderID), 10), Rule: h.limits.PerOrder},
+		ratelimit.Check{Key: clientKey(c), Rule: h.limits.PerClient},
+	)
+	if err != nil {
+		// Failing open keeps payments working if a shared store is down.
+		h.log(c).Error("Rate limit check failed", zap.Error(err))
+		return true
+	}
+	if decision.Allowed {
+		return true
+	}
+
+	retryAfter := int(math.Ceil(decision.RetryAfter.Seconds()))
+	h.log(c).Warn("Payment request throttled",
+		zap.String("rule", decision.Rule),
+		zap.Int("retry_after_seconds", retryAfter),
+	)
+	metrics.PaymentAttempts.WithLabelValues("throttled").Inc()
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	apperrors.Respond(c, apperrors.RateLimited("too many payment requests, retry later"))
+	return false
+}
+
+// clientKey identifies the caller by API key when one is sent, otherwise by
+// client IP. Keys are hashed so they are never held in the limiter store.
+func clientKey(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:8])
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func (h *PaymentHandler) getMpesaToken(ctx context.Context) (string, error) {
+	ctx, cancel := withDeadline(ctx, h.deadlines.Mpesa)
+	defer cancel()
+
 	auth := base64.StdEncoding.EncodeToString([]byte(
 		os.Getenv("MPESA_CONSUMER_KEY") + ":" + os.Getenv("MPESA_CONSUMER_SECRET"),
 	))
 
-	req, _ := http.NewRequest("GET",
+	req, _ := http.NewRequestWithContext(ctx, "GET",
 		"https://sandbox.safaricom.co.ke/oauth/v1/generate?grant_type=client_credentials",
 		nil,
 	)
 	req.Header.Add("Authorization", "Basic "+auth)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := h.mpesa.Do(req)
 	if err != nil {
+		metrics.TokenRefreshes.WithLabelValues("error").Inc()
 		return "", err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		metrics.TokenRefreshes.WithLabelValues("error").Inc()
+		return "", fmt.Errorf("token endpoint returned %d", resp.StatusCode)
+	}
+
 	var result struct {
 		AccessToken string `json:"access_token"`
 	}
-	json.NewDecoder(resp.Body).Decode(&result)
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		metrics.TokenRefreshes.WithLabelValues("error").Inc()
+		return "", err
+	}
+	if result.AccessToken == "" {
+		metrics.TokenRefreshes.WithLabelValues("error").Inc()
+		return "", errors.New("token endpoint returned no access token")
+	}
+	metrics.TokenRefreshes.WithLabelValues("ok").Inc()
 
 	return result.AccessToken, nil
 }
 
+// CheckMpesaToken verifies that the configured credentials can obtain an
+// OAuth token from Daraja.
+func (h *PaymentHandler) CheckMpesaToken(ctx context.Context) error {
+	_, err := h.getMpesaToken(ctx)
+	return err
+}
+
 func (h *PaymentHandler) PaymentCallback(c *gin.Context) {
 	var callback struct {
 		Body struct {
@@ -156,31 +378,128 @@ func (h *PaymentHandler) PaymentCallback(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&callback); err != nil {
-		h.Logger.Error("Invalid callback format", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid callback format"})
+		h.log(c).Error("Invalid callback format", zap.Error(err))
+		apperrors.Respond(c, apperrors.Validation("invalid callback format"))
+		return
+	}
+
+	// Daraja does not resend a callback it gave up waiting on, so the result
+	// is recorded even if the caller disconnects. Each call below is still
+	// bounded by its own deadline.
+	// Changes made on M-Pesa's word are attributed to it in the audit log.
+	source := audit.FromContext(c.Request.Context())
+	source.Actor = audit.MPesa
+	ctx := audit.WithSource(context.WithoutCancel(c.Request.Context()), source)
+	stk := callback.Body.StkCallback
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("mpesa.checkout_request_id", stk.CheckoutRequestID),
+		attribute.Int("mpesa.result_code", stk.ResultCode),
+	)
+	logging.With(c, h.Logger, zap.String("checkout_request_id", stk.CheckoutRequestID))
+
+	payment, err := h.repo.GetPaymentByCheckoutID(ctx, stk.CheckoutRequestID)
+	if err != nil {
+		h.log(c).Error("Callback for unknown payment",
+			zap.Error(err),
+		)
+		c.JSON(http.StatusOK, gin.H{"message": "Callback ignored"})
 		return
 	}
 
-	status := "failed"
-	if callback.Body.StkCallback.ResultCode == 0 {
-		status = "paid"
+	span.SetAttributes(attribute.Int64("order.id", int64(payment.OrderID)))
+	logging.With(c, h.Logger, zap.Uint("order_id", payment.OrderID))
+	metrics.CallbackLag.Observe(time.Since(payment.CreatedAt).Seconds())
+
+	resultCode := stk.ResultCode
+	payment.ResultCode = &resultCode
+	payment.ResultDesc = stk.ResultDesc
+	payment.Status = models.PaymentFailed
+	if stk.ResultCode == 0 {
+		payment.Status = models.PaymentPaid
+	}
+
+	for _, item := range stk.CallbackMetadata.Item {
+		switch item.Name {
+		case "MpesaReceiptNumber":
+			payment.ReceiptNumber = fmt.Sprint(item.Value)
+		case "Amount":
+			if v, ok := item.Value.(float64); ok {
+				payment.Amount = v
+			}
+		case "PhoneNumber":
+			if v, ok := item.Value.(float64); ok {
+				payment.PhoneNumber = strconv.FormatFloat(v, 'f', 0, 64)
+			}
+		case "TransactionDate":
+			if v, ok := item.Value.(float64); ok {
+				date := strconv.FormatFloat(v, 'f', 0, 64)
+				if t, err := time.ParseInLocation("20060102150405", date, reconciliation.Location); err == nil {
+					payment.TransactionDate = &t
+				}
+			}
+		}
+	}
+
+	if err := h.repo.UpdatePayment(ctx, payment); err != nil {
+		h.log(c).Error("Failed to record payment result",
+			zap.Error(err),
+		)
+	}
+
+	// A failed retry must not mark an order failed once another attempt
+	// has paid for it.
+	if payment.Status == models.PaymentFailed {
+		paid, err := h.repo.HasPaidPayment(ctx, payment.OrderID)
+		if err != nil {
+			h.log(c).Error("Failed to check for an earlier payment", zap.Error(err))
+		}
+		if paid {
+			h.log(c).Info("Order already paid; failed attempt not sent to the Orders Service")
+			c.JSON(http.StatusOK, gin.H{"message": "Callback processed"})
+			return
+		}
 	}
 
 	// Update order status in Orders Service
-	updateURL := fmt.Sprintf("%s/orders/%s/status",
+	updateURL := fmt.Sprintf("%s/orders/%d/status",
 		os.Getenv("ORDERS_SERVICE_URL"),
-		callback.Body.StkCallback.CheckoutRequestID,
+		payment.OrderID,
 	)
 
-	_, err := http.Post(updateURL, "application/json",
-		strings.NewReader(fmt.Sprintf(`{"status": "%s"}`, status)))
+	// The M-Pesa receipt number goes with the status so the Orders Service
+	// can print it on the customer's receipt.
+	update, _ := json.Marshal(struct {
+		Status           string `json:"status"`
+		PaymentReference string `json:"payment_reference,omitempty"`
+	}{payment.Status, payment.ReceiptNumber})
+
+	ordersCtx, cancel := withDeadline(ctx, h.deadlines.OrdersService)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ordersCtx, "PUT", updateURL, bytes.NewReader(update))
+	req.Header.Add("Content-Type", "application/json")
+	// The Orders Service only believes the actor from callers holding the
+	// shared service token.
+	req.Header.Set(middleware.ServiceTokenHeader, os.Getenv("PAYMENTS_SERVICE_TOKEN"))
+	req.Header.Set(audit.ActorHeader, audit.FromContext(ctx).Actor)
 
+	resp, err := h.orders.Do(req)
 	if err != nil {
-		h.Logger.Error("Failed to update order status",
+		h.log(c).Error("Failed to update order status",
 			zap.Error(err),
-			zap.String("checkout_id", callback.Body.StkCallback.CheckoutRequestID),
 		)
+	} else {
+		resp.Body.Close()
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Callback processed"})
-}
\ No newline at end of file
+}
+
+// withDeadline bounds a single call to a dependency. A zero deadline leaves
+// the call bounded only by ctx.
+func withDeadline(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
@@ -0,0 +1,197 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"paymentservice/audit"
+	"paymentservice/config"
+	"paymentservice/handlers"
+	"paymentservice/middleware"
+	"paymentservice/models"
+	"paymentservice/ratelimit"
+)
+
+func setupTestDB() *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	db.Migrator().DropTable(&models.AuditEntry{}, &models.Payment{})
+	db.AutoMigrate(&models.Payment{}, &models.AuditEntry{})
+	return db
+}
+
+func TestProcessPaymentRateLimit(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.NewMemoryStore())
+	limits := config.LoadPaymentLimits()
+	handler := handlers.NewPaymentHandler(setupTestDB(), config.LoadDeadlines(), limiter, limits, zap.NewNop())
+
+	router := gin.New()
+	router.POST("/payments", handler.ProcessPayment)
+
+	// Use up the cooldown for the phone so the request never reaches Daraja
+	limiter.Allow(context.Background(), ratelimit.Check{Key: "254708374149", Rule: limits.PhoneCooldown})
+
+	t.Run("Throttled phone", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/payments",
+			strings.NewReader(`{"order_id":1,"amount":"1","phone":"254708374149"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "60", w.Header().Get("Retry-After"))
+		assert.Contains(t, w.Body.String(), "/problems/rate-limited")
+	})
+}
+
+func TestProcessPaymentCurrency(t *testing.T) {
+	orders := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/orders/1":
+			io.WriteString(w, `{"id":1,"currency":"USD","total":10}`)
+		case "/orders/2":
+			io.WriteString(w, `{"id":2,"currency":"KES","total":1500}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer orders.Close()
+	t.Setenv("ORDERS_SERVICE_URL", orders.URL)
+
+	limiter := ratelimit.New(ratelimit.NewMemoryStore())
+	handler := handlers.NewPaymentHandler(setupTestDB(), config.LoadDeadlines(), limiter, config.LoadPaymentLimits(), zap.NewNop())
+
+	router := gin.New()
+	router.POST("/payments", handler.ProcessPayment)
+
+	t.Run("Non-KES order", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/payments",
+			strings.NewReader(`{"order_id":1,"amount":"1","phone":"254708374149","currency":"USD"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"currency"`)
+	})
+
+	t.Run("Invalid currency code", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/payments",
+			strings.NewReader(`{"order_id":1,"amount":"1","phone":"254708374149","currency":"kes"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "3-letter ISO 4217")
+	})
+
+	t.Run("Currency left out for a non-KES order", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/payments",
+			strings.NewReader(`{"order_id":1,"amount":"10","phone":"254708374149"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "order is in USD")
+	})
+
+	t.Run("Amount other than the order total", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/payments",
+			strings.NewReader(`{"order_id":2,"amount":"1","phone":"254711111111","currency":"KES"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"amount"`)
+		assert.Contains(t, w.Body.String(), "1500.00")
+	})
+
+	t.Run("Unknown order", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/payments",
+			strings.NewReader(`{"order_id":3,"amount":"1","phone":"254722222222"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestPaymentCallback(t *testing.T) {
+	var update, actor, token string
+	orders := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		update = r.Method + " " + r.URL.Path + " " + string(body)
+		actor = r.Header.Get(audit.ActorHeader)
+		token = r.Header.Get(middleware.ServiceTokenHeader)
+	}))
+	defer orders.Close()
+	t.Setenv("ORDERS_SERVICE_URL", orders.URL)
+	t.Setenv("PAYMENTS_SERVICE_TOKEN", "secret")
+
+	db := setupTestDB()
+	db.Create(&models.Payment{OrderID: 7, CheckoutRequestID: "ws_CO_1", Amount: 100, Status: models.PaymentPending})
+	limiter := ratelimit.New(ratelimit.NewMemoryStore())
+	handler := handlers.NewPaymentHandler(db, config.LoadDeadlines(), limiter, config.LoadPaymentLimits(), zap.NewNop())
+
+	router := gin.New()
+	router.Use(audit.Middleware(func(*gin.Context) bool { return false }))
+	router.POST("/payments/callback", handler.PaymentCallback)
+
+	t.Run("Receipt number sent with the status", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/payments/callback", strings.NewReader(`{"Body":{"stkCallback":{
+			"CheckoutRequestID":"ws_CO_1","ResultCode":0,"ResultDesc":"Success",
+			"CallbackMetadata":{"Item":[{"Name":"Amount","Value":100},{"Name":"MpesaReceiptNumber","Value":"QK12ABC3DE"}]}}}}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `PUT /orders/7/status {"status":"paid","payment_reference":"QK12ABC3DE"}`, update)
+		assert.Equal(t, audit.MPesa, actor)
+		assert.Equal(t, "secret", token, "the actor is sent with the service token")
+
+		var entry models.AuditEntry
+		assert.NoError(t, db.Where("action = ?", "payment.updated").First(&entry).Error)
+		assert.Equal(t, audit.MPesa, entry.Actor)
+		assert.JSONEq(t, `{"before":"pending","after":"paid"}`, mustJSON(t, entry.Changes["status"]))
+	})
+
+	t.Run("Failed attempt for a paid order", func(t *testing.T) {
+		update = ""
+		db.Create(&models.Payment{OrderID: 7, CheckoutRequestID: "ws_CO_2", Amount: 100, Status: models.PaymentPending})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/payments/callback", strings.NewReader(`{"Body":{"stkCallback":{
+			"CheckoutRequestID":"ws_CO_2","ResultCode":1032,"ResultDesc":"Request cancelled by user"}}}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, update, "the order stays paid")
+
+		var payment models.Payment
+		assert.NoError(t, db.Where("checkout_request_id = ?", "ws_CO_2").First(&payment).Error)
+		assert.Equal(t, models.PaymentFailed, payment.Status)
+	})
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	assert.NoError(t, err)
+	return string(data)
+}
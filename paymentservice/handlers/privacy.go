@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"paymentservice/apperrors"
+	"paymentservice/logging"
+	"paymentservice/models"
+	"paymentservice/repository"
+	"paymentservice/validation"
+)
+
+// maxExportOrders bounds how many orders a single payments lookup covers;
+// the orders service sends longer lists in batches.
+const maxExportOrders = 1000
+
+// PrivacyHandler serves the orders service's data subject requests: it
+// lists a customer's payments for an export and removes their phone
+// numbers on erasure.
+type PrivacyHandler struct {
+	Logger *zap.Logger
+	repo   *repository.PaymentRepository
+}
+
+func NewPrivacyHandler(repo *repository.PaymentRepository, logger *zap.Logger) *PrivacyHandler {
+	return &PrivacyHandler{
+		Logger: logger,
+		repo:   repo,
+	}
+}
+
+func (h *PrivacyHandler) log(c *gin.Context) *zap.Logger {
+	return logging.FromContext(c.Request.Context(), h.Logger)
+}
+
+// GetPayments returns the payments for every order_id in the query string.
+func (h *PrivacyHandler) GetPayments(c *gin.Context) {
+	values := c.QueryArray("order_id")
+	if len(values) == 0 || len(values) > maxExportOrders {
+		apperrors.Respond(c, apperrors.Validation("invalid query",
+			apperrors.FieldError{Field: "order_id", Message: fmt.Sprintf("must list between 1 and %d orders", maxExportOrders)}))
+		return
+	}
+	orderIDs := make([]uint, 0, len(values))
+	for _, v := range values {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || id == 0 {
+			apperrors.Respond(c, apperrors.Validation("invalid query",
+				apperrors.FieldError{Field: "order_id", Message: "must be a positive integer"}))
+			return
+		}
+		orderIDs = append(orderIDs, uint(id))
+	}
+
+	payments, err := h.repo.GetPaymentsForOrders(c.Request.Context(), orderIDs)
+	if err != nil {
+		h.log(c).Error("Failed to get payments", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, payments)
+}
+
+// AnonymizePayments removes the payer's phone number from the payments for
+// the listed orders. Running it again changes nothing.
+func (h *PrivacyHandler) AnonymizePayments(c *gin.Context) {
+	var req models.AnonymizeRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		apperrors.Respond(c, err)
+		return
+	}
+
+	anonymized, err := h.repo.AnonymizeOrderPayments(c.Request.Context(), req.OrderIDs, time.Now())
+	if err != nil {
+		h.log(c).Error("Failed to anonymize payments", zap.Error(err))
+		apperrors.Respond(c, err)
+		return
+	}
+	h.log(c).Info("Anonymized payments",
+		zap.Int("orders", len(req.OrderIDs)),
+		zap.Int64("payments", anonymized),
+	)
+	c.JSON(http.StatusOK, gin.H{"anonymized": anonymized})
+}
@@ -0,0 +1,73 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"paymentservice/handlers"
+	"paymentservice/models"
+	"paymentservice/repository"
+)
+
+func TestPrivacy(t *testing.T) {
+	db := setupTestDB()
+	db.Create(&models.Payment{OrderID: 7, CheckoutRequestID: "ws_CO_1", PhoneNumber: "254708374149", Amount: 100, Status: models.PaymentPaid, ReceiptNumber: "QK12ABC3DE"})
+	db.Create(&models.Payment{OrderID: 8, CheckoutRequestID: "ws_CO_2", PhoneNumber: "254708374149", Amount: 50, Status: models.PaymentFailed})
+	db.Create(&models.Payment{OrderID: 9, CheckoutRequestID: "ws_CO_3", PhoneNumber: "254711223344", Amount: 20, Status: models.PaymentPaid})
+	handler := handlers.NewPrivacyHandler(repository.NewPaymentRepository(db, 0), zap.NewNop())
+
+	router := gin.New()
+	router.GET("/payments", handler.GetPayments)
+	router.POST("/payments/anonymize", handler.AnonymizePayments)
+	get := func(path string) ([]models.Payment, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		var payments []models.Payment
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &payments))
+		}
+		return payments, w
+	}
+
+	t.Run("Payments for orders", func(t *testing.T) {
+		payments, w := get("/payments?order_id=7&order_id=8")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.Len(t, payments, 2)
+		assert.Equal(t, "254708374149", payments[0].PhoneNumber)
+
+		_, w = get("/payments")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		_, w = get("/payments?order_id=seven")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"order_id"`)
+	})
+
+	t.Run("Anonymize", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/payments/anonymize", strings.NewReader(`{"order_ids":[7,8]}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.JSONEq(t, `{"anonymized":2}`, w.Body.String())
+
+		payments, _ := get("/payments?order_id=7&order_id=9")
+		require.Len(t, payments, 2)
+		assert.Empty(t, payments[0].PhoneNumber)
+		assert.Equal(t, "QK12ABC3DE", payments[0].ReceiptNumber)
+		assert.Equal(t, "254711223344", payments[1].PhoneNumber, "other orders are untouched")
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", "/payments/anonymize", strings.NewReader(`{"order_ids":[]}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"paymentservice/apperrors"
+	"paymentservice/logging"
+	"paymentservice/reconciliation"
+)
+
+type ReconciliationHandler struct {
+	Logger  *zap.Logger
+	service *reconciliation.Service
+}
+
+func NewReconciliationHandler(service *reconciliation.Service, logger *zap.Logger) *ReconciliationHandler {
+	return &ReconciliationHandler{
+		Logger:  logger,
+		service: service,
+	}
+}
+
+func (h *ReconciliationHandler) GetReport(c *gin.Context) {
+	date := c.Param("date")
+	if _, _, err := reconciliation.DayBounds(date); err != nil {
+		apperrors.Respond(c, apperrors.Validation(err.Error()))
+		return
+	}
+
+	report, err := h.service.Report(c.Request.Context(), date)
+	if err != nil {
+		logging.FromContext(c.Request.Context(), h.Logger).Error("Reconciliation failed", zap.Error(err), zap.String("date", date))
+		apperrors.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,110 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Check reports whether a single dependency is usable.
+type Check func(ctx context.Context) error
+
+type Result struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Checker runs a named set of dependency checks concurrently.
+type Checker struct {
+	timeout time.Duration
+	names   []string
+	checks  map[string]Check
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout, checks: make(map[string]Check)}
+}
+
+func (c *Checker) Add(name string, check Check) {
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Run executes every check with the checker's timeout. The report is only
+// ok when all checks pass; checks still running at the deadline are
+// reported as timed out.
+func (c *Checker) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	type named struct {
+		name   string
+		result Result
+	}
+	results := make(chan named, len(c.names))
+	for _, name := range c.names {
+		go func(name string, check Check) {
+			start := time.Now()
+			err := check(ctx)
+			result := Result{Status: StatusOK, DurationMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = StatusUnavailable
+				result.Error = err.Error()
+			}
+			results <- named{name, result}
+		}(name, c.checks[name])
+	}
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(c.names))}
+	for range c.names {
+		select {
+		case r := <-results:
+			report.Checks[r.name] = r.result
+		case <-ctx.Done():
+		}
+	}
+	for _, name := range c.names {
+		if _, ok := report.Checks[name]; !ok {
+			report.Checks[name] = Result{
+				Status:     StatusUnavailable,
+				Error:      "check timed out",
+				DurationMs: c.timeout.Milliseconds(),
+			}
+		}
+		if report.Checks[name].Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+	return report
+}
+
+// Cached wraps check so its result is reused for ttl. Use it for checks
+// that hit rate-limited or slow upstreams.
+func Cached(check Check, ttl time.Duration) Check {
+	var mu sync.Mutex
+	var checkedAt time.Time
+	var last error
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !checkedAt.IsZero() && time.Since(checkedAt) < ttl {
+			return last
+		}
+		last = check(ctx)
+		checkedAt = time.Now()
+		return last
+	}
+}
@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader carries the request ID between clients and services.
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	loggerKey
+)
+
+// Middleware accepts the caller's X-Request-ID (or generates one), echoes it
+// on the response and stores it, along with a logger tagged with it, in the
+// request context.
+func Middleware(base *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+
+		logger := base.With(zap.String("request_id", id))
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.HasTraceID() {
+			logger = logger.With(zap.String("trace_id", span.TraceID().String()))
+		}
+
+		ctx := context.WithValue(c.Request.Context(), requestIDKey, id)
+		ctx = context.WithValue(ctx, loggerKey, logger)
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// RequestID returns the request ID stored in ctx, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// FromContext returns the request-scoped logger, or fallback outside a
+// request.
+func FromContext(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*zap.Logger); ok {
+		return logger
+	}
+	return fallback
+}
+
+// With adds fields (such as order_id) to the request-scoped logger so every
+// later log line for the request carries them.
+func With(c *gin.Context, fallback *zap.Logger, fields ...zap.Field) *zap.Logger {
+	logger := FromContext(c.Request.Context(), fallback).With(fields...)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), loggerKey, logger))
+	return logger
+}
+
+// Transport forwards the request ID in ctx on outbound requests.
+func Transport(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if id := RequestID(req.Context()); id != "" && req.Header.Get(RequestIDHeader) == "" {
+			req = req.Clone(req.Context())
+			req.Header.Set(RequestIDHeader, id)
+		}
+		return next.RoundTrip(req)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID rejects IDs that are empty, oversized or contain anything
+// other than visible ASCII, so callers cannot inject into logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
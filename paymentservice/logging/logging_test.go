@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestTransportForwardsRequestID(t *testing.T) {
+	var forwarded string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get(RequestIDHeader)
+	}))
+	defer upstream.Close()
+
+	client := &http.Client{Transport: Transport(http.DefaultTransport)}
+	router := gin.New()
+	router.Use(Middleware(zap.NewNop()))
+	router.POST("/callback", func(c *gin.Context) {
+		req, _ := http.NewRequestWithContext(c.Request.Context(), "PUT", upstream.URL, nil)
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("POST", "/callback", nil)
+	req.Header.Set(RequestIDHeader, "req-42")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "req-42", forwarded)
+}
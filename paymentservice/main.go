@@ -1,12 +1,37 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"paymentservice/audit"
+	"paymentservice/config"
 	"paymentservice/handlers"
+	"paymentservice/health"
+	"paymentservice/logging"
+	"paymentservice/metrics"
+	"paymentservice/middleware"
+	"paymentservice/models"
+	"paymentservice/ratelimit"
+	"paymentservice/reconciliation"
+	"paymentservice/repository"
+	"paymentservice/retention"
+	"paymentservice/tracing"
 )
 
 func main() {
@@ -17,33 +42,227 @@ func main() {
 	}
 	defer logger.Sync()
 
+	serverConfig := config.LoadServer("8081")
+	deadlines := config.LoadDeadlines()
+
+	// Database connection
+	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=5432",
+		os.Getenv("DB_HOST"), os.Getenv("DB_USER"),
+		os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"))
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		logger.Fatal("Database connection failed", zap.Error(err))
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background(), "paymentservice")
+	if err != nil {
+		logger.Fatal("Tracing initialization failed", zap.Error(err))
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		logger.Fatal("Failed to instrument database", zap.Error(err))
+	}
+
+	if sqlDB, err := db.DB(); err == nil {
+		if err := metrics.RegisterDBStats(sqlDB); err != nil {
+			logger.Error("Failed to register DB pool metrics", zap.Error(err))
+		}
+	}
+
+	// audit_entries belongs to the order service's migrations, so it is not
+	// migrated here
+	if err := db.AutoMigrate(&models.Payment{}, &models.StatementEntry{}, &models.StatementImport{}); err != nil {
+		logger.Fatal("Database migration failed", zap.Error(err))
+	}
+
+	reconciler := reconciliation.NewService(repository.NewPaymentRepository(db, deadlines.Database), logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		os.Exit(runReconcile(ctx, reconciler, os.Args[2:]))
+	}
+
+	// Background workers stop when workerCtx is cancelled during shutdown
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+
+	// Import statements dropped into the statement directory
+	if dir := os.Getenv("RECONCILIATION_STATEMENT_DIR"); dir != "" {
+		interval := config.Duration("RECONCILIATION_INTERVAL", 24*time.Hour)
+		job := reconciliation.NewJob(reconciler, dir, interval, logger)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			job.Run(workerCtx)
+		}()
+	}
+
+	// Strip phone numbers and payer names from records past retention
+	if retentionConfig := config.LoadRetention(); retentionConfig.MaxAge > 0 {
+		job := retention.NewJob(repository.NewPaymentRepository(db, deadlines.Database),
+			retentionConfig.MaxAge, retentionConfig.Interval, logger)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			job.Run(workerCtx)
+		}()
+	}
+
 	// Initialize payment handler with M-Pesa client
-	paymentHandler := handlers.NewPaymentHandler(logger)
+	paymentHandler := handlers.NewPaymentHandler(db, deadlines,
+		ratelimit.New(ratelimit.NewMemoryStore()), config.LoadPaymentLimits(), logger)
+	reconciliationHandler := handlers.NewReconciliationHandler(reconciler, logger)
+	privacyHandler := handlers.NewPrivacyHandler(repository.NewPaymentRepository(db, deadlines.Database), logger)
+
+	// Readiness covers Daraja credentials, the orders service and the payment store
+	checker := health.NewChecker(config.Duration("READINESS_TIMEOUT", 5*time.Second))
+	checker.Add("mpesa_token", health.Cached(paymentHandler.CheckMpesaToken, time.Minute))
+	checker.Add("orders_service", health.HTTP(http.DefaultClient, os.Getenv("ORDERS_SERVICE_URL")+"/healthz"))
+	checker.Add("payment_store", health.Database(db))
+	healthHandler := handlers.NewHealthHandler(checker, logger)
 
 	// Create Gin router with middleware
 	router := gin.Default()
 
+	// Client IPs feed the per-client rate limit, so only trust forwarding
+	// headers from known proxies
+	var proxies []string
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		proxies = strings.Split(v, ",")
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		logger.Fatal("Invalid TRUSTED_PROXIES", zap.Error(err))
+	}
+
+	// The orders service authenticates to this one, and this one to it,
+	// with the shared service token.
+	serviceToken := os.Getenv("PAYMENTS_SERVICE_TOKEN")
+	if serviceToken == "" {
+		logger.Warn("PAYMENTS_SERVICE_TOKEN is not set; customer data requests from the orders service will be refused")
+	}
+
 	// Add recovery middleware
 	router.Use(gin.Recovery())
+	router.Use(otelgin.Middleware("paymentservice"))
+	router.Use(logging.Middleware(logger))
+	// Only the orders service may name who a request is made for
+	router.Use(audit.Middleware(middleware.HasServiceToken(serviceToken)))
+	router.Use(metrics.Middleware())
+	router.Use(middleware.BodyLimit(serverConfig.MaxBodyBytes))
+
+	router.GET("/healthz", healthHandler.Liveness)
+	router.GET("/readyz", healthHandler.Readiness)
+	router.GET("/metrics", metrics.Handler())
 
 	// Register payment endpoints
 	router.POST("/payments", paymentHandler.ProcessPayment)
 	router.POST("/callback", paymentHandler.PaymentCallback)
+	// Payments by order are only shown to, and anonymized for, the orders
+	// service, and reconciliation reports, which carry payers' phone
+	// numbers, only to holders of the service token
+	services := router.Group("", middleware.ServiceToken(serviceToken))
+	services.GET("/payments", privacyHandler.GetPayments)
+	services.POST("/payments/anonymize", privacyHandler.AnonymizePayments)
+	services.GET("/reconciliation/:date", reconciliationHandler.GetReport)
 
 	// Start HTTP server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8081" // Default port
+	server := serverConfig.HTTPServer(router)
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Starting Payment Service",
+			zap.String("addr", server.Addr),
+			zap.String("environment", os.Getenv("GIN_MODE")),
+		)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal("Failed to start server",
+				zap.Error(err),
+			)
+		}
+	case <-ctx.Done():
 	}
+	stop()
 
-	logger.Info("Starting Payment Service",
-		zap.String("port", port),
-		zap.String("environment", os.Getenv("GIN_MODE")),
-	)
+	// Drain in-flight requests (including M-Pesa callbacks), then stop
+	// workers and close the connection pool
+	logger.Info("Shutting down Payment Service",
+		zap.Duration("grace_period", serverConfig.ShutdownGracePeriod))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serverConfig.ShutdownGracePeriod)
+	defer cancel()
 
-	if err := http.ListenAndServe(":"+port, router); err != nil {
-		logger.Fatal("Failed to start server",
-			zap.Error(err),
-		)
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Graceful shutdown timed out", zap.Error(err))
+	}
+
+	stopWorkers()
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-shutdownCtx.Done():
+		logger.Error("Background workers did not stop in time")
+	}
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("Failed to flush traces", zap.Error(err))
+	}
+
+	if sqlDB, err := db.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			logger.Error("Failed to close database", zap.Error(err))
+		}
+	}
+
+	logger.Info("Payment Service stopped")
+}
+
+// runReconcile implements `paymentservice reconcile`, which imports a
+// statement CSV and prints the reconciliation report for each day it covers.
+func runReconcile(ctx context.Context, reconciler *reconciliation.Service, args []string) int {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	file := fs.String("file", "", "M-Pesa organisation statement CSV to import")
+	date := fs.String("date", "", "only report this date (YYYY-MM-DD)")
+	fs.Parse(args)
+
+	if *file == "" && *date == "" {
+		fmt.Fprintln(os.Stderr, "usage: paymentservice reconcile [-file statement.csv] [-date YYYY-MM-DD]")
+		return 2
+	}
+
+	dates := []string{*date}
+	if *file != "" {
+		imported, err := reconciler.ImportFile(ctx, *file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "import failed:", err)
+			return 1
+		}
+		if *date == "" {
+			dates = imported
+		}
+	}
+
+	status := 0
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	for _, d := range dates {
+		report, err := reconciler.Report(ctx, d)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "reconciliation failed:", err)
+			return 1
+		}
+		enc.Encode(report)
+		if report.HasDiscrepancies() {
+			status = 3
+		}
 	}
-}
\ No newline at end of file
+	return status
+}
@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "paymentservice"
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	PaymentAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payment_attempts_total",
+		Help:      "STK push attempts by outcome.",
+	}, []string{"outcome"})
+
+	PaymentResults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payment_results_total",
+		Help:      "M-Pesa callback results by result code.",
+	}, []string{"result_code"})
+
+	MpesaDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mpesa_request_duration_seconds",
+		Help:      "Daraja API latency by endpoint and status.",
+		Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"endpoint", "status"})
+
+	MpesaErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mpesa_errors_total",
+		Help:      "Daraja API transport failures and non-2xx responses by endpoint.",
+	}, []string{"endpoint"})
+
+	TokenRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mpesa_token_refreshes_total",
+		Help:      "OAuth token requests by outcome.",
+	}, []string{"outcome"})
+
+	CallbackLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "callback_lag_seconds",
+		Help:      "Time between initiating an STK push and processing its callback.",
+		Buckets:   []float64{5, 10, 20, 30, 60, 120, 300, 600},
+	})
+
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Repository operation latency by operation and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "outcome"})
+)
+
+// Middleware records request count and latency per route. Unmatched paths
+// share one label so scanners cannot blow up cardinality.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		HTTPDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the default registry in the Prometheus text format.
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// ObserveQuery records the latency of a repository operation started at
+// start. It returns err so callers can wrap their return statement.
+func ObserveQuery(operation string, start time.Time, err error) error {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	DBQueryDuration.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// RegisterDBStats exports connection pool statistics for db.
+func RegisterDBStats(db *sql.DB) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// MpesaTransport records latency and failures of Daraja API calls made
+// through next.
+func MpesaTransport(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		endpoint := mpesaEndpoint(req.URL.Path)
+		start := time.Now()
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			MpesaErrors.WithLabelValues(endpoint).Inc()
+			MpesaDuration.WithLabelValues(endpoint, "error").Observe(time.Since(start).Seconds())
+			return nil, err
+		}
+		if resp.StatusCode >= 300 {
+			MpesaErrors.WithLabelValues(endpoint).Inc()
+		}
+		MpesaDuration.WithLabelValues(endpoint, strconv.Itoa(resp.StatusCode)).Observe(time.Since(start).Seconds())
+		return resp, nil
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func mpesaEndpoint(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/oauth/"):
+		return "oauth"
+	case strings.HasPrefix(path, "/mpesa/stkpush/"):
+		return "stkpush"
+	case strings.HasPrefix(path, "/mpesa/stkpushquery/"):
+		return "stkpushquery"
+	default:
+		return "other"
+	}
+}
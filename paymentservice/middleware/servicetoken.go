@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+	"paymentservice/apperrors"
+)
+
+// ServiceTokenHeader carries the secret shared with the orders service,
+// which sends it to reach routes behind ServiceToken and receives it on
+// this service's calls.
+const ServiceTokenHeader = "X-Service-Token"
+
+// HasServiceToken returns a check for whether a request carries token in
+// ServiceTokenHeader. With an empty token no request does.
+func HasServiceToken(token string) func(*gin.Context) bool {
+	return func(c *gin.Context) bool {
+		sent := c.GetHeader(ServiceTokenHeader)
+		return token != "" && subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1
+	}
+}
+
+// ServiceToken refuses requests that do not carry token in
+// ServiceTokenHeader. With an empty token every request is refused.
+func ServiceToken(token string) gin.HandlerFunc {
+	fromService := HasServiceToken(token)
+	return func(c *gin.Context) {
+		if !fromService(c) {
+			apperrors.Respond(c, apperrors.Unauthenticated("service credentials required", nil))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceToken(t *testing.T) {
+	request := func(configured, sent string) int {
+		router := gin.New()
+		router.GET("/payments", ServiceToken(configured), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/payments", nil)
+		req.Header.Set(ServiceTokenHeader, sent)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request("secret", "secret"))
+	assert.Equal(t, http.StatusUnauthorized, request("secret", ""))
+	assert.Equal(t, http.StatusUnauthorized, request("secret", "wrong"))
+	assert.Equal(t, http.StatusUnauthorized, request("", ""), "no token configured")
+
+	t.Run("Check without refusing", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/payments", nil)
+		assert.False(t, HasServiceToken("secret")(c))
+		c.Request.Header.Set(ServiceTokenHeader, "secret")
+		assert.True(t, HasServiceToken("secret")(c))
+		assert.False(t, HasServiceToken("")(c))
+	})
+}
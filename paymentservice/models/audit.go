@@ -0,0 +1,34 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry is a row of the audit log kept in the shared database. The
+// order service owns the table and its migrations; entries are only ever
+// appended.
+type AuditEntry struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+	Actor      string    `gorm:"not null" json:"actor"`
+	Action     string    `gorm:"not null;index" json:"action"`
+	EntityType string    `gorm:"not null;index:idx_audit_entries_entity" json:"entity_type"`
+	EntityID   uint      `gorm:"not null;index:idx_audit_entries_entity" json:"entity_id"`
+	Changes    Changes   `gorm:"serializer:json" json:"changes,omitempty"`
+	RequestID  string    `gorm:"not null;default:''" json:"request_id,omitempty"`
+	SourceIP   string    `gorm:"not null;default:''" json:"source_ip,omitempty"`
+}
+
+// Change is a field's value before and after an action; null before a
+// record was created. Personal data is shown as Redacted.
+type Change struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// Changes maps field names to how they changed.
+type Changes map[string]Change
+
+// Redacted stands in for personal data in audit entries.
+const Redacted = "[redacted]"
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	PaymentPending = "pending"
+	PaymentPaid    = "paid"
+	PaymentFailed  = "failed"
+)
+
+// Payment is a single STK push attempt for an order.
+type Payment struct {
+	gorm.Model
+	OrderID           uint       `gorm:"index;not null" json:"order_id"`
+	CheckoutRequestID string     `gorm:"uniqueIndex" json:"checkout_request_id"`
+	MerchantRequestID string     `json:"merchant_request_id"`
+	PhoneNumber       string     `json:"phone"`
+	Amount            float64    `gorm:"not null" json:"amount"`
+	Status            string     `gorm:"default:'pending'" json:"status"`
+	ResultCode        *int       `json:"result_code,omitempty"`
+	ResultDesc        string     `json:"result_desc,omitempty"`
+	ReceiptNumber     string     `gorm:"index" json:"receipt_number,omitempty"`
+	TransactionDate   *time.Time `gorm:"index" json:"transaction_date,omitempty"`
+	// AnonymizedAt is when the payer's phone number was removed, on request
+	// or once the payment passed the retention period.
+	AnonymizedAt *time.Time `gorm:"index" json:"anonymized_at,omitempty"`
+}
+
+// StatementEntry is one row imported from an M-Pesa organisation statement.
+type StatementEntry struct {
+	gorm.Model
+	Source         string    `gorm:"index;not null" json:"source"`
+	SourceHash     string    `gorm:"not null;default:''" json:"-"`
+	ReceiptNumber  string    `gorm:"index;not null" json:"receipt_number"`
+	CompletionTime time.Time `gorm:"index" json:"completion_time"`
+	Details        string    `json:"details"`
+	Status         string    `json:"status"`
+	PaidIn         float64   `json:"paid_in"`
+	Withdrawn      float64   `json:"withdrawn"`
+	OtherParty     string    `json:"other_party"`
+	AccountNumber  string    `json:"account_number"`
+}
+
+// StatementImport records a statement that has been imported, keyed by
+// the SHA-256 of its content, so the same statement is not imported again
+// whatever it is named and even when it has no rows.
+type StatementImport struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	Hash      string    `gorm:"uniqueIndex;not null" json:"hash"`
+	Source    string    `gorm:"not null" json:"source"`
+	Rows      int       `gorm:"not null" json:"rows"`
+	CreatedAt time.Time `json:"imported_at"`
+}
+
+// PaymentRequest is the payload accepted by POST /payments. Currency is the
+// order's currency; M-Pesa only takes KES, which is assumed when it is left
+// out. Either way the order itself must be in KES and Amount must be its
+// total.
+type PaymentRequest struct {
+	OrderID     uint   `json:"order_id" binding:"required"`
+	Amount      string `json:"amount" binding:"required,amount"`
+	PhoneNumber string `json:"phone" binding:"required,msisdn"`
+	Currency    string `json:"currency" binding:"omitempty,currency"`
+}
+
+// AnonymizeRequest is the payload accepted by POST /payments/anonymize.
+type AnonymizeRequest struct {
+	OrderIDs []uint `json:"order_ids" binding:"required,min=1,max=1000,dive,required"`
+}
@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often MemoryStore drops windows that have ended.
+const sweepInterval = time.Minute
+
+type window struct {
+	count   int
+	resetAt time.Time
+}
+
+// MemoryStore keeps counters in process memory. Counters are lost on
+// restart and are not shared between replicas.
+type MemoryStore struct {
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{windows: make(map[string]*window)}
+}
+
+func (s *MemoryStore) Hit(ctx context.Context, key string, length time.Duration, now time.Time) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for k, w := range s.windows {
+			if !now.Before(w.resetAt) {
+				delete(s.windows, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	w, ok := s.windows[key]
+	if !ok || !now.Before(w.resetAt) {
+		w = &window{resetAt: now.Add(length)}
+		s.windows[key] = w
+	}
+	w.count++
+	return w.count, w.resetAt, nil
+}
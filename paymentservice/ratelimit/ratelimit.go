@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule allows Limit hits per key in each fixed Window. A rule with a limit
+// of 1 acts as a cooldown between hits.
+type Rule struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+// Enabled reports whether the rule limits anything.
+func (r Rule) Enabled() bool {
+	return r.Limit > 0 && r.Window > 0
+}
+
+// ParseRule reads a rule written as "<limit>/<window>", e.g. "5/1h". An
+// empty spec or "off" yields a disabled rule.
+func ParseRule(name, spec string) (Rule, error) {
+	if spec == "" || spec == "off" {
+		return Rule{Name: name}, nil
+	}
+	limit, window, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Rule{}, fmt.Errorf("rate limit %q: want <limit>/<window>", spec)
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 0 {
+		return Rule{}, fmt.Errorf("rate limit %q: invalid limit", spec)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d < 0 {
+		return Rule{}, fmt.Errorf("rate limit %q: invalid window", spec)
+	}
+	return Rule{Name: name, Limit: n, Window: d}, nil
+}
+
+// Store counts hits per key in fixed windows. MemoryStore suits a single
+// instance; a shared store lets several replicas enforce one budget.
+type Store interface {
+	// Hit records a hit on key and returns the number of hits in the
+	// current window, including this one, and when that window ends.
+	Hit(ctx context.Context, key string, window time.Duration, now time.Time) (count int, resetAt time.Time, err error)
+}
+
+// Check applies Rule to the hits recorded under Key.
+type Check struct {
+	Key  string
+	Rule Rule
+}
+
+// Decision is the outcome of Allow. When a request is denied, Rule names
+// the rule that was exceeded and RetryAfter says when it will next pass.
+type Decision struct {
+	Allowed    bool
+	Rule       string
+	RetryAfter time.Duration
+}
+
+type Limiter struct {
+	store Store
+	now   func() time.Time
+}
+
+func New(store Store) *Limiter {
+	return &Limiter{store: store, now: time.Now}
+}
+
+// Allow records a hit against every enabled check and denies the request
+// if any of them is over its limit. Denied requests still count, so a
+// client that keeps retrying stays throttled.
+func (l *Limiter) Allow(ctx context.Context, checks ...Check) (Decision, error) {
+	now := l.now()
+	decision := Decision{Allowed: true}
+	for _, check := range checks {
+		if !check.Rule.Enabled() {
+			continue
+		}
+		key := check.Rule.Name + ":" + check.Key
+		count, resetAt, err := l.store.Hit(ctx, key, check.Rule.Window, now)
+		if err != nil {
+			return Decision{}, err
+		}
+		if count <= check.Rule.Limit {
+			continue
+		}
+		// Report the longest wait so a retry at RetryAfter passes every rule.
+		if wait := resetAt.Sub(now); decision.Allowed || wait > decision.RetryAfter {
+			decision = Decision{Rule: check.Rule.Name, RetryAfter: wait}
+		}
+	}
+	return decision, nil
+}
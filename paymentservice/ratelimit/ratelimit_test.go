@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLimiter(now *time.Time) *Limiter {
+	l := New(NewMemoryStore())
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	perPhone := Rule{Name: "phone", Limit: 2, Window: time.Hour}
+
+	t.Run("Allows up to the limit", func(t *testing.T) {
+		l := newTestLimiter(&now)
+		for i := 0; i < 2; i++ {
+			d, err := l.Allow(ctx, Check{Key: "254700000001", Rule: perPhone})
+			require.NoError(t, err)
+			assert.True(t, d.Allowed)
+		}
+		d, _ := l.Allow(ctx, Check{Key: "254700000001", Rule: perPhone})
+		assert.False(t, d.Allowed)
+		assert.Equal(t, "phone", d.Rule)
+		assert.Equal(t, time.Hour, d.RetryAfter)
+	})
+
+	t.Run("Keys are independent", func(t *testing.T) {
+		l := newTestLimiter(&now)
+		l.Allow(ctx, Check{Key: "a", Rule: perPhone})
+		l.Allow(ctx, Check{Key: "a", Rule: perPhone})
+		d, _ := l.Allow(ctx, Check{Key: "b", Rule: perPhone})
+		assert.True(t, d.Allowed)
+	})
+
+	t.Run("Window resets", func(t *testing.T) {
+		clock := now
+		l := newTestLimiter(&clock)
+		cooldown := Rule{Name: "cooldown", Limit: 1, Window: time.Minute}
+
+		d, _ := l.Allow(ctx, Check{Key: "a", Rule: cooldown})
+		assert.True(t, d.Allowed)
+
+		clock = clock.Add(20 * time.Second)
+		d, _ = l.Allow(ctx, Check{Key: "a", Rule: cooldown})
+		assert.False(t, d.Allowed)
+		assert.Equal(t, 40*time.Second, d.RetryAfter)
+
+		clock = clock.Add(40 * time.Second)
+		d, _ = l.Allow(ctx, Check{Key: "a", Rule: cooldown})
+		assert.True(t, d.Allowed)
+	})
+
+	t.Run("Longest wait wins", func(t *testing.T) {
+		l := newTestLimiter(&now)
+		short := Rule{Name: "short", Limit: 1, Window: time.Minute}
+		long := Rule{Name: "long", Limit: 1, Window: time.Hour}
+		l.Allow(ctx, Check{Key: "a", Rule: short}, Check{Key: "a", Rule: long})
+
+		d, _ := l.Allow(ctx, Check{Key: "a", Rule: short}, Check{Key: "a", Rule: long})
+		assert.False(t, d.Allowed)
+		assert.Equal(t, "long", d.Rule)
+		assert.Equal(t, time.Hour, d.RetryAfter)
+	})
+
+	t.Run("Disabled rules are skipped", func(t *testing.T) {
+		l := newTestLimiter(&now)
+		for i := 0; i < 10; i++ {
+			d, _ := l.Allow(ctx, Check{Key: "a", Rule: Rule{Name: "off"}})
+			assert.True(t, d.Allowed)
+		}
+	})
+}
+
+func TestParseRule(t *testing.T) {
+	r, err := ParseRule("phone", "5/1h")
+	require.NoError(t, err)
+	assert.Equal(t, Rule{Name: "phone", Limit: 5, Window: time.Hour}, r)
+
+	r, err = ParseRule("phone", "off")
+	require.NoError(t, err)
+	assert.False(t, r.Enabled())
+
+	for _, spec := range []string{"5", "x/1h", "5/soon", "-1/1h"} {
+		_, err := ParseRule("phone", spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	store.Hit(context.Background(), "old", time.Second, now)
+
+	store.Hit(context.Background(), "new", time.Second, now.Add(2*time.Minute))
+	assert.NotContains(t, store.windows, "old")
+	assert.Contains(t, store.windows, "new")
+}
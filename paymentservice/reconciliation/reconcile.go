@@ -0,0 +1,175 @@
+package reconciliation
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"paymentservice/models"
+)
+
+type Match struct {
+	ReceiptNumber    string  `json:"receipt_number"`
+	OrderID          uint    `json:"order_id"`
+	PaymentID        uint    `json:"payment_id"`
+	StatementEntryID uint    `json:"statement_entry_id"`
+	Amount           float64 `json:"amount"`
+}
+
+type AmountMismatch struct {
+	ReceiptNumber    string  `json:"receipt_number"`
+	OrderID          uint    `json:"order_id"`
+	PaymentID        uint    `json:"payment_id"`
+	StatementEntryID uint    `json:"statement_entry_id"`
+	PaymentAmount    float64 `json:"payment_amount"`
+	StatementAmount  float64 `json:"statement_amount"`
+}
+
+// Duplicate is a receipt number that appears more than once on either
+// side of the reconciliation.
+type Duplicate struct {
+	ReceiptNumber    string                  `json:"receipt_number"`
+	Payments         []models.Payment        `json:"payments"`
+	StatementEntries []models.StatementEntry `json:"statement_entries"`
+}
+
+type Summary struct {
+	Matched              int     `json:"matched"`
+	MissingFromStatement int     `json:"missing_from_statement"`
+	MissingFromPayments  int     `json:"missing_from_payments"`
+	Duplicated           int     `json:"duplicated"`
+	AmountMismatched     int     `json:"amount_mismatched"`
+	PaymentsTotal        float64 `json:"payments_total"`
+	StatementTotal       float64 `json:"statement_total"`
+}
+
+// Report is the outcome of matching one day's statement against stored
+// payments.
+type Report struct {
+	Date                 string                  `json:"date"`
+	GeneratedAt          time.Time               `json:"generated_at"`
+	Summary              Summary                 `json:"summary"`
+	Matched              []Match                 `json:"matched"`
+	MissingFromStatement []models.Payment        `json:"missing_from_statement"`
+	MissingFromPayments  []models.StatementEntry `json:"missing_from_payments"`
+	Duplicated           []Duplicate             `json:"duplicated"`
+	AmountMismatches     []AmountMismatch        `json:"amount_mismatches"`
+}
+
+// DayBounds returns the start and end of date (YYYY-MM-DD) in statement time.
+func DayBounds(date string) (time.Time, time.Time, error) {
+	from, err := time.ParseInLocation("2006-01-02", date, Location)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q: expected YYYY-MM-DD", date)
+	}
+	return from, from.AddDate(0, 0, 1), nil
+}
+
+// Reconcile matches statement credits to paid payments by receipt number
+// and amount. Debits and incomplete statement rows are ignored.
+func Reconcile(date string, entries []models.StatementEntry, payments []models.Payment) *Report {
+	report := &Report{
+		Date:                 date,
+		GeneratedAt:          time.Now().UTC(),
+		Matched:              []Match{},
+		MissingFromStatement: []models.Payment{},
+		MissingFromPayments:  []models.StatementEntry{},
+		Duplicated:           []Duplicate{},
+		AmountMismatches:     []AmountMismatch{},
+	}
+
+	byReceipt := make(map[string]*Duplicate)
+	group := func(receipt string) *Duplicate {
+		receipt = strings.ToUpper(receipt)
+		d, ok := byReceipt[receipt]
+		if !ok {
+			d = &Duplicate{ReceiptNumber: receipt}
+			byReceipt[receipt] = d
+		}
+		return d
+	}
+
+	for _, entry := range entries {
+		if entry.PaidIn <= 0 || !isCompleted(entry.Status) {
+			continue
+		}
+		report.Summary.StatementTotal += entry.PaidIn
+		d := group(entry.ReceiptNumber)
+		d.StatementEntries = append(d.StatementEntries, entry)
+	}
+	for _, payment := range payments {
+		report.Summary.PaymentsTotal += payment.Amount
+		if payment.ReceiptNumber == "" {
+			report.MissingFromStatement = append(report.MissingFromStatement, payment)
+			continue
+		}
+		d := group(payment.ReceiptNumber)
+		d.Payments = append(d.Payments, payment)
+	}
+
+	receipts := make([]string, 0, len(byReceipt))
+	for receipt := range byReceipt {
+		receipts = append(receipts, receipt)
+	}
+	sort.Strings(receipts)
+
+	for _, receipt := range receipts {
+		d := byReceipt[receipt]
+		switch {
+		case len(d.Payments) > 1 || len(d.StatementEntries) > 1:
+			if d.Payments == nil {
+				d.Payments = []models.Payment{}
+			}
+			if d.StatementEntries == nil {
+				d.StatementEntries = []models.StatementEntry{}
+			}
+			report.Duplicated = append(report.Duplicated, *d)
+		case len(d.StatementEntries) == 0:
+			report.MissingFromStatement = append(report.MissingFromStatement, d.Payments[0])
+		case len(d.Payments) == 0:
+			report.MissingFromPayments = append(report.MissingFromPayments, d.StatementEntries[0])
+		default:
+			payment, entry := d.Payments[0], d.StatementEntries[0]
+			if sameAmount(payment.Amount, entry.PaidIn) {
+				report.Matched = append(report.Matched, Match{
+					ReceiptNumber:    receipt,
+					OrderID:          payment.OrderID,
+					PaymentID:        payment.ID,
+					StatementEntryID: entry.ID,
+					Amount:           payment.Amount,
+				})
+			} else {
+				report.AmountMismatches = append(report.AmountMismatches, AmountMismatch{
+					ReceiptNumber:    receipt,
+					OrderID:          payment.OrderID,
+					PaymentID:        payment.ID,
+					StatementEntryID: entry.ID,
+					PaymentAmount:    payment.Amount,
+					StatementAmount:  entry.PaidIn,
+				})
+			}
+		}
+	}
+
+	report.Summary.Matched = len(report.Matched)
+	report.Summary.MissingFromStatement = len(report.MissingFromStatement)
+	report.Summary.MissingFromPayments = len(report.MissingFromPayments)
+	report.Summary.Duplicated = len(report.Duplicated)
+	report.Summary.AmountMismatched = len(report.AmountMismatches)
+	return report
+}
+
+func isCompleted(status string) bool {
+	return status == "" || strings.EqualFold(status, "completed")
+}
+
+func sameAmount(a, b float64) bool {
+	return math.Abs(a-b) < 0.005
+}
+
+func (r *Report) HasDiscrepancies() bool {
+	return len(r.MissingFromStatement)+len(r.MissingFromPayments)+
+		len(r.Duplicated)+len(r.AmountMismatches) > 0
+}
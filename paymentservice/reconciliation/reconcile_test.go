@@ -0,0 +1,101 @@
+package reconciliation
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"paymentservice/models"
+)
+
+const statementCSV = `Organisation Name:,Test Shop
+Statement Period:,2024-01-15 - 2024-01-15
+Receipt No.,Completion Time,Initiation Time,Details,Transaction Status,Paid In,Withdrawn,Balance,Balance Confirmed,Reason Type,Other Party Info,Linked Transaction ID,A/C No.
+SAB1,2024-01-15 10:00:00,2024-01-15 10:00:00,Pay Bill from 2547...,Completed,"1,000.00",,1000.00,true,Pay Bill,254708374149 - JOHN DOE,,ORDER_1
+SAB2,2024-01-15 11:00:00,2024-01-15 11:00:00,Pay Bill from 2547...,Completed,50.00,,1050.00,true,Pay Bill,254708374149 - JOHN DOE,,ORDER_2
+SAB3,2024-01-15 12:00:00,2024-01-15 12:00:00,Business Charge,Completed,,10.00,1040.00,true,Charge,,,
+`
+
+func TestParseStatement(t *testing.T) {
+	t.Run("Parse statement with preamble", func(t *testing.T) {
+		entries, err := ParseStatement(strings.NewReader(statementCSV), "statement.csv")
+		assert.NoError(t, err)
+		assert.Len(t, entries, 3)
+
+		assert.Equal(t, "SAB1", entries[0].ReceiptNumber)
+		assert.Equal(t, 1000.0, entries[0].PaidIn)
+		assert.Equal(t, "ORDER_1", entries[0].AccountNumber)
+		assert.Equal(t, "statement.csv", entries[0].Source)
+		assert.Equal(t, time.Date(2024, 1, 15, 10, 0, 0, 0, Location).Unix(), entries[0].CompletionTime.Unix())
+		assert.Equal(t, 10.0, entries[2].Withdrawn)
+	})
+
+	t.Run("Missing header", func(t *testing.T) {
+		_, err := ParseStatement(strings.NewReader("a,b,c\n1,2,3\n"), "bad.csv")
+		assert.ErrorIs(t, err, ErrNoHeader)
+	})
+
+	t.Run("Invalid amount", func(t *testing.T) {
+		csv := "Receipt No.,Completion Time,Paid In\nSAB1,2024-01-15 10:00:00,abc\n"
+		_, err := ParseStatement(strings.NewReader(csv), "bad.csv")
+		assert.Error(t, err)
+	})
+}
+
+func TestReconcile(t *testing.T) {
+	entry := func(receipt string, amount float64) models.StatementEntry {
+		return models.StatementEntry{ReceiptNumber: receipt, PaidIn: amount, Status: "Completed"}
+	}
+	payment := func(orderID uint, receipt string, amount float64) models.Payment {
+		return models.Payment{OrderID: orderID, ReceiptNumber: receipt, Amount: amount, Status: models.PaymentPaid}
+	}
+
+	entries := []models.StatementEntry{
+		entry("SAB1", 100),
+		entry("SAB2", 50),
+		entry("SAB3", 75),
+		entry("SAB4", 20),
+		entry("SAB4", 20),
+		{ReceiptNumber: "SAB9", Withdrawn: 10, Status: "Completed"},
+	}
+	payments := []models.Payment{
+		payment(1, "sab1", 100),
+		payment(2, "SAB2", 40),
+		payment(4, "SAB4", 20),
+		payment(5, "SAB5", 30),
+		payment(6, "", 15),
+	}
+
+	report := Reconcile("2024-01-15", entries, payments)
+
+	assert.Equal(t, 1, report.Summary.Matched)
+	assert.Equal(t, "SAB1", report.Matched[0].ReceiptNumber)
+	assert.Equal(t, uint(1), report.Matched[0].OrderID)
+
+	assert.Len(t, report.AmountMismatches, 1)
+	assert.Equal(t, 40.0, report.AmountMismatches[0].PaymentAmount)
+	assert.Equal(t, 50.0, report.AmountMismatches[0].StatementAmount)
+
+	assert.Len(t, report.MissingFromPayments, 1)
+	assert.Equal(t, "SAB3", report.MissingFromPayments[0].ReceiptNumber)
+
+	assert.Len(t, report.MissingFromStatement, 2)
+
+	assert.Len(t, report.Duplicated, 1)
+	assert.Equal(t, "SAB4", report.Duplicated[0].ReceiptNumber)
+	assert.Len(t, report.Duplicated[0].StatementEntries, 2)
+
+	assert.Equal(t, 265.0, report.Summary.StatementTotal)
+	assert.Equal(t, 205.0, report.Summary.PaymentsTotal)
+	assert.True(t, report.HasDiscrepancies())
+}
+
+func TestDayBounds(t *testing.T) {
+	from, to, err := DayBounds("2024-01-15")
+	assert.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, to.Sub(from))
+
+	_, _, err = DayBounds("15/01/2024")
+	assert.Error(t, err)
+}
@@ -0,0 +1,204 @@
+package reconciliation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	"paymentservice/models"
+	"paymentservice/repository"
+)
+
+type Service struct {
+	repo   *repository.PaymentRepository
+	logger *zap.Logger
+}
+
+func NewService(repo *repository.PaymentRepository, logger *zap.Logger) *Service {
+	return &Service{repo: repo, logger: logger}
+}
+
+// Import parses a statement read from source and stores its rows in place
+// of any stored for the days they cover. It returns those statement dates
+// (YYYY-MM-DD).
+func (s *Service) Import(ctx context.Context, r io.Reader, source string) ([]string, error) {
+	hash := sha256.New()
+	content := io.TeeReader(r, hash)
+	entries, err := ParseStatement(content, source)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(io.Discard, content); err != nil {
+		return nil, err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	for i := range entries {
+		entries[i].SourceHash = sum
+	}
+
+	seen := make(map[string]bool)
+	var dates []string
+	for _, entry := range entries {
+		date := entry.CompletionTime.In(Location).Format("2006-01-02")
+		if !seen[date] {
+			seen[date] = true
+			dates = append(dates, date)
+		}
+	}
+	sort.Strings(dates)
+
+	days := make([]time.Time, 0, len(dates))
+	for _, date := range dates {
+		from, _, err := DayBounds(date)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, from)
+	}
+	record := models.StatementImport{Hash: sum, Source: source}
+	if err := s.repo.ReplaceStatementEntries(ctx, record, days, entries); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Imported M-Pesa statement",
+		zap.String("source", source),
+		zap.Int("rows", len(entries)),
+		zap.Strings("dates", dates),
+	)
+	return dates, nil
+}
+
+func (s *Service) ImportFile(ctx context.Context, path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return s.Import(ctx, f, filepath.Base(path))
+}
+
+// Report reconciles the stored statement rows and payments for date.
+func (s *Service) Report(ctx context.Context, date string) (*Report, error) {
+	from, to, err := DayBounds(date)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.repo.GetStatementEntriesBetween(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := s.repo.GetPaidPaymentsBetween(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return Reconcile(date, entries, payments), nil
+}
+
+// Job periodically imports statement CSVs dropped into a directory and
+// logs the reconciliation outcome for each day they cover.
+type Job struct {
+	service  *Service
+	dir      string
+	interval time.Duration
+	logger   *zap.Logger
+}
+
+func NewJob(service *Service, dir string, interval time.Duration, logger *zap.Logger) *Job {
+	return &Job{service: service, dir: dir, interval: interval, logger: logger}
+}
+
+// Run imports pending statements immediately and then on every interval
+// until ctx is cancelled.
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce imports every statement in the directory whose content has not
+// been imported before, so a corrected statement replaces the rows of the
+// days it covers. It stops early once ctx is cancelled.
+func (j *Job) RunOnce(ctx context.Context) {
+	paths, err := filepath.Glob(filepath.Join(j.dir, "*.csv"))
+	if err != nil {
+		j.logger.Error("Failed to list statements", zap.Error(err), zap.String("dir", j.dir))
+		return
+	}
+
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			return
+		}
+		source := filepath.Base(path)
+		hash, err := fileHash(path)
+		var imported bool
+		if err == nil {
+			imported, err = j.service.repo.HasStatementImport(ctx, hash)
+		}
+		if err != nil {
+			j.logger.Error("Failed to check statement", zap.Error(err), zap.String("source", source))
+			continue
+		}
+		if imported {
+			continue
+		}
+
+		dates, err := j.service.ImportFile(ctx, path)
+		if err != nil {
+			j.logger.Error("Failed to import statement", zap.Error(err), zap.String("source", source))
+			continue
+		}
+		for _, date := range dates {
+			report, err := j.service.Report(ctx, date)
+			if err != nil {
+				j.logger.Error("Reconciliation failed", zap.Error(err), zap.String("date", date))
+				continue
+			}
+			logReport(j.logger, report)
+		}
+	}
+}
+
+// fileHash returns the hex SHA-256 of the file's content.
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func logReport(logger *zap.Logger, report *Report) {
+	fields := []zap.Field{
+		zap.String("date", report.Date),
+		zap.Int("matched", report.Summary.Matched),
+		zap.Int("missing_from_statement", report.Summary.MissingFromStatement),
+		zap.Int("missing_from_payments", report.Summary.MissingFromPayments),
+		zap.Int("duplicated", report.Summary.Duplicated),
+		zap.Int("amount_mismatched", report.Summary.AmountMismatched),
+	}
+	if report.HasDiscrepancies() {
+		logger.Warn("Reconciliation found discrepancies", fields...)
+		return
+	}
+	logger.Info("Reconciliation clean", fields...)
+}
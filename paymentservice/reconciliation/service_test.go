@@ -0,0 +1,68 @@
+package reconciliation
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"paymentservice/models"
+	"paymentservice/repository"
+)
+
+func TestJobRunOnce(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	db.Migrator().DropTable(&models.Payment{}, &models.StatementEntry{}, &models.StatementImport{})
+	require.NoError(t, db.AutoMigrate(&models.Payment{}, &models.StatementEntry{}, &models.StatementImport{}))
+
+	repo := repository.NewPaymentRepository(db, 0)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "statement.csv")
+	job := NewJob(NewService(repo, zap.NewNop()), dir, time.Hour, zap.NewNop())
+	from, to, err := DayBounds("2024-01-15")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, os.WriteFile(path, []byte(statementCSV), 0o644))
+	job.RunOnce(ctx)
+	entries, err := repo.GetStatementEntriesBetween(ctx, from, to)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	// A corrected statement uploaded under the same name replaces the rows.
+	corrected := strings.Replace(statementCSV, `"1,000.00"`, "900.00", 1)
+	require.NoError(t, os.WriteFile(path, []byte(corrected), 0o644))
+	job.RunOnce(ctx)
+	entries, err = repo.GetStatementEntriesBetween(ctx, from, to)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "SAB1", entries[0].ReceiptNumber)
+	assert.Equal(t, 900.0, entries[0].PaidIn)
+
+	// The next day's statement dropped under the same name keeps the
+	// earlier day's rows
+	next := strings.ReplaceAll(statementCSV, "2024-01-15", "2024-01-16")
+	require.NoError(t, os.WriteFile(path, []byte(next), 0o644))
+	job.RunOnce(ctx)
+	entries, err = repo.GetStatementEntriesBetween(ctx, from, to.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	assert.Len(t, entries, 6)
+
+	// A statement without rows is recorded so it is not imported again
+	empty := filepath.Join(dir, "empty.csv")
+	require.NoError(t, os.WriteFile(empty, []byte("Receipt No.,Completion Time,Paid In\n"), 0o644))
+	job.RunOnce(ctx)
+	hash, err := fileHash(empty)
+	require.NoError(t, err)
+	imported, err := repo.HasStatementImport(ctx, hash)
+	require.NoError(t, err)
+	assert.True(t, imported)
+}
@@ -0,0 +1,141 @@
+package reconciliation
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"paymentservice/models"
+)
+
+// Location is the timezone M-Pesa statements and callbacks are reported in.
+var Location = time.FixedZone("EAT", 3*60*60)
+
+var ErrNoHeader = errors.New("statement has no receipt number header row")
+
+var timeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"02-01-2006 15:04:05",
+	"02/01/2006 15:04:05",
+	"2006-01-02T15:04:05",
+	"20060102150405",
+}
+
+// Column names used by the Daraja organisation statement export. The
+// portal is not consistent about punctuation so headers are normalised
+// before lookup.
+var columns = map[string][]string{
+	"receipt":    {"receipt no", "receipt number", "transaction id"},
+	"completion": {"completion time", "transaction time"},
+	"details":    {"details"},
+	"status":     {"transaction status", "status"},
+	"paid_in":    {"paid in"},
+	"withdrawn":  {"withdrawn", "withdrawn amount"},
+	"other":      {"other party info", "other party"},
+	"account":    {"a/c no", "account no", "account number"},
+}
+
+// ParseStatement reads an M-Pesa organisation statement CSV. Any preamble
+// lines before the header row are skipped.
+func ParseStatement(r io.Reader, source string) ([]models.StatementEntry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var index map[string]int
+	var entries []models.StatementEntry
+	line := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if index == nil {
+			index = headerIndex(record)
+			continue
+		}
+
+		receipt := field(record, index, "receipt")
+		if receipt == "" {
+			continue
+		}
+
+		entry := models.StatementEntry{
+			Source:        source,
+			ReceiptNumber: receipt,
+			Details:       field(record, index, "details"),
+			Status:        field(record, index, "status"),
+			OtherParty:    field(record, index, "other"),
+			AccountNumber: field(record, index, "account"),
+		}
+		if entry.CompletionTime, err = parseTime(field(record, index, "completion")); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if entry.PaidIn, err = parseAmount(field(record, index, "paid_in")); err != nil {
+			return nil, fmt.Errorf("line %d: paid in: %w", line, err)
+		}
+		if entry.Withdrawn, err = parseAmount(field(record, index, "withdrawn")); err != nil {
+			return nil, fmt.Errorf("line %d: withdrawn: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if index == nil {
+		return nil, ErrNoHeader
+	}
+	return entries, nil
+}
+
+// headerIndex returns the column positions if record is the header row,
+// or nil otherwise.
+func headerIndex(record []string) map[string]int {
+	index := make(map[string]int)
+	for i, name := range record {
+		name = strings.ToLower(strings.Trim(strings.TrimSpace(name), ".:"))
+		for key, aliases := range columns {
+			for _, alias := range aliases {
+				if name == alias {
+					index[key] = i
+				}
+			}
+		}
+	}
+	if _, ok := index["receipt"]; !ok {
+		return nil
+	}
+	return index
+}
+
+func field(record []string, index map[string]int, key string) string {
+	i, ok := index[key]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, Location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised completion time %q", value)
+}
+
+func parseAmount(value string) (float64, error) {
+	value = strings.ReplaceAll(value, ",", "")
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"paymentservice/apperrors"
+)
+
+// Postgres SQLSTATE codes the repository translates.
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+	pgNotNullViolation    = "23502"
+	pgCheckViolation      = "23514"
+)
+
+// translate maps GORM and driver errors onto domain errors. entity names
+// the record in client-facing messages, e.g. "order".
+func translate(err error, entity string) error {
+	if err == nil {
+		return nil
+	}
+	if apperrors.KindOf(err) != apperrors.KindInternal {
+		return err
+	}
+
+	var pgErr *pgconn.PgError
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return apperrors.NotFound(entity+" not found", err)
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return apperrors.Conflict(entity+" already exists", err)
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		return apperrors.Validation(entity + " references a record that does not exist")
+	case errors.As(err, &pgErr):
+		switch pgErr.Code {
+		case pgUniqueViolation:
+			return apperrors.Conflict(entity+" already exists", err)
+		case pgForeignKeyViolation:
+			return apperrors.Validation(entity + " references a record that does not exist")
+		case pgNotNullViolation, pgCheckViolation:
+			return apperrors.Validation("invalid " + entity + ": " + pgErr.ColumnName)
+		}
+	case errors.As(err, &connectErr), errors.As(err, &netErr),
+		errors.Is(err, driver.ErrBadConn), errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, context.Canceled),
+		strings.Contains(err.Error(), "database is closed"):
+		return apperrors.Upstream("database unavailable", err)
+	}
+
+	// SQLite (used in tests) reports constraint failures only in the message.
+	switch msg := err.Error(); {
+	case strings.Contains(msg, "UNIQUE constraint failed"):
+		return apperrors.Conflict(entity+" already exists", err)
+	case strings.Contains(msg, "FOREIGN KEY constraint failed"):
+		return apperrors.Validation(entity + " references a record that does not exist")
+	}
+	return apperrors.Internal(entity+" operation failed", err)
+}
@@ -0,0 +1,260 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"paymentservice/audit"
+	"paymentservice/metrics"
+	"paymentservice/models"
+)
+
+// Audit log actions for payments.
+const (
+	ActionPaymentCreated    = "payment.created"
+	ActionPaymentUpdated    = "payment.updated"
+	ActionPaymentAnonymized = "payment.anonymized"
+)
+
+// personalFields are the payment fields whose values are redacted in the
+// audit log.
+var personalFields = []string{"phone"}
+
+type PaymentRepository struct {
+	db      *gorm.DB
+	timeout time.Duration
+}
+
+// NewPaymentRepository returns a repository whose queries are each cancelled
+// after queryTimeout, or only when their context ends if queryTimeout is
+// zero.
+func NewPaymentRepository(db *gorm.DB, queryTimeout time.Duration) *PaymentRepository {
+	return &PaymentRepository{db: db, timeout: queryTimeout}
+}
+
+// query returns the handle to run a single query under ctx. The caller must
+// call cancel once the query has finished.
+func (r *PaymentRepository) query(ctx context.Context) (db *gorm.DB, cancel context.CancelFunc) {
+	if r.timeout <= 0 {
+		return r.db.WithContext(ctx), func() {}
+	}
+	ctx, cancel = context.WithTimeout(ctx, r.timeout)
+	return r.db.WithContext(ctx), cancel
+}
+
+// CreatePayment stores payment and records it in the audit log.
+func (r *PaymentRepository) CreatePayment(ctx context.Context, payment *models.Payment) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+		entry, err := auditEntry(ctx, ActionPaymentCreated, nil, payment)
+		if err != nil {
+			return err
+		}
+		return tx.Create(entry).Error
+	})
+	return metrics.ObserveQuery("create_payment", start, translate(err, "payment"))
+}
+
+func (r *PaymentRepository) GetPaymentByCheckoutID(ctx context.Context, checkoutRequestID string) (*models.Payment, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var payment models.Payment
+	err := db.Where("checkout_request_id = ?", checkoutRequestID).First(&payment).Error
+	return &payment, metrics.ObserveQuery("get_payment", start, translate(err, "payment"))
+}
+
+// UpdatePayment saves payment, recording what changed in the audit log,
+// and, when it carries an M-Pesa result, counts the outcome by result code.
+func (r *PaymentRepository) UpdatePayment(ctx context.Context, payment *models.Payment) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var before models.Payment
+		if err := tx.First(&before, payment.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Save(payment).Error; err != nil {
+			return err
+		}
+		entry, err := auditEntry(ctx, ActionPaymentUpdated, &before, payment)
+		if err != nil {
+			return err
+		}
+		return tx.Create(entry).Error
+	})
+	if err == nil && payment.ResultCode != nil {
+		metrics.PaymentResults.WithLabelValues(strconv.Itoa(*payment.ResultCode)).Inc()
+	}
+	return metrics.ObserveQuery("update_payment", start, translate(err, "payment"))
+}
+
+// GetPaidPaymentsBetween returns completed payments whose M-Pesa transaction
+// date falls in [from, to).
+func (r *PaymentRepository) GetPaidPaymentsBetween(ctx context.Context, from, to time.Time) ([]models.Payment, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	var payments []models.Payment
+	err := db.
+		Where("status = ? AND transaction_date >= ? AND transaction_date < ?", models.PaymentPaid, from, to).
+		Order("transaction_date").
+		Find(&payments).Error
+	return payments, err
+}
+
+// ReplaceStatementEntries stores the rows of a statement and records its
+// import. Rows already stored for the statement days the new rows cover,
+// each given by its start in days, are dropped first, so a corrected
+// statement replaces the one it corrects whatever either file is named.
+func (r *PaymentRepository) ReplaceStatementEntries(ctx context.Context, record models.StatementImport, days []time.Time, entries []models.StatementEntry) error {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, day := range days {
+			err := tx.Unscoped().
+				Where("completion_time >= ? AND completion_time < ?", day, day.AddDate(0, 0, 1)).
+				Delete(&models.StatementEntry{}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("hash = ?", record.Hash).Delete(&models.StatementImport{}).Error; err != nil {
+			return err
+		}
+		record.Rows = len(entries)
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return tx.Create(&entries).Error
+	})
+}
+
+func (r *PaymentRepository) GetStatementEntriesBetween(ctx context.Context, from, to time.Time) ([]models.StatementEntry, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	var entries []models.StatementEntry
+	err := db.
+		Where("completion_time >= ? AND completion_time < ?", from, to).
+		Order("completion_time").
+		Find(&entries).Error
+	return entries, err
+}
+
+// HasStatementImport reports whether a statement whose content hashes to
+// hash has been imported.
+func (r *PaymentRepository) HasStatementImport(ctx context.Context, hash string) (bool, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	var count int64
+	err := db.Model(&models.StatementImport{}).Where("hash = ?", hash).Count(&count).Error
+	return count > 0, err
+}
+
+// HasPaidPayment reports whether any payment for the order has succeeded.
+func (r *PaymentRepository) HasPaidPayment(ctx context.Context, orderID uint) (bool, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var count int64
+	err := db.Model(&models.Payment{}).Where("order_id = ? AND status = ?", orderID, models.PaymentPaid).Count(&count).Error
+	return count > 0, metrics.ObserveQuery("has_paid_payment", start, translate(err, "payment"))
+}
+
+// GetPaymentsForOrders returns every payment attempt for the orders, oldest
+// first.
+func (r *PaymentRepository) GetPaymentsForOrders(ctx context.Context, orderIDs []uint) ([]models.Payment, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var payments []models.Payment
+	err := db.Where("order_id IN ?", orderIDs).Order("created_at, id").Find(&payments).Error
+	return payments, metrics.ObserveQuery("get_order_payments", start, translate(err, "payment"))
+}
+
+// AnonymizeOrderPayments removes the payer's phone number from the orders'
+// payments and returns how many payments it changed. Amounts, receipts and
+// dates are kept for the accounts.
+func (r *PaymentRepository) AnonymizeOrderPayments(ctx context.Context, orderIDs []uint, now time.Time) (int64, error) {
+	return r.anonymize(ctx, "anonymize_order_payments", now, "order_id IN ?", orderIDs)
+}
+
+// AnonymizePaymentsBefore removes the payer's phone number from payments
+// created before cutoff and returns how many payments it changed.
+func (r *PaymentRepository) AnonymizePaymentsBefore(ctx context.Context, cutoff, now time.Time) (int64, error) {
+	return r.anonymize(ctx, "anonymize_old_payments", now, "created_at < ?", cutoff)
+}
+
+// anonymize removes the phone number from the payments matching query that
+// still have one, recording each in the audit log.
+func (r *PaymentRepository) anonymize(ctx context.Context, op string, now time.Time, query string, args ...interface{}) (int64, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	start := time.Now()
+	var payments []models.Payment
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where(query, args...).Where("anonymized_at IS NULL").Order("id").Find(&payments).Error
+		if err != nil || len(payments) == 0 {
+			return err
+		}
+		ids := make([]uint, len(payments))
+		entries := make([]*models.AuditEntry, len(payments))
+		for i, before := range payments {
+			ids[i] = before.ID
+			after := before
+			after.PhoneNumber = ""
+			after.AnonymizedAt = &now
+			if entries[i], err = auditEntry(ctx, ActionPaymentAnonymized, &before, &after); err != nil {
+				return err
+			}
+		}
+		err = tx.Model(&models.Payment{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{"phone_number": "", "anonymized_at": now}).Error
+		if err != nil {
+			return err
+		}
+		return tx.CreateInBatches(entries, 100).Error
+	})
+	if err != nil {
+		payments = nil
+	}
+	return int64(len(payments)), metrics.ObserveQuery(op, start, translate(err, "payment"))
+}
+
+// AnonymizeStatementEntriesBefore removes the other party, which names the
+// payer, from statement rows completed before cutoff and returns how many
+// rows it changed.
+func (r *PaymentRepository) AnonymizeStatementEntriesBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	db, cancel := r.query(ctx)
+	defer cancel()
+	result := db.Model(&models.StatementEntry{}).
+		Where("completion_time < ? AND other_party <> ''", cutoff).
+		Update("other_party", "")
+	return result.RowsAffected, translate(result.Error, "statement entry")
+}
+
+// auditEntry describes how action changed a payment from before to after,
+// attributed to the request in ctx.
+func auditEntry(ctx context.Context, action string, before, after *models.Payment) (*models.AuditEntry, error) {
+	var old interface{}
+	if before != nil {
+		old = before
+	}
+	changes, err := audit.Diff(old, after, personalFields...)
+	if err != nil {
+		return nil, err
+	}
+	entry := audit.Entry(ctx, action, "payment", after.ID)
+	entry.Changes = changes
+	return entry, nil
+}
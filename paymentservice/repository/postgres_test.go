@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"paymentservice/apperrors"
+	"paymentservice/audit"
+	"paymentservice/models"
+)
+
+var ctx = context.Background()
+
+func setupTestDB() *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	db.Migrator().DropTable(&models.AuditEntry{}, &models.Payment{}, &models.StatementEntry{}, &models.StatementImport{})
+	db.AutoMigrate(&models.Payment{}, &models.StatementEntry{}, &models.StatementImport{}, &models.AuditEntry{})
+	return db
+}
+
+func TestPaymentRepository(t *testing.T) {
+	db := setupTestDB()
+	repo := NewPaymentRepository(db, 0)
+
+	t.Run("Create and get payment", func(t *testing.T) {
+		payment := &models.Payment{OrderID: 1, CheckoutRequestID: "ws_CO_1", Amount: 100, Status: models.PaymentPending}
+		err := repo.CreatePayment(ctx, payment)
+		assert.NoError(t, err)
+		assert.NotZero(t, payment.ID)
+
+		fetched, err := repo.GetPaymentByCheckoutID(ctx, "ws_CO_1")
+		assert.NoError(t, err)
+		assert.Equal(t, payment.ID, fetched.ID)
+		assert.Equal(t, uint(1), fetched.OrderID)
+	})
+
+	t.Run("Get unknown payment", func(t *testing.T) {
+		_, err := repo.GetPaymentByCheckoutID(ctx, "ws_CO_missing")
+		assert.Error(t, err)
+	})
+
+	t.Run("Paid payments between", func(t *testing.T) {
+		day := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+		inside := day.Add(10 * time.Hour)
+		outside := day.Add(30 * time.Hour)
+		repo.CreatePayment(ctx, &models.Payment{OrderID: 2, CheckoutRequestID: "ws_CO_2", Amount: 10, Status: models.PaymentPaid, TransactionDate: &inside})
+		repo.CreatePayment(ctx, &models.Payment{OrderID: 3, CheckoutRequestID: "ws_CO_3", Amount: 10, Status: models.PaymentPaid, TransactionDate: &outside})
+		repo.CreatePayment(ctx, &models.Payment{OrderID: 4, CheckoutRequestID: "ws_CO_4", Amount: 10, Status: models.PaymentFailed, TransactionDate: &inside})
+
+		payments, err := repo.GetPaidPaymentsBetween(ctx, day, day.Add(24*time.Hour))
+		assert.NoError(t, err)
+		assert.Len(t, payments, 1)
+		assert.Equal(t, uint(2), payments[0].OrderID)
+	})
+}
+
+func TestStatementEntries(t *testing.T) {
+	db := setupTestDB()
+	repo := NewPaymentRepository(db, 0)
+	day := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Re-import replaces rows for the days it covers", func(t *testing.T) {
+		entries := []models.StatementEntry{
+			{Source: "a.csv", SourceHash: "v1", ReceiptNumber: "SAB1", CompletionTime: day.Add(time.Hour), PaidIn: 10},
+			{Source: "a.csv", SourceHash: "v1", ReceiptNumber: "SAB2", CompletionTime: day.Add(2 * time.Hour), PaidIn: 20},
+		}
+		days := []time.Time{day}
+		assert.NoError(t, repo.ReplaceStatementEntries(ctx, models.StatementImport{Hash: "v1", Source: "a.csv"}, days, entries))
+		assert.NoError(t, repo.ReplaceStatementEntries(ctx, models.StatementImport{Hash: "v2", Source: "b.csv"}, days, entries[:1]))
+
+		fetched, err := repo.GetStatementEntriesBetween(ctx, day, day.Add(24*time.Hour))
+		assert.NoError(t, err)
+		assert.Len(t, fetched, 1)
+
+		// The next day's statement under the first name keeps this day's rows
+		next := day.AddDate(0, 0, 1)
+		later := []models.StatementEntry{{Source: "a.csv", SourceHash: "v3", ReceiptNumber: "SAB3", CompletionTime: next.Add(time.Hour), PaidIn: 30}}
+		assert.NoError(t, repo.ReplaceStatementEntries(ctx, models.StatementImport{Hash: "v3", Source: "a.csv"}, []time.Time{next}, later))
+		fetched, err = repo.GetStatementEntriesBetween(ctx, day, next.AddDate(0, 0, 1))
+		assert.NoError(t, err)
+		assert.Len(t, fetched, 2)
+
+		for hash, want := range map[string]bool{"v1": true, "v2": true, "v3": true, "v4": false} {
+			imported, err := repo.HasStatementImport(ctx, hash)
+			assert.NoError(t, err)
+			assert.Equal(t, want, imported, hash)
+		}
+	})
+
+	t.Run("Empty statements are recorded", func(t *testing.T) {
+		assert.NoError(t, repo.ReplaceStatementEntries(ctx, models.StatementImport{Hash: "empty", Source: "empty.csv"}, nil, nil))
+		imported, err := repo.HasStatementImport(ctx, "empty")
+		assert.NoError(t, err)
+		assert.True(t, imported)
+
+		// Importing the same content again is idempotent
+		assert.NoError(t, repo.ReplaceStatementEntries(ctx, models.StatementImport{Hash: "empty", Source: "empty.csv"}, nil, nil))
+	})
+}
+
+func TestAnonymize(t *testing.T) {
+	db := setupTestDB()
+	repo := NewPaymentRepository(db, 0)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i, orderID := range []uint{1, 1, 2} {
+		payment := &models.Payment{OrderID: orderID, CheckoutRequestID: fmt.Sprintf("ws_CO_%d", i),
+			PhoneNumber: "254708374149", Amount: 100, Status: models.PaymentPaid, ReceiptNumber: fmt.Sprintf("SAB%d", i)}
+		assert.NoError(t, repo.CreatePayment(ctx, payment))
+	}
+
+	t.Run("Payments for orders", func(t *testing.T) {
+		payments, err := repo.GetPaymentsForOrders(ctx, []uint{1, 3})
+		assert.NoError(t, err)
+		assert.Len(t, payments, 2)
+		assert.Equal(t, "254708374149", payments[0].PhoneNumber)
+	})
+
+	t.Run("Order payments", func(t *testing.T) {
+		n, err := repo.AnonymizeOrderPayments(ctx, []uint{1}, now)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+		n, err = repo.AnonymizeOrderPayments(ctx, []uint{1}, now)
+		assert.NoError(t, err)
+		assert.Zero(t, n, "already anonymized")
+
+		payments, err := repo.GetPaymentsForOrders(ctx, []uint{1, 2})
+		assert.NoError(t, err)
+		assert.Empty(t, payments[0].PhoneNumber)
+		assert.Equal(t, "SAB0", payments[0].ReceiptNumber, "financial details are kept")
+		assert.NotNil(t, payments[0].AnonymizedAt)
+		assert.Equal(t, "254708374149", payments[2].PhoneNumber)
+	})
+
+	t.Run("Past retention", func(t *testing.T) {
+		n, err := repo.AnonymizePaymentsBefore(ctx, time.Now().Add(-time.Hour), now)
+		assert.NoError(t, err)
+		assert.Zero(t, n, "payments are too recent")
+		n, err = repo.AnonymizePaymentsBefore(ctx, time.Now().Add(time.Hour), now)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+
+		entries := []models.StatementEntry{
+			{Source: "a.csv", ReceiptNumber: "SABA", CompletionTime: now.Add(-48 * time.Hour), OtherParty: "254708***149 - JANE DOE"},
+			{Source: "a.csv", ReceiptNumber: "SABB", CompletionTime: now, OtherParty: "254708***149 - JANE DOE"},
+		}
+		assert.NoError(t, repo.ReplaceStatementEntries(ctx, models.StatementImport{Hash: "a", Source: "a.csv"}, nil, entries))
+		n, err = repo.AnonymizeStatementEntriesBefore(ctx, now.Add(-24*time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		fetched, err := repo.GetStatementEntriesBetween(ctx, now.Add(-72*time.Hour), now.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Empty(t, fetched[0].OtherParty)
+		assert.NotEmpty(t, fetched[1].OtherParty)
+	})
+}
+
+func TestAuditLog(t *testing.T) {
+	db := setupTestDB()
+	repo := NewPaymentRepository(db, 0)
+	ctx := audit.WithSource(ctx, audit.Source{Actor: "checkout", IP: "192.0.2.1"})
+	entries := func(action string) []models.AuditEntry {
+		var entries []models.AuditEntry
+		assert.NoError(t, db.Where("action = ?", action).Order("id").Find(&entries).Error)
+		return entries
+	}
+
+	payment := &models.Payment{OrderID: 7, CheckoutRequestID: "ws_CO_audit", PhoneNumber: "254708374149",
+		Amount: 100, Status: models.PaymentPending}
+	assert.NoError(t, repo.CreatePayment(ctx, payment))
+	created := entries(ActionPaymentCreated)
+	if assert.Len(t, created, 1) {
+		assert.Equal(t, "checkout", created[0].Actor)
+		assert.Equal(t, "192.0.2.1", created[0].SourceIP)
+		assert.Equal(t, payment.ID, created[0].EntityID)
+		assert.Equal(t, "payment", created[0].EntityType)
+		assert.Equal(t, `"[redacted]"`, string(created[0].Changes["phone"].After))
+		assert.Equal(t, `7`, string(created[0].Changes["order_id"].After))
+	}
+
+	payment.Status = models.PaymentPaid
+	payment.ReceiptNumber = "QK12ABC3DE"
+	assert.NoError(t, repo.UpdatePayment(context.Background(), payment))
+	updated := entries(ActionPaymentUpdated)
+	if assert.Len(t, updated, 1) {
+		assert.Equal(t, audit.System, updated[0].Actor)
+		assert.Equal(t, models.Changes{
+			"status":         {Before: []byte(`"pending"`), After: []byte(`"paid"`)},
+			"receipt_number": {Before: []byte(`null`), After: []byte(`"QK12ABC3DE"`)},
+		}, updated[0].Changes)
+	}
+
+	unknown := &models.Payment{OrderID: 7, Amount: 1}
+	unknown.ID = 9999
+	assert.Error(t, repo.UpdatePayment(ctx, unknown))
+	assert.Len(t, entries(ActionPaymentUpdated), 1, "failed updates are not recorded")
+
+	_, err := repo.AnonymizeOrderPayments(ctx, []uint{7}, time.Now())
+	assert.NoError(t, err)
+	anonymized := entries(ActionPaymentAnonymized)
+	if assert.Len(t, anonymized, 1) {
+		assert.Equal(t, `"[redacted]"`, string(anonymized[0].Changes["phone"].Before))
+		assert.Equal(t, `""`, string(anonymized[0].Changes["phone"].After))
+		assert.Contains(t, anonymized[0].Changes, "anonymized_at")
+	}
+}
+
+func TestQueryDeadline(t *testing.T) {
+	repo := NewPaymentRepository(setupTestDB(), time.Nanosecond)
+
+	_, err := repo.GetPaymentByCheckoutID(ctx, "ws_CO_1")
+	assert.True(t, apperrors.Is(err, apperrors.KindUpstream))
+}
@@ -0,0 +1,65 @@
+// Package retention removes personal data from payment records once they
+// are old enough that only the accounts still need them.
+package retention
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"paymentservice/repository"
+)
+
+// Job periodically anonymizes payments and statement rows older than the
+// retention period. Amounts, receipt numbers and dates are kept, so
+// reconciliation reports still balance.
+type Job struct {
+	repo     *repository.PaymentRepository
+	maxAge   time.Duration
+	interval time.Duration
+	logger   *zap.Logger
+}
+
+func NewJob(repo *repository.PaymentRepository, maxAge, interval time.Duration, logger *zap.Logger) *Job {
+	return &Job{repo: repo, maxAge: maxAge, interval: interval, logger: logger}
+}
+
+// Run applies the retention period immediately and then on every interval
+// until ctx is cancelled.
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.RunOnce(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce anonymizes every record that was older than the retention period
+// at now.
+func (j *Job) RunOnce(ctx context.Context, now time.Time) {
+	cutoff := now.Add(-j.maxAge)
+
+	payments, err := j.repo.AnonymizePaymentsBefore(ctx, cutoff, now)
+	if err != nil {
+		j.logger.Error("Failed to anonymize old payments", zap.Error(err))
+		return
+	}
+	entries, err := j.repo.AnonymizeStatementEntriesBefore(ctx, cutoff)
+	if err != nil {
+		j.logger.Error("Failed to anonymize old statement rows", zap.Error(err))
+		return
+	}
+	if payments > 0 || entries > 0 {
+		j.logger.Info("Anonymized payment data past retention",
+			zap.Time("cutoff", cutoff),
+			zap.Int64("payments", payments),
+			zap.Int64("statement_rows", entries),
+		)
+	}
+}
@@ -0,0 +1,40 @@
+package retention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"paymentservice/models"
+	"paymentservice/repository"
+)
+
+func TestRunOnce(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	db.Migrator().DropTable(&models.AuditEntry{}, &models.Payment{}, &models.StatementEntry{}, &models.StatementImport{})
+	require.NoError(t, db.AutoMigrate(&models.Payment{}, &models.StatementEntry{}, &models.StatementImport{}, &models.AuditEntry{}))
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := &models.Payment{OrderID: 1, CheckoutRequestID: "ws_CO_1", PhoneNumber: "254708374149", Amount: 100}
+	old.CreatedAt = now.Add(-31 * 24 * time.Hour)
+	recent := &models.Payment{OrderID: 2, CheckoutRequestID: "ws_CO_2", PhoneNumber: "254708374149", Amount: 100}
+	recent.CreatedAt = now.Add(-29 * 24 * time.Hour)
+	require.NoError(t, db.Create(old).Error)
+	require.NoError(t, db.Create(recent).Error)
+
+	repo := repository.NewPaymentRepository(db, 0)
+	NewJob(repo, 30*24*time.Hour, time.Hour, zap.NewNop()).RunOnce(context.Background(), now)
+
+	payments, err := repo.GetPaymentsForOrders(context.Background(), []uint{1, 2})
+	require.NoError(t, err)
+	require.Len(t, payments, 2)
+	assert.Empty(t, payments[0].PhoneNumber)
+	assert.Equal(t, 100.0, payments[0].Amount)
+	assert.Equal(t, "254708374149", payments[1].PhoneNumber)
+}
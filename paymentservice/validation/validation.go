@@ -0,0 +1,144 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"paymentservice/apperrors"
+)
+
+// msisdn matches Safaricom numbers in the 2547XXXXXXXX / 2541XXXXXXXX form
+// Daraja expects for PartyA and PhoneNumber.
+var msisdn = regexp.MustCompile(`^254[17]\d{8}$`)
+
+// currency matches ISO 4217 codes such as KES or USD.
+var currency = regexp.MustCompile(`^[A-Z]{3}$`)
+
+var validate = newValidator()
+
+// newValidator reads the same `binding` tags Gin uses, reports fields by
+// their JSON names and adds the custom rules shared by every input path.
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.SetTagName("binding")
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	v.RegisterValidation("msisdn", func(fl validator.FieldLevel) bool {
+		return msisdn.MatchString(fl.Field().String())
+	})
+	v.RegisterValidation("currency", func(fl validator.FieldLevel) bool {
+		return currency.MatchString(fl.Field().String())
+	})
+	v.RegisterValidation("amount", func(fl validator.FieldLevel) bool {
+		amount, err := strconv.ParseFloat(fl.Field().String(), 64)
+		return err == nil && amount > 0
+	})
+	v.RegisterValidation("notblank", func(fl validator.FieldLevel) bool {
+		return strings.TrimSpace(fl.Field().String()) != ""
+	})
+	return v
+}
+
+// Struct validates v against its `binding` tags. Failures are returned as
+// a validation error listing every invalid field.
+func Struct(v interface{}) error {
+	err := validate.Struct(v)
+	if err == nil {
+		return nil
+	}
+
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return apperrors.Validation(err.Error())
+	}
+	fields := make([]apperrors.FieldError, 0, len(invalid))
+	for _, fe := range invalid {
+		fields = append(fields, apperrors.FieldError{
+			Field:   fieldPath(fe),
+			Message: message(fe),
+		})
+	}
+	return apperrors.Validation("request has invalid fields", fields...)
+}
+
+// BindJSON decodes the request body into v and validates it.
+func BindJSON(c *gin.Context, v interface{}) error {
+	if c.Request.Body == nil {
+		return apperrors.Validation("request body is required")
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return apperrors.Validation("request body is required")
+		}
+		return apperrors.Validation("invalid request body: " + err.Error())
+	}
+	return Struct(v)
+}
+
+// fieldPath drops the top-level struct name, e.g. "products[0].id".
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if i := strings.Index(ns, "."); i >= 0 {
+		return ns[i+1:]
+	}
+	return ns
+}
+
+func message(fe validator.FieldError) string {
+	isString := fe.Kind() == reflect.String
+	switch fe.Tag() {
+	case "required", "notblank":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "msisdn":
+		return "must be a Safaricom number in the form 2547XXXXXXXX"
+	case "amount":
+		return "must be a positive number"
+	case "currency":
+		return "must be a 3-letter ISO 4217 currency code"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte":
+		return "must be at least " + fe.Param()
+	case "lte":
+		return "must be at most " + fe.Param()
+	case "min":
+		if isString {
+			return fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must contain at least %s %s", fe.Param(), items(fe.Param()))
+	case "max":
+		if isString {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must contain at most %s %s", fe.Param(), items(fe.Param()))
+	default:
+		return "failed the " + fe.Tag() + " rule"
+	}
+}
+
+func items(n string) string {
+	if n == "1" {
+		return "item"
+	}
+	return "items"
+}
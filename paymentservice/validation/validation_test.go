@@ -0,0 +1,38 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"paymentservice/apperrors"
+	"paymentservice/models"
+)
+
+func TestPaymentRequest(t *testing.T) {
+	t.Run("Valid request", func(t *testing.T) {
+		assert.NoError(t, Struct(&models.PaymentRequest{OrderID: 1, Amount: "1", PhoneNumber: "254708374149"}))
+	})
+
+	tests := []struct {
+		name    string
+		request models.PaymentRequest
+		field   string
+		message string
+	}{
+		{"Missing order", models.PaymentRequest{Amount: "1", PhoneNumber: "254708374149"}, "order_id", "is required"},
+		{"Zero amount", models.PaymentRequest{OrderID: 1, Amount: "0", PhoneNumber: "254708374149"}, "amount", "must be a positive number"},
+		{"Non-numeric amount", models.PaymentRequest{OrderID: 1, Amount: "ten", PhoneNumber: "254708374149"}, "amount", "must be a positive number"},
+		{"Local phone format", models.PaymentRequest{OrderID: 1, Amount: "1", PhoneNumber: "0708374149"}, "phone", "must be a Safaricom number in the form 2547XXXXXXXX"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var appErr *apperrors.Error
+			require.ErrorAs(t, Struct(&tt.request), &appErr)
+			require.Len(t, appErr.Fields, 1)
+			assert.Equal(t, tt.field, appErr.Fields[0].Field)
+			assert.Equal(t, tt.message, appErr.Fields[0].Message)
+		})
+	}
+}